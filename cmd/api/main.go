@@ -3,12 +3,16 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"tracktrades/internal/adapters/alphavantage"
+	"tracktrades/internal/adapters/notify"
 	"tracktrades/internal/adapters/storage"
 	"tracktrades/internal/app"
 	"tracktrades/internal/domain/portfolio"
@@ -26,18 +30,52 @@ func main() {
 	}
 	defaultPortfolio := envOrDefault("PORTFOLIO_NAME", storeInfo.DefaultPortfolio)
 
+	notifier, err := notify.New(envOrDefault("ALERT_NOTIFIER", "log"))
+	if err != nil {
+		log.Fatalf("invalid notifier: %v", err)
+	}
+
 	pricer := alphavantage.New(apiKey)
-	svc := app.NewPortfolioService(storeInfo.Store, pricer)
+	svc := app.NewPortfolioService(storeInfo.Store, pricer, app.WithFXRates(pricer), app.WithPriceHistory(pricer), app.WithNotifier(notifier), app.WithSplitDetection(pricer), app.WithDividendImport(pricer))
 
 	ctx := context.Background()
 	cancel := svc.StartPriceUpdater(ctx, defaultPortfolio, 5*time.Minute)
 	defer cancel()
+	cancelClose := svc.StartDailyClose(ctx, defaultPortfolio, 16, 30)
+	defer cancelClose()
+	cancelInterest := svc.StartMarginInterest(ctx, defaultPortfolio, 17, 0)
+	defer cancelInterest()
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", healthHandler)
 	mux.HandleFunc("/portfolio", makePortfolioHandler(svc, defaultPortfolio))
 	mux.HandleFunc("/positions", makePositionsHandler(svc, defaultPortfolio))
 	mux.HandleFunc("/position", makePositionHandler(svc, defaultPortfolio))
+	mux.HandleFunc("/transactions", makeTransactionsHandler(svc, defaultPortfolio))
+	mux.HandleFunc("/corporate-actions", makeCorporateActionsHandler(svc, defaultPortfolio))
+	mux.HandleFunc("/journal", makeJournalHandler(svc, defaultPortfolio))
+	mux.HandleFunc("/journal/stats", makeJournalStatsHandler(svc, defaultPortfolio))
+	mux.HandleFunc("/income", makeIncomeHandler(svc, defaultPortfolio))
+	mux.HandleFunc("/fees", makeFeesHandler(svc, defaultPortfolio))
+	mux.HandleFunc("/margin", makeMarginHandler(svc, defaultPortfolio))
+	mux.HandleFunc("/margin/accrue", makeAccrueMarginHandler(svc, defaultPortfolio))
+	mux.HandleFunc("/dividends/import", makeImportDividendsHandler(svc, defaultPortfolio))
+	mux.HandleFunc("/realized", makeRealizedHandler(svc, defaultPortfolio))
+	mux.HandleFunc("/history", makeHistoryHandler(svc, defaultPortfolio))
+	mux.HandleFunc("/risk", makeRiskHandler(svc, defaultPortfolio))
+	mux.HandleFunc("/concentration", makeConcentrationHandler(svc, defaultPortfolio))
+	mux.HandleFunc("/recovery", makeRecoveryHandler(svc, defaultPortfolio))
+	mux.HandleFunc("/simulate", makeSimulateHandler(svc, defaultPortfolio))
+	mux.HandleFunc("/scenarios", makeScenariosHandler(svc, defaultPortfolio))
+	mux.HandleFunc("/scenarios/run", makeRunScenarioHandler(svc, defaultPortfolio))
+	mux.HandleFunc("/returns", makeReturnsHandler(svc, defaultPortfolio))
+	mux.HandleFunc("/targets", makeTargetsHandler(svc, defaultPortfolio))
+	mux.HandleFunc("/rebalance", makeRebalanceHandler(svc, defaultPortfolio))
+	mux.HandleFunc("/benchmarks", makeBenchmarksHandler(svc, defaultPortfolio))
+	mux.HandleFunc("/instruments", makeInstrumentsHandler(svc, defaultPortfolio))
+	mux.HandleFunc("/alerts", makeAlertsHandler(svc, defaultPortfolio))
+	mux.HandleFunc("/watchlists", makeWatchlistsHandler(svc, defaultPortfolio))
+	mux.HandleFunc("/tax-report", makeTaxReportHandler(svc, defaultPortfolio))
 	mux.HandleFunc("/recompute-peaks", makeRecomputePeaksHandler(svc, defaultPortfolio))
 	mux.HandleFunc("/update-prices", makeUpdatePricesHandler(svc, defaultPortfolio))
 
@@ -96,7 +134,12 @@ func makePositionsHandler(svc *app.PortfolioService, defaultPortfolio string) ht
 				http.Error(w, "ticker required", http.StatusBadRequest)
 				return
 			}
-			if err := svc.AddOrUpdatePosition(r.Context(), portfolioName, &in); err != nil {
+			err := svc.AddOrUpdatePosition(r.Context(), portfolioName, &in)
+			if errors.Is(err, portfolio.ErrLedgerManaged) || errors.Is(err, portfolio.ErrOutOfRange) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err != nil {
 				http.Error(w, "failed to save position", http.StatusInternalServerError)
 				return
 			}
@@ -134,42 +177,959 @@ func makePositionHandler(svc *app.PortfolioService, defaultPortfolio string) htt
 	}
 }
 
-func makeRecomputePeaksHandler(svc *app.PortfolioService, defaultPortfolio string) http.HandlerFunc {
+func makeTransactionsHandler(svc *app.PortfolioService, defaultPortfolio string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		portfolioName := portfolioFromRequest(r, defaultPortfolio)
+
+		switch r.Method {
+		case http.MethodGet:
+			list, err := svc.ListTransactions(r.Context(), portfolioName, r.URL.Query().Get("ticker"))
+			if err != nil {
+				http.Error(w, "failed to list transactions", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, list)
+		case http.MethodPost:
+			var in portfolio.Transaction
+			if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+				http.Error(w, "invalid json", http.StatusBadRequest)
+				return
+			}
+			tx, err := svc.RecordTransaction(r.Context(), portfolioName, in)
+			if errors.Is(err, portfolio.ErrInvalidTransaction) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				http.Error(w, "failed to record transaction", http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			writeJSON(w, tx)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// makeJournalHandler lists annotated positions and trades and replaces the
+// annotations of one of them.
+func makeJournalHandler(svc *app.PortfolioService, defaultPortfolio string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		portfolioName := portfolioFromRequest(r, defaultPortfolio)
+
+		switch r.Method {
+		case http.MethodGet:
+			q := r.URL.Query()
+			entries, err := svc.GetJournal(r.Context(), portfolioName, portfolio.JournalFilter{
+				Tag: q.Get("tag"), Strategy: q.Get("strategy"), Ticker: q.Get("ticker"),
+			})
+			if err != nil {
+				http.Error(w, "failed to load journal", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, entries)
+		case http.MethodPost:
+			var in struct {
+				Ticker string `json:"ticker"`
+				TxID   string `json:"tx_id"`
+				portfolio.JournalNote
+			}
+			if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+				http.Error(w, "invalid json", http.StatusBadRequest)
+				return
+			}
+			if (in.Ticker == "") == (in.TxID == "") {
+				http.Error(w, "exactly one of ticker or tx_id is required", http.StatusBadRequest)
+				return
+			}
+			var (
+				res any
+				err error
+			)
+			if in.TxID != "" {
+				res, err = svc.AnnotateTransaction(r.Context(), portfolioName, in.TxID, in.JournalNote)
+			} else {
+				res, err = svc.AnnotatePosition(r.Context(), portfolioName, in.Ticker, in.JournalNote)
+			}
+			if errors.Is(err, portfolio.ErrInvalidJournal) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, "failed to annotate", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, res)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func makeJournalStatsHandler(svc *app.PortfolioService, defaultPortfolio string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		by, err := portfolio.ParseJournalGrouping(r.URL.Query().Get("by"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		breakdown, err := svc.GetJournalBreakdown(r.Context(), portfolioFromRequest(r, defaultPortfolio), by)
+		if err != nil {
+			http.Error(w, "failed to compute journal stats", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, breakdown)
+	}
+}
+
+// makeCorporateActionsHandler lists splits and renames and records new ones.
+func makeCorporateActionsHandler(svc *app.PortfolioService, defaultPortfolio string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		portfolioName := portfolioFromRequest(r, defaultPortfolio)
+
+		switch r.Method {
+		case http.MethodGet:
+			list, err := svc.ListCorporateActions(r.Context(), portfolioName)
+			if err != nil {
+				http.Error(w, "failed to list corporate actions", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, list)
+		case http.MethodPost:
+			var in portfolio.Transaction
+			if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+				http.Error(w, "invalid json", http.StatusBadRequest)
+				return
+			}
+			if !in.IsCorporateAction() {
+				http.Error(w, "type must be split, stock-dividend or rename", http.StatusBadRequest)
+				return
+			}
+			tx, err := svc.RecordTransaction(r.Context(), portfolioName, in)
+			if errors.Is(err, portfolio.ErrInvalidTransaction) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				http.Error(w, "failed to record corporate action", http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			writeJSON(w, tx)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func makeIncomeHandler(svc *app.PortfolioService, defaultPortfolio string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		portfolioName := portfolioFromRequest(r, defaultPortfolio)
+
+		from, to, err := rangeFromRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		summary, err := svc.GetIncome(r.Context(), portfolioName, from, to)
+		if err != nil {
+			http.Error(w, "failed to compute income", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, summary)
+	}
+}
+
+func makeFeesHandler(svc *app.PortfolioService, defaultPortfolio string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		portfolioName := portfolioFromRequest(r, defaultPortfolio)
+
+		from, to, err := rangeFromRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		report, err := svc.GetFeeReport(r.Context(), portfolioName, from, to)
+		if err != nil {
+			http.Error(w, "failed to compute fees", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, report)
+	}
+}
+
+func makeMarginHandler(svc *app.PortfolioService, defaultPortfolio string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		portfolioName := portfolioFromRequest(r, defaultPortfolio)
+
+		switch r.Method {
+		case http.MethodGet:
+			status, err := svc.GetMargin(r.Context(), portfolioName)
+			if errors.Is(err, portfolio.ErrInvalidMargin) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, "failed to get margin", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, status)
+		case http.MethodPost:
+			var in portfolio.MarginAccount
+			if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+				http.Error(w, "invalid json", http.StatusBadRequest)
+				return
+			}
+			m, err := svc.SetMargin(r.Context(), portfolioName, &in)
+			if errors.Is(err, portfolio.ErrInvalidMargin) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				http.Error(w, "failed to set margin", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, m)
+		case http.MethodDelete:
+			if _, err := svc.SetMargin(r.Context(), portfolioName, nil); err != nil {
+				http.Error(w, "failed to remove margin", http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func makeAccrueMarginHandler(svc *app.PortfolioService, defaultPortfolio string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 		portfolioName := portfolioFromRequest(r, defaultPortfolio)
-		if err := svc.RecomputeHistoricalPeaks(r.Context(), portfolioName); err != nil {
-			http.Error(w, "failed", http.StatusInternalServerError)
+
+		accrual, err := svc.AccrueMarginInterest(r.Context(), portfolioName, time.Now())
+		if errors.Is(err, portfolio.ErrInvalidMargin) {
+			http.Error(w, err.Error(), http.StatusNotFound)
 			return
 		}
-		writeJSON(w, map[string]string{"status": "ok"})
+		if err != nil {
+			http.Error(w, "failed to accrue margin interest", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, accrual)
 	}
 }
 
-func makeUpdatePricesHandler(svc *app.PortfolioService, defaultPortfolio string) http.HandlerFunc {
+func makeImportDividendsHandler(svc *app.PortfolioService, defaultPortfolio string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 		portfolioName := portfolioFromRequest(r, defaultPortfolio)
-		if err := svc.UpdateAllPrices(r.Context(), portfolioName); err != nil {
-			http.Error(w, "failed", http.StatusInternalServerError)
+
+		var since time.Time
+		if s := r.URL.Query().Get("since"); s != "" {
+			t, err := time.Parse("2006-01-02", s)
+			if err != nil {
+				http.Error(w, "invalid since", http.StatusBadRequest)
+				return
+			}
+			since = t
+		}
+		recorded, err := svc.ImportDividends(r.Context(), portfolioName, since)
+		if errors.Is(err, portfolio.ErrInvalidTransaction) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		writeJSON(w, map[string]string{"status": "ok"})
+		if err != nil {
+			http.Error(w, "failed to import dividends", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, recorded)
 	}
 }
 
-func portfolioFromRequest(r *http.Request, defaultName string) string {
-	name := r.URL.Query().Get("portfolio")
-	if name == "" {
-		return defaultName
+func makeRealizedHandler(svc *app.PortfolioService, defaultPortfolio string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		portfolioName := portfolioFromRequest(r, defaultPortfolio)
+
+		sales, err := svc.ListSales(r.Context(), portfolioName, r.URL.Query().Get("ticker"))
+		if err != nil {
+			http.Error(w, "failed to list realized gains", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, sales)
 	}
-	return name
+}
+
+func makeRiskHandler(svc *app.PortfolioService, defaultPortfolio string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		portfolioName := portfolioFromRequest(r, defaultPortfolio)
+
+		risk, err := svc.GetRisk(r.Context(), portfolioName)
+		if err != nil {
+			http.Error(w, "failed to compute risk", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, risk)
+	}
+}
+
+func makeConcentrationHandler(svc *app.PortfolioService, defaultPortfolio string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		portfolioName := portfolioFromRequest(r, defaultPortfolio)
+
+		switch r.Method {
+		case http.MethodGet:
+			report, err := svc.GetConcentration(r.Context(), portfolioName)
+			if err != nil {
+				http.Error(w, "failed to compute concentration", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, report)
+		case http.MethodPost:
+			var in portfolio.ConcentrationLimits
+			if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+				http.Error(w, "invalid json", http.StatusBadRequest)
+				return
+			}
+			limits, err := svc.SetConcentrationLimits(r.Context(), portfolioName, in)
+			if errors.Is(err, portfolio.ErrInvalidConcentration) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				http.Error(w, "failed to set concentration limits", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, limits)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func makeRecoveryHandler(svc *app.PortfolioService, defaultPortfolio string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		portfolioName := portfolioFromRequest(r, defaultPortfolio)
+
+		q := r.URL.Query()
+		opts := portfolio.RecoveryOptions{AnnualReturnPct: portfolio.DefaultAnnualReturnPct}
+		if raw := q.Get("return"); raw != "" {
+			v, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				http.Error(w, "invalid return", http.StatusBadRequest)
+				return
+			}
+			opts.AnnualReturnPct = v
+		}
+		if raw := q.Get("by"); raw != "" {
+			t, err := time.Parse("2006-01-02", raw)
+			if err != nil {
+				http.Error(w, "invalid by", http.StatusBadRequest)
+				return
+			}
+			opts.By = t
+		}
+
+		report, err := svc.GetRecovery(r.Context(), portfolioName, opts)
+		if errors.Is(err, portfolio.ErrInvalidRecovery) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, "failed to project recovery", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, report)
+	}
+}
+
+func makeSimulateHandler(svc *app.PortfolioService, defaultPortfolio string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		portfolioName := portfolioFromRequest(r, defaultPortfolio)
+
+		q := r.URL.Query()
+		method, err := portfolio.ParseSimulationMethod(q.Get("method"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		opts := portfolio.SimulationOptions{Method: method}
+		for key, dst := range map[string]*int{"days": &opts.HorizonDays, "paths": &opts.Paths, "lookback_days": &opts.LookbackDays} {
+			if raw := q.Get(key); raw != "" {
+				v, err := strconv.Atoi(raw)
+				if err != nil {
+					http.Error(w, "invalid "+key, http.StatusBadRequest)
+					return
+				}
+				*dst = v
+			}
+		}
+		for key, dst := range map[string]*float64{"drawdown_limit": &opts.DrawdownLimitPct, "goal": &opts.GoalValue} {
+			if raw := q.Get(key); raw != "" {
+				v, err := strconv.ParseFloat(raw, 64)
+				if err != nil {
+					http.Error(w, "invalid "+key, http.StatusBadRequest)
+					return
+				}
+				*dst = v
+			}
+		}
+		if raw := q.Get("seed"); raw != "" {
+			v, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				http.Error(w, "invalid seed", http.StatusBadRequest)
+				return
+			}
+			opts.Seed = v
+		}
+
+		result, err := svc.Simulate(r.Context(), portfolioName, opts)
+		if errors.Is(err, portfolio.ErrInvalidSimulation) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, "failed to simulate", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, result)
+	}
+}
+
+func makeScenariosHandler(svc *app.PortfolioService, defaultPortfolio string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		portfolioName := portfolioFromRequest(r, defaultPortfolio)
+
+		switch r.Method {
+		case http.MethodGet:
+			scenarios, err := svc.ListScenarios(r.Context(), portfolioName)
+			if err != nil {
+				http.Error(w, "failed to list scenarios", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, scenarios)
+		case http.MethodPost:
+			var in portfolio.Scenario
+			if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+				http.Error(w, "invalid json", http.StatusBadRequest)
+				return
+			}
+			sc, err := svc.SaveScenario(r.Context(), portfolioName, in)
+			if errors.Is(err, portfolio.ErrInvalidScenario) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				http.Error(w, "failed to save scenario", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, sc)
+		case http.MethodDelete:
+			err := svc.RemoveScenario(r.Context(), portfolioName, r.URL.Query().Get("name"))
+			if errors.Is(err, portfolio.ErrInvalidScenario) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, "failed to remove scenario", http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// makeRunScenarioHandler runs the saved scenario named in the query on GET and
+// the scenario in the body on POST.
+func makeRunScenarioHandler(svc *app.PortfolioService, defaultPortfolio string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		portfolioName := portfolioFromRequest(r, defaultPortfolio)
+
+		var (
+			result portfolio.ScenarioResult
+			err    error
+		)
+		invalid := http.StatusBadRequest
+		switch r.Method {
+		case http.MethodGet:
+			result, err = svc.RunSavedScenario(r.Context(), portfolioName, r.URL.Query().Get("name"))
+			invalid = http.StatusNotFound
+		case http.MethodPost:
+			var in portfolio.Scenario
+			if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+				http.Error(w, "invalid json", http.StatusBadRequest)
+				return
+			}
+			result, err = svc.RunScenario(r.Context(), portfolioName, in)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if errors.Is(err, portfolio.ErrInvalidScenario) {
+			http.Error(w, err.Error(), invalid)
+			return
+		}
+		if err != nil {
+			http.Error(w, "failed to run scenario", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, result)
+	}
+}
+
+func makeHistoryHandler(svc *app.PortfolioService, defaultPortfolio string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		portfolioName := portfolioFromRequest(r, defaultPortfolio)
+
+		from, to, err := rangeFromRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		curve, err := svc.GetHistory(r.Context(), portfolioName, from, to)
+		if err != nil {
+			http.Error(w, "failed to load history", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, curve)
+	}
+}
+
+func makeBenchmarksHandler(svc *app.PortfolioService, defaultPortfolio string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		portfolioName := portfolioFromRequest(r, defaultPortfolio)
+
+		switch r.Method {
+		case http.MethodGet:
+			from, to, err := rangeFromRequest(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			var tickers []string
+			if raw := r.URL.Query().Get("tickers"); raw != "" {
+				tickers = strings.Split(raw, ",")
+			}
+			report, err := svc.CompareBenchmarks(r.Context(), portfolioName, tickers, from, to)
+			if err != nil {
+				http.Error(w, "failed to compare benchmarks", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, report)
+		case http.MethodPost:
+			var in struct {
+				Tickers []string `json:"tickers"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+				http.Error(w, "invalid json", http.StatusBadRequest)
+				return
+			}
+			if err := svc.SetBenchmarks(r.Context(), portfolioName, in.Tickers); err != nil {
+				http.Error(w, "failed to set benchmarks", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, map[string][]string{"benchmarks": portfolio.NormalizeBenchmarks(in.Tickers)})
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func makeAlertsHandler(svc *app.PortfolioService, defaultPortfolio string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		portfolioName := portfolioFromRequest(r, defaultPortfolio)
+
+		switch r.Method {
+		case http.MethodGet:
+			rules, err := svc.ListAlerts(r.Context(), portfolioName)
+			if err != nil {
+				http.Error(w, "failed to list alerts", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, rules)
+		case http.MethodPost:
+			var in portfolio.AlertRule
+			if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+				http.Error(w, "invalid json", http.StatusBadRequest)
+				return
+			}
+			rule, err := svc.AddAlert(r.Context(), portfolioName, in)
+			if errors.Is(err, portfolio.ErrInvalidAlert) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				http.Error(w, "failed to add alert", http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			writeJSON(w, rule)
+		case http.MethodDelete:
+			err := svc.RemoveAlert(r.Context(), portfolioName, r.URL.Query().Get("id"))
+			if errors.Is(err, portfolio.ErrInvalidAlert) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, "failed to remove alert", http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// makeWatchlistsHandler serves the portfolio's watchlists, or the global ones
+// with ?global=true.
+func makeWatchlistsHandler(svc *app.PortfolioService, defaultPortfolio string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		owner := portfolioFromRequest(r, defaultPortfolio)
+		if raw := r.URL.Query().Get("global"); raw != "" {
+			global, err := strconv.ParseBool(raw)
+			if err != nil {
+				http.Error(w, "invalid global", http.StatusBadRequest)
+				return
+			}
+			if global {
+				owner = app.GlobalWatchlists
+			}
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			lists, err := svc.GetWatchlists(r.Context(), owner, r.URL.Query().Get("list"))
+			if errors.Is(err, portfolio.ErrInvalidWatchlist) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, "failed to get watchlists", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, lists)
+		case http.MethodPost:
+			var in struct {
+				List   string `json:"list"`
+				Ticker string `json:"ticker"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+				http.Error(w, "invalid json", http.StatusBadRequest)
+				return
+			}
+			item, err := svc.Watch(r.Context(), owner, in.List, in.Ticker)
+			if errors.Is(err, portfolio.ErrInvalidWatchlist) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				http.Error(w, "failed to watch ticker", http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			writeJSON(w, item)
+		case http.MethodDelete:
+			q := r.URL.Query()
+			err := svc.Unwatch(r.Context(), owner, q.Get("list"), q.Get("ticker"))
+			if errors.Is(err, portfolio.ErrInvalidWatchlist) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, "failed to unwatch", http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func makeInstrumentsHandler(svc *app.PortfolioService, defaultPortfolio string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		portfolioName := portfolioFromRequest(r, defaultPortfolio)
+
+		switch r.Method {
+		case http.MethodGet:
+			list, err := svc.ListInstruments(r.Context(), portfolioName)
+			if err != nil {
+				http.Error(w, "failed to list instruments", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, list)
+		case http.MethodPost:
+			var in portfolio.Instrument
+			if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+				http.Error(w, "invalid json", http.StatusBadRequest)
+				return
+			}
+			inst, err := svc.SetInstrument(r.Context(), portfolioName, in)
+			if errors.Is(err, portfolio.ErrInvalidInstrument) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				http.Error(w, "failed to set instrument", http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			writeJSON(w, inst)
+		case http.MethodDelete:
+			err := svc.RemoveInstrument(r.Context(), portfolioName, r.URL.Query().Get("ticker"))
+			if errors.Is(err, portfolio.ErrInvalidInstrument) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, "failed to remove instrument", http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func makeTargetsHandler(svc *app.PortfolioService, defaultPortfolio string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		portfolioName := portfolioFromRequest(r, defaultPortfolio)
+
+		switch r.Method {
+		case http.MethodGet:
+			a, err := svc.GetAllocation(r.Context(), portfolioName)
+			if err != nil {
+				http.Error(w, "failed to load targets", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, a)
+		case http.MethodPost:
+			var in app.Allocation
+			if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+				http.Error(w, "invalid json", http.StatusBadRequest)
+				return
+			}
+			err := svc.SetAllocation(r.Context(), portfolioName, in)
+			if errors.Is(err, portfolio.ErrInvalidAllocation) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				http.Error(w, "failed to set targets", http.StatusInternalServerError)
+				return
+			}
+			a, err := svc.GetAllocation(r.Context(), portfolioName)
+			if err != nil {
+				http.Error(w, "failed to load targets", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, a)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func makeRebalanceHandler(svc *app.PortfolioService, defaultPortfolio string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		portfolioName := portfolioFromRequest(r, defaultPortfolio)
+
+		q := r.URL.Query()
+		var opts portfolio.RebalanceOptions
+		if raw := q.Get("new_cash"); raw != "" {
+			v, err := portfolio.ParseDecimal(raw)
+			if err != nil {
+				http.Error(w, "invalid new_cash", http.StatusBadRequest)
+				return
+			}
+			opts.NewCash = v
+		}
+		if raw := q.Get("cash_only"); raw != "" {
+			v, err := strconv.ParseBool(raw)
+			if err != nil {
+				http.Error(w, "invalid cash_only", http.StatusBadRequest)
+				return
+			}
+			opts.CashOnly = v
+		}
+
+		plan, err := svc.GetRebalancePlan(r.Context(), portfolioName, opts)
+		if errors.Is(err, portfolio.ErrInvalidAllocation) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, "failed to plan rebalance", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, plan)
+	}
+}
+
+func makeReturnsHandler(svc *app.PortfolioService, defaultPortfolio string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		portfolioName := portfolioFromRequest(r, defaultPortfolio)
+
+		from, to, err := rangeFromRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		report, err := svc.GetReturns(r.Context(), portfolioName, from, to)
+		if err != nil {
+			http.Error(w, "failed to compute returns", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, report)
+	}
+}
+
+func makeTaxReportHandler(svc *app.PortfolioService, defaultPortfolio string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		portfolioName := portfolioFromRequest(r, defaultPortfolio)
+
+		year := time.Now().Year()
+		if ys := r.URL.Query().Get("year"); ys != "" {
+			y, err := strconv.Atoi(ys)
+			if err != nil {
+				http.Error(w, "invalid year", http.StatusBadRequest)
+				return
+			}
+			year = y
+		}
+
+		report, err := svc.GetTaxReport(r.Context(), portfolioName, year)
+		if err != nil {
+			http.Error(w, "failed to build tax report", http.StatusInternalServerError)
+			return
+		}
+
+		switch r.URL.Query().Get("format") {
+		case "", "json":
+			writeJSON(w, report)
+		case "csv":
+			w.Header().Set("Content-Type", "text/csv")
+			w.Header().Set("Content-Disposition", "attachment; filename=form8949-"+strconv.Itoa(year)+".csv")
+			_ = portfolio.WriteForm8949CSV(w, report)
+		default:
+			http.Error(w, "unsupported format", http.StatusBadRequest)
+		}
+	}
+}
+
+func makeRecomputePeaksHandler(svc *app.PortfolioService, defaultPortfolio string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		portfolioName := portfolioFromRequest(r, defaultPortfolio)
+		if err := svc.RecomputeHistoricalPeaks(r.Context(), portfolioName); err != nil {
+			http.Error(w, "failed", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, map[string]string{"status": "ok"})
+	}
+}
+
+func makeUpdatePricesHandler(svc *app.PortfolioService, defaultPortfolio string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		portfolioName := portfolioFromRequest(r, defaultPortfolio)
+		if err := svc.UpdateAllPrices(r.Context(), portfolioName); err != nil {
+			http.Error(w, "failed", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, map[string]string{"status": "ok"})
+	}
+}
+
+func portfolioFromRequest(r *http.Request, defaultName string) string {
+	name := r.URL.Query().Get("portfolio")
+	if name == "" {
+		return defaultName
+	}
+	return name
+}
+
+// rangeFromRequest reads the from/to query parameters (YYYY-MM-DD), defaulting
+// to the year ending today. The end date is inclusive.
+func rangeFromRequest(r *http.Request) (from, to time.Time, err error) {
+	to = time.Now()
+	if s := r.URL.Query().Get("to"); s != "" {
+		if to, err = time.Parse("2006-01-02", s); err != nil {
+			return time.Time{}, time.Time{}, errors.New("invalid to date")
+		}
+		to = to.Add(24*time.Hour - time.Nanosecond)
+	}
+	from = to.AddDate(-1, 0, 0)
+	if s := r.URL.Query().Get("from"); s != "" {
+		if from, err = time.Parse("2006-01-02", s); err != nil {
+			return time.Time{}, time.Time{}, errors.New("invalid from date")
+		}
+	}
+	if !to.After(from) {
+		return time.Time{}, time.Time{}, errors.New("to must be after from")
+	}
+	return from, to, nil
 }
 
 func envOrDefault(key, def string) string {
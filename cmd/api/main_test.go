@@ -29,11 +29,11 @@ func newTestService(t *testing.T) (*app.PortfolioService, string) {
 	svc := app.NewPortfolioService(storeInfo.Store, testPricer{})
 	ctx := context.Background()
 	portfolioName := "Test"
-	if _, err := svc.CreatePortfolio(ctx, portfolioName, 500); err != nil {
+	if _, err := svc.CreatePortfolio(ctx, portfolioName, portfolio.NewDecimal(500)); err != nil {
 		t.Fatalf("CreatePortfolio: %v", err)
 	}
 
-	pos := &portfolio.Position{Ticker: "AAPL", Shares: 2, CostBasis: 200, CurrentPrice: 125}
+	pos := &portfolio.Position{Ticker: "AAPL", Shares: portfolio.NewDecimal(2), CostBasis: portfolio.NewDecimal(200), CurrentPrice: 125}
 	pos.UpdatePrice(pos.CurrentPrice)
 	if err := svc.AddOrUpdatePosition(ctx, portfolioName, pos); err != nil {
 		t.Fatalf("AddOrUpdatePosition: %v", err)
@@ -93,6 +93,25 @@ func TestPositionsHandlerValidation(t *testing.T) {
 	}
 }
 
+func TestPositionsHandlerRejectsLedgerManagedEdit(t *testing.T) {
+	svc, portfolioName := newTestService(t)
+	ctx := context.Background()
+	tx := portfolio.Transaction{Type: portfolio.TxBuy, Ticker: "MSFT", Quantity: portfolio.NewDecimal(3), Price: portfolio.NewDecimal(100)}
+	if _, err := svc.RecordTransaction(ctx, portfolioName, tx); err != nil {
+		t.Fatalf("RecordTransaction: %v", err)
+	}
+	handler := makePositionsHandler(svc, portfolioName)
+
+	req := httptest.NewRequest(http.MethodPost, "/positions", bytes.NewBufferString(`{"ticker":"MSFT","shares":1}`))
+	w := httptest.NewRecorder()
+
+	handler(w, req)
+
+	if w.Result().StatusCode != http.StatusBadRequest {
+		t.Fatalf("status=%d want %d", w.Result().StatusCode, http.StatusBadRequest)
+	}
+}
+
 func TestPositionHandler(t *testing.T) {
 	svc, portfolioName := newTestService(t)
 	handler := makePositionHandler(svc, portfolioName)
@@ -107,3 +126,61 @@ func TestPositionHandler(t *testing.T) {
 		t.Fatalf("status=%d want %d", res.StatusCode, http.StatusOK)
 	}
 }
+
+func TestTransactionsHandler(t *testing.T) {
+	svc, portfolioName := newTestService(t)
+	handler := makeTransactionsHandler(svc, portfolioName)
+
+	body := bytes.NewBufferString(`{"type":"buy","ticker":"MSFT","quantity":3,"price":100,"date":"2024-01-02T00:00:00Z"}`)
+	req := httptest.NewRequest(http.MethodPost, "/transactions", body)
+	w := httptest.NewRecorder()
+	handler(w, req)
+	if w.Result().StatusCode != http.StatusCreated {
+		t.Fatalf("status=%d want %d", w.Result().StatusCode, http.StatusCreated)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/transactions", bytes.NewBufferString(`{"type":"sell","ticker":"MSFT","quantity":10,"price":100}`))
+	w = httptest.NewRecorder()
+	handler(w, req)
+	if w.Result().StatusCode != http.StatusBadRequest {
+		t.Fatalf("oversell status=%d want %d", w.Result().StatusCode, http.StatusBadRequest)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/transactions?ticker=MSFT", nil)
+	w = httptest.NewRecorder()
+	handler(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+	var got []portfolio.Transaction
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if len(got) != 1 || got[0].Ticker != "MSFT" {
+		t.Fatalf("unexpected response: %+v", got)
+	}
+}
+
+func TestTaxReportHandlerCSV(t *testing.T) {
+	svc, portfolioName := newTestService(t)
+	ctx := context.Background()
+	if _, err := svc.RecordTransaction(ctx, portfolioName, portfolio.Transaction{Type: portfolio.TxSell, Ticker: "AAPL", Quantity: portfolio.NewDecimal(1), Price: portfolio.NewDecimal(150)}); err != nil {
+		t.Fatalf("RecordTransaction: %v", err)
+	}
+
+	handler := makeTaxReportHandler(svc, portfolioName)
+	req := httptest.NewRequest(http.MethodGet, "/tax-report?format=csv", nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	res := w.Result()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status=%d want %d", res.StatusCode, http.StatusOK)
+	}
+	if ct := res.Header.Get("Content-Type"); ct != "text/csv" {
+		t.Fatalf("Content-Type=%q want text/csv", ct)
+	}
+	if !bytes.Contains(w.Body.Bytes(), []byte("1 sh AAPL")) {
+		t.Fatalf("expected AAPL row, got %q", w.Body.String())
+	}
+}
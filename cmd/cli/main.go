@@ -8,9 +8,11 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	"tracktrades/internal/adapters/alphavantage"
+	"tracktrades/internal/adapters/notify"
 	"tracktrades/internal/adapters/storage"
 	"tracktrades/internal/app"
 	"tracktrades/internal/domain/portfolio"
@@ -48,7 +50,13 @@ func main() {
 
 	store := storeInfo.Store
 	pricer := selectPricer(apiKey)
-	svc := app.NewPortfolioService(store, pricer)
+	opts := serviceOptions(apiKey)
+	notifier, err := notify.New(envOrDefault("ALERT_NOTIFIER", "stdout"))
+	if err != nil {
+		log.Fatalf("invalid notifier: %v", err)
+	}
+	opts = append(opts, app.WithNotifier(notifier))
+	svc := app.NewPortfolioService(store, pricer, opts...)
 
 	ctx := context.Background()
 
@@ -65,6 +73,94 @@ func main() {
 		cmdErr = runPosition(ctx, svc, portfolioName, args)
 	case "add-position":
 		cmdErr = runAddPosition(ctx, svc, portfolioName, args)
+	case "record-trade":
+		cmdErr = runRecordTrade(ctx, svc, portfolioName, args)
+	case "expire-options":
+		cmdErr = runExpireOptions(ctx, svc, portfolioName, args)
+	case "transactions":
+		cmdErr = runTransactions(ctx, svc, portfolioName, args)
+	case "corporate-actions":
+		cmdErr = runCorporateActions(ctx, svc, portfolioName, args)
+	case "journal":
+		cmdErr = runJournal(ctx, svc, portfolioName, args)
+	case "annotate":
+		cmdErr = runAnnotate(ctx, svc, portfolioName, args)
+	case "journal-stats":
+		cmdErr = runJournalStats(ctx, svc, portfolioName, args)
+	case "income":
+		cmdErr = runIncome(ctx, svc, portfolioName, args)
+	case "fees":
+		cmdErr = runFees(ctx, svc, portfolioName, args)
+	case "margin":
+		cmdErr = runMargin(ctx, svc, portfolioName, args)
+	case "set-margin":
+		cmdErr = runSetMargin(ctx, svc, portfolioName, args)
+	case "accrue-interest":
+		cmdErr = runAccrueInterest(ctx, svc, portfolioName, args)
+	case "import-dividends":
+		cmdErr = runImportDividends(ctx, svc, portfolioName, apiKey, args)
+	case "set-drip":
+		cmdErr = runSetDrip(ctx, svc, portfolioName, args)
+	case "realized":
+		cmdErr = runRealized(ctx, svc, portfolioName, args)
+	case "history":
+		cmdErr = runHistory(ctx, svc, portfolioName, args)
+	case "risk":
+		cmdErr = runRisk(ctx, svc, portfolioName, args)
+	case "recovery":
+		cmdErr = runRecovery(ctx, svc, portfolioName, args)
+	case "concentration":
+		cmdErr = runConcentration(ctx, svc, portfolioName, args)
+	case "set-concentration":
+		cmdErr = runSetConcentration(ctx, svc, portfolioName, args)
+	case "simulate":
+		cmdErr = runSimulate(ctx, svc, portfolioName, args)
+	case "scenarios":
+		cmdErr = runScenarios(ctx, svc, portfolioName, args)
+	case "save-scenario":
+		cmdErr = runSaveScenario(ctx, svc, portfolioName, args)
+	case "remove-scenario":
+		cmdErr = runRemoveScenario(ctx, svc, portfolioName, args)
+	case "stress":
+		cmdErr = runStress(ctx, svc, portfolioName, args)
+	case "set-risk":
+		cmdErr = runSetRisk(ctx, svc, portfolioName, args)
+	case "benchmarks":
+		cmdErr = runBenchmarks(ctx, svc, portfolioName, apiKey, args)
+	case "set-benchmarks":
+		cmdErr = runSetBenchmarks(ctx, svc, portfolioName, args)
+	case "instruments":
+		cmdErr = runInstruments(ctx, svc, portfolioName, args)
+	case "set-instrument":
+		cmdErr = runSetInstrument(ctx, svc, portfolioName, args)
+	case "remove-instrument":
+		cmdErr = runRemoveInstrument(ctx, svc, portfolioName, args)
+	case "alerts":
+		cmdErr = runAlerts(ctx, svc, portfolioName, args)
+	case "add-alert":
+		cmdErr = runAddAlert(ctx, svc, portfolioName, args)
+	case "remove-alert":
+		cmdErr = runRemoveAlert(ctx, svc, portfolioName, args)
+	case "watch":
+		cmdErr = runWatch(ctx, svc, portfolioName, args)
+	case "unwatch":
+		cmdErr = runUnwatch(ctx, svc, portfolioName, args)
+	case "watchlists":
+		cmdErr = runWatchlists(ctx, svc, portfolioName, args)
+	case "set-target":
+		cmdErr = runSetTarget(ctx, svc, portfolioName, args)
+	case "tag-ticker":
+		cmdErr = runTagTicker(ctx, svc, portfolioName, args)
+	case "targets":
+		cmdErr = runTargets(ctx, svc, portfolioName, args)
+	case "rebalance":
+		cmdErr = runRebalance(ctx, svc, portfolioName, args)
+	case "returns":
+		cmdErr = runReturns(ctx, svc, portfolioName, apiKey, args)
+	case "tax-report":
+		cmdErr = runTaxReport(ctx, svc, portfolioName, args)
+	case "set-lot-method":
+		cmdErr = runSetLotMethod(ctx, svc, portfolioName, args)
 	case "update-prices":
 		cmdErr = runUpdatePrices(ctx, svc, portfolioName, apiKey, args)
 	case "recompute-peaks":
@@ -136,6 +232,7 @@ func runAddPosition(ctx context.Context, svc *app.PortfolioService, defaultPortf
 	costBasis := fs.Float64("cost", 0, "Total cost basis")
 	price := fs.Float64("price", 0, "Current price")
 	entryDateStr := fs.String("entry", "", "Entry date (YYYY-MM-DD)")
+	short := fs.Bool("short", false, "Position is a short sale; --cost is the proceeds received")
 	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
 	_ = fs.Parse(args)
 
@@ -151,10 +248,13 @@ func runAddPosition(ctx context.Context, svc *app.PortfolioService, defaultPortf
 
 	pos := &portfolio.Position{
 		Ticker:       *ticker,
-		Shares:       *shares,
-		CostBasis:    *costBasis,
+		Shares:       portfolio.NewDecimal(*shares),
+		CostBasis:    portfolio.NewDecimal(*costBasis),
 		CurrentPrice: *price,
 	}
+	if *short {
+		pos.Side = portfolio.Short
+	}
 
 	if *entryDateStr != "" {
 		t, err := time.Parse(defaultTimeLayout, *entryDateStr)
@@ -175,6 +275,919 @@ func runAddPosition(ctx context.Context, svc *app.PortfolioService, defaultPortf
 	return nil
 }
 
+func runRecordTrade(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("record-trade", flag.ExitOnError)
+	txType := fs.String("type", string(portfolio.TxBuy), "Transaction type (buy, sell, short, cover, dividend, stock-dividend, fee, deposit, withdrawal, split, rename)")
+	ticker := fs.String("ticker", "", "Ticker symbol")
+	quantity := fs.Float64("quantity", 0, "Shares bought or sold")
+	price := fs.Float64("price", 0, "Price per share")
+	commission := fs.Float64("commission", 0, "Broker commission on a trade")
+	exchangeFee := fs.Float64("exchange-fee", 0, "Exchange fee on a trade")
+	regulatoryFee := fs.Float64("regulatory-fee", 0, "Regulatory fee on a trade (SEC, FINRA TAF, stamp duty)")
+	amount := fs.Float64("amount", 0, "Cash amount for dividend, fee, deposit or withdrawal")
+	reinvest := fs.Bool("reinvest", false, "Reinvest a dividend in new shares at --price")
+	ratio := fs.String("ratio", "", "Split or rename ratio, new shares per old share (10:1, 1:10 or a number)")
+	newTicker := fs.String("new-ticker", "", "Ticker a rename moves the holding to")
+	currency := fs.String("currency", "", "Currency of price/amount (default position or base currency)")
+	fxRate := fs.Float64("fx-rate", 0, "Rate to base currency (fetched from AlphaVantage when omitted)")
+	dateStr := fs.String("date", "", "Trade date (YYYY-MM-DD, default today)")
+	lotsStr := fs.String("lots", "", "Lots to close on a sell (LOT_ID:QTY,...)")
+	note := fs.String("note", "", "Free-text note")
+	tags := fs.String("tags", "", "Journal tags (comma-separated)")
+	strategy := fs.String("strategy", "", "Strategy the trade belongs to")
+	underlying := fs.String("underlying", "", "Option underlying (trades an option contract)")
+	strike := fs.Float64("strike", 0, "Option strike")
+	expiryStr := fs.String("expiry", "", "Option expiry (YYYY-MM-DD)")
+	right := fs.String("right", "", "Option right (call or put)")
+	multiplier := fs.Float64("multiplier", 0, "Option contract multiplier (default 100)")
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	kind, err := portfolio.ParseTransactionType(*txType)
+	if err != nil {
+		return err
+	}
+	lots, err := parseLotSelections(*lotsStr)
+	if err != nil {
+		return err
+	}
+	var shareRatio portfolio.Decimal
+	if *ratio != "" {
+		if shareRatio, err = portfolio.ParseSplitRatio(*ratio); err != nil {
+			return err
+		}
+	}
+
+	tx := portfolio.Transaction{
+		Type:          kind,
+		Ticker:        *ticker,
+		Quantity:      portfolio.NewDecimal(*quantity),
+		Price:         portfolio.NewDecimal(*price),
+		Commission:    portfolio.NewDecimal(*commission),
+		ExchangeFee:   portfolio.NewDecimal(*exchangeFee),
+		RegulatoryFee: portfolio.NewDecimal(*regulatoryFee),
+		Amount:        portfolio.NewDecimal(*amount),
+		Ratio:         shareRatio,
+		NewTicker:     *newTicker,
+		Reinvest:      *reinvest,
+		Currency:      *currency,
+		FXRate:        portfolio.NewDecimal(*fxRate),
+		Lots:          lots,
+		Note:          *note,
+		Tags:          strings.Split(*tags, ","),
+		Strategy:      *strategy,
+	}
+	if *underlying != "" {
+		contract, err := parseOptionContract(*underlying, *strike, *expiryStr, *right, *multiplier)
+		if err != nil {
+			return err
+		}
+		tx.Option = &contract
+	}
+	if *dateStr != "" {
+		t, err := time.Parse(defaultTimeLayout, *dateStr)
+		if err != nil {
+			return fmt.Errorf("invalid date: %w", err)
+		}
+		tx.Date = t
+	}
+
+	recorded, err := svc.RecordTransaction(ctx, *portfolioName, tx)
+	if err != nil {
+		return err
+	}
+	return printJSON(recorded)
+}
+
+func parseOptionContract(underlying string, strike float64, expiry, right string, multiplier float64) (portfolio.OptionContract, error) {
+	r, err := portfolio.ParseOptionRight(right)
+	if err != nil {
+		return portfolio.OptionContract{}, err
+	}
+	t, err := time.Parse(defaultTimeLayout, expiry)
+	if err != nil {
+		return portfolio.OptionContract{}, fmt.Errorf("invalid expiry: %w", err)
+	}
+	return portfolio.OptionContract{Underlying: underlying, Strike: strike, Expiry: t, Right: r, Multiplier: multiplier}, nil
+}
+
+func runExpireOptions(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("expire-options", flag.ExitOnError)
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	res, err := svc.ExpireOptions(ctx, *portfolioName)
+	if err != nil {
+		return err
+	}
+	return printJSON(res)
+}
+
+func runTransactions(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("transactions", flag.ExitOnError)
+	ticker := fs.String("ticker", "", "Only show transactions for this ticker")
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	txs, err := svc.ListTransactions(ctx, *portfolioName, *ticker)
+	if err != nil {
+		return err
+	}
+	return printJSON(txs)
+}
+
+func runCorporateActions(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("corporate-actions", flag.ExitOnError)
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	actions, err := svc.ListCorporateActions(ctx, *portfolioName)
+	if err != nil {
+		return err
+	}
+	return printJSON(actions)
+}
+
+func runJournal(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("journal", flag.ExitOnError)
+	tag := fs.String("tag", "", "Only entries with this tag")
+	strategy := fs.String("strategy", "", "Only entries of this strategy")
+	ticker := fs.String("ticker", "", "Only entries for this ticker")
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	entries, err := svc.GetJournal(ctx, *portfolioName, portfolio.JournalFilter{Tag: *tag, Strategy: *strategy, Ticker: *ticker})
+	if err != nil {
+		return err
+	}
+	return printJSON(entries)
+}
+
+func runAnnotate(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("annotate", flag.ExitOnError)
+	ticker := fs.String("ticker", "", "Position to annotate")
+	txID := fs.String("tx", "", "Transaction ID to annotate")
+	note := fs.String("note", "", "Free-text note")
+	tags := fs.String("tags", "", "Tags (comma-separated)")
+	strategy := fs.String("strategy", "", "Strategy name")
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	if (*ticker == "") == (*txID == "") {
+		return errors.New("exactly one of --ticker or --tx is required")
+	}
+	n := portfolio.JournalNote{Note: *note, Tags: strings.Split(*tags, ","), Strategy: *strategy}
+	if *txID != "" {
+		tx, err := svc.AnnotateTransaction(ctx, *portfolioName, *txID, n)
+		if err != nil {
+			return err
+		}
+		return printJSON(tx)
+	}
+	n, err := svc.AnnotatePosition(ctx, *portfolioName, *ticker, n)
+	if err != nil {
+		return err
+	}
+	return printJSON(n)
+}
+
+func runJournalStats(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("journal-stats", flag.ExitOnError)
+	by := fs.String("by", string(portfolio.GroupByTag), "Group by tag or strategy")
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	grouping, err := portfolio.ParseJournalGrouping(*by)
+	if err != nil {
+		return err
+	}
+	breakdown, err := svc.GetJournalBreakdown(ctx, *portfolioName, grouping)
+	if err != nil {
+		return err
+	}
+	return printJSON(breakdown)
+}
+
+func runIncome(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("income", flag.ExitOnError)
+	fromStr := fs.String("from", "", "Range start (YYYY-MM-DD, default one year ago)")
+	toStr := fs.String("to", "", "Range end (YYYY-MM-DD, default today)")
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	from, to, err := parseRange(*fromStr, *toStr)
+	if err != nil {
+		return err
+	}
+	summary, err := svc.GetIncome(ctx, *portfolioName, from, to)
+	if err != nil {
+		return err
+	}
+	return printJSON(summary)
+}
+
+func runFees(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("fees", flag.ExitOnError)
+	fromStr := fs.String("from", "", "Range start (YYYY-MM-DD, default one year ago)")
+	toStr := fs.String("to", "", "Range end (YYYY-MM-DD, default today)")
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	from, to, err := parseRange(*fromStr, *toStr)
+	if err != nil {
+		return err
+	}
+	report, err := svc.GetFeeReport(ctx, *portfolioName, from, to)
+	if err != nil {
+		return err
+	}
+	return printJSON(report)
+}
+
+func runMargin(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("margin", flag.ExitOnError)
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	status, err := svc.GetMargin(ctx, *portfolioName)
+	if err != nil {
+		return err
+	}
+	return printJSON(status)
+}
+
+func runSetMargin(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("set-margin", flag.ExitOnError)
+	initial := fs.Float64("initial", 50, "Initial requirement in percent of position value")
+	maintenance := fs.Float64("maintenance", 25, "Maintenance requirement of long positions in percent")
+	shortMaintenance := fs.Float64("short-maintenance", 30, "Maintenance requirement of short positions in percent")
+	rate := fs.Float64("rate", 0, "Annual interest rate on the margin loan in percent")
+	disable := fs.Bool("disable", false, "Turn the margin account off")
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	var settings *portfolio.MarginAccount
+	if !*disable {
+		settings = &portfolio.MarginAccount{
+			InitialPct: *initial, MaintenancePct: *maintenance, ShortMaintenancePct: *shortMaintenance, InterestRatePct: *rate,
+		}
+	}
+	m, err := svc.SetMargin(ctx, *portfolioName, settings)
+	if err != nil || m == nil {
+		return err
+	}
+	return printJSON(m)
+}
+
+func runAccrueInterest(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("accrue-interest", flag.ExitOnError)
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	accrual, err := svc.AccrueMarginInterest(ctx, *portfolioName, time.Now())
+	if err != nil {
+		return err
+	}
+	return printJSON(accrual)
+}
+
+func runImportDividends(ctx context.Context, svc *app.PortfolioService, defaultPortfolio, apiKey string, args []string) error {
+	if err := requireAPIKey(apiKey); err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("import-dividends", flag.ExitOnError)
+	sinceStr := fs.String("since", "", "Earliest ex-date (YYYY-MM-DD, default each position's entry date)")
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	var since time.Time
+	if *sinceStr != "" {
+		t, err := time.Parse(defaultTimeLayout, *sinceStr)
+		if err != nil {
+			return fmt.Errorf("invalid --since: %w", err)
+		}
+		since = t
+	}
+	recorded, err := svc.ImportDividends(ctx, *portfolioName, since)
+	if err != nil {
+		return err
+	}
+	return printJSON(recorded)
+}
+
+func runSetDrip(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("set-drip", flag.ExitOnError)
+	enabled := fs.Bool("enabled", true, "Reinvest imported dividends in new shares")
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	return svc.SetDividendReinvestment(ctx, *portfolioName, *enabled)
+}
+
+func runRealized(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("realized", flag.ExitOnError)
+	ticker := fs.String("ticker", "", "Only show sales of this ticker")
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	sales, err := svc.ListSales(ctx, *portfolioName, *ticker)
+	if err != nil {
+		return err
+	}
+	return printJSON(sales)
+}
+
+func runSetLotMethod(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("set-lot-method", flag.ExitOnError)
+	method := fs.String("method", "", "Lot matching method (fifo, lifo, highest-cost, specific)")
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	m, err := portfolio.ParseLotMethod(*method)
+	if err != nil {
+		return err
+	}
+	if err := svc.SetLotMethod(ctx, *portfolioName, m); err != nil {
+		return err
+	}
+	fmt.Printf("lot method for %s set to %s\n", *portfolioName, m)
+	return nil
+}
+
+func runRisk(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("risk", flag.ExitOnError)
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	risk, err := svc.GetRisk(ctx, *portfolioName)
+	if err != nil {
+		return err
+	}
+	return printJSON(risk)
+}
+
+func runRecovery(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("recovery", flag.ExitOnError)
+	annualReturn := fs.Float64("return", portfolio.DefaultAnnualReturnPct, "Assumed compounded annual return in percent")
+	byStr := fs.String("by", "", "Target recovery date (YYYY-MM-DD, default one year from today)")
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	opts := portfolio.RecoveryOptions{AnnualReturnPct: *annualReturn}
+	if *byStr != "" {
+		t, err := time.Parse(defaultTimeLayout, *byStr)
+		if err != nil {
+			return fmt.Errorf("invalid --by: %w", err)
+		}
+		opts.By = t
+	}
+	report, err := svc.GetRecovery(ctx, *portfolioName, opts)
+	if err != nil {
+		return err
+	}
+	return printJSON(report)
+}
+
+func runConcentration(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("concentration", flag.ExitOnError)
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	report, err := svc.GetConcentration(ctx, *portfolioName)
+	if err != nil {
+		return err
+	}
+	return printJSON(report)
+}
+
+func runSetConcentration(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("set-concentration", flag.ExitOnError)
+	maxPosition := fs.Float64("max-position", 0, "Largest position weight in percent before warning (default 20)")
+	maxTop5 := fs.Float64("max-top5", 0, "Weight of the five largest positions in percent before warning (default 60)")
+	maxHHI := fs.Float64("max-hhi", 0, "Herfindahl index between 0 and 1 before warning (default 0.15)")
+	minBets := fs.Float64("min-bets", 0, "Fewest effective bets before warning (default off)")
+	correlation := fs.Float64("correlation", 0, "Correlation at which positions are clustered (default 0.8)")
+	maxCluster := fs.Float64("max-cluster", 0, "Weight of a correlated cluster in percent before warning (default 40)")
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	limits, err := svc.SetConcentrationLimits(ctx, *portfolioName, portfolio.ConcentrationLimits{
+		MaxPositionPct: *maxPosition, MaxTop5Pct: *maxTop5, MaxHHI: *maxHHI, MinEffectiveBets: *minBets,
+		CorrelationThreshold: *correlation, MaxClusterPct: *maxCluster,
+	})
+	if err != nil {
+		return err
+	}
+	return printJSON(limits)
+}
+
+func runSimulate(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	method := fs.String("method", "bootstrap", "Sampling method (bootstrap or normal)")
+	days := fs.Int("days", 252, "Horizon in trading days")
+	paths := fs.Int("paths", 1000, "Number of simulated paths")
+	seed := fs.Int64("seed", 0, "Random seed (0 picks one; the result reports it)")
+	lookback := fs.Int("lookback-days", 730, "Calendar days of price history to sample")
+	drawdownLimit := fs.Float64("drawdown-limit", 0, "Drawdown from peak in percent to report the probability of hitting")
+	goal := fs.Float64("goal", 0, "Portfolio value to report the probability of reaching")
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	m, err := portfolio.ParseSimulationMethod(*method)
+	if err != nil {
+		return err
+	}
+	result, err := svc.Simulate(ctx, *portfolioName, portfolio.SimulationOptions{
+		Method: m, HorizonDays: *days, Paths: *paths, Seed: *seed, LookbackDays: *lookback,
+		DrawdownLimitPct: *drawdownLimit, GoalValue: *goal,
+	})
+	if err != nil {
+		return err
+	}
+	return printJSON(result)
+}
+
+func runScenarios(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("scenarios", flag.ExitOnError)
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	scenarios, err := svc.ListScenarios(ctx, *portfolioName)
+	if err != nil {
+		return err
+	}
+	return printJSON(scenarios)
+}
+
+func runSaveScenario(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("save-scenario", flag.ExitOnError)
+	name := fs.String("name", "", "Scenario name")
+	description := fs.String("description", "", "What the scenario models")
+	shocks := fs.String("shocks", "", `Shocks such as "tech -30%, BTC -50%, all equities -20%, USD +5%"`)
+	replayFrom := fs.String("replay-from", "", "Start of a historical window to replay (YYYY-MM-DD)")
+	replayTo := fs.String("replay-to", "", "End of the historical window (YYYY-MM-DD)")
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	sc, err := scenarioFromFlags(*shocks, *replayFrom, *replayTo)
+	if err != nil {
+		return err
+	}
+	sc.Name, sc.Description = *name, *description
+	sc, err = svc.SaveScenario(ctx, *portfolioName, sc)
+	if err != nil {
+		return err
+	}
+	return printJSON(sc)
+}
+
+func runRemoveScenario(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("remove-scenario", flag.ExitOnError)
+	name := fs.String("name", "", "Scenario name")
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	if err := svc.RemoveScenario(ctx, *portfolioName, *name); err != nil {
+		return err
+	}
+	fmt.Printf("scenario %s removed\n", *name)
+	return nil
+}
+
+func runStress(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("stress", flag.ExitOnError)
+	name := fs.String("name", "", "Saved scenario to run")
+	shocks := fs.String("shocks", "", "Shocks to run without saving")
+	replayFrom := fs.String("replay-from", "", "Start of a historical window to replay (YYYY-MM-DD)")
+	replayTo := fs.String("replay-to", "", "End of the historical window (YYYY-MM-DD)")
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	var (
+		result portfolio.ScenarioResult
+		err    error
+	)
+	if *name != "" {
+		result, err = svc.RunSavedScenario(ctx, *portfolioName, *name)
+	} else {
+		var sc portfolio.Scenario
+		if sc, err = scenarioFromFlags(*shocks, *replayFrom, *replayTo); err != nil {
+			return err
+		}
+		result, err = svc.RunScenario(ctx, *portfolioName, sc)
+	}
+	if err != nil {
+		return err
+	}
+	return printJSON(result)
+}
+
+// scenarioFromFlags builds a scenario from --shocks and the --replay-from and
+// --replay-to window, which are given together.
+func scenarioFromFlags(shocks, replayFrom, replayTo string) (portfolio.Scenario, error) {
+	sc := portfolio.Scenario{Expression: shocks}
+	if replayFrom == "" && replayTo == "" {
+		return sc, nil
+	}
+	from, err := time.Parse(defaultTimeLayout, replayFrom)
+	if err != nil {
+		return sc, fmt.Errorf("invalid --replay-from: %w", err)
+	}
+	to, err := time.Parse(defaultTimeLayout, replayTo)
+	if err != nil {
+		return sc, fmt.Errorf("invalid --replay-to: %w", err)
+	}
+	sc.Replay = &portfolio.Replay{From: from, To: to}
+	return sc, nil
+}
+
+func runSetRisk(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("set-risk", flag.ExitOnError)
+	riskFree := fs.Float64("risk-free", 0, "Annual risk-free rate in percent")
+	benchmark := fs.String("benchmark", "", "Benchmark ticker for beta and correlation")
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	if err := svc.SetRiskSettings(ctx, *portfolioName, *riskFree, *benchmark); err != nil {
+		return err
+	}
+	fmt.Printf("risk settings for %s updated\n", *portfolioName)
+	return nil
+}
+
+func runHistory(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	fromStr := fs.String("from", "", "Range start (YYYY-MM-DD, default one year ago)")
+	toStr := fs.String("to", "", "Range end (YYYY-MM-DD, default today)")
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	from, to, err := parseRange(*fromStr, *toStr)
+	if err != nil {
+		return err
+	}
+	curve, err := svc.GetHistory(ctx, *portfolioName, from, to)
+	if err != nil {
+		return err
+	}
+	return printJSON(curve)
+}
+
+func runBenchmarks(ctx context.Context, svc *app.PortfolioService, defaultPortfolio, apiKey string, args []string) error {
+	if err := requireAPIKey(apiKey); err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("benchmarks", flag.ExitOnError)
+	tickers := fs.String("tickers", "", "Comma-separated benchmark tickers (default: the portfolio's benchmarks)")
+	fromStr := fs.String("from", "", "Range start (YYYY-MM-DD, default one year ago)")
+	toStr := fs.String("to", "", "Range end (YYYY-MM-DD, default today)")
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	from, to, err := parseRange(*fromStr, *toStr)
+	if err != nil {
+		return err
+	}
+	var list []string
+	if *tickers != "" {
+		list = strings.Split(*tickers, ",")
+	}
+	report, err := svc.CompareBenchmarks(ctx, *portfolioName, list, from, to)
+	if err != nil {
+		return err
+	}
+	return printJSON(report)
+}
+
+func runSetBenchmarks(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("set-benchmarks", flag.ExitOnError)
+	tickers := fs.String("tickers", "", "Comma-separated benchmark tickers, e.g. SPY,QQQ")
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	list := portfolio.NormalizeBenchmarks(strings.Split(*tickers, ","))
+	if err := svc.SetBenchmarks(ctx, *portfolioName, list); err != nil {
+		return err
+	}
+	fmt.Printf("benchmarks for %s set to %s\n", *portfolioName, strings.Join(list, ","))
+	return nil
+}
+
+func runInstruments(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("instruments", flag.ExitOnError)
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	list, err := svc.ListInstruments(ctx, *portfolioName)
+	if err != nil {
+		return err
+	}
+	return printJSON(list)
+}
+
+func runSetInstrument(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("set-instrument", flag.ExitOnError)
+	ticker := fs.String("ticker", "", "Ticker the definition applies to")
+	class := fs.String("class", "equity", "Asset class (equity, etf, fund, bond, crypto)")
+	exchange := fs.String("exchange", "", "Listing exchange (LSE, XETRA, TSX, ...)")
+	currency := fs.String("currency", "", "Quote currency, or the market of a crypto pair")
+	symbols := fs.String("symbols", "", "Provider symbols (PROVIDER:SYMBOL,...), e.g. alphavantage:VOD.LON")
+	name := fs.String("name", "", "Display name")
+	maintenance := fs.Float64("maintenance", 0, "Margin maintenance requirement in percent (default the account's)")
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	c, err := portfolio.ParseAssetClass(*class)
+	if err != nil {
+		return err
+	}
+	m, err := parseSymbols(*symbols)
+	if err != nil {
+		return err
+	}
+	inst, err := svc.SetInstrument(ctx, *portfolioName, portfolio.Instrument{
+		Ticker: *ticker, Name: *name, AssetClass: c, Exchange: *exchange, Currency: *currency, Symbols: m,
+		MaintenancePct: *maintenance,
+	})
+	if err != nil {
+		return err
+	}
+	return printJSON(inst)
+}
+
+func parseSymbols(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	m := make(map[string]string)
+	for _, part := range strings.Split(s, ",") {
+		provider, symbol, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok || provider == "" || symbol == "" {
+			return nil, fmt.Errorf("invalid provider symbol %q, want PROVIDER:SYMBOL", part)
+		}
+		m[provider] = symbol
+	}
+	return m, nil
+}
+
+func runRemoveInstrument(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("remove-instrument", flag.ExitOnError)
+	ticker := fs.String("ticker", "", "Ticker whose definition to remove")
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	return svc.RemoveInstrument(ctx, *portfolioName, *ticker)
+}
+
+func runAlerts(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("alerts", flag.ExitOnError)
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	rules, err := svc.ListAlerts(ctx, *portfolioName)
+	if err != nil {
+		return err
+	}
+	return printJSON(rules)
+}
+
+func runAddAlert(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("add-alert", flag.ExitOnError)
+	kind := fs.String("kind", "", "Rule kind (trailing-stop, stop-price, target-price, portfolio-drawdown, recovery-needed)")
+	ticker := fs.String("ticker", "", "Position the rule watches (omit for portfolio rules)")
+	threshold := fs.Float64("threshold", 0, "Percent for drawdown rules, price for stop and target rules")
+	note := fs.String("note", "", "Free-text note included with the rule")
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	k, err := portfolio.ParseAlertKind(*kind)
+	if err != nil {
+		return err
+	}
+	rule, err := svc.AddAlert(ctx, *portfolioName, portfolio.AlertRule{Kind: k, Ticker: *ticker, Threshold: *threshold, Note: *note})
+	if err != nil {
+		return err
+	}
+	return printJSON(rule)
+}
+
+func runRemoveAlert(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("remove-alert", flag.ExitOnError)
+	id := fs.String("id", "", "Alert ID to remove")
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	if err := svc.RemoveAlert(ctx, *portfolioName, *id); err != nil {
+		return err
+	}
+	fmt.Printf("alert %s removed from %s\n", *id, *portfolioName)
+	return nil
+}
+
+// watchlistOwner is the portfolio holding the watchlists a command targets.
+func watchlistOwner(portfolioName string, global bool) string {
+	if global {
+		return app.GlobalWatchlists
+	}
+	return portfolioName
+}
+
+func runWatch(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	ticker := fs.String("ticker", "", "Ticker to watch")
+	list := fs.String("list", "default", "Watchlist name")
+	global := fs.Bool("global", false, "Use the watchlists shared by all portfolios")
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	item, err := svc.Watch(ctx, watchlistOwner(*portfolioName, *global), *list, *ticker)
+	if err != nil {
+		return err
+	}
+	return printJSON(item)
+}
+
+func runUnwatch(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("unwatch", flag.ExitOnError)
+	ticker := fs.String("ticker", "", "Ticker to remove")
+	list := fs.String("list", "default", "Watchlist name")
+	all := fs.Bool("all", false, "Remove the whole watchlist")
+	global := fs.Bool("global", false, "Use the watchlists shared by all portfolios")
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	if (*ticker == "") == !*all {
+		return errors.New("exactly one of --ticker or --all is required")
+	}
+	owner := watchlistOwner(*portfolioName, *global)
+	if err := svc.Unwatch(ctx, owner, *list, *ticker); err != nil {
+		return err
+	}
+	if *all {
+		fmt.Printf("watchlist %s removed from %s\n", *list, owner)
+	} else {
+		fmt.Printf("%s removed from watchlist %s\n", strings.ToUpper(*ticker), *list)
+	}
+	return nil
+}
+
+func runWatchlists(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("watchlists", flag.ExitOnError)
+	list := fs.String("list", "", "Only this watchlist")
+	global := fs.Bool("global", false, "Use the watchlists shared by all portfolios")
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	lists, err := svc.GetWatchlists(ctx, watchlistOwner(*portfolioName, *global), *list)
+	if err != nil {
+		return err
+	}
+	return printJSON(lists)
+}
+
+func runSetTarget(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("set-target", flag.ExitOnError)
+	ticker := fs.String("ticker", "", "Ticker the target applies to")
+	tag := fs.String("tag", "", "Tag the target applies to (instead of --ticker)")
+	weight := fs.Float64("weight", 0, "Target weight in percent (0 removes the target)")
+	band := fs.Float64("band", 0, "Tolerance band in percentage points")
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	target := portfolio.AllocationTarget{Ticker: *ticker, Tag: *tag, WeightPct: *weight, BandPct: *band}
+	if err := svc.SetTarget(ctx, *portfolioName, target); err != nil {
+		return err
+	}
+	a, err := svc.GetAllocation(ctx, *portfolioName)
+	if err != nil {
+		return err
+	}
+	return printJSON(a)
+}
+
+func runTagTicker(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("tag-ticker", flag.ExitOnError)
+	ticker := fs.String("ticker", "", "Ticker to tag")
+	tag := fs.String("tag", "", "Allocation tag such as an asset class (empty clears it)")
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	if *ticker == "" {
+		return errors.New("--ticker is required")
+	}
+	if err := svc.TagTicker(ctx, *portfolioName, *ticker, *tag); err != nil {
+		return err
+	}
+	fmt.Printf("%s tagged %q in %s\n", strings.ToUpper(*ticker), *tag, *portfolioName)
+	return nil
+}
+
+func runTargets(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("targets", flag.ExitOnError)
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	a, err := svc.GetAllocation(ctx, *portfolioName)
+	if err != nil {
+		return err
+	}
+	return printJSON(a)
+}
+
+func runRebalance(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("rebalance", flag.ExitOnError)
+	newCash := fs.Float64("new-cash", 0, "Additional cash to invest")
+	cashOnly := fs.Bool("cash-only", false, "Only buy with available cash, never sell")
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	plan, err := svc.GetRebalancePlan(ctx, *portfolioName, portfolio.RebalanceOptions{NewCash: portfolio.NewDecimal(*newCash), CashOnly: *cashOnly})
+	if err != nil {
+		return err
+	}
+	return printJSON(plan)
+}
+
+func runReturns(ctx context.Context, svc *app.PortfolioService, defaultPortfolio, apiKey string, args []string) error {
+	if err := requireAPIKey(apiKey); err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("returns", flag.ExitOnError)
+	fromStr := fs.String("from", "", "Range start (YYYY-MM-DD, default one year ago)")
+	toStr := fs.String("to", "", "Range end (YYYY-MM-DD, default today)")
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	from, to, err := parseRange(*fromStr, *toStr)
+	if err != nil {
+		return err
+	}
+	report, err := svc.GetReturns(ctx, *portfolioName, from, to)
+	if err != nil {
+		return err
+	}
+	return printJSON(report)
+}
+
+// parseRange parses --from/--to, defaulting to the year ending today. The end
+// date is inclusive.
+func parseRange(fromStr, toStr string) (from, to time.Time, err error) {
+	to = time.Now()
+	if toStr != "" {
+		if to, err = time.Parse(defaultTimeLayout, toStr); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid --to: %w", err)
+		}
+		to = to.Add(24*time.Hour - time.Nanosecond)
+	}
+	from = to.AddDate(-1, 0, 0)
+	if fromStr != "" {
+		if from, err = time.Parse(defaultTimeLayout, fromStr); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid --from: %w", err)
+		}
+	}
+	return from, to, nil
+}
+
+func runTaxReport(ctx context.Context, svc *app.PortfolioService, defaultPortfolio string, args []string) error {
+	fs := flag.NewFlagSet("tax-report", flag.ExitOnError)
+	year := fs.Int("year", time.Now().Year(), "Tax year")
+	format := fs.String("format", "json", "Output format (json or csv for Form 8949 rows)")
+	portfolioName := fs.String("portfolio", defaultPortfolio, "Portfolio to target")
+	_ = fs.Parse(args)
+
+	report, err := svc.GetTaxReport(ctx, *portfolioName, *year)
+	if err != nil {
+		return err
+	}
+	switch *format {
+	case "json":
+		return printJSON(report)
+	case "csv":
+		return portfolio.WriteForm8949CSV(os.Stdout, report)
+	default:
+		return fmt.Errorf("unsupported format %q", *format)
+	}
+}
+
+func parseLotSelections(s string) ([]portfolio.LotSelection, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var lots []portfolio.LotSelection
+	for _, part := range strings.Split(s, ",") {
+		id, qty, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid lot selection %q, want LOT_ID:QTY", part)
+		}
+		q, err := portfolio.ParseDecimal(qty)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quantity in lot selection %q: %w", part, err)
+		}
+		lots = append(lots, portfolio.LotSelection{LotID: id, Quantity: q})
+	}
+	return lots, nil
+}
+
 func runUpdatePrices(ctx context.Context, svc *app.PortfolioService, defaultPortfolio, apiKey string, args []string) error {
 	if err := requireAPIKey(apiKey); err != nil {
 		return err
@@ -201,16 +1214,22 @@ func runCreatePortfolio(ctx context.Context, svc *app.PortfolioService, args []s
 	fs := flag.NewFlagSet("create-portfolio", flag.ExitOnError)
 	name := fs.String("name", "", "Portfolio name")
 	cash := fs.Float64("cash", defaultCash, "Starting cash")
+	currency := fs.String("currency", "", "Base currency (default USD)")
 	_ = fs.Parse(args)
 
 	if *name == "" {
 		return errors.New("--name is required")
 	}
 
-	_, err := svc.CreatePortfolio(ctx, *name, *cash)
+	_, err := svc.CreatePortfolio(ctx, *name, portfolio.NewDecimal(*cash))
 	if err != nil {
 		return err
 	}
+	if *currency != "" {
+		if err := svc.SetBaseCurrency(ctx, *name, *currency); err != nil {
+			return err
+		}
+	}
 	fmt.Printf("portfolio %s created\n", *name)
 	return nil
 }
@@ -265,6 +1284,14 @@ func selectPricer(apiKey string) ports.PriceProvider {
 	return alphavantage.New(apiKey)
 }
 
+func serviceOptions(apiKey string) []app.Option {
+	if apiKey == "" {
+		return nil
+	}
+	client := alphavantage.New(apiKey)
+	return []app.Option{app.WithFXRates(client), app.WithPriceHistory(client), app.WithSplitDetection(client), app.WithDividendImport(client)}
+}
+
 func requireAPIKey(apiKey string) error {
 	if apiKey == "" {
 		return errors.New("set ALPHAVANTAGE_API_KEY for this command")
@@ -278,11 +1305,93 @@ func usage() {
 	fmt.Fprintln(os.Stderr, "  metrics [--portfolio NAME]                    Show portfolio metrics")
 	fmt.Fprintln(os.Stderr, "  positions [--portfolio NAME]                  List all positions")
 	fmt.Fprintln(os.Stderr, "  position --ticker TICKER [--portfolio NAME]   Show a single position")
-	fmt.Fprintln(os.Stderr, "  add-position --ticker T --shares N --price P [--cost C] [--entry YYYY-MM-DD] [--portfolio NAME]")
+	fmt.Fprintln(os.Stderr, "  add-position --ticker T --shares N --price P [--cost C] [--entry YYYY-MM-DD] [--short] [--portfolio NAME]")
 	fmt.Fprintln(os.Stderr, "                                                Add or update a position")
+	fmt.Fprintln(os.Stderr, "  record-trade --type TYPE [--ticker T] [--quantity N] [--price P] [--amount A] [--ratio R] [--new-ticker T] [--reinvest] [--currency C] [--fx-rate R]")
+	fmt.Fprintln(os.Stderr, "               [--commission C] [--exchange-fee F] [--regulatory-fee F]")
+	fmt.Fprintln(os.Stderr, "               [--lots ID:QTY,...] [--date YYYY-MM-DD] [--note TEXT] [--tags T,...] [--strategy S] [--portfolio NAME]")
+	fmt.Fprintln(os.Stderr, "               [--underlying U --strike K --expiry YYYY-MM-DD --right call|put [--multiplier M]]")
+	fmt.Fprintln(os.Stderr, "                                                Record a ledger transaction")
+	fmt.Fprintln(os.Stderr, "  expire-options [--portfolio NAME]             Settle expired options: worthless at zero, in-the-money in cash")
+	fmt.Fprintln(os.Stderr, "  transactions [--ticker T] [--portfolio NAME]  List ledger transactions")
+	fmt.Fprintln(os.Stderr, "  corporate-actions [--portfolio NAME]          List recorded splits and renames")
+	fmt.Fprintln(os.Stderr, "  journal [--tag T] [--strategy S] [--ticker T] [--portfolio NAME]")
+	fmt.Fprintln(os.Stderr, "                                                List annotated positions and trades")
+	fmt.Fprintln(os.Stderr, "  annotate (--ticker T | --tx ID) [--note TEXT] [--tags T,...] [--strategy S] [--portfolio NAME]")
+	fmt.Fprintln(os.Stderr, "                                                Replace the note, tags and strategy of a position or trade")
+	fmt.Fprintln(os.Stderr, "  journal-stats [--by tag|strategy] [--portfolio NAME]")
+	fmt.Fprintln(os.Stderr, "                                                P&L and win rate per tag or strategy")
+	fmt.Fprintln(os.Stderr, "  income [--from YYYY-MM-DD] [--to YYYY-MM-DD] [--portfolio NAME]")
+	fmt.Fprintln(os.Stderr, "                                                Dividend income by ticker and month, TTM and yields")
+	fmt.Fprintln(os.Stderr, "  fees [--from YYYY-MM-DD] [--to YYYY-MM-DD] [--portfolio NAME]")
+	fmt.Fprintln(os.Stderr, "                                                Trade and account fees with fee drag per position")
+	fmt.Fprintln(os.Stderr, "  margin [--portfolio NAME]                     Margin loan, leverage, buying power and margin-call distance")
+	fmt.Fprintln(os.Stderr, "  set-margin [--initial PCT] [--maintenance PCT] [--short-maintenance PCT] [--rate PCT] [--disable] [--portfolio NAME]")
+	fmt.Fprintln(os.Stderr, "                                                Open or update the margin account")
+	fmt.Fprintln(os.Stderr, "  accrue-interest [--portfolio NAME]            Accrue margin interest and post ended months")
+	fmt.Fprintln(os.Stderr, "  import-dividends [--since YYYY-MM-DD] [--portfolio NAME]")
+	fmt.Fprintln(os.Stderr, "                                                Record dividends from AlphaVantage (requires ALPHAVANTAGE_API_KEY)")
+	fmt.Fprintln(os.Stderr, "  set-drip --enabled=true|false [--portfolio NAME]")
+	fmt.Fprintln(os.Stderr, "                                                Reinvest imported dividends instead of crediting cash")
+	fmt.Fprintln(os.Stderr, "  realized [--ticker T] [--portfolio NAME]      Show realized gain per sale")
+	fmt.Fprintln(os.Stderr, "  history [--from YYYY-MM-DD] [--to YYYY-MM-DD] [--portfolio NAME]")
+	fmt.Fprintln(os.Stderr, "                                                Stored equity curve with high-water mark")
+	fmt.Fprintln(os.Stderr, "  risk [--portfolio NAME]                       Volatility, Sharpe, Sortino, max drawdown and beta")
+	fmt.Fprintln(os.Stderr, "  recovery [--return PCT] [--by YYYY-MM-DD] [--portfolio NAME]")
+	fmt.Fprintln(os.Stderr, "                                                Time to recover drawdowns, return needed by a date, probability")
+	fmt.Fprintln(os.Stderr, "  concentration [--portfolio NAME]              Position weights, HHI, correlation matrix and clusters")
+	fmt.Fprintln(os.Stderr, "  set-concentration [--max-position PCT] [--max-top5 PCT] [--max-hhi H] [--min-bets N]")
+	fmt.Fprintln(os.Stderr, "                    [--correlation C] [--max-cluster PCT] [--portfolio NAME]")
+	fmt.Fprintln(os.Stderr, "                                                Set the thresholds metrics warn above")
+	fmt.Fprintln(os.Stderr, "  simulate [--days N] [--paths N] [--seed S] [--method bootstrap|normal] [--lookback-days N]")
+	fmt.Fprintln(os.Stderr, "           [--drawdown-limit PCT] [--goal VALUE] [--portfolio NAME]")
+	fmt.Fprintln(os.Stderr, "                                                Monte Carlo value bands, drawdown and goal probabilities")
+	fmt.Fprintln(os.Stderr, "  scenarios [--portfolio NAME]                  List saved stress scenarios")
+	fmt.Fprintln(os.Stderr, "  save-scenario --name N [--shocks \"tech -30%, USD +5%\"] [--replay-from YYYY-MM-DD --replay-to YYYY-MM-DD]")
+	fmt.Fprintln(os.Stderr, "                [--description D] [--portfolio NAME]")
+	fmt.Fprintln(os.Stderr, "                                                Save a named scenario of shocks and/or a historical replay")
+	fmt.Fprintln(os.Stderr, "  remove-scenario --name N [--portfolio NAME]   Delete a saved scenario")
+	fmt.Fprintln(os.Stderr, "  stress (--name N | [--shocks S] [--replay-from YYYY-MM-DD --replay-to YYYY-MM-DD]) [--portfolio NAME]")
+	fmt.Fprintln(os.Stderr, "                                                Value, per-position loss, drawdown and recovery under a scenario")
+	fmt.Fprintln(os.Stderr, "  set-risk [--risk-free PCT] [--benchmark T] [--portfolio NAME]")
+	fmt.Fprintln(os.Stderr, "                                                Set the risk-free rate and benchmark")
+	fmt.Fprintln(os.Stderr, "  benchmarks [--tickers T,...] [--from YYYY-MM-DD] [--to YYYY-MM-DD] [--portfolio NAME]")
+	fmt.Fprintln(os.Stderr, "                                                Compare against benchmarks (requires ALPHAVANTAGE_API_KEY)")
+	fmt.Fprintln(os.Stderr, "  set-benchmarks --tickers T,... [--portfolio NAME]")
+	fmt.Fprintln(os.Stderr, "                                                Declare the portfolio's benchmark tickers")
+	fmt.Fprintln(os.Stderr, "  instruments [--portfolio NAME]                List instrument definitions")
+	fmt.Fprintln(os.Stderr, "  set-instrument --ticker T [--class C] [--exchange X] [--currency CCY]")
+	fmt.Fprintln(os.Stderr, "                 [--symbols PROVIDER:SYMBOL,...] [--name N] [--maintenance PCT] [--portfolio NAME]")
+	fmt.Fprintln(os.Stderr, "                                                Register how a ticker is classified and quoted")
+	fmt.Fprintln(os.Stderr, "  remove-instrument --ticker T [--portfolio NAME]")
+	fmt.Fprintln(os.Stderr, "                                                Remove an instrument definition")
+	fmt.Fprintln(os.Stderr, "  alerts [--portfolio NAME]                     List alert rules and their state")
+	fmt.Fprintln(os.Stderr, "  add-alert --kind KIND [--ticker T] --threshold N [--note TEXT] [--portfolio NAME]")
+	fmt.Fprintln(os.Stderr, "                                                Add an alert rule checked after every price refresh")
+	fmt.Fprintln(os.Stderr, "  remove-alert --id ID [--portfolio NAME]       Remove an alert rule")
+	fmt.Fprintln(os.Stderr, "  watch --ticker T [--list L] [--global] [--portfolio NAME]")
+	fmt.Fprintln(os.Stderr, "                                                Add a ticker to a watchlist")
+	fmt.Fprintln(os.Stderr, "  unwatch (--ticker T | --all) [--list L] [--global] [--portfolio NAME]")
+	fmt.Fprintln(os.Stderr, "                                                Remove a ticker or a whole watchlist")
+	fmt.Fprintln(os.Stderr, "  watchlists [--list L] [--global] [--portfolio NAME]")
+	fmt.Fprintln(os.Stderr, "                                                Show watched prices, change since added and 52-week high")
+	fmt.Fprintln(os.Stderr, "  set-target (--ticker T | --tag TAG) --weight PCT [--band PCT] [--portfolio NAME]")
+	fmt.Fprintln(os.Stderr, "                                                Set a target weight (0 removes it)")
+	fmt.Fprintln(os.Stderr, "  tag-ticker --ticker T --tag TAG [--portfolio NAME]")
+	fmt.Fprintln(os.Stderr, "                                                Tag a ticker for tag targets")
+	fmt.Fprintln(os.Stderr, "  targets [--portfolio NAME]                    Show target weights and tags")
+	fmt.Fprintln(os.Stderr, "  rebalance [--new-cash N] [--cash-only] [--portfolio NAME]")
+	fmt.Fprintln(os.Stderr, "                                                Plan trades that bring weights back to target")
+	fmt.Fprintln(os.Stderr, "  returns [--from YYYY-MM-DD] [--to YYYY-MM-DD] [--portfolio NAME]")
+	fmt.Fprintln(os.Stderr, "                                                Time- and money-weighted returns (requires ALPHAVANTAGE_API_KEY)")
+	fmt.Fprintln(os.Stderr, "  tax-report [--year YYYY] [--format json|csv] [--portfolio NAME]")
+	fmt.Fprintln(os.Stderr, "                                                Short/long-term gains summary or Form 8949 CSV")
+	fmt.Fprintln(os.Stderr, "  set-lot-method --method M [--portfolio NAME]  Set lot matching (fifo, lifo, highest-cost, specific)")
 	fmt.Fprintln(os.Stderr, "  update-prices [--portfolio NAME]              Refresh prices via AlphaVantage (requires ALPHAVANTAGE_API_KEY)")
-	fmt.Fprintln(os.Stderr, "  recompute-peaks [--portfolio NAME]            Recompute historical peaks (requires ALPHAVANTAGE_API_KEY)")
-	fmt.Fprintln(os.Stderr, "  create-portfolio --name NAME [--cash AMOUNT]  Create a new portfolio")
+	fmt.Fprintln(os.Stderr, "  recompute-peaks [--portfolio NAME]            Record detected splits and recompute historical peaks")
+	fmt.Fprintln(os.Stderr, "                                                (requires ALPHAVANTAGE_API_KEY)")
+	fmt.Fprintln(os.Stderr, "  create-portfolio --name NAME [--cash AMOUNT] [--currency CCY]")
+	fmt.Fprintln(os.Stderr, "                                                Create a new portfolio")
 	fmt.Fprintln(os.Stderr, "  list-portfolios                               List existing portfolios")
 	fmt.Fprintln(os.Stderr, "  remove-portfolio --name NAME                  Delete a portfolio file")
 	fmt.Fprintln(os.Stderr)
@@ -24,11 +24,11 @@ func newCLITestService(t *testing.T) (*app.PortfolioService, string) {
 	svc := app.NewPortfolioService(storeInfo.Store, noopPricer{})
 	ctx := context.Background()
 	portfolioName := "CLI"
-	if _, err := svc.CreatePortfolio(ctx, portfolioName, 1000); err != nil {
+	if _, err := svc.CreatePortfolio(ctx, portfolioName, portfolio.NewDecimal(1000)); err != nil {
 		t.Fatalf("CreatePortfolio: %v", err)
 	}
 
-	pos := &portfolio.Position{Ticker: "MSFT", Shares: 5, CostBasis: 500, CurrentPrice: 250}
+	pos := &portfolio.Position{Ticker: "MSFT", Shares: portfolio.NewDecimal(5), CostBasis: portfolio.NewDecimal(500), CurrentPrice: 250}
 	pos.UpdatePrice(pos.CurrentPrice)
 	if err := svc.AddOrUpdatePosition(ctx, portfolioName, pos); err != nil {
 		t.Fatalf("AddOrUpdatePosition: %v", err)
@@ -91,3 +91,26 @@ func TestRunUpdatePricesRequiresAPIKey(t *testing.T) {
                 t.Fatalf("expected API key error, got %v", err)
         }
 }
+
+func TestRunRecordTrade(t *testing.T) {
+	svc, portfolioName := newCLITestService(t)
+
+	out := captureOutput(t, func() {
+		args := []string{"--type", "buy", "--ticker", "AMD", "--quantity", "4", "--price", "150", "--date", "2024-01-02"}
+		if err := runRecordTrade(context.Background(), svc, portfolioName, args); err != nil {
+			t.Fatalf("runRecordTrade: %v", err)
+		}
+	})
+	if !strings.Contains(out, `"ticker": "AMD"`) {
+		t.Fatalf("expected recorded transaction, got %q", out)
+	}
+
+	out = captureOutput(t, func() {
+		if err := runTransactions(context.Background(), svc, portfolioName, []string{"--ticker", "AMD"}); err != nil {
+			t.Fatalf("runTransactions: %v", err)
+		}
+	})
+	if !strings.Contains(out, `"type": "buy"`) {
+		t.Fatalf("expected transaction list, got %q", out)
+	}
+}
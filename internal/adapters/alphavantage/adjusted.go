@@ -0,0 +1,114 @@
+package alphavantage
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"tracktrades/internal/domain/portfolio"
+)
+
+// adjustedBar is one day of TIME_SERIES_DAILY_ADJUSTED. High and Low are as
+// traded; Factor is the product of the split coefficients after the day, so
+// High / Factor is in today's shares.
+type adjustedBar struct {
+	Date     time.Time
+	High     float64
+	Low      float64
+	Close    float64
+	Dividend float64
+	Split    float64
+	Factor   float64
+}
+
+// dailyAdjusted fetches the full adjusted daily series for pos, oldest first.
+func (c *Client) dailyAdjusted(ctx context.Context, pos *portfolio.Position) ([]adjustedBar, error) {
+	data, err := c.query(ctx, url.Values{
+		"function":   {"TIME_SERIES_DAILY_ADJUSTED"},
+		"symbol":     {symbol(pos)},
+		"outputsize": {"full"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	series, _ := data["Time Series (Daily)"].(map[string]interface{})
+	if series == nil {
+		return nil, fmt.Errorf("no adjusted series in response for %s", pos.Ticker)
+	}
+
+	bars := make([]adjustedBar, 0, len(series))
+	for ds, raw := range series {
+		d, err := time.Parse("2006-01-02", ds)
+		if err != nil {
+			continue
+		}
+		day, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		bar := adjustedBar{Date: d, Split: 1}
+		bar.High = parseField(day, "2. high")
+		bar.Low = parseField(day, "3. low")
+		bar.Close = parseField(day, "4. close")
+		bar.Dividend = parseField(day, "7. dividend amount")
+		if s := parseField(day, "8. split coefficient"); s > 0 {
+			bar.Split = s
+		}
+		bars = append(bars, bar)
+	}
+	sort.Slice(bars, func(i, j int) bool { return bars[i].Date.Before(bars[j].Date) })
+
+	factor := 1.0
+	for i := len(bars) - 1; i >= 0; i-- {
+		bars[i].Factor = factor
+		factor *= bars[i].Split
+	}
+	return bars, nil
+}
+
+// Splits reports the splits of pos since the given date from the split
+// coefficients of the adjusted daily series. Crypto and options have none.
+func (c *Client) Splits(ctx context.Context, pos *portfolio.Position, since time.Time) ([]portfolio.SplitEvent, error) {
+	if pos.Option != nil || pos.IsCrypto() {
+		return nil, nil
+	}
+	bars, err := c.dailyAdjusted(ctx, pos)
+	if err != nil {
+		return nil, err
+	}
+	var events []portfolio.SplitEvent
+	for _, bar := range bars {
+		if bar.Split != 1 && !bar.Date.Before(since) {
+			events = append(events, portfolio.SplitEvent{Ticker: pos.Ticker, Date: bar.Date, Ratio: portfolio.NewDecimal(bar.Split)})
+		}
+	}
+	return events, nil
+}
+
+// Dividends reports cash dividends per share of pos with an ex-date on or
+// after since, from the dividend amounts of the adjusted daily series.
+func (c *Client) Dividends(ctx context.Context, pos *portfolio.Position, since time.Time) ([]portfolio.DividendEvent, error) {
+	if pos.Option != nil || pos.IsCrypto() {
+		return nil, nil
+	}
+	bars, err := c.dailyAdjusted(ctx, pos)
+	if err != nil {
+		return nil, err
+	}
+	var events []portfolio.DividendEvent
+	for _, bar := range bars {
+		if bar.Dividend > 0 && !bar.Date.Before(since) {
+			events = append(events, portfolio.DividendEvent{Ticker: pos.Ticker, ExDate: bar.Date, PerShare: bar.Dividend, Price: bar.Close})
+		}
+	}
+	return events, nil
+}
+
+func parseField(day map[string]interface{}, key string) float64 {
+	s, _ := day[key].(string)
+	v, _ := strconv.ParseFloat(s, 64)
+	return v
+}
@@ -1,6 +1,13 @@
 package alphavantage
 
-import "tracktrades/internal/ports"
+import (
+	"errors"
+
+	"tracktrades/internal/ports"
+)
+
+// errNoOptionQuotes is returned for option positions, which AlphaVantage does not quote.
+var errNoOptionQuotes = errors.New("option quotes are not available from AlphaVantage")
 
 type Client struct {
 	APIKey string
@@ -10,4 +17,10 @@ func New(apiKey string) *Client {
 	return &Client{APIKey: apiKey}
 }
 
-var _ ports.PriceProvider = (*Client)(nil)
+var (
+	_ ports.PriceProvider        = (*Client)(nil)
+	_ ports.FXRateProvider       = (*Client)(nil)
+	_ ports.PriceHistoryProvider = (*Client)(nil)
+	_ ports.SplitProvider        = (*Client)(nil)
+	_ ports.DividendProvider     = (*Client)(nil)
+)
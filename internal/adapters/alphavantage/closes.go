@@ -0,0 +1,65 @@
+package alphavantage
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"tracktrades/internal/domain/portfolio"
+)
+
+// DailyCloses returns no closes for options, so valuations fall back to their traded prices.
+func (c *Client) DailyCloses(ctx context.Context, pos *portfolio.Position, from, to time.Time) ([]portfolio.PricePoint, error) {
+	if pos.Option != nil {
+		return nil, nil
+	}
+	params := url.Values{
+		"function":   {"TIME_SERIES_DAILY"},
+		"symbol":     {symbol(pos)},
+		"outputsize": {"full"},
+	}
+	seriesKey := "Time Series (Daily)"
+	closeKeys := []string{"4. close"}
+	if pos.IsCrypto() {
+		params.Set("function", "DIGITAL_CURRENCY_DAILY")
+		params.Set("market", pos.QuoteCurrency())
+		seriesKey = "Time Series (Digital Currency Daily)"
+		closeKeys = []string{"4a. close (" + pos.QuoteCurrency() + ")", "4. close"}
+	}
+
+	data, err := c.query(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	series, _ := data[seriesKey].(map[string]interface{})
+	if series == nil {
+		return nil, fmt.Errorf("no historical series in response for %s", pos.Ticker)
+	}
+
+	var points []portfolio.PricePoint
+	for ds, raw := range series {
+		d, err := time.Parse("2006-01-02", ds)
+		if err != nil || d.Before(from) || d.After(to) {
+			continue
+		}
+		day, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, key := range closeKeys {
+			cs, ok := day[key].(string)
+			if !ok {
+				continue
+			}
+			if v, err := strconv.ParseFloat(cs, 64); err == nil && v > 0 {
+				points = append(points, portfolio.PricePoint{Date: d, Close: v})
+			}
+			break
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Date.Before(points[j].Date) })
+	return points, nil
+}
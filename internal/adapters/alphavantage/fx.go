@@ -0,0 +1,112 @@
+package alphavantage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (c *Client) Rate(ctx context.Context, from, to string) (float64, error) {
+	if strings.EqualFold(from, to) {
+		return 1, nil
+	}
+
+	data, err := c.query(ctx, url.Values{
+		"function":      {"CURRENCY_EXCHANGE_RATE"},
+		"from_currency": {from},
+		"to_currency":   {to},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var rate float64
+	if r, ok := data["Realtime Currency Exchange Rate"].(map[string]interface{}); ok {
+		if s, ok := r["5. Exchange Rate"].(string); ok {
+			rate, _ = strconv.ParseFloat(s, 64)
+		}
+	}
+	if rate <= 0 {
+		return 0, fmt.Errorf("no exchange rate found in response for %s/%s", from, to)
+	}
+	return rate, nil
+}
+
+// HistoricalRate returns the FX_DAILY close on the given date, or the most recent
+// close before it when markets were shut.
+func (c *Client) HistoricalRate(ctx context.Context, from, to string, on time.Time) (float64, error) {
+	if strings.EqualFold(from, to) {
+		return 1, nil
+	}
+
+	data, err := c.query(ctx, url.Values{
+		"function":    {"FX_DAILY"},
+		"from_symbol": {from},
+		"to_symbol":   {to},
+		"outputsize":  {"full"},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	series, _ := data["Time Series FX (Daily)"].(map[string]interface{})
+	if series == nil {
+		return 0, fmt.Errorf("no FX series in response for %s/%s", from, to)
+	}
+
+	var best time.Time
+	var rate float64
+	for ds, raw := range series {
+		d, err := time.Parse("2006-01-02", ds)
+		if err != nil || d.After(on) || d.Before(best) {
+			continue
+		}
+		day, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		cs, _ := day["4. close"].(string)
+		if v, err := strconv.ParseFloat(cs, 64); err == nil && v > 0 {
+			best, rate = d, v
+		}
+	}
+	if rate <= 0 {
+		return 0, fmt.Errorf("no %s/%s rate on or before %s", from, to, on.Format("2006-01-02"))
+	}
+	return rate, nil
+}
+
+// query performs an AlphaVantage request and decodes the JSON body.
+func (c *Client) query(ctx context.Context, params url.Values) (map[string]interface{}, error) {
+	params.Set("apikey", c.APIKey)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		"https://www.alphavantage.co/query?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var data map[string]interface{}
+	_ = json.Unmarshal(body, &data)
+
+	if note, ok := data["Note"].(string); ok {
+		return nil, fmt.Errorf("API limit: %s", note)
+	}
+	return data, nil
+}
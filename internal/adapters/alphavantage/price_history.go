@@ -2,100 +2,95 @@ package alphavantage
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"net/url"
-	"strconv"
 	"time"
 
 	"tracktrades/internal/domain/portfolio"
 )
 
+// ComputeHistoricalPeak sets PeakPrice to the highest high since entry, or the
+// lowest low for shorts. Stock highs and lows are split-adjusted to today's
+// shares so a split since entry does not leave a pre-split peak behind.
 func (c *Client) ComputeHistoricalPeak(ctx context.Context, pos *portfolio.Position) error {
+	if pos.Option != nil {
+		return fmt.Errorf("%s: %w", pos.Ticker, errNoOptionQuotes)
+	}
 	if pos.EntryDate.IsZero() {
 		return fmt.Errorf("entry date missing for %s", pos.Ticker)
 	}
 
-	function := "TIME_SERIES_DAILY"
-	if pos.IsCrypto() {
-		function = "DIGITAL_CURRENCY_DAILY"
-	}
-
-	params := url.Values{
-		"function":   {function},
-		"symbol":     {pos.SymbolBase()},
-		"apikey":     {c.APIKey},
-		"outputsize": {"full"},
-	}
+	var bars []adjustedBar
+	var err error
 	if pos.IsCrypto() {
-		params.Set("market", "USD")
+		bars, err = c.cryptoDaily(ctx, pos)
+	} else {
+		bars, err = c.dailyAdjusted(ctx, pos)
 	}
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
-		"https://www.alphavantage.co/query?"+params.Encode(), nil)
 	if err != nil {
 		return err
 	}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
-	}
-	body, err := io.ReadAll(resp.Body)
-	resp.Body.Close()
-	if err != nil {
-		return err
+	better := func(v, best float64) bool { return v > best }
+	if pos.IsShort() {
+		better = func(v, best float64) bool { return v > 0 && (best <= 0 || v < best) }
 	}
 
-	var data map[string]interface{}
-	_ = json.Unmarshal(body, &data)
-
-	if note, ok := data["Note"].(string); ok {
-		return fmt.Errorf("API limit: %s", note)
+	best := pos.PeakPrice
+	if better(pos.CurrentPrice, best) {
+		best = pos.CurrentPrice
+	}
+	for _, bar := range bars {
+		if bar.Date.Before(pos.EntryDate) {
+			continue
+		}
+		v := bar.High
+		if pos.IsShort() {
+			v = bar.Low
+		}
+		if v /= bar.Factor; better(v, best) {
+			best = v
+		}
 	}
 
-	var series map[string]interface{}
-	if pos.IsCrypto() {
-		series, _ = data["Time Series (Digital Currency Daily)"].(map[string]interface{})
-	} else {
-		series, _ = data["Time Series (Daily)"].(map[string]interface{})
+	pos.PeakPrice = best
+	pos.UpdatePrice(pos.CurrentPrice)
+	return nil
+}
+
+// cryptoDaily fetches the daily highs and lows of a crypto pair, which never split.
+func (c *Client) cryptoDaily(ctx context.Context, pos *portfolio.Position) ([]adjustedBar, error) {
+	data, err := c.query(ctx, url.Values{
+		"function":   {"DIGITAL_CURRENCY_DAILY"},
+		"symbol":     {symbol(pos)},
+		"market":     {pos.QuoteCurrency()},
+		"outputsize": {"full"},
+	})
+	if err != nil {
+		return nil, err
 	}
+	series, _ := data["Time Series (Digital Currency Daily)"].(map[string]interface{})
 	if series == nil {
-		return fmt.Errorf("no historical series in response for %s", pos.Ticker)
-	}
-
-	maxPrice := pos.PeakPrice
-	if maxPrice < pos.CurrentPrice {
-		maxPrice = pos.CurrentPrice
+		return nil, fmt.Errorf("no historical series in response for %s", pos.Ticker)
 	}
 
+	bars := make([]adjustedBar, 0, len(series))
 	for ds, raw := range series {
 		d, err := time.Parse("2006-01-02", ds)
-		if err != nil || d.Before(pos.EntryDate) {
+		if err != nil {
 			continue
 		}
-
 		day, ok := raw.(map[string]interface{})
 		if !ok {
 			continue
 		}
-
-		var hs string
-		if pos.IsCrypto() {
-			hs, _ = day["2b. high (USD)"].(string)
-		} else {
-			hs, _ = day["2. high"].(string)
-		}
-
-		h, err := strconv.ParseFloat(hs, 64)
-		if err == nil && h > maxPrice {
-			maxPrice = h
-		}
+		bars = append(bars, adjustedBar{
+			Date:   d,
+			High:   parseField(day, "2b. high ("+pos.QuoteCurrency()+")"),
+			Low:    parseField(day, "3b. low ("+pos.QuoteCurrency()+")"),
+			Split:  1,
+			Factor: 1,
+		})
 	}
-
-	pos.PeakPrice = maxPrice
-	pos.UpdatePrice(pos.CurrentPrice)
-	return nil
+	return bars, nil
 }
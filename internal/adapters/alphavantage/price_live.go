@@ -8,21 +8,25 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"time"
 
 	"tracktrades/internal/domain/portfolio"
 )
 
 func (c *Client) UpdatePrice(ctx context.Context, pos *portfolio.Position) error {
+	if pos.Option != nil {
+		return fmt.Errorf("%s: %w", pos.Ticker, errNoOptionQuotes)
+	}
 	baseURL := "https://www.alphavantage.co/query"
 
 	params := url.Values{"apikey": {c.APIKey}}
 	if pos.IsCrypto() {
 		params.Set("function", "CURRENCY_EXCHANGE_RATE")
-		params.Set("from_currency", pos.SymbolBase())
-		params.Set("to_currency", "USD")
+		params.Set("from_currency", symbol(pos))
+		params.Set("to_currency", pos.QuoteCurrency())
 	} else {
 		params.Set("function", "GLOBAL_QUOTE")
-		params.Set("symbol", pos.Ticker)
+		params.Set("symbol", symbol(pos))
 	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"?"+params.Encode(), nil)
@@ -44,15 +48,18 @@ func (c *Client) UpdatePrice(ctx context.Context, pos *portfolio.Position) error
 	_ = json.Unmarshal(body, &data)
 
 	var price float64
+	var day string
 	if q, ok := data["Global Quote"].(map[string]interface{}); ok {
 		if s, ok := q["05. price"].(string); ok {
 			price, _ = strconv.ParseFloat(s, 64)
 		}
+		day, _ = q["07. latest trading day"].(string)
 	}
 	if rate, ok := data["Realtime Currency Exchange Rate"].(map[string]interface{}); ok {
 		if s, ok := rate["5. Exchange Rate"].(string); ok {
 			price, _ = strconv.ParseFloat(s, 64)
 		}
+		day, _ = rate["6. Last Refreshed"].(string)
 	}
 
 	if price <= 0 {
@@ -60,5 +67,11 @@ func (c *Client) UpdatePrice(ctx context.Context, pos *portfolio.Position) error
 	}
 
 	pos.UpdatePrice(price)
+	pos.QuoteDate = nil
+	if len(day) >= 10 {
+		if d, err := time.Parse("2006-01-02", day[:10]); err == nil {
+			pos.QuoteDate = &d
+		}
+	}
 	return nil
 }
@@ -0,0 +1,53 @@
+package alphavantage
+
+import (
+	"strings"
+
+	"tracktrades/internal/domain/portfolio"
+)
+
+// providerName keys AlphaVantage symbols in an instrument's symbol map.
+const providerName = "alphavantage"
+
+// exchangeSuffixes maps exchange codes to the suffix AlphaVantage appends to
+// symbols listed outside the US.
+var exchangeSuffixes = map[string]string{
+	"LSE":   "LON",
+	"LON":   "LON",
+	"XETRA": "DEX",
+	"DEX":   "DEX",
+	"FRA":   "FRK",
+	"TSX":   "TRT",
+	"TRT":   "TRT",
+	"TSXV":  "TRV",
+	"TRV":   "TRV",
+	"BSE":   "BSE",
+	"SSE":   "SHH",
+	"SHH":   "SHH",
+	"SZSE":  "SHZ",
+	"SHZ":   "SHZ",
+}
+
+// symbol is the AlphaVantage symbol of pos: the instrument's explicit mapping,
+// the base asset of a crypto pair, or the ticker with its exchange suffix.
+func symbol(pos *portfolio.Position) string {
+	ticker := strings.ToUpper(pos.Ticker)
+	inst := pos.Instrument
+	if inst == nil {
+		return ticker
+	}
+	if s := inst.Symbol(providerName); s != "" {
+		return s
+	}
+	if inst.AssetClass == portfolio.AssetCrypto {
+		base := strings.TrimRight(strings.TrimSuffix(ticker, pos.QuoteCurrency()), "-/")
+		if base != "" {
+			return base
+		}
+		return ticker
+	}
+	if suffix, ok := exchangeSuffixes[inst.Exchange]; ok && !strings.Contains(ticker, ".") {
+		return ticker + "." + suffix
+	}
+	return ticker
+}
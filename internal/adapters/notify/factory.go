@@ -0,0 +1,59 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"tracktrades/internal/domain/portfolio"
+	"tracktrades/internal/ports"
+)
+
+// New returns a notifier for a comma-separated spec. Examples:
+//   - "log" (standard logger)
+//   - "stdout" (JSON lines on stdout)
+//   - "webhook:https://hooks.example.com/alerts"
+//   - "log,webhook:https://hooks.example.com/alerts"
+func New(spec string) (ports.Notifier, error) {
+	var all Multi
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kind, arg, _ := strings.Cut(part, ":")
+		switch strings.ToLower(kind) {
+		case "log":
+			all = append(all, NewLogNotifier(nil))
+		case "stdout":
+			all = append(all, NewStdoutNotifier(nil))
+		case "webhook":
+			if arg == "" {
+				return nil, errors.New("webhook notifier requires a URL")
+			}
+			all = append(all, NewWebhookNotifier(arg))
+		default:
+			return nil, fmt.Errorf("unsupported notifier: %s", kind)
+		}
+	}
+	if len(all) == 1 {
+		return all[0], nil
+	}
+	return all, nil
+}
+
+// Multi fans an event out to several notifiers.
+type Multi []ports.Notifier
+
+var _ ports.Notifier = Multi(nil)
+
+func (m Multi) Notify(ctx context.Context, event portfolio.AlertEvent) error {
+	var errs []error
+	for _, n := range m {
+		if err := n.Notify(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,28 @@
+package notify
+
+import (
+	"context"
+	"log"
+
+	"tracktrades/internal/domain/portfolio"
+	"tracktrades/internal/ports"
+)
+
+// LogNotifier writes alert events to a standard logger.
+type LogNotifier struct {
+	Logger *log.Logger
+}
+
+var _ ports.Notifier = (*LogNotifier)(nil)
+
+func NewLogNotifier(logger *log.Logger) *LogNotifier {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return &LogNotifier{Logger: logger}
+}
+
+func (n *LogNotifier) Notify(ctx context.Context, event portfolio.AlertEvent) error {
+	n.Logger.Printf("alert [%s] %s", event.Portfolio, event.Message)
+	return nil
+}
@@ -0,0 +1,33 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"tracktrades/internal/domain/portfolio"
+	"tracktrades/internal/ports"
+)
+
+// StdoutNotifier writes each alert event as a JSON line.
+type StdoutNotifier struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+var _ ports.Notifier = (*StdoutNotifier)(nil)
+
+func NewStdoutNotifier(w io.Writer) *StdoutNotifier {
+	if w == nil {
+		w = os.Stdout
+	}
+	return &StdoutNotifier{w: w}
+}
+
+func (n *StdoutNotifier) Notify(ctx context.Context, event portfolio.AlertEvent) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return json.NewEncoder(n.w).Encode(event)
+}
@@ -44,11 +44,14 @@ func NewDBPortfolioStore(path string) (*SQLitePortfolioStore, error) {
 
 func (s *SQLitePortfolioStore) initSchema() error {
 	ctx := context.Background()
-	_, err := s.db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS portfolios (name TEXT PRIMARY KEY, data TEXT NOT NULL);")
+	if _, err := s.db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS portfolios (name TEXT PRIMARY KEY, data TEXT NOT NULL);"); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS watchlists (name TEXT PRIMARY KEY, data TEXT NOT NULL);")
 	return err
 }
 
-func (s *SQLitePortfolioStore) Create(ctx context.Context, name string, cash float64) (*portfolio.Portfolio, error) {
+func (s *SQLitePortfolioStore) Create(ctx context.Context, name string, cash portfolio.Decimal) (*portfolio.Portfolio, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -119,6 +122,9 @@ func (s *SQLitePortfolioStore) Load(ctx context.Context, name string) (*portfoli
 	if p.Positions == nil {
 		p.Positions = make(map[string]*portfolio.Position)
 	}
+	if err := p.Migrate(); err != nil {
+		return nil, err
+	}
 	return clonePortfolio(&p), nil
 }
 
@@ -153,6 +159,38 @@ func (s *SQLitePortfolioStore) Remove(ctx context.Context, name string) error {
 	return nil
 }
 
+// LoadWatchlists reads the global watchlists, kept in their own table.
+func (s *SQLitePortfolioStore) LoadWatchlists(ctx context.Context) (portfolio.Watchlists, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var data string
+	err := s.db.QueryRowContext(ctx, "SELECT data FROM watchlists WHERE name=?", globalWatchlistsKey).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fs.ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	var lists portfolio.Watchlists
+	if err := json.Unmarshal([]byte(data), &lists); err != nil {
+		return nil, err
+	}
+	return lists, nil
+}
+
+func (s *SQLitePortfolioStore) SaveWatchlists(ctx context.Context, lists portfolio.Watchlists) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.Marshal(watchlistsDocument(lists))
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, "INSERT INTO watchlists(name, data) VALUES(?, ?) ON CONFLICT(name) DO UPDATE SET data=excluded.data;", globalWatchlistsKey, string(data))
+	return err
+}
+
 func (s *SQLitePortfolioStore) saveUnlocked(ctx context.Context, name string, p *portfolio.Portfolio) error {
 	data, err := json.Marshal(p)
 	if err != nil {
@@ -180,12 +218,100 @@ func clonePortfolio(p *portfolio.Portfolio) *portfolio.Portfolio {
 		cp.Positions = make(map[string]*portfolio.Position, len(p.Positions))
 		for k, v := range p.Positions {
 			pos := *v
+			pos.Lots = append([]portfolio.Lot(nil), v.Lots...)
+			pos.Tags = append([]string(nil), v.Tags...)
+			if v.Option != nil {
+				c := *v.Option
+				pos.Option = &c
+			}
+			if v.Instrument != nil {
+				inst := cloneInstrument(*v.Instrument)
+				pos.Instrument = &inst
+			}
 			cp.Positions[k] = &pos
 		}
 	}
+	if p.Transactions != nil {
+		cp.Transactions = make([]portfolio.Transaction, len(p.Transactions))
+		for i, tx := range p.Transactions {
+			tx.Lots = append([]portfolio.LotSelection(nil), tx.Lots...)
+			tx.Tags = append([]string(nil), tx.Tags...)
+			if tx.Option != nil {
+				c := *tx.Option
+				tx.Option = &c
+			}
+			cp.Transactions[i] = tx
+		}
+	}
+	cp.Benchmarks = append([]string(nil), p.Benchmarks...)
+	cp.Targets = append([]portfolio.AllocationTarget(nil), p.Targets...)
+	if p.AllocationTags != nil {
+		cp.AllocationTags = make(map[string]string, len(p.AllocationTags))
+		for k, v := range p.AllocationTags {
+			cp.AllocationTags[k] = v
+		}
+	}
+	if p.Alerts != nil {
+		cp.Alerts = make([]portfolio.AlertRule, len(p.Alerts))
+		for i, r := range p.Alerts {
+			if r.TriggeredAt != nil {
+				t := *r.TriggeredAt
+				r.TriggeredAt = &t
+			}
+			cp.Alerts[i] = r
+		}
+	}
+	cp.Watchlists = cloneWatchlists(p.Watchlists)
+	if p.Margin != nil {
+		m := *p.Margin
+		cp.Margin = &m
+	}
+	if p.Scenarios != nil {
+		cp.Scenarios = make([]portfolio.Scenario, len(p.Scenarios))
+		for i, sc := range p.Scenarios {
+			sc.Shocks = append([]portfolio.Shock(nil), sc.Shocks...)
+			if sc.Replay != nil {
+				r := *sc.Replay
+				sc.Replay = &r
+			}
+			cp.Scenarios[i] = sc
+		}
+	}
+	if p.ConcentrationLimits != nil {
+		l := *p.ConcentrationLimits
+		cp.ConcentrationLimits = &l
+	}
+	if p.Instruments != nil {
+		cp.Instruments = make(map[string]portfolio.Instrument, len(p.Instruments))
+		for k, v := range p.Instruments {
+			cp.Instruments[k] = cloneInstrument(v)
+		}
+	}
+	if p.History != nil {
+		cp.History = make([]portfolio.Snapshot, len(p.History))
+		for i, snap := range p.History {
+			prices := make(map[string]float64, len(snap.Prices))
+			for k, v := range snap.Prices {
+				prices[k] = v
+			}
+			snap.Prices = prices
+			cp.History[i] = snap
+		}
+	}
 	return &cp
 }
 
+func cloneInstrument(inst portfolio.Instrument) portfolio.Instrument {
+	if inst.Symbols != nil {
+		symbols := make(map[string]string, len(inst.Symbols))
+		for k, v := range inst.Symbols {
+			symbols[k] = v
+		}
+		inst.Symbols = symbols
+	}
+	return inst
+}
+
 func ensureSQLiteDir(path string) error {
 	if path == "" || path == ":memory:" {
 		return nil
@@ -207,3 +333,31 @@ func ensureSQLiteDir(path string) error {
 	}
 	return os.MkdirAll(dir, 0o755)
 }
+
+// Paths and keys of the global watchlists, which every backend keeps apart
+// from the portfolios.
+const (
+	sharedDir           = "shared"
+	globalWatchlistsKey = "global"
+)
+
+// watchlistsDocument stores an empty set of watchlists as [] rather than null,
+// so a saved document is told apart from a missing one.
+func watchlistsDocument(lists portfolio.Watchlists) portfolio.Watchlists {
+	if lists == nil {
+		return portfolio.Watchlists{}
+	}
+	return lists
+}
+
+func cloneWatchlists(lists portfolio.Watchlists) portfolio.Watchlists {
+	if lists == nil {
+		return nil
+	}
+	cp := make(portfolio.Watchlists, len(lists))
+	for i, wl := range lists {
+		wl.Items = append([]portfolio.WatchItem(nil), wl.Items...)
+		cp[i] = wl
+	}
+	return cp
+}
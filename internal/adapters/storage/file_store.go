@@ -16,7 +16,8 @@ import (
 )
 
 // FilePortfolioStore keeps portfolios as individual JSON files within a base directory.
-// Each portfolio is stored as <name>.json.
+// Each portfolio is stored as <name>.json and the global watchlists as
+// shared/watchlists.json.
 type FilePortfolioStore struct {
 	baseDir string
 	mu      sync.RWMutex
@@ -28,7 +29,7 @@ func NewFilePortfolioStore(baseDir string) *FilePortfolioStore {
 	return &FilePortfolioStore{baseDir: baseDir}
 }
 
-func (s *FilePortfolioStore) Create(ctx context.Context, name string, cash float64) (*portfolio.Portfolio, error) {
+func (s *FilePortfolioStore) Create(ctx context.Context, name string, cash portfolio.Decimal) (*portfolio.Portfolio, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -101,6 +102,9 @@ func (s *FilePortfolioStore) Load(ctx context.Context, name string) (*portfolio.
 	if p.Positions == nil {
 		p.Positions = make(map[string]*portfolio.Position)
 	}
+	if err := p.Migrate(); err != nil {
+		return nil, err
+	}
 	return &p, nil
 }
 
@@ -136,6 +140,39 @@ func (s *FilePortfolioStore) Remove(ctx context.Context, name string) error {
 	return nil
 }
 
+func (s *FilePortfolioStore) LoadWatchlists(ctx context.Context) (portfolio.Watchlists, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, err := os.ReadFile(s.watchlistsPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fs.ErrNotExist
+		}
+		return nil, err
+	}
+	var lists portfolio.Watchlists
+	if err := json.Unmarshal(data, &lists); err != nil {
+		return nil, err
+	}
+	return lists, nil
+}
+
+func (s *FilePortfolioStore) SaveWatchlists(ctx context.Context, lists portfolio.Watchlists) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := s.watchlistsPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(watchlistsDocument(lists), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
 func (s *FilePortfolioStore) saveUnlocked(p *portfolio.Portfolio, path string) error {
 	data, err := json.MarshalIndent(p, "", "  ")
 	if err != nil {
@@ -148,3 +185,8 @@ func (s *FilePortfolioStore) pathFor(name string) string {
 	filename := fmt.Sprintf("%s.json", name)
 	return filepath.Join(s.baseDir, filename)
 }
+
+// watchlistsPath sits in a subdirectory so List never mistakes it for a portfolio.
+func (s *FilePortfolioStore) watchlistsPath() string {
+	return filepath.Join(s.baseDir, sharedDir, "watchlists.json")
+}
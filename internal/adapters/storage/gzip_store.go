@@ -19,7 +19,8 @@ import (
 )
 
 // GzipPortfolioStore keeps portfolios as gzipped JSON files within a base directory.
-// Each portfolio is stored as <name>.json.gz.
+// Each portfolio is stored as <name>.json.gz and the global watchlists as
+// shared/watchlists.json.gz.
 type GzipPortfolioStore struct {
 	baseDir string
 	mu      sync.RWMutex
@@ -31,7 +32,7 @@ func NewGzipPortfolioStore(baseDir string) *GzipPortfolioStore {
 	return &GzipPortfolioStore{baseDir: baseDir}
 }
 
-func (s *GzipPortfolioStore) Create(ctx context.Context, name string, cash float64) (*portfolio.Portfolio, error) {
+func (s *GzipPortfolioStore) Create(ctx context.Context, name string, cash portfolio.Decimal) (*portfolio.Portfolio, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -109,6 +110,9 @@ func (s *GzipPortfolioStore) Load(ctx context.Context, name string) (*portfolio.
 	if p.Positions == nil {
 		p.Positions = make(map[string]*portfolio.Position)
 	}
+	if err := p.Migrate(); err != nil {
+		return nil, err
+	}
 	return &p, nil
 }
 
@@ -144,6 +148,47 @@ func (s *GzipPortfolioStore) Remove(ctx context.Context, name string) error {
 	return nil
 }
 
+func (s *GzipPortfolioStore) LoadWatchlists(ctx context.Context) (portfolio.Watchlists, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, err := os.ReadFile(s.watchlistsPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fs.ErrNotExist
+		}
+		return nil, err
+	}
+	uncompressed, err := s.inflate(data)
+	if err != nil {
+		return nil, err
+	}
+	var lists portfolio.Watchlists
+	if err := json.Unmarshal(uncompressed, &lists); err != nil {
+		return nil, err
+	}
+	return lists, nil
+}
+
+func (s *GzipPortfolioStore) SaveWatchlists(ctx context.Context, lists portfolio.Watchlists) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := s.watchlistsPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(watchlistsDocument(lists), "", "  ")
+	if err != nil {
+		return err
+	}
+	compressed, err := s.deflate(data)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, compressed, 0o644)
+}
+
 func (s *GzipPortfolioStore) saveUnlocked(p *portfolio.Portfolio, path string) error {
 	data, err := json.MarshalIndent(p, "", "  ")
 	if err != nil {
@@ -161,6 +206,11 @@ func (s *GzipPortfolioStore) pathFor(name string) string {
 	return filepath.Join(s.baseDir, filename)
 }
 
+// watchlistsPath sits in a subdirectory so List never mistakes it for a portfolio.
+func (s *GzipPortfolioStore) watchlistsPath() string {
+	return filepath.Join(s.baseDir, sharedDir, "watchlists.json.gz")
+}
+
 func (s *GzipPortfolioStore) deflate(data []byte) ([]byte, error) {
 	var buf bytes.Buffer
 	zw := gzip.NewWriter(&buf)
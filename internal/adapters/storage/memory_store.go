@@ -12,8 +12,9 @@ import (
 
 // MemoryPortfolioStore keeps portfolios in-memory. Useful for tests or ephemeral runs.
 type MemoryPortfolioStore struct {
-	mu    sync.RWMutex
-	store map[string]*portfolio.Portfolio
+	mu         sync.RWMutex
+	store      map[string]*portfolio.Portfolio
+	watchlists portfolio.Watchlists
 }
 
 var _ ports.PortfolioStore = (*MemoryPortfolioStore)(nil)
@@ -22,7 +23,7 @@ func NewMemoryPortfolioStore() *MemoryPortfolioStore {
 	return &MemoryPortfolioStore{store: make(map[string]*portfolio.Portfolio)}
 }
 
-func (s *MemoryPortfolioStore) Create(ctx context.Context, name string, cash float64) (*portfolio.Portfolio, error) {
+func (s *MemoryPortfolioStore) Create(ctx context.Context, name string, cash portfolio.Decimal) (*portfolio.Portfolio, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -88,17 +89,24 @@ func (s *MemoryPortfolioStore) Remove(ctx context.Context, name string) error {
 	return nil
 }
 
-func (s *MemoryPortfolioStore) clone(p *portfolio.Portfolio) *portfolio.Portfolio {
-	if p == nil {
-		return nil
-	}
-	cp := *p
-	if p.Positions != nil {
-		cp.Positions = make(map[string]*portfolio.Position, len(p.Positions))
-		for k, v := range p.Positions {
-			pos := *v
-			cp.Positions[k] = &pos
-		}
+func (s *MemoryPortfolioStore) LoadWatchlists(ctx context.Context) (portfolio.Watchlists, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.watchlists == nil {
+		return nil, fs.ErrNotExist
 	}
-	return &cp
+	return cloneWatchlists(s.watchlists), nil
+}
+
+func (s *MemoryPortfolioStore) SaveWatchlists(ctx context.Context, lists portfolio.Watchlists) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.watchlists = watchlistsDocument(cloneWatchlists(lists))
+	return nil
+}
+
+func (s *MemoryPortfolioStore) clone(p *portfolio.Portfolio) *portfolio.Portfolio {
+	return clonePortfolio(p)
 }
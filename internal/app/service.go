@@ -2,6 +2,11 @@ package app
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
 	"time"
 
 	"tracktrades/internal/domain/portfolio"
@@ -9,81 +14,966 @@ import (
 )
 
 type PortfolioService struct {
-	store  ports.PortfolioStore
-	pricer ports.PriceProvider
+	store   ports.PortfolioStore
+	pricer  ports.PriceProvider
+	fx      ports.FXRateProvider
+	history ports.PriceHistoryProvider
+	notify  ports.Notifier
+	splits  ports.SplitProvider
+	divs    ports.DividendProvider
 }
 
-func NewPortfolioService(store ports.PortfolioStore, pricer ports.PriceProvider) *PortfolioService {
-	return &PortfolioService{
+// Option configures optional collaborators of the service.
+type Option func(*PortfolioService)
+
+// WithFXRates enables conversion of foreign-currency positions and trades into the base currency.
+func WithFXRates(fx ports.FXRateProvider) Option {
+	return func(s *PortfolioService) { s.fx = fx }
+}
+
+// WithPriceHistory enables calculations that need daily closes, such as returns.
+func WithPriceHistory(h ports.PriceHistoryProvider) Option {
+	return func(s *PortfolioService) { s.history = h }
+}
+
+// WithNotifier delivers alert events raised after price refreshes.
+func WithNotifier(n ports.Notifier) Option {
+	return func(s *PortfolioService) { s.notify = n }
+}
+
+// WithSplitDetection records splits reported by the provider when peaks are recomputed.
+func WithSplitDetection(sp ports.SplitProvider) Option {
+	return func(s *PortfolioService) { s.splits = sp }
+}
+
+// WithDividendImport enables importing dividend events reported by the provider.
+func WithDividendImport(dp ports.DividendProvider) Option {
+	return func(s *PortfolioService) { s.divs = dp }
+}
+
+func NewPortfolioService(store ports.PortfolioStore, pricer ports.PriceProvider, opts ...Option) *PortfolioService {
+	s := &PortfolioService{
 		store:  store,
 		pricer: pricer,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *PortfolioService) CreatePortfolio(ctx context.Context, name string, cash portfolio.Decimal) (*portfolio.Portfolio, error) {
+	if cash.Overflowed() {
+		return nil, fmt.Errorf("%w: starting cash %v", portfolio.ErrOutOfRange, cash)
+	}
+	return s.store.Create(ctx, name, cash)
+}
+
+// SetBaseCurrency changes the reporting currency. Ledger amounts are kept in the
+// base currency, so it can only change before anything has been recorded.
+func (s *PortfolioService) SetBaseCurrency(ctx context.Context, name, currency string) error {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return err
+	}
+	if len(p.Transactions) > 0 || len(p.Positions) > 0 {
+		return errors.New("base currency can only be changed on an empty portfolio")
+	}
+	p.BaseCurrency = portfolio.NormalizeCurrency(currency)
+	return s.store.Save(ctx, name, p)
+}
+
+func (s *PortfolioService) ListPortfolios(ctx context.Context) ([]string, error) {
+	return s.store.List(ctx)
+}
+
+func (s *PortfolioService) RemovePortfolio(ctx context.Context, name string) error {
+	return s.store.Remove(ctx, name)
+}
+
+func (s *PortfolioService) GetMetrics(ctx context.Context, name string) (portfolio.PortfolioMetrics, error) {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return portfolio.PortfolioMetrics{}, err
+	}
+	m := p.Metrics()
+	// Beta is best effort here; a failed benchmark fetch leaves the other risk figures intact.
+	if closes, err := s.benchmarkCloses(ctx, p); err == nil && len(closes) > 0 {
+		m.Risk = p.Risk(closes).Portfolio
+	}
+	return m, nil
+}
+
+func (s *PortfolioService) ListPositions(ctx context.Context, name string) ([]portfolio.PositionDetails, error) {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]portfolio.PositionDetails, 0, len(p.Positions))
+	for ticker := range p.Positions {
+		d, _ := p.PositionDetails(ticker)
+		res = append(res, d)
+	}
+	return res, nil
+}
+
+func (s *PortfolioService) GetPosition(ctx context.Context, name, ticker string) (portfolio.PositionDetails, bool, error) {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return portfolio.PositionDetails{}, false, err
+	}
+	d, ok := p.PositionDetails(ticker)
+	return d, ok, nil
+}
+
+func (s *PortfolioService) AddOrUpdatePosition(ctx context.Context, name string, pos *portfolio.Position) error {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return err
+	}
+	if p.IsLedgerManaged(pos.Ticker) {
+		return fmt.Errorf("%w: record a trade for %s instead", portfolio.ErrLedgerManaged, pos.Ticker)
+	}
+	for _, d := range []portfolio.Decimal{pos.Shares, pos.CostBasis, pos.LocalCostBasis, pos.RealizedPnL} {
+		if d.Overflowed() {
+			return fmt.Errorf("%w: position %s amount %v", portfolio.ErrOutOfRange, pos.Ticker, d)
+		}
+	}
+	p.AddPosition(pos)
+	return s.store.Save(ctx, name, p)
+}
+
+func (s *PortfolioService) RecordTransaction(ctx context.Context, name string, tx portfolio.Transaction) (portfolio.Transaction, error) {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return portfolio.Transaction{}, err
+	}
+	recorded, err := s.record(ctx, p, tx)
+	if err != nil {
+		return portfolio.Transaction{}, err
+	}
+	if err := s.store.Save(ctx, name, p); err != nil {
+		return portfolio.Transaction{}, err
+	}
+	return recorded, nil
+}
+
+// record fills in the historical FX rate of a foreign-currency transaction
+// before adding it to the ledger.
+func (s *PortfolioService) record(ctx context.Context, p *portfolio.Portfolio, tx portfolio.Transaction) (portfolio.Transaction, error) {
+	tx = p.WithDefaults(tx)
+	if tx.FXRate.IsZero() && s.fx != nil && !tx.IsCorporateAction() {
+		rate, err := s.fx.HistoricalRate(ctx, tx.Currency, p.Base(), tx.Date)
+		if err != nil {
+			return portfolio.Transaction{}, fmt.Errorf("fx rate %s/%s: %w", tx.Currency, p.Base(), err)
+		}
+		tx.FXRate = portfolio.NewDecimal(rate)
+	}
+	return p.Record(tx)
+}
+
+func (s *PortfolioService) SetLotMethod(ctx context.Context, name string, method portfolio.LotMethod) error {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return err
+	}
+	p.LotMethod = method
+	return s.store.Save(ctx, name, p)
+}
+
+// SetRiskSettings stores the annual risk-free rate and the benchmark ticker used by risk statistics.
+func (s *PortfolioService) SetRiskSettings(ctx context.Context, name string, riskFreePct float64, benchmark string) error {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return err
+	}
+	p.RiskFreeRatePct = riskFreePct
+	p.RiskBenchmark = strings.ToUpper(strings.TrimSpace(benchmark))
+	return s.store.Save(ctx, name, p)
+}
+
+// GetRisk computes risk statistics from the stored history. Beta and correlation
+// are included when a benchmark is set and price history is configured.
+func (s *PortfolioService) GetRisk(ctx context.Context, name string) (portfolio.PortfolioRisk, error) {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return portfolio.PortfolioRisk{}, err
+	}
+	closes, err := s.benchmarkCloses(ctx, p)
+	if err != nil {
+		return portfolio.PortfolioRisk{}, err
+	}
+	return p.Risk(closes), nil
+}
+
+// benchmarkCloses fetches the risk benchmark over the span of the stored history.
+func (s *PortfolioService) benchmarkCloses(ctx context.Context, p *portfolio.Portfolio) ([]portfolio.PricePoint, error) {
+	if p.RiskBenchmark == "" || s.history == nil || len(p.History) < 2 {
+		return nil, nil
+	}
+	from, to := p.History[0].Time, p.History[len(p.History)-1].Time
+	closes, err := s.dailyCloses(ctx, p, []string{p.RiskBenchmark}, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return closes[p.RiskBenchmark], nil
+}
+
+func (s *PortfolioService) ListSales(ctx context.Context, name, ticker string) ([]portfolio.Sale, error) {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return p.Sales(ticker)
+}
+
+func (s *PortfolioService) GetTaxReport(ctx context.Context, name string, year int) (portfolio.TaxReport, error) {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return portfolio.TaxReport{}, err
+	}
+	return p.TaxReport(year)
+}
+
+// GetReturns computes time- and money-weighted returns for the portfolio and each
+// position held between from and to, valuing holdings at historical daily closes.
+func (s *PortfolioService) GetReturns(ctx context.Context, name string, from, to time.Time) (portfolio.ReturnsReport, error) {
+	if !to.After(from) {
+		return portfolio.ReturnsReport{}, errors.New("range end must be after its start")
+	}
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return portfolio.ReturnsReport{}, err
+	}
+	closes, err := s.dailyCloses(ctx, p, p.TradedTickers(to), from, to)
+	if err != nil {
+		return portfolio.ReturnsReport{}, err
+	}
+	return p.ReturnsReport(closes, from, to), nil
+}
+
+// SetBenchmarks replaces the index tickers the portfolio is compared against.
+func (s *PortfolioService) SetBenchmarks(ctx context.Context, name string, tickers []string) error {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return err
+	}
+	p.Benchmarks = portfolio.NormalizeBenchmarks(tickers)
+	return s.store.Save(ctx, name, p)
+}
+
+// CompareBenchmarks compares the portfolio with its declared benchmarks, or with
+// tickers when given, between from and to.
+func (s *PortfolioService) CompareBenchmarks(ctx context.Context, name string, tickers []string, from, to time.Time) (portfolio.BenchmarkReport, error) {
+	if !to.After(from) {
+		return portfolio.BenchmarkReport{}, errors.New("range end must be after its start")
+	}
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return portfolio.BenchmarkReport{}, err
+	}
+	tickers = portfolio.NormalizeBenchmarks(tickers)
+	if len(tickers) == 0 {
+		tickers = p.Benchmarks
+	}
+	if len(tickers) == 0 {
+		return portfolio.BenchmarkReport{}, errors.New("portfolio has no benchmarks")
+	}
+	closes, err := s.dailyCloses(ctx, p, p.TradedTickers(to), from, to)
+	if err != nil {
+		return portfolio.BenchmarkReport{}, err
+	}
+	benchmarks, err := s.dailyCloses(ctx, p, tickers, from, to)
+	if err != nil {
+		return portfolio.BenchmarkReport{}, err
+	}
+	return p.CompareBenchmarks(closes, benchmarks, from, to), nil
+}
+
+// Allocation is the target configuration of a portfolio.
+type Allocation struct {
+	Targets []portfolio.AllocationTarget `json:"targets"`
+	Tags    map[string]string            `json:"tags"`
+}
+
+func (s *PortfolioService) GetAllocation(ctx context.Context, name string) (Allocation, error) {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return Allocation{}, err
+	}
+	a := Allocation{Targets: p.Targets, Tags: p.AllocationTags}
+	if a.Targets == nil {
+		a.Targets = []portfolio.AllocationTarget{}
+	}
+	if a.Tags == nil {
+		a.Tags = map[string]string{}
+	}
+	return a, nil
+}
+
+// SetAllocation replaces the targets and ticker tags of a portfolio.
+func (s *PortfolioService) SetAllocation(ctx context.Context, name string, a Allocation) error {
+	targets, err := portfolio.ValidateTargets(a.Targets)
+	if err != nil {
+		return err
+	}
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return err
+	}
+	p.Targets = targets
+	p.AllocationTags = nil
+	for ticker, tag := range a.Tags {
+		setAllocationTag(p, ticker, tag)
+	}
+	return s.store.Save(ctx, name, p)
+}
+
+// SetTarget adds or replaces a single target; a zero weight removes it.
+func (s *PortfolioService) SetTarget(ctx context.Context, name string, target portfolio.AllocationTarget) error {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return err
+	}
+	normalized, err := portfolio.ValidateTargets([]portfolio.AllocationTarget{target})
+	if err != nil {
+		return err
+	}
+	target = normalized[0]
+
+	targets := make([]portfolio.AllocationTarget, 0, len(p.Targets)+1)
+	for _, t := range p.Targets {
+		if t.Ticker != target.Ticker || t.Tag != target.Tag {
+			targets = append(targets, t)
+		}
+	}
+	if target.WeightPct > 0 {
+		targets = append(targets, target)
+	}
+	if p.Targets, err = portfolio.ValidateTargets(targets); err != nil {
+		return err
+	}
+	return s.store.Save(ctx, name, p)
+}
+
+// TagTicker assigns ticker to a tag used by tag targets; an empty tag clears it.
+func (s *PortfolioService) TagTicker(ctx context.Context, name, ticker, tag string) error {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return err
+	}
+	setAllocationTag(p, ticker, tag)
+	return s.store.Save(ctx, name, p)
+}
+
+func setAllocationTag(p *portfolio.Portfolio, ticker, tag string) {
+	ticker = strings.ToUpper(strings.TrimSpace(ticker))
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" {
+		delete(p.AllocationTags, ticker)
+		return
+	}
+	if p.AllocationTags == nil {
+		p.AllocationTags = make(map[string]string)
+	}
+	p.AllocationTags[ticker] = tag
+}
+
+func (s *PortfolioService) GetRebalancePlan(ctx context.Context, name string, opts portfolio.RebalanceOptions) (portfolio.RebalancePlan, error) {
+	if opts.NewCash.IsNegative() {
+		return portfolio.RebalancePlan{}, fmt.Errorf("%w: new cash must not be negative", portfolio.ErrInvalidAllocation)
+	}
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return portfolio.RebalancePlan{}, err
+	}
+	return p.RebalancePlan(opts), nil
+}
+
+// dailyCloses fetches closes for tickers, starting a week before from so the
+// first day of the range can carry forward the previous close.
+func (s *PortfolioService) dailyCloses(ctx context.Context, p *portfolio.Portfolio, tickers []string, from, to time.Time) (map[string][]portfolio.PricePoint, error) {
+	if s.history == nil {
+		return nil, errors.New("price history is not configured")
+	}
+	closes := make(map[string][]portfolio.PricePoint, len(tickers))
+	for _, ticker := range tickers {
+		pos, ok := p.Positions[ticker]
+		if !ok {
+			pos = p.QuotePosition(ticker)
+		}
+		points, err := s.history.DailyCloses(ctx, pos, from.AddDate(0, 0, -7), to)
+		if err != nil {
+			return nil, fmt.Errorf("closes for %s: %w", ticker, err)
+		}
+		closes[ticker] = points
+	}
+	return closes, nil
+}
+
+func (s *PortfolioService) ListTransactions(ctx context.Context, name, ticker string) ([]portfolio.Transaction, error) {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return p.TransactionsFor(ticker), nil
+}
+
+// ListCorporateActions returns the recorded splits and renames.
+func (s *PortfolioService) ListCorporateActions(ctx context.Context, name string) ([]portfolio.Transaction, error) {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return p.CorporateActions(), nil
+}
+
+// AnnotatePosition replaces the journal note, tags and strategy of a position.
+func (s *PortfolioService) AnnotatePosition(ctx context.Context, name, ticker string, note portfolio.JournalNote) (portfolio.JournalNote, error) {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return portfolio.JournalNote{}, err
+	}
+	note, err = p.AnnotatePosition(ticker, note)
+	if err != nil {
+		return portfolio.JournalNote{}, err
+	}
+	if err := s.store.Save(ctx, name, p); err != nil {
+		return portfolio.JournalNote{}, err
+	}
+	return note, nil
+}
+
+// AnnotateTransaction replaces the journal note, tags and strategy of a ledger entry.
+func (s *PortfolioService) AnnotateTransaction(ctx context.Context, name, id string, note portfolio.JournalNote) (portfolio.Transaction, error) {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return portfolio.Transaction{}, err
+	}
+	tx, err := p.AnnotateTransaction(id, note)
+	if err != nil {
+		return portfolio.Transaction{}, err
+	}
+	if err := s.store.Save(ctx, name, p); err != nil {
+		return portfolio.Transaction{}, err
+	}
+	return tx, nil
+}
+
+func (s *PortfolioService) GetJournal(ctx context.Context, name string, f portfolio.JournalFilter) ([]portfolio.JournalEntry, error) {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return p.Journal(f), nil
+}
+
+// GetJournalBreakdown reports P&L and win rate per tag or strategy.
+func (s *PortfolioService) GetJournalBreakdown(ctx context.Context, name string, by portfolio.JournalGrouping) (portfolio.JournalBreakdown, error) {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return portfolio.JournalBreakdown{}, err
+	}
+	return p.JournalBreakdown(by)
+}
+
+// GlobalWatchlists selects the watchlists shared by all portfolios when passed
+// as the portfolio name to the watchlist methods. Portfolio names are never
+// empty, so it cannot clash with one.
+const GlobalWatchlists = ""
+
+// globalWatchlists loads the global watchlists, which are empty until first saved.
+func (s *PortfolioService) globalWatchlists(ctx context.Context) (portfolio.Watchlists, error) {
+	lists, err := s.store.LoadWatchlists(ctx)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return lists, err
+}
+
+// watchlistOwner is a portfolio whose watchlists are being changed, or the
+// global watchlists when p is nil, which are quoted with the instruments
+// registered across all portfolios.
+type watchlistOwner struct {
+	name        string
+	p           *portfolio.Portfolio
+	lists       *portfolio.Watchlists
+	instruments map[string]portfolio.Instrument
+}
+
+// globalWatchlistOwner loads the global watchlists with the instruments they
+// are quoted with.
+func (s *PortfolioService) globalWatchlistOwner(ctx context.Context) (watchlistOwner, error) {
+	lists, err := s.globalWatchlists(ctx)
+	if err != nil {
+		return watchlistOwner{}, err
+	}
+	instruments, err := s.sharedInstruments(ctx)
+	if err != nil {
+		return watchlistOwner{}, err
+	}
+	return watchlistOwner{lists: &lists, instruments: instruments}, nil
+}
+
+// sharedInstruments merges the instrument registries of every portfolio. When
+// portfolios define a ticker differently, the first by name wins.
+func (s *PortfolioService) sharedInstruments(ctx context.Context) (map[string]portfolio.Instrument, error) {
+	names, err := s.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	res := make(map[string]portfolio.Instrument)
+	for _, name := range names {
+		p, err := s.store.Load(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		for ticker, inst := range p.Instruments {
+			if _, ok := res[ticker]; !ok {
+				res[ticker] = inst
+			}
+		}
+	}
+	return res, nil
+}
+
+func (s *PortfolioService) loadWatchlists(ctx context.Context, name string) (watchlistOwner, error) {
+	if name == GlobalWatchlists {
+		return s.globalWatchlistOwner(ctx)
+	}
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return watchlistOwner{}, err
+	}
+	return watchlistOwner{name: name, p: p, lists: &p.Watchlists}, nil
+}
+
+func (s *PortfolioService) saveWatchlists(ctx context.Context, o watchlistOwner) error {
+	if o.p == nil {
+		return s.store.SaveWatchlists(ctx, *o.lists)
+	}
+	return s.store.Save(ctx, o.name, o.p)
+}
+
+// quotePosition returns the unheld position a watched ticker is quoted with.
+func (o watchlistOwner) quotePosition(ticker string) *portfolio.Position {
+	if o.p == nil {
+		return portfolio.NewQuotePosition(ticker, o.instruments)
+	}
+	return o.p.QuotePosition(ticker)
+}
+
+// heldPrice is the current price of a held stock position in ticker.
+func (o watchlistOwner) heldPrice(ticker string) float64 {
+	if o.p == nil {
+		return 0
+	}
+	if pos, held := o.p.Positions[ticker]; held && pos.Option == nil {
+		return pos.CurrentPrice
+	}
+	return 0
+}
+
+// Watch adds ticker to a watchlist and quotes it straight away, so the price
+// it was added at and its 52-week high are known. A failed quote is filled in
+// by the next price refresh.
+func (s *PortfolioService) Watch(ctx context.Context, name, list, ticker string) (portfolio.WatchItem, error) {
+	o, err := s.loadWatchlists(ctx, name)
+	if err != nil {
+		return portfolio.WatchItem{}, err
+	}
+	now := time.Now()
+	item, err := o.lists.Watch(list, ticker, now)
+	if err != nil {
+		return portfolio.WatchItem{}, err
+	}
+	if item.AddedPrice == 0 {
+		s.quoteWatched(ctx, o, item.Ticker, now)
+		item, _ = o.lists.WatchQuote(item.Ticker)
+	}
+	if err := s.saveWatchlists(ctx, o); err != nil {
+		return portfolio.WatchItem{}, err
+	}
+	return item, nil
+}
+
+// Unwatch removes ticker from a watchlist, or the whole list when ticker is empty.
+func (s *PortfolioService) Unwatch(ctx context.Context, name, list, ticker string) error {
+	o, err := s.loadWatchlists(ctx, name)
+	if err != nil {
+		return err
+	}
+	if !o.lists.Unwatch(list, ticker) {
+		if ticker == "" {
+			return fmt.Errorf("%w: no watchlist %s", portfolio.ErrInvalidWatchlist, list)
+		}
+		return fmt.Errorf("%w: %s is not on watchlist %s", portfolio.ErrInvalidWatchlist, ticker, list)
+	}
+	return s.saveWatchlists(ctx, o)
+}
+
+// GetWatchlists reports the named watchlist, or all of them when list is empty.
+func (s *PortfolioService) GetWatchlists(ctx context.Context, name, list string) ([]portfolio.WatchlistView, error) {
+	o, err := s.loadWatchlists(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return o.lists.WatchlistViews(list)
+}
+
+// quoteWatched fetches the price and 52-week high of a watched ticker.
+func (s *PortfolioService) quoteWatched(ctx context.Context, o watchlistOwner, ticker string, now time.Time) {
+	quote := o.quotePosition(ticker)
+	if item, ok := o.lists.WatchQuote(ticker); ok {
+		quote.CurrentPrice = item.Price
+	}
+	_ = s.pricer.UpdatePrice(ctx, quote)
+	quote.EntryDate = now.AddDate(-1, 0, 0)
+	if err := s.pricer.ComputeHistoricalPeak(ctx, quote); err != nil {
+		quote.PeakPrice = 0
+	}
+	o.lists.UpdateWatchQuote(ticker, quote.CurrentPrice, quote.PeakPrice)
 }
 
-func (s *PortfolioService) CreatePortfolio(ctx context.Context, name string, cash float64) (*portfolio.Portfolio, error) {
-	return s.store.Create(ctx, name, cash)
+// refreshWatchlists prices every watched ticker once, reusing the price of a
+// held position. Items keep their last quote on failure.
+func (s *PortfolioService) refreshWatchlists(ctx context.Context, o watchlistOwner) {
+	for _, ticker := range o.lists.WatchedTickers() {
+		if price := o.heldPrice(ticker); price > 0 {
+			o.lists.UpdateWatchQuote(ticker, price, 0)
+			continue
+		}
+		quote := o.quotePosition(ticker)
+		if err := s.pricer.UpdatePrice(ctx, quote); err == nil {
+			o.lists.UpdateWatchQuote(ticker, quote.CurrentPrice, 0)
+		}
+	}
 }
 
-func (s *PortfolioService) ListPortfolios(ctx context.Context) ([]string, error) {
-	return s.store.List(ctx)
+// updateGlobalWatchlists applies update to the global watchlists alongside a
+// portfolio job and saves them. It returns the lists for alert evaluation and
+// does nothing when no global list exists.
+func (s *PortfolioService) updateGlobalWatchlists(ctx context.Context, update func(watchlistOwner)) ([]portfolio.Watchlist, error) {
+	lists, err := s.globalWatchlists(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(lists) == 0 {
+		return nil, nil
+	}
+	instruments, err := s.sharedInstruments(ctx)
+	if err != nil {
+		return nil, err
+	}
+	update(watchlistOwner{lists: &lists, instruments: instruments})
+	return lists, s.store.SaveWatchlists(ctx, lists)
 }
 
-func (s *PortfolioService) RemovePortfolio(ctx context.Context, name string) error {
-	return s.store.Remove(ctx, name)
+// SetDividendReinvestment chooses whether imported dividends buy new shares
+// instead of being credited to cash.
+func (s *PortfolioService) SetDividendReinvestment(ctx context.Context, name string, reinvest bool) error {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return err
+	}
+	p.ReinvestDividends = reinvest
+	return s.store.Save(ctx, name, p)
 }
 
-func (s *PortfolioService) GetMetrics(ctx context.Context, name string) (portfolio.PortfolioMetrics, error) {
+// GetIncome summarises dividends received between from and to.
+func (s *PortfolioService) GetIncome(ctx context.Context, name string, from, to time.Time) (portfolio.IncomeSummary, error) {
 	p, err := s.store.Load(ctx, name)
 	if err != nil {
-		return portfolio.PortfolioMetrics{}, err
+		return portfolio.IncomeSummary{}, err
 	}
-	return p.Metrics(), nil
+	return p.IncomeSummary(from, to), nil
 }
 
-func (s *PortfolioService) ListPositions(ctx context.Context, name string) ([]portfolio.PositionDetails, error) {
+// GetFeeReport totals the trade and account fees recorded between from and to.
+func (s *PortfolioService) GetFeeReport(ctx context.Context, name string, from, to time.Time) (portfolio.FeeReport, error) {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return portfolio.FeeReport{}, err
+	}
+	return p.FeeReport(from, to), nil
+}
+
+// GetRecovery projects how the portfolio and its positions recover from their
+// drawdowns under opts.
+func (s *PortfolioService) GetRecovery(ctx context.Context, name string, opts portfolio.RecoveryOptions) (portfolio.RecoveryReport, error) {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return portfolio.RecoveryReport{}, err
+	}
+	return p.RecoveryProjections(time.Now(), opts)
+}
+
+// Simulate runs a Monte Carlo simulation of the portfolio value. With price
+// history configured it samples daily closes over the lookback period;
+// otherwise it samples the prices in the stored history. Option positions are
+// not quoted by the history provider and are held at their current value.
+func (s *PortfolioService) Simulate(ctx context.Context, name string, opts portfolio.SimulationOptions) (portfolio.SimulationResult, error) {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return portfolio.SimulationResult{}, err
+	}
+	opts = opts.WithDefaults()
+	var closes map[string][]portfolio.PricePoint
+	if s.history != nil {
+		to := time.Now()
+		from := to.AddDate(0, 0, -opts.LookbackDays)
+		closes = make(map[string][]portfolio.PricePoint, len(p.Positions))
+		for ticker, pos := range p.Positions {
+			if pos.Option != nil {
+				continue
+			}
+			points, err := s.history.DailyCloses(ctx, pos, from, to)
+			if err != nil {
+				return portfolio.SimulationResult{}, fmt.Errorf("closes for %s: %w", ticker, err)
+			}
+			closes[ticker] = points
+		}
+	}
+	return p.Simulate(closes, opts)
+}
+
+// SetMargin opens or updates the margin account of the portfolio; a nil
+// account turns margin off.
+func (s *PortfolioService) SetMargin(ctx context.Context, name string, m *portfolio.MarginAccount) (*portfolio.MarginAccount, error) {
 	p, err := s.store.Load(ctx, name)
 	if err != nil {
 		return nil, err
 	}
-	res := make([]portfolio.PositionDetails, 0, len(p.Positions))
-	for _, pos := range p.Positions {
-		res = append(res, pos.DetailedMetrics())
+	m, err = p.SetMargin(m)
+	if err != nil {
+		return nil, err
 	}
-	return res, nil
+	if err := s.store.Save(ctx, name, p); err != nil {
+		return nil, err
+	}
+	return m, nil
 }
 
-func (s *PortfolioService) GetPosition(ctx context.Context, name, ticker string) (portfolio.PositionDetails, bool, error) {
+func (s *PortfolioService) GetMargin(ctx context.Context, name string) (portfolio.MarginStatus, error) {
 	p, err := s.store.Load(ctx, name)
 	if err != nil {
-		return portfolio.PositionDetails{}, false, err
+		return portfolio.MarginStatus{}, err
 	}
-	d, ok := p.PositionDetails(ticker)
-	return d, ok, nil
+	return p.MarginStatus()
 }
 
-func (s *PortfolioService) AddOrUpdatePosition(ctx context.Context, name string, pos *portfolio.Position) error {
+// AccrueMarginInterest accrues interest on the margin loan up to now and posts
+// the charges of any month that has ended.
+func (s *PortfolioService) AccrueMarginInterest(ctx context.Context, name string, now time.Time) (portfolio.MarginAccrual, error) {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return portfolio.MarginAccrual{}, err
+	}
+	accrual, err := p.AccrueMarginInterest(now)
+	if err != nil {
+		return portfolio.MarginAccrual{}, err
+	}
+	if err := s.store.Save(ctx, name, p); err != nil {
+		return portfolio.MarginAccrual{}, err
+	}
+	return accrual, nil
+}
+
+// GetConcentration weighs and correlates the holdings and checks them against
+// the concentration limits.
+func (s *PortfolioService) GetConcentration(ctx context.Context, name string) (portfolio.ConcentrationReport, error) {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return portfolio.ConcentrationReport{}, err
+	}
+	return p.Concentration(), nil
+}
+
+// SetConcentrationLimits replaces the thresholds metrics warn above.
+func (s *PortfolioService) SetConcentrationLimits(ctx context.Context, name string, l portfolio.ConcentrationLimits) (portfolio.ConcentrationLimits, error) {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return portfolio.ConcentrationLimits{}, err
+	}
+	l, err = p.SetConcentrationLimits(l)
+	if err != nil {
+		return portfolio.ConcentrationLimits{}, err
+	}
+	if err := s.store.Save(ctx, name, p); err != nil {
+		return portfolio.ConcentrationLimits{}, err
+	}
+	return l, nil
+}
+
+// ListScenarios returns the saved stress scenarios.
+func (s *PortfolioService) ListScenarios(ctx context.Context, name string) ([]portfolio.Scenario, error) {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return p.Scenarios, nil
+}
+
+// SaveScenario saves sc under its name, replacing a scenario of the same name.
+func (s *PortfolioService) SaveScenario(ctx context.Context, name string, sc portfolio.Scenario) (portfolio.Scenario, error) {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return portfolio.Scenario{}, err
+	}
+	sc, err = p.SaveScenario(sc)
+	if err != nil {
+		return portfolio.Scenario{}, err
+	}
+	if err := s.store.Save(ctx, name, p); err != nil {
+		return portfolio.Scenario{}, err
+	}
+	return sc, nil
+}
+
+func (s *PortfolioService) RemoveScenario(ctx context.Context, name, scenario string) error {
 	p, err := s.store.Load(ctx, name)
 	if err != nil {
 		return err
 	}
-	p.AddPosition(pos)
+	if !p.RemoveScenario(scenario) {
+		return fmt.Errorf("%w: no scenario %s", portfolio.ErrInvalidScenario, scenario)
+	}
 	return s.store.Save(ctx, name, p)
 }
 
+// RunSavedScenario runs the saved scenario of that name against the current
+// holdings.
+func (s *PortfolioService) RunSavedScenario(ctx context.Context, name, scenario string) (portfolio.ScenarioResult, error) {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return portfolio.ScenarioResult{}, err
+	}
+	sc, err := p.SavedScenario(scenario)
+	if err != nil {
+		return portfolio.ScenarioResult{}, err
+	}
+	return s.runScenario(ctx, p, sc)
+}
+
+// RunScenario runs a scenario without saving it.
+func (s *PortfolioService) RunScenario(ctx context.Context, name string, sc portfolio.Scenario) (portfolio.ScenarioResult, error) {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return portfolio.ScenarioResult{}, err
+	}
+	return s.runScenario(ctx, p, sc)
+}
+
+// runScenario replays from provider closes when price history is configured
+// and from the stored history otherwise.
+func (s *PortfolioService) runScenario(ctx context.Context, p *portfolio.Portfolio, sc portfolio.Scenario) (portfolio.ScenarioResult, error) {
+	var closes map[string][]portfolio.PricePoint
+	if sc.Replay != nil && s.history != nil {
+		var err error
+		closes, err = s.dailyCloses(ctx, p, p.ReplayTickers(), sc.Replay.From, sc.Replay.To)
+		if err != nil {
+			return portfolio.ScenarioResult{}, err
+		}
+	}
+	return p.RunScenario(sc, closes)
+}
+
+// ImportDividends records the dividends the provider reports for current
+// positions with an ex-date on or after since, or after entry for positions
+// opened later. Events already in the ledger are skipped.
+func (s *PortfolioService) ImportDividends(ctx context.Context, name string, since time.Time) ([]portfolio.Transaction, error) {
+	if s.divs == nil {
+		return nil, errors.New("dividend import is not configured")
+	}
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	var events []portfolio.DividendEvent
+	for _, pos := range p.Positions {
+		start := since
+		if pos.EntryDate.After(start) {
+			start = pos.EntryDate
+		}
+		found, err := s.divs.Dividends(ctx, pos, start)
+		if err != nil {
+			return nil, fmt.Errorf("dividends %s: %w", pos.Ticker, err)
+		}
+		events = append(events, found...)
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].ExDate.Before(events[j].ExDate) })
+
+	recorded := []portfolio.Transaction{}
+	for _, ev := range events {
+		// One event at a time so shares bought by an earlier reinvestment
+		// receive later dividends.
+		for _, tx := range p.DividendTransactions([]portfolio.DividendEvent{ev}, p.ReinvestDividends) {
+			rec, err := s.record(ctx, p, tx)
+			if err != nil {
+				return nil, err
+			}
+			recorded = append(recorded, rec)
+		}
+	}
+	if err := s.store.Save(ctx, name, p); err != nil {
+		return nil, err
+	}
+	return recorded, nil
+}
+
+// RecomputeHistoricalPeaks records any splits the split provider reports since
+// each position's entry, then recomputes peaks from split-adjusted prices.
 func (s *PortfolioService) RecomputeHistoricalPeaks(ctx context.Context, name string) error {
 	p, err := s.store.Load(ctx, name)
 	if err != nil {
 		return err
 	}
+	if s.splits != nil {
+		var events []portfolio.SplitEvent
+		for _, pos := range p.Positions {
+			found, err := s.splits.Splits(ctx, pos, pos.EntryDate)
+			if err != nil {
+				continue
+			}
+			events = append(events, found...)
+		}
+		if _, err := p.RecordSplits(events); err != nil {
+			return err
+		}
+	}
 	for _, pos := range p.Positions {
 		if err := s.pricer.ComputeHistoricalPeak(ctx, pos); err != nil {
 			continue
 		}
 	}
-	return s.store.Save(ctx, name, p)
+	now := time.Now()
+	recomputeHighs := func(o watchlistOwner) {
+		for _, ticker := range o.lists.WatchedTickers() {
+			s.quoteWatched(ctx, o, ticker, now)
+		}
+	}
+	recomputeHighs(watchlistOwner{name: name, p: p, lists: &p.Watchlists})
+	if err := s.store.Save(ctx, name, p); err != nil {
+		return err
+	}
+	_, err = s.updateGlobalWatchlists(ctx, recomputeHighs)
+	return err
 }
 
 func (s *PortfolioService) UpdateAllPrices(ctx context.Context, name string) error {
+	return s.refresh(ctx, name, false)
+}
+
+// RecordDailyClose refreshes prices and stores the day's closing snapshot.
+func (s *PortfolioService) RecordDailyClose(ctx context.Context, name string) error {
+	return s.refresh(ctx, name, true)
+}
+
+// refresh updates prices and FX rates, settles expired options, appends a
+// snapshot, quotes the portfolio's and the global watchlists and evaluates
+// alert rules, notifying after the state is saved.
+func (s *PortfolioService) refresh(ctx context.Context, name string, isClose bool) error {
 	p, err := s.store.Load(ctx, name)
 	if err != nil {
 		return err
@@ -91,9 +981,188 @@ func (s *PortfolioService) UpdateAllPrices(ctx context.Context, name string) err
 	for _, pos := range p.Positions {
 		_ = s.pricer.UpdatePrice(ctx, pos)
 	}
+	s.refreshUnderlyings(ctx, p)
+	s.refreshFXRates(ctx, p)
+	s.refreshWatchlists(ctx, watchlistOwner{name: name, p: p, lists: &p.Watchlists})
+	shared, sharedErr := s.updateGlobalWatchlists(ctx, func(o watchlistOwner) { s.refreshWatchlists(ctx, o) })
+	now := time.Now()
+	_, expiryErr := p.ExpireOptions(now)
+	p.RecordSnapshot(now, isClose)
+	events := p.EvaluateAlerts(now, shared...)
+	if err := s.store.Save(ctx, name, p); err != nil {
+		return err
+	}
+	return errors.Join(sharedErr, expiryErr, s.notifyAll(ctx, events))
+}
+
+// refreshUnderlyings prices the underlying of every option position that is not
+// itself held in the portfolio.
+func (s *PortfolioService) refreshUnderlyings(ctx context.Context, p *portfolio.Portfolio) {
+	prices := make(map[string]float64)
+	for _, pos := range p.Positions {
+		if pos.Option == nil {
+			continue
+		}
+		underlying := pos.Option.Underlying
+		if _, held := p.Positions[underlying]; held {
+			continue
+		}
+		price, ok := prices[underlying]
+		if !ok {
+			quote := p.QuotePosition(underlying)
+			if quote.Currency == "" {
+				quote.Currency = pos.Currency
+			}
+			if err := s.pricer.UpdatePrice(ctx, quote); err == nil {
+				price = quote.CurrentPrice
+			}
+			prices[underlying] = price
+		}
+		if price > 0 {
+			pos.UnderlyingPrice = price
+		}
+	}
+}
+
+// ExpireOptions settles expired options: worthless ones at zero and
+// in-the-money ones in cash at their intrinsic value.
+func (s *PortfolioService) ExpireOptions(ctx context.Context, name string) ([]portfolio.OptionExpiry, error) {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	s.refreshUnderlyings(ctx, p)
+	res, err := p.ExpireOptions(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if res == nil {
+		res = []portfolio.OptionExpiry{}
+	}
+	return res, s.store.Save(ctx, name, p)
+}
+
+// notifyAll delivers events after their state has been saved, so a failed
+// delivery is reported but never repeated.
+func (s *PortfolioService) notifyAll(ctx context.Context, events []portfolio.AlertEvent) error {
+	if s.notify == nil {
+		return nil
+	}
+	var errs []error
+	for _, e := range events {
+		if err := s.notify.Notify(ctx, e); err != nil {
+			errs = append(errs, fmt.Errorf("notify %s: %w", e.Rule.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *PortfolioService) ListAlerts(ctx context.Context, name string) ([]portfolio.AlertRule, error) {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if p.Alerts == nil {
+		return []portfolio.AlertRule{}, nil
+	}
+	return p.Alerts, nil
+}
+
+func (s *PortfolioService) AddAlert(ctx context.Context, name string, rule portfolio.AlertRule) (portfolio.AlertRule, error) {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return portfolio.AlertRule{}, err
+	}
+	rule, err = p.AddAlert(rule)
+	if err != nil {
+		return portfolio.AlertRule{}, err
+	}
+	if err := s.store.Save(ctx, name, p); err != nil {
+		return portfolio.AlertRule{}, err
+	}
+	return rule, nil
+}
+
+// ListInstruments returns the instrument registry of the portfolio.
+func (s *PortfolioService) ListInstruments(ctx context.Context, name string) ([]portfolio.Instrument, error) {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return p.ListInstruments(), nil
+}
+
+// SetInstrument registers or replaces an instrument definition.
+func (s *PortfolioService) SetInstrument(ctx context.Context, name string, inst portfolio.Instrument) (portfolio.Instrument, error) {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return portfolio.Instrument{}, err
+	}
+	inst, err = p.SetInstrument(inst)
+	if err != nil {
+		return portfolio.Instrument{}, err
+	}
+	if err := s.store.Save(ctx, name, p); err != nil {
+		return portfolio.Instrument{}, err
+	}
+	return inst, nil
+}
+
+func (s *PortfolioService) RemoveInstrument(ctx context.Context, name, ticker string) error {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return err
+	}
+	if !p.RemoveInstrument(ticker) {
+		return fmt.Errorf("%w: no instrument %s", portfolio.ErrInvalidInstrument, ticker)
+	}
+	return s.store.Save(ctx, name, p)
+}
+
+func (s *PortfolioService) RemoveAlert(ctx context.Context, name, id string) error {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return err
+	}
+	if !p.RemoveAlert(id) {
+		return fmt.Errorf("%w: no alert %s", portfolio.ErrInvalidAlert, id)
+	}
 	return s.store.Save(ctx, name, p)
 }
 
+func (s *PortfolioService) GetHistory(ctx context.Context, name string, from, to time.Time) (portfolio.EquityCurve, error) {
+	p, err := s.store.Load(ctx, name)
+	if err != nil {
+		return portfolio.EquityCurve{}, err
+	}
+	return p.EquityCurve(from, to), nil
+}
+
+// refreshFXRates updates the conversion rate of every foreign-currency position,
+// fetching each currency pair once. Positions keep their last rate on failure.
+func (s *PortfolioService) refreshFXRates(ctx context.Context, p *portfolio.Portfolio) {
+	if s.fx == nil {
+		return
+	}
+	base := p.Base()
+	rates := make(map[string]float64)
+	for _, pos := range p.Positions {
+		ccy := pos.QuoteCurrency()
+		if ccy == base {
+			continue
+		}
+		rate, ok := rates[ccy]
+		if !ok {
+			r, err := s.fx.Rate(ctx, ccy, base)
+			if err != nil {
+				continue
+			}
+			rate, rates[ccy] = r, r
+		}
+		pos.FXRate = rate
+	}
+}
+
 func (s *PortfolioService) StartPriceUpdater(ctx context.Context, name string, interval time.Duration) (cancel func()) {
 	ctx, cancel = context.WithCancel(ctx)
 
@@ -113,3 +1182,52 @@ func (s *PortfolioService) StartPriceUpdater(ctx context.Context, name string, i
 
 	return cancel
 }
+
+// StartDailyClose runs RecordDailyClose every day at the given local time of day.
+func (s *PortfolioService) StartDailyClose(ctx context.Context, name string, hour, minute int) (cancel func()) {
+	ctx, cancel = context.WithCancel(ctx)
+
+	go func() {
+		for {
+			timer := time.NewTimer(time.Until(nextDailyRun(time.Now(), hour, minute)))
+			select {
+			case <-timer.C:
+				_ = s.RecordDailyClose(ctx, name)
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			}
+		}
+	}()
+
+	return cancel
+}
+
+// StartMarginInterest runs AccrueMarginInterest every day at the given local
+// time of day. Portfolios without a margin account are skipped.
+func (s *PortfolioService) StartMarginInterest(ctx context.Context, name string, hour, minute int) (cancel func()) {
+	ctx, cancel = context.WithCancel(ctx)
+
+	go func() {
+		for {
+			timer := time.NewTimer(time.Until(nextDailyRun(time.Now(), hour, minute)))
+			select {
+			case <-timer.C:
+				_, _ = s.AccrueMarginInterest(ctx, name, time.Now())
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			}
+		}
+	}()
+
+	return cancel
+}
+
+func nextDailyRun(now time.Time, hour, minute int) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
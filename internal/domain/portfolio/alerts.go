@@ -0,0 +1,240 @@
+package portfolio
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidAlert marks alert rules that cannot be evaluated.
+var ErrInvalidAlert = errors.New("invalid alert rule")
+
+type AlertKind string
+
+const (
+	// AlertTrailingStop fires when a position falls Threshold percent from its
+	// peak, or a short rises Threshold percent above its low.
+	AlertTrailingStop AlertKind = "trailing-stop"
+	// AlertStopPrice fires when a position's price is at or below Threshold
+	// (at or above for shorts).
+	AlertStopPrice AlertKind = "stop-price"
+	// AlertTargetPrice fires when a position's price is at or above Threshold
+	// (at or below for shorts).
+	AlertTargetPrice AlertKind = "target-price"
+	// AlertPortfolioDrawdown fires when the portfolio is Threshold percent below its high-water mark.
+	AlertPortfolioDrawdown AlertKind = "portfolio-drawdown"
+	// AlertRecoveryNeeded fires when the gain needed to recover exceeds Threshold percent,
+	// for the position named by Ticker or for the whole portfolio when Ticker is empty.
+	AlertRecoveryNeeded AlertKind = "recovery-needed"
+)
+
+func ParseAlertKind(s string) (AlertKind, error) {
+	k := AlertKind(strings.ToLower(strings.TrimSpace(s)))
+	switch k {
+	case AlertTrailingStop, AlertStopPrice, AlertTargetPrice, AlertPortfolioDrawdown, AlertRecoveryNeeded:
+		return k, nil
+	default:
+		return "", fmt.Errorf("%w: unknown alert kind %q", ErrInvalidAlert, s)
+	}
+}
+
+// AlertRule is a user-defined condition. Triggered records whether the condition
+// held at the last evaluation so each crossing is notified once.
+type AlertRule struct {
+	ID          string     `json:"id"`
+	Kind        AlertKind  `json:"kind"`
+	Ticker      string     `json:"ticker,omitempty"`
+	Threshold   float64    `json:"threshold"`
+	Note        string     `json:"note,omitempty"`
+	Triggered   bool       `json:"triggered"`
+	TriggeredAt *time.Time `json:"triggered_at,omitempty"`
+	LastValue   float64    `json:"last_value"`
+}
+
+func (r AlertRule) Validate() error {
+	if _, err := ParseAlertKind(string(r.Kind)); err != nil {
+		return err
+	}
+	if r.Threshold <= 0 {
+		return fmt.Errorf("%w: threshold must be greater than zero", ErrInvalidAlert)
+	}
+	switch r.Kind {
+	case AlertTrailingStop, AlertStopPrice, AlertTargetPrice:
+		if r.Ticker == "" {
+			return fmt.Errorf("%w: %s requires a ticker", ErrInvalidAlert, r.Kind)
+		}
+	case AlertPortfolioDrawdown:
+		if r.Ticker != "" {
+			return fmt.Errorf("%w: %s applies to the whole portfolio", ErrInvalidAlert, r.Kind)
+		}
+	}
+	return nil
+}
+
+type AlertState string
+
+const (
+	AlertTriggered AlertState = "triggered"
+	AlertCleared   AlertState = "cleared"
+)
+
+// AlertEvent is emitted when a rule changes state.
+type AlertEvent struct {
+	Portfolio string     `json:"portfolio"`
+	Rule      AlertRule  `json:"rule"`
+	State     AlertState `json:"state"`
+	Value     float64    `json:"value"`
+	Time      time.Time  `json:"time"`
+	Message   string     `json:"message"`
+}
+
+// AddAlert validates rule, assigns it the next alert ID and stores it.
+func (p *Portfolio) AddAlert(rule AlertRule) (AlertRule, error) {
+	rule.Ticker = strings.ToUpper(strings.TrimSpace(rule.Ticker))
+	if err := rule.Validate(); err != nil {
+		return AlertRule{}, err
+	}
+	next := 0
+	for _, r := range p.Alerts {
+		if n, err := strconv.Atoi(strings.TrimPrefix(r.ID, "alert-")); err == nil && n > next {
+			next = n
+		}
+	}
+	rule.ID = fmt.Sprintf("alert-%d", next+1)
+	rule.Triggered, rule.TriggeredAt, rule.LastValue = false, nil, 0
+	p.Alerts = append(p.Alerts, rule)
+	return rule, nil
+}
+
+// RemoveAlert deletes the rule with the given ID and reports whether it existed.
+func (p *Portfolio) RemoveAlert(id string) bool {
+	for i, r := range p.Alerts {
+		if r.ID == id {
+			p.Alerts = append(p.Alerts[:i], p.Alerts[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// EvaluateAlerts checks every rule against current prices and metrics, updates
+// the stored state and returns an event for each rule that triggered or cleared.
+// Rules on a ticker that is not held use its watchlist quote, from the
+// portfolio's own lists or from shared. Rules whose ticker is neither held
+// nor watched, or is unpriced, keep their state.
+func (p *Portfolio) EvaluateAlerts(now time.Time, shared ...Watchlist) []AlertEvent {
+	m := p.Metrics()
+	var events []AlertEvent
+	for i := range p.Alerts {
+		r := &p.Alerts[i]
+		value, hit, ok := p.alertCondition(*r, m, shared)
+		if !ok {
+			continue
+		}
+		r.LastValue = value
+		if hit == r.Triggered {
+			continue
+		}
+		r.Triggered = hit
+		state := AlertCleared
+		if hit {
+			state = AlertTriggered
+			t := now
+			r.TriggeredAt = &t
+		}
+		events = append(events, AlertEvent{
+			Portfolio: p.Name,
+			Rule:      *r,
+			State:     state,
+			Value:     value,
+			Time:      now,
+			Message:   alertMessage(*r, state, value),
+		})
+	}
+	return events
+}
+
+func (p *Portfolio) alertCondition(r AlertRule, m PortfolioMetrics, shared []Watchlist) (value float64, hit, ok bool) {
+	if r.Ticker == "" {
+		switch r.Kind {
+		case AlertPortfolioDrawdown:
+			return m.DrawdownFromPeakPct, m.DrawdownFromPeakPct >= r.Threshold, m.HighWaterMark.IsPositive()
+		case AlertRecoveryNeeded:
+			return m.RecoveryNeededPct, m.RecoveryNeededPct >= r.Threshold, m.HighWaterMark.IsPositive()
+		}
+		return 0, false, false
+	}
+
+	pos, found := p.Positions[r.Ticker]
+	if !found {
+		if item, watched := p.WatchQuote(r.Ticker, shared...); watched {
+			return watchCondition(r, item)
+		}
+		return 0, false, false
+	}
+	if pos.CurrentPrice <= 0 {
+		return 0, false, false
+	}
+	d := pos.DetailedMetrics()
+	switch r.Kind {
+	case AlertTrailingStop:
+		return d.DrawdownFromPeakPct, d.DrawdownFromPeakPct >= r.Threshold, true
+	case AlertStopPrice:
+		if pos.IsShort() {
+			return pos.CurrentPrice, pos.CurrentPrice >= r.Threshold, true
+		}
+		return pos.CurrentPrice, pos.CurrentPrice <= r.Threshold, true
+	case AlertTargetPrice:
+		if pos.IsShort() {
+			return pos.CurrentPrice, pos.CurrentPrice <= r.Threshold, true
+		}
+		return pos.CurrentPrice, pos.CurrentPrice >= r.Threshold, true
+	case AlertRecoveryNeeded:
+		return d.RecoveryNeededPct, d.RecoveryNeededPct >= r.Threshold, true
+	}
+	return 0, false, false
+}
+
+// watchCondition evaluates a ticker rule against a watched quote. The trailing
+// stop and recovery rules measure from the 52-week high.
+func watchCondition(r AlertRule, item WatchItem) (value float64, hit, ok bool) {
+	if item.Price <= 0 {
+		return 0, false, false
+	}
+	switch r.Kind {
+	case AlertTrailingStop:
+		v := item.DrawdownFromHighPct()
+		return v, v >= r.Threshold, true
+	case AlertStopPrice:
+		return item.Price, item.Price <= r.Threshold, true
+	case AlertTargetPrice:
+		return item.Price, item.Price >= r.Threshold, true
+	case AlertRecoveryNeeded:
+		v := item.RecoveryNeededPct()
+		return v, v >= r.Threshold, true
+	}
+	return 0, false, false
+}
+
+func alertMessage(r AlertRule, state AlertState, value float64) string {
+	subject := "portfolio"
+	if r.Ticker != "" {
+		subject = r.Ticker
+	}
+	var condition string
+	switch r.Kind {
+	case AlertTrailingStop:
+		condition = fmt.Sprintf("is %.2f%% below its peak (trailing stop %.2f%%)", value, r.Threshold)
+	case AlertStopPrice:
+		condition = fmt.Sprintf("trades at %.2f (stop %.2f)", value, r.Threshold)
+	case AlertTargetPrice:
+		condition = fmt.Sprintf("trades at %.2f (target %.2f)", value, r.Threshold)
+	case AlertPortfolioDrawdown:
+		condition = fmt.Sprintf("is %.2f%% below its high-water mark (limit %.2f%%)", value, r.Threshold)
+	case AlertRecoveryNeeded:
+		condition = fmt.Sprintf("needs %.2f%% to recover (limit %.2f%%)", value, r.Threshold)
+	}
+	return fmt.Sprintf("%s %s: %s %s", r.ID, state, subject, condition)
+}
@@ -0,0 +1,128 @@
+package portfolio
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"tracktrades/internal/util"
+)
+
+// BenchmarkPoint pairs the portfolio and benchmark growth on one day, both
+// rebased to 100 at the start of the range.
+type BenchmarkPoint struct {
+	Date      time.Time `json:"date"`
+	Portfolio float64   `json:"portfolio"`
+	Benchmark float64   `json:"benchmark"`
+}
+
+// BenchmarkComparison measures the portfolio against one benchmark ticker.
+// Alpha and tracking error are annualized from daily returns.
+type BenchmarkComparison struct {
+	Ticker             string           `json:"ticker"`
+	PortfolioReturnPct float64          `json:"portfolio_return_pct"`
+	BenchmarkReturnPct float64          `json:"benchmark_return_pct"`
+	RelativeReturnPct  float64          `json:"relative_return_pct"`
+	AlphaPct           float64          `json:"alpha_pct"`
+	Beta               float64          `json:"beta"`
+	TrackingErrorPct   float64          `json:"tracking_error_pct"`
+	InformationRatio   float64          `json:"information_ratio"`
+	Series             []BenchmarkPoint `json:"series"`
+}
+
+type BenchmarkReport struct {
+	From       time.Time             `json:"from"`
+	To         time.Time             `json:"to"`
+	Portfolio  ReturnFigures         `json:"portfolio"`
+	Benchmarks []BenchmarkComparison `json:"benchmarks"`
+}
+
+// NormalizeBenchmarks upper-cases tickers and drops blanks and duplicates.
+func NormalizeBenchmarks(tickers []string) []string {
+	seen := make(map[string]bool, len(tickers))
+	var res []string
+	for _, t := range tickers {
+		t = strings.ToUpper(strings.TrimSpace(t))
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		res = append(res, t)
+	}
+	return res
+}
+
+// CompareBenchmarks values the portfolio from the ledger and closes between from
+// and to and compares its time-weighted growth with each benchmark's closes.
+func (p *Portfolio) CompareBenchmarks(closes, benchmarks map[string][]PricePoint, from, to time.Time) BenchmarkReport {
+	series := p.ValueSeries(closes, from, to)
+	report := BenchmarkReport{
+		From:       from,
+		To:         to,
+		Portfolio:  Returns(series),
+		Benchmarks: []BenchmarkComparison{},
+	}
+
+	tickers := make([]string, 0, len(benchmarks))
+	for ticker := range benchmarks {
+		tickers = append(tickers, ticker)
+	}
+	sort.Strings(tickers)
+	for _, ticker := range tickers {
+		report.Benchmarks = append(report.Benchmarks, compareSeries(ticker, series, benchmarks[ticker], p.RiskFreeRatePct))
+	}
+	return report
+}
+
+func compareSeries(ticker string, series []Valuation, closes []PricePoint, riskFreePct float64) BenchmarkComparison {
+	cmp := BenchmarkComparison{Ticker: ticker, Series: []BenchmarkPoint{}}
+	if len(series) == 0 {
+		return cmp
+	}
+	start := closeAsOf(closes, series[0].Date)
+	if start <= 0 {
+		return cmp
+	}
+
+	growth, prevBench := 1.0, start
+	var xs, ys []float64
+	for i, v := range series {
+		bench := closeAsOf(closes, v.Date)
+		if i > 0 {
+			if base := series[i-1].Value + v.Flow; base > 0 {
+				r := v.Value/base - 1
+				growth *= 1 + r
+				xs = append(xs, r)
+				ys = append(ys, bench/prevBench-1)
+			}
+		}
+		prevBench = bench
+		cmp.Series = append(cmp.Series, BenchmarkPoint{Date: v.Date, Portfolio: growth * 100, Benchmark: bench / start * 100})
+	}
+
+	last := cmp.Series[len(cmp.Series)-1]
+	cmp.PortfolioReturnPct = last.Portfolio - 100
+	cmp.BenchmarkReturnPct = last.Benchmark - 100
+	cmp.RelativeReturnPct = cmp.PortfolioReturnPct - cmp.BenchmarkReturnPct
+	if len(xs) < 2 {
+		return cmp
+	}
+
+	dailyRF := riskFreePct / 100 / tradingDaysPerYear
+	if v := util.StdDev(ys); v > 0 {
+		cmp.Beta = util.Covariance(xs, ys) / (v * v)
+	}
+	cmp.AlphaPct = (util.Mean(xs) - dailyRF - cmp.Beta*(util.Mean(ys)-dailyRF)) * tradingDaysPerYear * 100
+
+	active := make([]float64, len(xs))
+	for i := range xs {
+		active[i] = xs[i] - ys[i]
+	}
+	te := util.StdDev(active) * math.Sqrt(tradingDaysPerYear)
+	cmp.TrackingErrorPct = te * 100
+	if te > 0 {
+		cmp.InformationRatio = util.Mean(active) * tradingDaysPerYear / te
+	}
+	return cmp
+}
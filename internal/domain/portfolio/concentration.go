@@ -0,0 +1,343 @@
+package portfolio
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"tracktrades/internal/util"
+)
+
+// ErrInvalidConcentration is returned for out-of-range concentration limits.
+var ErrInvalidConcentration = errors.New("invalid concentration limits")
+
+// minCorrelationObservations is the number of shared daily returns a pair of
+// positions needs before their correlation is reported.
+const minCorrelationObservations = 20
+
+// ConcentrationLimits are the thresholds above which metrics warn. Weights
+// are percentages of gross exposure. MaxHHI is the Herfindahl index on
+// weights as fractions, between 0 and 1. MinEffectiveBets warns when the
+// portfolio behaves like fewer independent positions and is off when zero.
+// Positions whose daily returns correlate at CorrelationThreshold or more are
+// clustered, and MaxClusterPct caps the weight of a cluster.
+type ConcentrationLimits struct {
+	MaxPositionPct       float64 `json:"max_position_pct"`
+	MaxTop5Pct           float64 `json:"max_top5_pct"`
+	MaxHHI               float64 `json:"max_hhi"`
+	MinEffectiveBets     float64 `json:"min_effective_bets,omitempty"`
+	CorrelationThreshold float64 `json:"correlation_threshold"`
+	MaxClusterPct        float64 `json:"max_cluster_pct"`
+}
+
+// WithDefaults fills unset limits: 20% in one position, 60% in the top five,
+// an HHI of 0.15, clusters at a correlation of 0.8 and 40% in one cluster.
+func (l ConcentrationLimits) WithDefaults() ConcentrationLimits {
+	if l.MaxPositionPct == 0 {
+		l.MaxPositionPct = 20
+	}
+	if l.MaxTop5Pct == 0 {
+		l.MaxTop5Pct = 60
+	}
+	if l.MaxHHI == 0 {
+		l.MaxHHI = 0.15
+	}
+	if l.CorrelationThreshold == 0 {
+		l.CorrelationThreshold = 0.8
+	}
+	if l.MaxClusterPct == 0 {
+		l.MaxClusterPct = 40
+	}
+	return l
+}
+
+func (l ConcentrationLimits) Validate() error {
+	for _, limit := range []struct {
+		name string
+		pct  float64
+	}{{"max position", l.MaxPositionPct}, {"max top 5", l.MaxTop5Pct}, {"max cluster", l.MaxClusterPct}} {
+		if limit.pct <= 0 || limit.pct > 100 {
+			return fmt.Errorf("%w: %s weight must be in (0, 100]", ErrInvalidConcentration, limit.name)
+		}
+	}
+	if l.MaxHHI <= 0 || l.MaxHHI > 1 {
+		return fmt.Errorf("%w: max HHI must be in (0, 1]", ErrInvalidConcentration)
+	}
+	if l.MinEffectiveBets < 0 {
+		return fmt.Errorf("%w: min effective bets must not be negative", ErrInvalidConcentration)
+	}
+	if l.CorrelationThreshold <= 0 || l.CorrelationThreshold > 1 {
+		return fmt.Errorf("%w: correlation threshold must be in (0, 1]", ErrInvalidConcentration)
+	}
+	return nil
+}
+
+// SetConcentrationLimits replaces the warning thresholds; unset limits take
+// their defaults.
+func (p *Portfolio) SetConcentrationLimits(l ConcentrationLimits) (ConcentrationLimits, error) {
+	l = l.WithDefaults()
+	if err := l.Validate(); err != nil {
+		return ConcentrationLimits{}, err
+	}
+	p.ConcentrationLimits = &l
+	return l, nil
+}
+
+// concentrationLimits returns the configured limits or the defaults.
+func (p *Portfolio) concentrationLimits() ConcentrationLimits {
+	if p.ConcentrationLimits == nil {
+		return ConcentrationLimits{}.WithDefaults()
+	}
+	return p.ConcentrationLimits.WithDefaults()
+}
+
+type PositionWeight struct {
+	Ticker    string  `json:"ticker"`
+	Short     bool    `json:"short,omitempty"`
+	Value     Decimal `json:"value"`
+	WeightPct float64 `json:"weight_pct"`
+}
+
+// ConcentrationStats measure how concentrated the holdings are by their
+// share of gross exposure, so shorts count by their size. EffectiveBets is
+// the inverse of the Herfindahl index: the number of equal positions that
+// would be as concentrated.
+type ConcentrationStats struct {
+	Positions        int     `json:"positions"`
+	LargestTicker    string  `json:"largest_ticker,omitempty"`
+	LargestWeightPct float64 `json:"largest_weight_pct"`
+	Top5WeightPct    float64 `json:"top5_weight_pct"`
+	HHI              float64 `json:"hhi"`
+	EffectiveBets    float64 `json:"effective_bets"`
+}
+
+// CorrelationCluster is a group of positions linked by correlations at or
+// above the threshold, directly or through other members. MinCorrelation is
+// the weakest of those links.
+type CorrelationCluster struct {
+	Tickers        []string `json:"tickers"`
+	WeightPct      float64  `json:"weight_pct"`
+	MinCorrelation float64  `json:"min_correlation"`
+}
+
+// CorrelationMatrix holds the correlations of the positions' daily returns
+// from the stored history, with shorts on their inverted returns so that
+// correlation means moving the portfolio the same way. Matrix follows the
+// order of Tickers; a pair with fewer than 20 shared returns is null.
+type CorrelationMatrix struct {
+	Tickers  []string             `json:"tickers"`
+	Matrix   [][]*float64         `json:"matrix"`
+	Clusters []CorrelationCluster `json:"clusters"`
+}
+
+// ConcentrationWarning reports a limit that is exceeded.
+type ConcentrationWarning struct {
+	Kind    string   `json:"kind"`
+	Tickers []string `json:"tickers,omitempty"`
+	Value   float64  `json:"value"`
+	Limit   float64  `json:"limit"`
+	Message string   `json:"message"`
+}
+
+type ConcentrationReport struct {
+	Limits      ConcentrationLimits    `json:"limits"`
+	Stats       ConcentrationStats     `json:"stats"`
+	Weights     []PositionWeight       `json:"weights"`
+	Correlation CorrelationMatrix      `json:"correlation"`
+	Warnings    []ConcentrationWarning `json:"warnings"`
+}
+
+// Concentration weighs the holdings, correlates them on the stored history
+// and checks both against the limits.
+func (p *Portfolio) Concentration() ConcentrationReport {
+	limits := p.concentrationLimits()
+	weights := p.positionWeights()
+	stats := concentrationStats(weights)
+	corr := p.correlationMatrix(weights, limits.CorrelationThreshold)
+	return ConcentrationReport{
+		Limits:      limits,
+		Stats:       stats,
+		Weights:     weights,
+		Correlation: corr,
+		Warnings:    concentrationWarnings(limits, stats, weights, corr.Clusters),
+	}
+}
+
+// positionWeights returns the positions by descending weight.
+func (p *Portfolio) positionWeights() []PositionWeight {
+	weights := make([]PositionWeight, 0, len(p.Positions))
+	var gross Decimal
+	for ticker, pos := range p.Positions {
+		v := pos.MarketValue()
+		gross = gross.Add(v.Abs())
+		weights = append(weights, PositionWeight{Ticker: ticker, Short: pos.IsShort(), Value: v})
+	}
+	if gross.IsPositive() {
+		for i := range weights {
+			weights[i].WeightPct = weights[i].Value.Abs().Float() / gross.Float() * 100
+		}
+	}
+	sort.Slice(weights, func(i, j int) bool {
+		if weights[i].WeightPct != weights[j].WeightPct {
+			return weights[i].WeightPct > weights[j].WeightPct
+		}
+		return weights[i].Ticker < weights[j].Ticker
+	})
+	return weights
+}
+
+func concentrationStats(weights []PositionWeight) ConcentrationStats {
+	stats := ConcentrationStats{Positions: len(weights)}
+	if len(weights) == 0 || weights[0].WeightPct == 0 {
+		return stats
+	}
+	stats.LargestTicker, stats.LargestWeightPct = weights[0].Ticker, weights[0].WeightPct
+	for i, w := range weights {
+		if i < 5 {
+			stats.Top5WeightPct += w.WeightPct
+		}
+		stats.HHI += (w.WeightPct / 100) * (w.WeightPct / 100)
+	}
+	stats.EffectiveBets = 1 / stats.HHI
+	return stats
+}
+
+// correlationMatrix correlates the positions in ticker order and clusters
+// them by single linkage at threshold.
+func (p *Portfolio) correlationMatrix(weights []PositionWeight, threshold float64) CorrelationMatrix {
+	tickers := make([]string, 0, len(weights))
+	weightOf := make(map[string]float64, len(weights))
+	for _, w := range weights {
+		tickers = append(tickers, w.Ticker)
+		weightOf[w.Ticker] = w.WeightPct
+	}
+	sort.Strings(tickers)
+
+	returns := make([]map[time.Time]float64, len(tickers))
+	for i, ticker := range tickers {
+		returns[i] = make(map[time.Time]float64)
+		for _, r := range p.PositionDailyReturns(ticker) {
+			returns[i][r.Date] = r.Return
+		}
+	}
+
+	m := CorrelationMatrix{Tickers: tickers, Matrix: make([][]*float64, len(tickers)), Clusters: []CorrelationCluster{}}
+	for i := range tickers {
+		m.Matrix[i] = make([]*float64, len(tickers))
+		one := 1.0
+		m.Matrix[i][i] = &one
+	}
+	// parent is a union-find forest over the ticker indexes.
+	parent := make([]int, len(tickers))
+	for i := range parent {
+		parent[i] = i
+	}
+	find := func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+	weakest := make(map[int]float64)
+	type link struct {
+		i, j int
+		c    float64
+	}
+	var links []link
+	for i := range tickers {
+		for j := i + 1; j < len(tickers); j++ {
+			var xs, ys []float64
+			for day, x := range returns[i] {
+				if y, ok := returns[j][day]; ok {
+					xs, ys = append(xs, x), append(ys, y)
+				}
+			}
+			if len(xs) < minCorrelationObservations {
+				continue
+			}
+			c := util.Correlation(xs, ys)
+			m.Matrix[i][j], m.Matrix[j][i] = &c, &c
+			if c >= threshold {
+				links = append(links, link{i, j, c})
+			}
+		}
+	}
+	for _, l := range links {
+		a, b := find(l.i), find(l.j)
+		if a != b {
+			parent[b] = a
+		}
+	}
+	for _, l := range links {
+		root := find(l.i)
+		if c, seen := weakest[root]; !seen || l.c < c {
+			weakest[root] = l.c
+		}
+	}
+
+	members := make(map[int][]string)
+	for i, ticker := range tickers {
+		root := find(i)
+		members[root] = append(members[root], ticker)
+	}
+	for root, group := range members {
+		if len(group) < 2 {
+			continue
+		}
+		cluster := CorrelationCluster{Tickers: group, MinCorrelation: weakest[root]}
+		for _, ticker := range group {
+			cluster.WeightPct += weightOf[ticker]
+		}
+		m.Clusters = append(m.Clusters, cluster)
+	}
+	sort.Slice(m.Clusters, func(i, j int) bool {
+		if m.Clusters[i].WeightPct != m.Clusters[j].WeightPct {
+			return m.Clusters[i].WeightPct > m.Clusters[j].WeightPct
+		}
+		return m.Clusters[i].Tickers[0] < m.Clusters[j].Tickers[0]
+	})
+	return m
+}
+
+func concentrationWarnings(l ConcentrationLimits, stats ConcentrationStats, weights []PositionWeight, clusters []CorrelationCluster) []ConcentrationWarning {
+	warnings := []ConcentrationWarning{}
+	for _, w := range weights {
+		if w.WeightPct <= l.MaxPositionPct {
+			break
+		}
+		warnings = append(warnings, ConcentrationWarning{
+			Kind: "position-weight", Tickers: []string{w.Ticker}, Value: w.WeightPct, Limit: l.MaxPositionPct,
+			Message: fmt.Sprintf("%s is %.1f%% of the portfolio, above the %.1f%% limit", w.Ticker, w.WeightPct, l.MaxPositionPct),
+		})
+	}
+	if stats.Top5WeightPct > l.MaxTop5Pct && len(weights) > 5 {
+		warnings = append(warnings, ConcentrationWarning{
+			Kind: "top5-weight", Value: stats.Top5WeightPct, Limit: l.MaxTop5Pct,
+			Message: fmt.Sprintf("the five largest positions are %.1f%% of the portfolio, above the %.1f%% limit", stats.Top5WeightPct, l.MaxTop5Pct),
+		})
+	}
+	if stats.HHI > l.MaxHHI {
+		warnings = append(warnings, ConcentrationWarning{
+			Kind: "hhi", Value: stats.HHI, Limit: l.MaxHHI,
+			Message: fmt.Sprintf("Herfindahl index %.3f is above the %.3f limit", stats.HHI, l.MaxHHI),
+		})
+	}
+	if stats.Positions > 0 && stats.EffectiveBets < l.MinEffectiveBets {
+		warnings = append(warnings, ConcentrationWarning{
+			Kind: "effective-bets", Value: stats.EffectiveBets, Limit: l.MinEffectiveBets,
+			Message: fmt.Sprintf("%.1f effective bets is below the minimum of %.1f", stats.EffectiveBets, l.MinEffectiveBets),
+		})
+	}
+	for _, c := range clusters {
+		if c.WeightPct <= l.MaxClusterPct {
+			break
+		}
+		warnings = append(warnings, ConcentrationWarning{
+			Kind: "correlated-cluster", Tickers: c.Tickers, Value: c.WeightPct, Limit: l.MaxClusterPct,
+			Message: fmt.Sprintf("correlated positions %v are %.1f%% of the portfolio, above the %.1f%% limit", c.Tickers, c.WeightPct, l.MaxClusterPct),
+		})
+	}
+	return warnings
+}
@@ -0,0 +1,171 @@
+package portfolio
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// SplitEvent is a split reported by a price provider. Ratio is new shares per
+// old share, so reverse splits have a ratio below one.
+type SplitEvent struct {
+	Ticker string    `json:"ticker"`
+	Date   time.Time `json:"date"`
+	Ratio  Decimal   `json:"ratio"`
+}
+
+// ParseSplitRatio reads a split ratio written as "10:1", "10-for-1", "1:10" or
+// a plain number of new shares per old share.
+func ParseSplitRatio(s string) (Decimal, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for _, sep := range []string{":", "-for-", "/"} {
+		if newShares, oldShares, ok := strings.Cut(s, sep); ok {
+			n, err1 := ParseDecimal(newShares)
+			o, err2 := ParseDecimal(oldShares)
+			if err1 != nil || err2 != nil || !n.IsPositive() || !o.IsPositive() {
+				return Decimal{}, invalidTx("invalid split ratio %q", s)
+			}
+			return n.Div(o), nil
+		}
+	}
+	r, err := ParseDecimal(s)
+	if err != nil || !r.IsPositive() {
+		return Decimal{}, invalidTx("invalid split ratio %q", s)
+	}
+	return r, nil
+}
+
+// IsCorporateAction reports whether the transaction is a split, a stock
+// dividend or a rename, which change share counts and tickers but never move cash.
+func (t Transaction) IsCorporateAction() bool {
+	return t.Type == TxSplit || t.Type == TxStockDividend || t.Type == TxRename
+}
+
+// shareRatio is new shares per old share; renames without a ratio keep the count.
+func (t Transaction) shareRatio() Decimal {
+	if !t.Ratio.IsPositive() {
+		return NewDecimal(1)
+	}
+	return t.Ratio
+}
+
+// CorporateActions returns the recorded splits, stock dividends and renames, oldest first.
+func (p *Portfolio) CorporateActions() []Transaction {
+	res := []Transaction{}
+	for _, tx := range p.Transactions {
+		if tx.IsCorporateAction() {
+			res = append(res, tx)
+		}
+	}
+	return res
+}
+
+// RecordSplits records the events not already in the ledger, skipping splits
+// on or before the position's entry date since those shares were bought at
+// post-split prices.
+func (p *Portfolio) RecordSplits(events []SplitEvent) ([]Transaction, error) {
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Date.Before(events[j].Date) })
+	var recorded []Transaction
+	for _, ev := range events {
+		pos, ok := p.Positions[ev.Ticker]
+		if !ok || !ev.Ratio.IsPositive() || ev.Ratio == NewDecimal(1) || !dayOf(ev.Date).After(dayOf(pos.EntryDate)) || p.hasSplit(ev) {
+			continue
+		}
+		tx, err := p.Record(Transaction{Type: TxSplit, Ticker: ev.Ticker, Date: dayOf(ev.Date), Ratio: ev.Ratio, Note: "detected split"})
+		if err != nil {
+			return recorded, err
+		}
+		recorded = append(recorded, tx)
+	}
+	return recorded, nil
+}
+
+func (p *Portfolio) hasSplit(ev SplitEvent) bool {
+	for _, tx := range p.Transactions {
+		if tx.Type == TxSplit && tx.Ticker == ev.Ticker && dayOf(tx.Date).Equal(dayOf(ev.Date)) {
+			return true
+		}
+	}
+	return false
+}
+
+// adjustForCorporateAction rescales what the ledger replay does not own so
+// quotes after a split or rename compare with those before it: the current and
+// peak price, stored snapshot prices and price alert thresholds. Renames also
+// move targets, allocation tags and alerts to the new ticker. prior is the
+// position as it was before the action; mergedInto reports that the new ticker
+// was already held and keeps its own prices.
+func (p *Portfolio) adjustForCorporateAction(tx Transaction, prior Position, mergedInto bool) {
+	ratio := tx.shareRatio()
+	if tx.Type == TxStockDividend && prior.Shares.IsPositive() {
+		ratio = prior.Shares.Add(tx.Quantity).Div(prior.Shares)
+	}
+	switch tx.Type {
+	case TxSplit, TxStockDividend:
+		if pos, ok := p.Positions[tx.Ticker]; ok {
+			// A quote taken on or after the split date is already post-split.
+			if dayOf(pos.LastUpdate).Before(dayOf(tx.Date)) {
+				pos.CurrentPrice /= ratio.Float()
+			}
+			pos.PeakPrice /= ratio.Float()
+			pos.clampPeak()
+		}
+		p.rescaleHistory(tx.Ticker, tx.Ticker, tx.Date, ratio)
+		p.rescaleAlerts(tx.Ticker, tx.Ticker, ratio)
+	case TxRename:
+		if pos, ok := p.Positions[tx.NewTicker]; ok && !mergedInto {
+			pos.CurrentPrice = prior.CurrentPrice / ratio.Float()
+			pos.PeakPrice = prior.PeakPrice / ratio.Float()
+			pos.LastUpdate = prior.LastUpdate
+			pos.Currency = prior.Currency
+			pos.FXRate = prior.FXRate
+			pos.Note, pos.Tags, pos.Strategy = prior.Note, prior.Tags, prior.Strategy
+		}
+		p.rescaleHistory(tx.Ticker, tx.NewTicker, time.Time{}, ratio)
+		p.rescaleAlerts(tx.Ticker, tx.NewTicker, ratio)
+		for i := range p.Targets {
+			if p.Targets[i].Ticker == tx.Ticker {
+				p.Targets[i].Ticker = tx.NewTicker
+			}
+		}
+		if tag, ok := p.AllocationTags[tx.Ticker]; ok {
+			delete(p.AllocationTags, tx.Ticker)
+			if _, exists := p.AllocationTags[tx.NewTicker]; !exists {
+				p.AllocationTags[tx.NewTicker] = tag
+			}
+		}
+	}
+}
+
+// rescaleHistory divides the stored prices of from by ratio and files them
+// under to. A zero before rescales every snapshot, otherwise only those taken
+// before that day.
+func (p *Portfolio) rescaleHistory(from, to string, before time.Time, ratio Decimal) {
+	for i := range p.History {
+		snap := &p.History[i]
+		if !before.IsZero() && !dayOf(snap.Time).Before(dayOf(before)) {
+			continue
+		}
+		price, ok := snap.Prices[from]
+		if !ok {
+			continue
+		}
+		delete(snap.Prices, from)
+		if _, exists := snap.Prices[to]; !exists || from == to {
+			snap.Prices[to] = price / ratio.Float()
+		}
+	}
+}
+
+func (p *Portfolio) rescaleAlerts(from, to string, ratio Decimal) {
+	for i := range p.Alerts {
+		r := &p.Alerts[i]
+		if r.Ticker != from {
+			continue
+		}
+		r.Ticker = to
+		if r.Kind == AlertStopPrice || r.Kind == AlertTargetPrice {
+			r.Threshold /= ratio.Float()
+		}
+	}
+}
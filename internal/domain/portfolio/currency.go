@@ -0,0 +1,82 @@
+package portfolio
+
+import (
+	"sort"
+	"strings"
+)
+
+// DefaultCurrency is assumed for portfolios and positions that predate currency support.
+const DefaultCurrency = "USD"
+
+func NormalizeCurrency(c string) string {
+	c = strings.ToUpper(strings.TrimSpace(c))
+	if c == "" {
+		return DefaultCurrency
+	}
+	return c
+}
+
+// Base returns the currency TotalValue, Metrics and the ledger's cash are reported in.
+func (p *Portfolio) Base() string {
+	return NormalizeCurrency(p.BaseCurrency)
+}
+
+// QuoteCurrency is the currency the position's prices are quoted in.
+func (p *Position) QuoteCurrency() string {
+	return NormalizeCurrency(p.Currency)
+}
+
+// Rate converts the position's quote currency into the portfolio base currency.
+func (p *Position) Rate() float64 {
+	if p.FXRate <= 0 {
+		return 1
+	}
+	return p.FXRate
+}
+
+// LocalCost is the cost basis in the quote currency. Positions entered without
+// a local figure are assumed to have been bought at the current rate.
+func (p *Position) LocalCost() Decimal {
+	if !p.LocalCostBasis.IsZero() {
+		return p.LocalCostBasis
+	}
+	return p.CostBasis.MulFloat(1 / p.Rate()).RoundTo(p.QuoteCurrency())
+}
+
+// CurrencyExposure is the part of a portfolio held in one currency.
+type CurrencyExposure struct {
+	Currency   string  `json:"currency"`
+	LocalValue Decimal `json:"local_value"`
+	BaseValue  Decimal `json:"base_value"`
+	FXPnL      Decimal `json:"fx_pnl"`
+}
+
+func (p *Portfolio) CurrencyExposures() []CurrencyExposure {
+	base := p.Base()
+	byCcy := map[string]*CurrencyExposure{
+		base: {Currency: base, LocalValue: p.Cash, BaseValue: p.Cash},
+	}
+	for _, pos := range p.Positions {
+		ccy := pos.QuoteCurrency()
+		e, ok := byCcy[ccy]
+		if !ok {
+			e = &CurrencyExposure{Currency: ccy}
+			byCcy[ccy] = e
+		}
+		e.LocalValue = e.LocalValue.Add(pos.LocalValue())
+		e.BaseValue = e.BaseValue.Add(pos.CurrentValue())
+		e.FXPnL = e.FXPnL.Add(pos.FXPnL())
+	}
+
+	res := make([]CurrencyExposure, 0, len(byCcy))
+	for _, e := range byCcy {
+		res = append(res, *e)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Currency < res[j].Currency })
+	return res
+}
+
+// FXPnL is the part of the unrealized P&L caused by exchange-rate moves since purchase.
+func (p *Position) FXPnL() Decimal {
+	return p.signed(p.LocalCost().MulFloat(p.Rate()).Sub(p.CostBasis))
+}
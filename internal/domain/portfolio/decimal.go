@@ -0,0 +1,316 @@
+package portfolio
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+const (
+	decimalPlaces = 8
+	decimalScale  = 100_000_000
+)
+
+// Decimal is a fixed-point number with eight decimal places, used for share
+// quantities and booked amounts so that sums of cash, cost basis and proceeds
+// are exact. The units are a 128-bit integer, so it holds values up to about
+// ±1.7e30, far beyond any amount in won or yen; arithmetic beyond that
+// saturates at the limit, which Overflowed reports. Decimals encode to JSON
+// as plain numbers written out in full, and decode from numbers or strings
+// without passing through float64.
+type Decimal struct {
+	// hi and lo are the two's-complement halves of the multiple of 1e-8.
+	hi int64
+	lo uint64
+}
+
+// ErrOutOfRange is returned for amounts beyond the range of a Decimal.
+var ErrOutOfRange = errors.New("amount out of range")
+
+var (
+	maxDecimal = Decimal{hi: math.MaxInt64, lo: math.MaxUint64}
+	minDecimal = Decimal{hi: math.MinInt64}
+
+	bigScale = big.NewInt(decimalScale)
+	bigMax   = maxDecimal.big()
+	bigMin   = minDecimal.big()
+)
+
+// maxDecimalFloat is the magnitude beyond which a float saturates.
+const maxDecimalFloat = 0x1p127 / decimalScale
+
+// NewDecimal converts f using its shortest decimal representation, so 0.1
+// becomes exactly 0.1, rounding half away from zero beyond eight places.
+// Values out of range saturate and NaN becomes zero.
+func NewDecimal(f float64) Decimal {
+	switch {
+	case math.IsNaN(f):
+		return Decimal{}
+	case f >= maxDecimalFloat:
+		return maxDecimal
+	case f <= -maxDecimalFloat:
+		return minDecimal
+	}
+	d, err := ParseDecimal(strconv.FormatFloat(f, 'g', -1, 64))
+	if err != nil {
+		return saturated(int(math.Copysign(1, f)))
+	}
+	return d
+}
+
+// ParseDecimal reads a decimal number such as "1234.56", "-0.5" or "1e-7",
+// rounding half away from zero beyond eight places.
+func ParseDecimal(s string) (Decimal, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+	q := quoRound(new(big.Int).Mul(r.Num(), bigScale), r.Denom())
+	if q.Cmp(bigMax) > 0 || q.Cmp(bigMin) < 0 {
+		return Decimal{}, fmt.Errorf("%w: decimal %q", ErrOutOfRange, s)
+	}
+	return fromBig(q), nil
+}
+
+// Add returns d + e, saturating at the range limits. A saturated operand
+// stays saturated, so an overflow is never cancelled out by later sums.
+func (d Decimal) Add(e Decimal) Decimal {
+	switch {
+	case d.Overflowed():
+		return d
+	case e.Overflowed():
+		return e
+	}
+	lo, carry := bits.Add64(d.lo, e.lo, 0)
+	hi := d.hi + e.hi + int64(carry)
+	if (d.hi < 0) == (e.hi < 0) && (hi < 0) != (d.hi < 0) {
+		return saturated(e.Sign())
+	}
+	return Decimal{hi: hi, lo: lo}
+}
+
+// Sub returns d − e, saturating at the range limits.
+func (d Decimal) Sub(e Decimal) Decimal { return d.Add(e.Neg()) }
+
+func (d Decimal) Neg() Decimal {
+	switch d {
+	case minDecimal:
+		return maxDecimal
+	case maxDecimal:
+		return minDecimal
+	}
+	lo, borrow := bits.Sub64(0, d.lo, 0)
+	return Decimal{hi: -d.hi - int64(borrow), lo: lo}
+}
+
+// saturated is the range limit on the side of sign.
+func saturated(sign int) Decimal {
+	if sign < 0 {
+		return minDecimal
+	}
+	return maxDecimal
+}
+
+// Overflowed reports whether d saturated at the range limit, so it no longer
+// holds the true result of the arithmetic that produced it.
+func (d Decimal) Overflowed() bool {
+	return d == maxDecimal || d == minDecimal
+}
+
+// Mul returns d × e rounded to eight places.
+func (d Decimal) Mul(e Decimal) Decimal {
+	if d.Overflowed() || e.Overflowed() {
+		return saturated(d.Sign() * e.Sign())
+	}
+	return mulDiv(d.big(), e.big(), bigScale)
+}
+
+// MulFloat multiplies by a price, rate or ratio given as a float. The product
+// is taken in float64, which is exact to well below a cent for any amount a
+// portfolio holds, and rounded to eight places.
+func (d Decimal) MulFloat(f float64) Decimal {
+	if d.Overflowed() && f != 0 {
+		return saturated(d.Sign() * int(math.Copysign(1, f)))
+	}
+	return NewDecimal(d.Float() * f)
+}
+
+// Div returns d ÷ e rounded to eight places, or zero when e is zero.
+func (d Decimal) Div(e Decimal) Decimal {
+	if e.IsZero() {
+		return Decimal{}
+	}
+	if d.Overflowed() {
+		return saturated(d.Sign() * e.Sign())
+	}
+	return mulDiv(d.big(), bigScale, e.big())
+}
+
+// Scale returns d × num ÷ den rounded to eight places, or zero when den is
+// zero. It splits an amount pro rata without rounding the ratio first.
+func (d Decimal) Scale(num, den Decimal) Decimal {
+	if den.IsZero() {
+		return Decimal{}
+	}
+	if d.Overflowed() && !num.IsZero() {
+		return saturated(d.Sign() * num.Sign() * den.Sign())
+	}
+	return mulDiv(d.big(), num.big(), den.big())
+}
+
+// Round rounds half away from zero to the given number of decimal places.
+func (d Decimal) Round(places int) Decimal {
+	if places >= decimalPlaces || d.Overflowed() {
+		return d
+	}
+	if places < 0 {
+		places = 0
+	}
+	step := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimalPlaces-places)), nil)
+	q := quoRound(d.big(), step)
+	return fromBig(q.Mul(q, step))
+}
+
+// RoundTo rounds an amount to the minor unit of currency.
+func (d Decimal) RoundTo(currency string) Decimal { return d.Round(CurrencyPlaces(currency)) }
+
+func (d Decimal) Sign() int {
+	switch {
+	case d.hi < 0:
+		return -1
+	case d.hi == 0 && d.lo == 0:
+		return 0
+	}
+	return 1
+}
+
+func (d Decimal) IsZero() bool     { return d.Sign() == 0 }
+func (d Decimal) IsPositive() bool { return d.Sign() > 0 }
+func (d Decimal) IsNegative() bool { return d.Sign() < 0 }
+
+// Cmp returns -1, 0 or 1 as d is less than, equal to or greater than e.
+func (d Decimal) Cmp(e Decimal) int {
+	switch {
+	case d.hi < e.hi, d.hi == e.hi && d.lo < e.lo:
+		return -1
+	case d.hi > e.hi, d.hi == e.hi && d.lo > e.lo:
+		return 1
+	}
+	return 0
+}
+
+func (d Decimal) Abs() Decimal {
+	if d.IsNegative() {
+		return d.Neg()
+	}
+	return d
+}
+
+func MinDecimal(a, b Decimal) Decimal {
+	if a.Cmp(b) <= 0 {
+		return a
+	}
+	return b
+}
+
+// Float returns the nearest float64, for statistics and display.
+func (d Decimal) Float() float64 {
+	if d.IsNegative() {
+		return -d.Neg().Float()
+	}
+	return (float64(d.hi)*0x1p64 + float64(d.lo)) / decimalScale
+}
+
+// String writes the exact value without trailing zeros.
+func (d Decimal) String() string {
+	sign := ""
+	if d.IsNegative() {
+		sign = "-"
+	}
+	whole, frac := new(big.Int).QuoRem(new(big.Int).Abs(d.big()), bigScale, new(big.Int))
+	if frac.Sign() == 0 {
+		return sign + whole.String()
+	}
+	fs := strings.TrimRight(fmt.Sprintf("%08d", frac.Int64()), "0")
+	return sign + whole.String() + "." + fs
+}
+
+// StringFixed writes the value rounded to places decimals, padding with zeros.
+func (d Decimal) StringFixed(places int) string {
+	s := d.Round(places).String()
+	if places <= 0 {
+		return s
+	}
+	whole, frac, _ := strings.Cut(s, ".")
+	return whole + "." + frac + strings.Repeat("0", places-len(frac))
+}
+
+func (d Decimal) MarshalJSON() ([]byte, error) { return []byte(d.String()), nil }
+
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "null" || s == "" {
+		*d = Decimal{}
+		return nil
+	}
+	v, err := ParseDecimal(s)
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
+
+// big returns the units of d.
+func (d Decimal) big() *big.Int {
+	b := new(big.Int).SetInt64(d.hi)
+	b.Lsh(b, 64)
+	return b.Or(b, new(big.Int).SetUint64(d.lo))
+}
+
+// fromBig returns the Decimal of units b, saturating outside the range.
+func fromBig(b *big.Int) Decimal {
+	switch {
+	case b.Cmp(bigMax) >= 0:
+		return maxDecimal
+	case b.Cmp(bigMin) <= 0:
+		return minDecimal
+	}
+	lo := new(big.Int).And(b, new(big.Int).SetUint64(math.MaxUint64)).Uint64()
+	return Decimal{hi: new(big.Int).Rsh(b, 64).Int64(), lo: lo}
+}
+
+// mulDiv returns a × b ÷ c rounded half away from zero, saturating on overflow.
+func mulDiv(a, b, c *big.Int) Decimal {
+	return fromBig(quoRound(new(big.Int).Mul(a, b), c))
+}
+
+// quoRound returns n ÷ d rounded half away from zero.
+func quoRound(n, d *big.Int) *big.Int {
+	q, r := new(big.Int).QuoRem(n, d, new(big.Int))
+	if r.Sign() != 0 && new(big.Int).Abs(new(big.Int).Lsh(r, 1)).Cmp(new(big.Int).Abs(d)) >= 0 {
+		q.Add(q, big.NewInt(int64(n.Sign()*d.Sign())))
+	}
+	return q
+}
+
+// currencyPlaces lists currencies whose minor unit is not the cent.
+var currencyPlaces = map[string]int{
+	"JPY": 0, "KRW": 0, "VND": 0, "CLP": 0, "ISK": 0, "HUF": 0,
+	"BHD": 3, "KWD": 3, "OMR": 3, "JOD": 3, "TND": 3,
+	"BTC": 8, "ETH": 8,
+}
+
+// CurrencyPlaces is the number of decimal places amounts in currency are
+// rounded to when booked: 0 for yen and won, 3 for the Gulf dinars, 8 for
+// crypto and 2 for everything else.
+func CurrencyPlaces(currency string) int {
+	if places, ok := currencyPlaces[NormalizeCurrency(currency)]; ok {
+		return places
+	}
+	return 2
+}
@@ -0,0 +1,140 @@
+package portfolio
+
+import (
+	"sort"
+	"time"
+)
+
+// shortDividendNote marks the fee a short holding pays in place of a dividend,
+// which is a carrying cost rather than a fee.
+const shortDividendNote = "dividend paid on short"
+
+// FeeBreakdown totals fees by kind in the base currency. Account fees are fee
+// transactions: custody, platform or advisory charges, posted to the account
+// or, with a ticker, to a position.
+type FeeBreakdown struct {
+	Commission Decimal `json:"commission"`
+	Exchange   Decimal `json:"exchange"`
+	Regulatory Decimal `json:"regulatory"`
+	Account    Decimal `json:"account"`
+	Total      Decimal `json:"total"`
+}
+
+func (b *FeeBreakdown) addTrade(tx Transaction, base string) {
+	kinds := []*Decimal{&b.Commission, &b.Exchange, &b.Regulatory}
+	for i, f := range []Decimal{tx.Commission, tx.ExchangeFee, tx.RegulatoryFee} {
+		amount := tx.toBase(f.RoundTo(tx.Currency), base)
+		*kinds[i] = kinds[i].Add(amount)
+		b.Total = b.Total.Add(amount)
+	}
+}
+
+func (b *FeeBreakdown) addAccount(tx Transaction, base string) {
+	amount := tx.toBase(tx.Amount.RoundTo(tx.Currency), base)
+	b.Account = b.Account.Add(amount)
+	b.Total = b.Total.Add(amount)
+}
+
+// tradeFeePct is the trade fees as a percentage of notional.
+func (b FeeBreakdown) tradeFeePct(notional Decimal) float64 {
+	if notional.IsZero() {
+		return 0
+	}
+	return b.Total.Sub(b.Account).Float() / notional.Float() * 100
+}
+
+// PositionFees is the fee drag of one ticker. PctOfTraded is the trade fees as
+// a percentage of the notional traded.
+type PositionFees struct {
+	Ticker string `json:"ticker"`
+	FeeBreakdown
+	Trades         int     `json:"trades"`
+	TradedNotional Decimal `json:"traded_notional"`
+	PctOfTraded    float64 `json:"pct_of_traded"`
+}
+
+// FeeReport is the fee drag of the portfolio between From and To. DragPct is
+// the total fees as a percentage of the average portfolio value over the
+// period, taken from the stored history or, without any, the current value.
+type FeeReport struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	FeeBreakdown
+	Trades         int            `json:"trades"`
+	TradedNotional Decimal        `json:"traded_notional"`
+	PctOfTraded    float64        `json:"pct_of_traded"`
+	AverageValue   float64        `json:"average_value"`
+	DragPct        float64        `json:"drag_pct"`
+	Positions      []PositionFees `json:"positions"`
+}
+
+// FeeReport totals the trade and account fees recorded between from and to.
+// A zero from includes everything before to. Fees of renamed tickers are
+// reported under the current ticker.
+func (p *Portfolio) FeeReport(from, to time.Time) FeeReport {
+	from, to = dayOf(from), dayOf(to)
+	base := p.Base()
+	renamed := p.renames()
+	report := FeeReport{From: from, To: to, Positions: []PositionFees{}}
+
+	byTicker := make(map[string]*PositionFees)
+	position := func(ticker string) *PositionFees {
+		ticker = resolveTicker(renamed, ticker)
+		pf := byTicker[ticker]
+		if pf == nil {
+			pf = &PositionFees{Ticker: ticker}
+			byTicker[ticker] = pf
+		}
+		return pf
+	}
+	for _, tx := range p.Transactions {
+		if d := dayOf(tx.Date); d.Before(from) || d.After(to) {
+			continue
+		}
+		switch {
+		case tx.IsTrade():
+			notional := tx.toBase(tx.Notional(), base)
+			report.addTrade(tx, base)
+			report.Trades++
+			report.TradedNotional = report.TradedNotional.Add(notional)
+			pf := position(tx.Ticker)
+			pf.addTrade(tx, base)
+			pf.Trades++
+			pf.TradedNotional = pf.TradedNotional.Add(notional)
+		case tx.Type == TxFee && tx.Note != shortDividendNote:
+			report.addAccount(tx, base)
+			if tx.Ticker != "" {
+				position(tx.Ticker).addAccount(tx, base)
+			}
+		}
+	}
+
+	for _, pf := range byTicker {
+		pf.PctOfTraded = pf.tradeFeePct(pf.TradedNotional)
+		report.Positions = append(report.Positions, *pf)
+	}
+	sort.Slice(report.Positions, func(i, j int) bool { return report.Positions[i].Ticker < report.Positions[j].Ticker })
+	report.PctOfTraded = report.tradeFeePct(report.TradedNotional)
+
+	report.AverageValue = p.averageValue(from, to)
+	if report.AverageValue > 0 {
+		report.DragPct = report.Total.Float() / report.AverageValue * 100
+	}
+	return report
+}
+
+// averageValue is the mean stored portfolio value between from and to, or the
+// current value when no snapshot falls in the period.
+func (p *Portfolio) averageValue(from, to time.Time) float64 {
+	sum, n := 0.0, 0
+	for _, snap := range p.History {
+		if d := dayOf(snap.Time); !d.Before(from) && !d.After(to) {
+			sum += snap.Value.Float()
+			n++
+		}
+	}
+	if n == 0 {
+		return p.TotalValue().Float()
+	}
+	return sum / float64(n)
+}
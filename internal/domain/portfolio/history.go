@@ -0,0 +1,98 @@
+package portfolio
+
+import "time"
+
+// Snapshot is a stored valuation of the portfolio. Refreshes on the same day are
+// merged into one snapshot that keeps the day's high; the daily close job marks
+// the last snapshot of the day with Close. QuoteDate is the latest market date
+// among the position quotes, when the price provider reports one.
+type Snapshot struct {
+	Time      time.Time          `json:"time"`
+	Value     Decimal            `json:"value"`
+	Cash      Decimal            `json:"cash"`
+	High      Decimal            `json:"high"`
+	Close     bool               `json:"close,omitempty"`
+	Prices    map[string]float64 `json:"prices,omitempty"`
+	QuoteDate *time.Time         `json:"quote_date,omitempty"`
+}
+
+type EquityPoint struct {
+	Time                time.Time `json:"time"`
+	Value               float64   `json:"value"`
+	HighWaterMark       float64   `json:"high_water_mark"`
+	DrawdownFromPeakPct float64   `json:"drawdown_from_peak_pct"`
+}
+
+type EquityCurve struct {
+	HighWaterMark float64       `json:"high_water_mark"`
+	Points        []EquityPoint `json:"points"`
+}
+
+// RecordSnapshot values the portfolio at t and appends it to History.
+func (p *Portfolio) RecordSnapshot(t time.Time, isClose bool) Snapshot {
+	value := p.TotalValue()
+	snap := Snapshot{Time: t, Value: value, Cash: p.Cash, High: value, Close: isClose, Prices: make(map[string]float64, len(p.Positions))}
+	for ticker, pos := range p.Positions {
+		snap.Prices[ticker] = pos.CurrentPrice
+		if q := pos.QuoteDate; q != nil && (snap.QuoteDate == nil || q.After(*snap.QuoteDate)) {
+			snap.QuoteDate = q
+		}
+	}
+
+	if n := len(p.History); n > 0 {
+		last := p.History[n-1]
+		if !last.Close && dayOf(last.Time).Equal(dayOf(t)) {
+			if last.High.Cmp(snap.High) > 0 {
+				snap.High = last.High
+			}
+			p.History = p.History[:n-1]
+		}
+	}
+	p.History = append(p.History, snap)
+
+	if snap.High.Cmp(p.PeakValue) > 0 {
+		p.PeakValue = snap.High
+	}
+	return snap
+}
+
+// HighWaterMark is the highest value in the stored history. Portfolios without
+// history fall back to the stored PeakValue.
+func (p *Portfolio) HighWaterMark() Decimal {
+	if len(p.History) == 0 {
+		return p.PeakValue
+	}
+	var hwm Decimal
+	for _, s := range p.History {
+		if s.High.Cmp(hwm) > 0 {
+			hwm = s.High
+		}
+	}
+	return hwm
+}
+
+// EquityCurve returns the stored valuations between from and to with the running
+// high-water mark, which includes every snapshot before from.
+func (p *Portfolio) EquityCurve(from, to time.Time) EquityCurve {
+	curve := EquityCurve{Points: []EquityPoint{}}
+	hwm := 0.0
+	for _, s := range p.History {
+		if s.Time.After(to) {
+			break
+		}
+		if high := s.High.Float(); high > hwm {
+			hwm = high
+		}
+		if s.Time.Before(from) {
+			continue
+		}
+		value := s.Value.Float()
+		dd := 0.0
+		if hwm > 0 {
+			dd = (hwm - value) / hwm * 100
+		}
+		curve.Points = append(curve.Points, EquityPoint{Time: s.Time, Value: value, HighWaterMark: hwm, DrawdownFromPeakPct: dd})
+	}
+	curve.HighWaterMark = hwm
+	return curve
+}
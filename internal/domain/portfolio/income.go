@@ -0,0 +1,205 @@
+package portfolio
+
+import (
+	"sort"
+	"time"
+)
+
+// DividendEvent is a cash dividend per share reported by a price provider.
+// Price is the close on the ex-date, used when the dividend is reinvested.
+type DividendEvent struct {
+	Ticker   string    `json:"ticker"`
+	ExDate   time.Time `json:"ex_date"`
+	PerShare float64   `json:"per_share"`
+	Price    float64   `json:"price,omitempty"`
+}
+
+// TickerIncome is the dividend income of one ticker in base currency.
+// Yields use the trailing twelve months against the position's cost basis and
+// current value.
+type TickerIncome struct {
+	Ticker          string  `json:"ticker"`
+	Total           float64 `json:"total"`
+	Reinvested      float64 `json:"reinvested"`
+	TTM             float64 `json:"ttm"`
+	YieldOnCostPct  float64 `json:"yield_on_cost_pct"`
+	CurrentYieldPct float64 `json:"current_yield_pct"`
+}
+
+type MonthlyIncome struct {
+	Month  string  `json:"month"`
+	Amount float64 `json:"amount"`
+}
+
+// IncomeSummary totals dividends received between From and To. TTM is the
+// twelve months ending at To; portfolio yields only count tickers still held.
+type IncomeSummary struct {
+	From            time.Time       `json:"from"`
+	To              time.Time       `json:"to"`
+	Total           float64         `json:"total"`
+	Reinvested      float64         `json:"reinvested"`
+	TTM             float64         `json:"ttm"`
+	YieldOnCostPct  float64         `json:"yield_on_cost_pct"`
+	CurrentYieldPct float64         `json:"current_yield_pct"`
+	ByTicker        []TickerIncome  `json:"by_ticker"`
+	ByMonth         []MonthlyIncome `json:"by_month"`
+}
+
+// IncomeSummary reports dividends paid between from and to. A zero from
+// includes everything before to.
+func (p *Portfolio) IncomeSummary(from, to time.Time) IncomeSummary {
+	from, to = dayOf(from), dayOf(to)
+	ttmStart := to.AddDate(-1, 0, 0)
+	renamed := p.renames()
+	summary := IncomeSummary{From: from, To: to, ByTicker: []TickerIncome{}, ByMonth: []MonthlyIncome{}}
+
+	byTicker := make(map[string]*TickerIncome)
+	byMonth := make(map[string]float64)
+	for _, tx := range p.Transactions {
+		if tx.Type != TxDividend || tx.Ticker == "" {
+			continue
+		}
+		d := dayOf(tx.Date)
+		if d.After(to) {
+			continue
+		}
+		ticker := resolveTicker(renamed, tx.Ticker)
+		ti := byTicker[ticker]
+		if ti == nil {
+			ti = &TickerIncome{Ticker: ticker}
+			byTicker[ticker] = ti
+		}
+		amount := tx.toBase(tx.Amount.RoundTo(tx.Currency), p.Base()).Float()
+		if d.After(ttmStart) {
+			ti.TTM += amount
+		}
+		if d.Before(from) {
+			continue
+		}
+		ti.Total += amount
+		summary.Total += amount
+		if tx.Reinvest {
+			ti.Reinvested += amount
+			summary.Reinvested += amount
+		}
+		byMonth[d.Format("2006-01")] += amount
+	}
+
+	heldTTM, cost, value := 0.0, 0.0, 0.0
+	for ticker, ti := range byTicker {
+		summary.TTM += ti.TTM
+		if pos, ok := p.Positions[ticker]; ok && !pos.IsShort() {
+			ti.YieldOnCostPct, ti.CurrentYieldPct = pos.yields(ti.TTM)
+			heldTTM += ti.TTM
+			cost += pos.CostBasis.Float()
+			value += pos.CurrentValue().Float()
+		}
+		if ti.Total != 0 || ti.TTM != 0 {
+			summary.ByTicker = append(summary.ByTicker, *ti)
+		}
+	}
+	if cost > 0 {
+		summary.YieldOnCostPct = heldTTM / cost * 100
+	}
+	if value > 0 {
+		summary.CurrentYieldPct = heldTTM / value * 100
+	}
+
+	sort.Slice(summary.ByTicker, func(i, j int) bool { return summary.ByTicker[i].Ticker < summary.ByTicker[j].Ticker })
+	for month, amount := range byMonth {
+		summary.ByMonth = append(summary.ByMonth, MonthlyIncome{Month: month, Amount: amount})
+	}
+	sort.Slice(summary.ByMonth, func(i, j int) bool { return summary.ByMonth[i].Month < summary.ByMonth[j].Month })
+	return summary
+}
+
+// dividends returns all dividends received on ticker, including under earlier
+// tickers it was renamed from, and those of the twelve months ending at now.
+func (p *Portfolio) dividends(ticker string, now time.Time) (total, ttm Decimal) {
+	renamed := p.renames()
+	ttmStart := dayOf(now).AddDate(-1, 0, 0)
+	for _, tx := range p.Transactions {
+		if tx.Type != TxDividend || tx.Ticker == "" || resolveTicker(renamed, tx.Ticker) != ticker || tx.Date.After(now) {
+			continue
+		}
+		amount := tx.toBase(tx.Amount.RoundTo(tx.Currency), p.Base())
+		total = total.Add(amount)
+		if dayOf(tx.Date).After(ttmStart) {
+			ttm = ttm.Add(amount)
+		}
+	}
+	return total, ttm
+}
+
+// yields returns the yield on cost and current yield of an annual income.
+func (pos *Position) yields(annual float64) (onCost, current float64) {
+	if cost := pos.CostBasis.Float(); cost > 0 {
+		onCost = annual / cost * 100
+	}
+	if v := pos.CurrentValue().Float(); v > 0 {
+		current = annual / v * 100
+	}
+	return onCost, current
+}
+
+// DividendTransactions turns provider events into ledger entries for the
+// shares held at the close before each ex-date, skipping events already
+// recorded. Long holdings receive a dividend, reinvested when reinvest is set
+// and the event has a price; short holdings pay it as a fee.
+func (p *Portfolio) DividendTransactions(events []DividendEvent, reinvest bool) []Transaction {
+	sort.SliceStable(events, func(i, j int) bool { return events[i].ExDate.Before(events[j].ExDate) })
+	ledger := p.LedgerWithOpeningBalances()
+
+	var res []Transaction
+	for _, ev := range events {
+		if ev.PerShare <= 0 || p.hasDividend(ev) {
+			continue
+		}
+		cur := newLedgerCursor(ledger, p.Base())
+		cur.advance(dayOf(ev.ExDate).AddDate(0, 0, -1), func(Transaction) {})
+		shares := cur.shares[ev.Ticker]
+		if shares.IsZero() {
+			continue
+		}
+
+		tx := Transaction{Type: TxDividend, Ticker: ev.Ticker, Date: dayOf(ev.ExDate), Amount: shares.MulFloat(ev.PerShare), Note: "imported dividend"}
+		if shares.IsNegative() {
+			tx.Type, tx.Amount, tx.Note = TxFee, tx.Amount.Neg(), shortDividendNote
+		} else if reinvest && ev.Price > 0 {
+			tx.Reinvest, tx.Price = true, NewDecimal(ev.Price)
+		}
+		res = append(res, tx)
+	}
+	return res
+}
+
+func (p *Portfolio) hasDividend(ev DividendEvent) bool {
+	for _, tx := range p.Transactions {
+		if (tx.Type == TxDividend || tx.Type == TxFee) && tx.Ticker == ev.Ticker && dayOf(tx.Date).Equal(dayOf(ev.ExDate)) {
+			return true
+		}
+	}
+	return false
+}
+
+// renames maps every renamed ticker to the ticker it became.
+func (p *Portfolio) renames() map[string]string {
+	m := make(map[string]string)
+	for _, tx := range p.Transactions {
+		if tx.Type == TxRename {
+			m[tx.Ticker] = tx.NewTicker
+		}
+	}
+	return m
+}
+
+func resolveTicker(renamed map[string]string, ticker string) string {
+	for i := 0; i < len(renamed); i++ {
+		next, ok := renamed[ticker]
+		if !ok {
+			break
+		}
+		ticker = next
+	}
+	return ticker
+}
@@ -0,0 +1,190 @@
+package portfolio
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrInvalidInstrument is returned for malformed instrument definitions.
+var ErrInvalidInstrument = errors.New("invalid instrument")
+
+type AssetClass string
+
+const (
+	AssetEquity AssetClass = "equity"
+	AssetETF    AssetClass = "etf"
+	AssetFund   AssetClass = "fund"
+	AssetBond   AssetClass = "bond"
+	AssetCrypto AssetClass = "crypto"
+)
+
+func ParseAssetClass(s string) (AssetClass, error) {
+	switch c := AssetClass(strings.ToLower(strings.TrimSpace(s))); c {
+	case AssetEquity, AssetETF, AssetFund, AssetBond, AssetCrypto:
+		return c, nil
+	case "":
+		return AssetEquity, nil
+	default:
+		return "", fmt.Errorf("%w: unknown asset class %q", ErrInvalidInstrument, s)
+	}
+}
+
+// Instrument describes how a ticker trades and is quoted. Currency is the
+// quote currency; for crypto it is the market the pair is priced in, so ETHBTC
+// is an ETH instrument quoted in BTC. Symbols maps a price provider name to the
+// symbol it knows the instrument by, for listings whose provider symbol
+// differs from the ticker.
+type Instrument struct {
+	Ticker     string            `json:"ticker"`
+	Name       string            `json:"name,omitempty"`
+	AssetClass AssetClass        `json:"asset_class"`
+	Exchange   string            `json:"exchange,omitempty"`
+	Currency   string            `json:"currency,omitempty"`
+	Symbols    map[string]string `json:"symbols,omitempty"`
+	// MaintenancePct overrides the margin maintenance requirement.
+	MaintenancePct float64 `json:"maintenance_pct,omitempty"`
+}
+
+// Normalized upper-cases the ticker, exchange and currency and defaults the
+// asset class to equity.
+func (i Instrument) Normalized() Instrument {
+	i.Ticker = strings.ToUpper(strings.TrimSpace(i.Ticker))
+	i.Exchange = strings.ToUpper(strings.TrimSpace(i.Exchange))
+	if i.Currency != "" {
+		i.Currency = NormalizeCurrency(i.Currency)
+	}
+	if i.AssetClass == "" {
+		i.AssetClass = AssetEquity
+	}
+	if len(i.Symbols) > 0 {
+		symbols := make(map[string]string, len(i.Symbols))
+		for provider, symbol := range i.Symbols {
+			if symbol = strings.TrimSpace(symbol); symbol != "" {
+				symbols[strings.ToLower(strings.TrimSpace(provider))] = symbol
+			}
+		}
+		i.Symbols = symbols
+	}
+	return i
+}
+
+func (i Instrument) Validate() error {
+	if i.Ticker == "" {
+		return fmt.Errorf("%w: ticker is required", ErrInvalidInstrument)
+	}
+	if _, err := ParseAssetClass(string(i.AssetClass)); err != nil {
+		return err
+	}
+	if i.MaintenancePct < 0 || i.MaintenancePct > 100 {
+		return fmt.Errorf("%w: maintenance requirement must be between 0 and 100 percent", ErrInvalidInstrument)
+	}
+	return nil
+}
+
+// Symbol returns the symbol provider quotes the instrument under, or "" when
+// no mapping is set.
+func (i Instrument) Symbol(provider string) string {
+	return i.Symbols[strings.ToLower(provider)]
+}
+
+func (i Instrument) clone() *Instrument {
+	c := i
+	if i.Symbols != nil {
+		c.Symbols = make(map[string]string, len(i.Symbols))
+		for k, v := range i.Symbols {
+			c.Symbols[k] = v
+		}
+	}
+	return &c
+}
+
+// IsCrypto reports whether the position is registered as a crypto instrument.
+func (p *Position) IsCrypto() bool {
+	return p.Instrument != nil && p.Instrument.AssetClass == AssetCrypto
+}
+
+// AssetClass is the registered asset class, equity when none is registered
+// and empty for option contracts.
+func (p *Position) AssetClass() AssetClass {
+	if p.Option != nil {
+		return ""
+	}
+	if p.Instrument == nil {
+		return AssetEquity
+	}
+	return p.Instrument.AssetClass
+}
+
+// Instrument returns the registered definition of ticker.
+func (p *Portfolio) Instrument(ticker string) (Instrument, bool) {
+	inst, ok := p.Instruments[strings.ToUpper(ticker)]
+	return inst, ok
+}
+
+// ListInstruments returns the registered instruments sorted by ticker.
+func (p *Portfolio) ListInstruments() []Instrument {
+	res := make([]Instrument, 0, len(p.Instruments))
+	for _, inst := range p.Instruments {
+		res = append(res, inst)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Ticker < res[j].Ticker })
+	return res
+}
+
+// SetInstrument registers or replaces the definition of inst.Ticker and
+// attaches it to the position of that ticker.
+func (p *Portfolio) SetInstrument(inst Instrument) (Instrument, error) {
+	inst = inst.Normalized()
+	if err := inst.Validate(); err != nil {
+		return Instrument{}, err
+	}
+	if p.Instruments == nil {
+		p.Instruments = make(map[string]Instrument)
+	}
+	p.Instruments[inst.Ticker] = inst
+	p.attachInstruments()
+	return inst, nil
+}
+
+// RemoveInstrument drops the definition of ticker, so the ticker is quoted as
+// an equity again.
+func (p *Portfolio) RemoveInstrument(ticker string) bool {
+	ticker = strings.ToUpper(ticker)
+	if _, ok := p.Instruments[ticker]; !ok {
+		return false
+	}
+	delete(p.Instruments, ticker)
+	p.attachInstruments()
+	return true
+}
+
+// QuotePosition returns an unheld position for ticker carrying its registered
+// instrument and quote currency, for fetching quotes of benchmarks and option
+// underlyings.
+func (p *Portfolio) QuotePosition(ticker string) *Position {
+	return NewQuotePosition(ticker, p.Instruments)
+}
+
+// NewQuotePosition returns an unheld position for ticker carrying its
+// definition from instruments, keyed by upper-case ticker, when there is one.
+func NewQuotePosition(ticker string, instruments map[string]Instrument) *Position {
+	pos := &Position{Ticker: ticker}
+	if inst, ok := instruments[strings.ToUpper(ticker)]; ok {
+		pos.Instrument = inst.clone()
+		pos.Currency = inst.Currency
+	}
+	return pos
+}
+
+// attachInstruments copies the registered definitions onto the positions they
+// describe. Option contracts are quoted on their own and never carry one.
+func (p *Portfolio) attachInstruments() {
+	for ticker, pos := range p.Positions {
+		pos.Instrument = nil
+		if inst, ok := p.Instrument(ticker); ok && pos.Option == nil {
+			pos.Instrument = inst.clone()
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package portfolio
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrInvalidJournal is returned when a journal note targets a position or
+// transaction that does not exist, or groups by an unknown field.
+var ErrInvalidJournal = errors.New("invalid journal entry")
+
+// JournalNote is the free-text note, tags and strategy attached to a position
+// or a trade.
+type JournalNote struct {
+	Note     string   `json:"note,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Strategy string   `json:"strategy,omitempty"`
+}
+
+func (n JournalNote) normalized() JournalNote {
+	n.Note = strings.TrimSpace(n.Note)
+	n.Tags = NormalizeTags(n.Tags)
+	n.Strategy = normalizeStrategy(n.Strategy)
+	return n
+}
+
+// NormalizeTags lower-cases and trims tags, dropping empty and duplicate ones,
+// and sorts them.
+func NormalizeTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	var res []string
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		res = append(res, t)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func normalizeStrategy(s string) string { return strings.ToLower(strings.TrimSpace(s)) }
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// AnnotatePosition replaces the note, tags and strategy of the position.
+// Annotations stay on the position while it is open.
+func (p *Portfolio) AnnotatePosition(ticker string, n JournalNote) (JournalNote, error) {
+	pos, ok := p.Positions[ticker]
+	if !ok {
+		return JournalNote{}, fmt.Errorf("%w: no position %s", ErrInvalidJournal, ticker)
+	}
+	n = n.normalized()
+	pos.Note, pos.Tags, pos.Strategy = n.Note, n.Tags, n.Strategy
+	return n, nil
+}
+
+// AnnotateTransaction replaces the note, tags and strategy of the ledger entry id.
+func (p *Portfolio) AnnotateTransaction(id string, n JournalNote) (Transaction, error) {
+	n = n.normalized()
+	for i := range p.Transactions {
+		tx := &p.Transactions[i]
+		if tx.ID == id {
+			tx.Note, tx.Tags, tx.Strategy = n.Note, n.Tags, n.Strategy
+			return *tx, nil
+		}
+	}
+	return Transaction{}, fmt.Errorf("%w: no transaction %s", ErrInvalidJournal, id)
+}
+
+// JournalFilter narrows the journal to entries carrying Tag, using Strategy or
+// about Ticker; empty fields match everything.
+type JournalFilter struct {
+	Tag      string
+	Strategy string
+	Ticker   string
+}
+
+func (f JournalFilter) matches(ticker string, tags []string, strategy string) bool {
+	if f.Ticker != "" && !strings.EqualFold(f.Ticker, ticker) {
+		return false
+	}
+	if f.Tag != "" && !hasTag(tags, strings.ToLower(strings.TrimSpace(f.Tag))) {
+		return false
+	}
+	if f.Strategy != "" && normalizeStrategy(f.Strategy) != strategy {
+		return false
+	}
+	return true
+}
+
+const (
+	JournalPosition = "position"
+	JournalTrade    = "trade"
+)
+
+// JournalEntry is an annotated position or trade. Date is the entry date of a
+// position and the trade date of a trade.
+type JournalEntry struct {
+	Kind     string          `json:"kind"`
+	Ticker   string          `json:"ticker"`
+	Date     time.Time       `json:"date"`
+	TxID     string          `json:"tx_id,omitempty"`
+	Type     TransactionType `json:"type,omitempty"`
+	Quantity float64         `json:"quantity,omitempty"`
+	Price    float64         `json:"price,omitempty"`
+	JournalNote
+}
+
+// Journal lists the annotated positions and trades matching f, oldest first.
+func (p *Portfolio) Journal(f JournalFilter) []JournalEntry {
+	res := []JournalEntry{}
+	for ticker, pos := range p.Positions {
+		if (pos.Note == "" && len(pos.Tags) == 0 && pos.Strategy == "") || !f.matches(ticker, pos.Tags, pos.Strategy) {
+			continue
+		}
+		res = append(res, JournalEntry{
+			Kind: JournalPosition, Ticker: ticker, Date: pos.EntryDate,
+			JournalNote: JournalNote{Note: pos.Note, Tags: pos.Tags, Strategy: pos.Strategy},
+		})
+	}
+	for _, tx := range p.Transactions {
+		if !tx.IsTrade() || (tx.Note == "" && len(tx.Tags) == 0 && tx.Strategy == "") || !f.matches(tx.Ticker, tx.Tags, tx.Strategy) {
+			continue
+		}
+		res = append(res, JournalEntry{
+			Kind: JournalTrade, Ticker: tx.Ticker, Date: tx.Date, TxID: tx.ID, Type: tx.Type,
+			Quantity: tx.Quantity.Float(), Price: tx.Price.Float(),
+			JournalNote: JournalNote{Note: tx.Note, Tags: tx.Tags, Strategy: tx.Strategy},
+		})
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if !res[i].Date.Equal(res[j].Date) {
+			return res[i].Date.Before(res[j].Date)
+		}
+		return res[i].Kind < res[j].Kind
+	})
+	return res
+}
+
+// JournalGrouping is the field a journal breakdown groups by.
+type JournalGrouping string
+
+const (
+	GroupByTag      JournalGrouping = "tag"
+	GroupByStrategy JournalGrouping = "strategy"
+)
+
+func ParseJournalGrouping(s string) (JournalGrouping, error) {
+	switch g := JournalGrouping(strings.ToLower(strings.TrimSpace(s))); g {
+	case "", GroupByTag:
+		return GroupByTag, nil
+	case GroupByStrategy:
+		return GroupByStrategy, nil
+	default:
+		return "", fmt.Errorf("%w: unknown grouping %q", ErrInvalidJournal, s)
+	}
+}
+
+// JournalGroup is the performance of one tag or strategy. Trades counts the
+// sells and covers that closed shares attributed to it, of which Wins had a
+// positive and Losses a negative realized gain.
+type JournalGroup struct {
+	Name          string  `json:"name"`
+	Trades        int     `json:"trades"`
+	Wins          int     `json:"wins"`
+	Losses        int     `json:"losses"`
+	WinRatePct    float64 `json:"win_rate_pct"`
+	RealizedPnL   Decimal `json:"realized_pnl"`
+	UnrealizedPnL Decimal `json:"unrealized_pnl"`
+	OpenPositions int     `json:"open_positions"`
+}
+
+type JournalBreakdown struct {
+	By     JournalGrouping `json:"by"`
+	Groups []JournalGroup  `json:"groups"`
+}
+
+// JournalBreakdown attributes P&L to tags or strategies. A closed lot counts
+// toward the tags of the trade that opened it and the trade that closed it;
+// its strategy is the opening trade's, else the closing trade's. Open lots
+// also count toward the position's own tags and strategy. A lot with several
+// tags counts in full toward each, so tag groups can overlap.
+func (p *Portfolio) JournalBreakdown(by JournalGrouping) (JournalBreakdown, error) {
+	sales, err := p.Sales("")
+	if err != nil {
+		return JournalBreakdown{}, err
+	}
+	byID := make(map[string]Transaction, len(p.Transactions))
+	for _, tx := range p.Transactions {
+		byID[tx.ID] = tx
+	}
+	labels := func(notes ...JournalNote) []string {
+		if by == GroupByStrategy {
+			for _, n := range notes {
+				if n.Strategy != "" {
+					return []string{n.Strategy}
+				}
+			}
+			return nil
+		}
+		var tags []string
+		for _, n := range notes {
+			tags = append(tags, n.Tags...)
+		}
+		return NormalizeTags(tags)
+	}
+
+	groups := make(map[string]*JournalGroup)
+	group := func(name string) *JournalGroup {
+		g := groups[name]
+		if g == nil {
+			g = &JournalGroup{Name: name}
+			groups[name] = g
+		}
+		return g
+	}
+
+	for _, sale := range sales {
+		closing := byID[sale.TxID].journalNote()
+		gains := make(map[string]Decimal)
+		for _, l := range sale.Lots {
+			for _, name := range labels(byID[l.LotID].journalNote(), closing) {
+				gains[name] = gains[name].Add(l.Gain)
+			}
+		}
+		for name, gain := range gains {
+			g := group(name)
+			g.Trades++
+			g.RealizedPnL = g.RealizedPnL.Add(gain)
+			switch gain.Sign() {
+			case 1:
+				g.Wins++
+			case -1:
+				g.Losses++
+			}
+		}
+	}
+
+	for _, pos := range p.Positions {
+		own := JournalNote{Tags: pos.Tags, Strategy: pos.Strategy}
+		unit := pos.CurrentPrice * pos.Multiplier() * pos.Rate()
+		held := make(map[string]bool)
+		for _, l := range pos.Lots {
+			pnl := pos.signed(l.Quantity).MulFloat(unit).Sub(pos.signed(l.CostBasis))
+			for _, name := range labels(byID[l.ID].journalNote(), own) {
+				g := group(name)
+				g.UnrealizedPnL = g.UnrealizedPnL.Add(pnl)
+				held[name] = true
+			}
+		}
+		if len(pos.Lots) == 0 {
+			pnl := pos.CurrentValue().Sub(pos.signed(pos.CostBasis))
+			for _, name := range labels(own) {
+				g := group(name)
+				g.UnrealizedPnL = g.UnrealizedPnL.Add(pnl)
+				held[name] = true
+			}
+		}
+		for name := range held {
+			groups[name].OpenPositions++
+		}
+	}
+
+	res := JournalBreakdown{By: by, Groups: make([]JournalGroup, 0, len(groups))}
+	for _, g := range groups {
+		if g.Trades > 0 {
+			g.WinRatePct = float64(g.Wins) / float64(g.Trades) * 100
+		}
+		res.Groups = append(res.Groups, *g)
+	}
+	sort.Slice(res.Groups, func(i, j int) bool { return res.Groups[i].Name < res.Groups[j].Name })
+	return res, nil
+}
+
+func (t Transaction) journalNote() JournalNote {
+	return JournalNote{Note: t.Note, Tags: t.Tags, Strategy: t.Strategy}
+}
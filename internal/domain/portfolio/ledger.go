@@ -0,0 +1,480 @@
+package portfolio
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const openingBalanceNote = "opening balance"
+
+type holding struct {
+	ticker    string
+	currency  string
+	option    *OptionContract
+	short     bool
+	lots      []Lot
+	entryDate time.Time
+	lastDate  time.Time
+	lastPrice float64
+	lastRate  float64
+	realized  Decimal
+}
+
+func (h *holding) shares() Decimal {
+	var total Decimal
+	for _, l := range h.lots {
+		total = total.Add(l.Quantity)
+	}
+	return total
+}
+
+func (h *holding) cost() Decimal {
+	var total Decimal
+	for _, l := range h.lots {
+		total = total.Add(l.CostBasis)
+	}
+	return total
+}
+
+func (h *holding) localCost() Decimal {
+	var total Decimal
+	for _, l := range h.lots {
+		total = total.Add(l.LocalCostBasis)
+	}
+	return total
+}
+
+// held reports whether any shares of the holding are open.
+func (h *holding) held() bool { return h != nil && h.shares().IsPositive() }
+
+// rescale converts the share count of every lot so the holding totals shares,
+// keeping each lot's proportion; the last lot takes the rounding remainder.
+// Shares standing in as wash-sale replacements convert with their lot.
+func (h *holding) rescale(shares Decimal) {
+	total, left := h.shares(), shares
+	for i := range h.lots {
+		lot := &h.lots[i]
+		qty := left
+		if i < len(h.lots)-1 {
+			qty = lot.Quantity.Scale(shares, total)
+		}
+		lot.WashReplaced = lot.WashReplaced.Scale(qty, lot.Quantity)
+		lot.Quantity = qty
+		left = left.Sub(qty)
+	}
+}
+
+type ledgerState struct {
+	base     string
+	cash     Decimal
+	realized Decimal
+	holdings map[string]*holding
+	sales    []Sale
+	pending  []pendingLoss
+}
+
+// Record validates tx, appends it to the ledger and replays the ledger so Cash and
+// Positions reflect every recorded transaction. The first time a transaction is
+// recorded, the current cash balance and any hand-entered positions are converted
+// into opening-balance ledger entries so nothing is lost.
+func (p *Portfolio) Record(tx Transaction) (Transaction, error) {
+	tx = p.WithDefaults(tx)
+	if err := tx.Validate(); err != nil {
+		return Transaction{}, err
+	}
+	if tx.FXRate.IsZero() && !tx.IsCorporateAction() {
+		return Transaction{}, invalidTx("fx rate from %s to %s is required", tx.Currency, p.Base())
+	}
+	if tx.closes() && tx.LotMethod == "" {
+		tx.LotMethod = p.LotMethod
+		if tx.LotMethod == "" {
+			tx.LotMethod = LotFIFO
+		}
+	}
+
+	ledger := append(p.openingEntries(tx.Date), p.Transactions...)
+	tx.ID = fmt.Sprintf("tx-%d", len(ledger)+1)
+	ledger = append(ledger, tx)
+	sort.SliceStable(ledger, func(i, j int) bool { return ledger[i].Date.Before(ledger[j].Date) })
+
+	state, err := replay(ledger, p.Base())
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	var prior Position
+	if pos, ok := p.Positions[tx.Ticker]; ok {
+		prior = *pos
+	}
+	_, mergedInto := p.Positions[tx.NewTicker]
+
+	p.Transactions = ledger
+	p.apply(state)
+	if tx.IsCorporateAction() {
+		p.adjustForCorporateAction(tx, prior, mergedInto)
+	}
+	return tx, nil
+}
+
+// WithDefaults fills in the date and currency of tx. The currency defaults to
+// the position's quote currency, then the registered instrument's, or the base
+// currency for new tickers and cash movements; transactions in the base currency get an FX rate of 1.
+func (p *Portfolio) WithDefaults(tx Transaction) Transaction {
+	if tx.Date.IsZero() {
+		tx.Date = time.Now()
+	}
+	if tx.Currency == "" {
+		if pos, ok := p.Positions[tx.Ticker]; ok && tx.Ticker != "" {
+			tx.Currency = pos.QuoteCurrency()
+		} else if inst, ok := p.Instrument(tx.Ticker); ok && tx.Ticker != "" && inst.Currency != "" {
+			tx.Currency = inst.Currency
+		}
+	}
+	if tx.Type == TxDividend && tx.Reinvest && tx.Quantity.IsZero() && tx.Price.IsPositive() {
+		tx.Quantity = tx.Amount.Div(tx.Price)
+	}
+	n := JournalNote{Note: tx.Note, Tags: tx.Tags, Strategy: tx.Strategy}.normalized()
+	tx.Note, tx.Tags, tx.Strategy = n.Note, n.Tags, n.Strategy
+	if tx.Option != nil {
+		c := tx.Option.Normalized()
+		tx.Option = &c
+		if tx.Ticker == "" {
+			tx.Ticker = c.Symbol()
+		}
+	} else if pos, ok := p.Positions[tx.Ticker]; ok && tx.Ticker != "" && pos.Option != nil {
+		c := *pos.Option
+		tx.Option = &c
+	}
+	tx.Currency = NormalizeCurrency(firstNonEmpty(tx.Currency, p.Base()))
+	if tx.Currency == p.Base() && tx.FXRate.IsZero() {
+		tx.FXRate = NewDecimal(1)
+	}
+	return tx
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// Rebuild replays the ledger and refreshes Cash and Positions from it.
+func (p *Portfolio) Rebuild() error {
+	if len(p.Transactions) == 0 {
+		return nil
+	}
+	state, err := replay(p.Transactions, p.Base())
+	if err != nil {
+		return err
+	}
+	p.apply(state)
+	return nil
+}
+
+// ErrLedgerManaged is returned when a position derived from recorded
+// transactions is edited directly.
+var ErrLedgerManaged = errors.New("position is derived from the transaction ledger")
+
+// IsLedgerManaged reports whether the position for ticker is derived from recorded transactions.
+func (p *Portfolio) IsLedgerManaged(ticker string) bool {
+	for _, tx := range p.Transactions {
+		if tx.Ticker == ticker || tx.NewTicker == ticker {
+			return true
+		}
+	}
+	return false
+}
+
+// Sales replays the ledger and returns the realized result of every sell of
+// ticker, or of all tickers when ticker is empty.
+func (p *Portfolio) Sales(ticker string) ([]Sale, error) {
+	state, err := replay(p.Transactions, p.Base())
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Sale, 0, len(state.sales))
+	for _, sale := range state.sales {
+		if ticker == "" || sale.Ticker == ticker {
+			res = append(res, sale)
+		}
+	}
+	return res, nil
+}
+
+// TransactionsFor returns the ledger entries for ticker, or the whole ledger when ticker is empty.
+func (p *Portfolio) TransactionsFor(ticker string) []Transaction {
+	res := make([]Transaction, 0, len(p.Transactions))
+	for _, tx := range p.Transactions {
+		if ticker == "" || tx.Ticker == ticker || tx.NewTicker == ticker {
+			res = append(res, tx)
+		}
+	}
+	return res
+}
+
+// openingEntries converts state that predates the ledger into transactions:
+// the cash balance on the very first record and any position that was added
+// directly rather than through a trade.
+func (p *Portfolio) openingEntries(fallback time.Time) []Transaction {
+	if len(p.Transactions) > 0 && p.Transactions[0].Date.Before(fallback) {
+		fallback = p.Transactions[0].Date
+	}
+
+	var entries []Transaction
+	if len(p.Transactions) == 0 && !p.Cash.IsZero() {
+		tx := Transaction{Type: TxDeposit, Date: fallback, Amount: p.Cash.Abs(), Currency: p.Base(), FXRate: NewDecimal(1), Note: openingBalanceNote}
+		if p.Cash.IsNegative() {
+			tx.Type = TxWithdrawal
+		}
+		entries = append(entries, tx)
+	}
+
+	tickers := make([]string, 0, len(p.Positions))
+	for ticker, pos := range p.Positions {
+		if pos.Shares.IsPositive() && !p.IsLedgerManaged(ticker) {
+			tickers = append(tickers, ticker)
+		}
+	}
+	sort.Strings(tickers)
+
+	for _, ticker := range tickers {
+		pos := p.Positions[ticker]
+		date := pos.EntryDate
+		if date.IsZero() {
+			date = fallback
+		}
+		// A position entered without a cost basis opens at a zero price and the
+		// position's own rate rather than dividing zero by zero.
+		shares, cost, local := pos.Shares.Float(), pos.CostBasis.Float(), pos.LocalCost().Float()
+		price, rate := 0.0, pos.Rate()
+		if cost != 0 && local != 0 {
+			price, rate = local/(shares*pos.Multiplier()), cost/local
+		}
+		// A short enters as a withdrawal of its proceeds followed by the short
+		// sale that pays them back in, so cash is unchanged.
+		funding, trade := TxDeposit, TxBuy
+		if pos.IsShort() {
+			funding, trade = TxWithdrawal, TxShort
+		}
+		if pos.CostBasis.IsPositive() {
+			entries = append(entries, Transaction{Type: funding, Date: date, Amount: pos.CostBasis, Currency: p.Base(), FXRate: NewDecimal(1), Note: openingBalanceNote})
+		}
+		entries = append(entries, Transaction{
+			Type: trade, Ticker: ticker, Date: date, Quantity: pos.Shares, Price: NewDecimal(price),
+			Currency: pos.QuoteCurrency(), FXRate: NewDecimal(rate), Note: openingBalanceNote,
+			Option: pos.Option,
+		})
+	}
+
+	offset := len(p.Transactions)
+	for i := range entries {
+		entries[i].ID = fmt.Sprintf("tx-%d", offset+i+1)
+	}
+	return entries
+}
+
+// replay books every transaction of ledger in order. Amounts are rounded to
+// their currency as they are booked, so cash and cost basis are exact sums of
+// rounded entries in the base currency.
+func replay(ledger []Transaction, base string) (ledgerState, error) {
+	state := ledgerState{base: base, holdings: make(map[string]*holding)}
+
+	for _, tx := range ledger {
+		state.cash = state.cash.Add(tx.cashImpact(base))
+
+		switch tx.Type {
+		case TxBuy, TxShort:
+			if err := state.open(tx); err != nil {
+				return ledgerState{}, err
+			}
+		case TxDividend:
+			if tx.Reinvest {
+				if err := state.open(tx); err != nil {
+					return ledgerState{}, err
+				}
+			}
+		case TxStockDividend:
+			h := state.holdings[tx.Ticker]
+			if !h.held() {
+				return ledgerState{}, invalidTx("stock dividend of %s on %s without a holding",
+					tx.Ticker, tx.Date.Format("2006-01-02"))
+			}
+			before := h.shares()
+			h.rescale(before.Add(tx.Quantity))
+			state.rescalePending(tx.Ticker, tx.Ticker, h.shares().Div(before))
+			h.lastPrice *= before.Float() / h.shares().Float()
+		case TxSell, TxCover:
+			h := state.holdings[tx.Ticker]
+			var held Decimal
+			if h != nil {
+				held = h.shares()
+			}
+			if held.IsPositive() && h.short != (tx.Type == TxCover) {
+				return ledgerState{}, sideMismatch(h, tx)
+			}
+			if tx.Quantity.Cmp(held) > 0 {
+				return ledgerState{}, invalidTx("%s of %v %s on %s exceeds holding of %v",
+					tx.Type, tx.Quantity, tx.Ticker, tx.Date.Format("2006-01-02"), held)
+			}
+			lots, sale, err := closeLots(h.lots, tx, base)
+			if err != nil {
+				return ledgerState{}, err
+			}
+			h.lots = lots
+			h.lastPrice = tx.Price.Float()
+			h.lastDate = tx.Date
+			h.lastRate = tx.rate().Float()
+			h.realized = h.realized.Add(sale.Gain)
+			state.realized = state.realized.Add(sale.Gain)
+			state.sales = append(state.sales, sale)
+			if tx.Type == TxSell {
+				state.washAfterSale(h)
+			}
+		case TxSplit:
+			h := state.holdings[tx.Ticker]
+			if !h.held() {
+				return ledgerState{}, invalidTx("split of %s on %s without a holding",
+					tx.Ticker, tx.Date.Format("2006-01-02"))
+			}
+			h.rescale(h.shares().Mul(tx.Ratio))
+			state.rescalePending(tx.Ticker, tx.Ticker, tx.Ratio)
+			if h.lastPrice > 0 {
+				h.lastPrice /= tx.Ratio.Float()
+			}
+		case TxRename:
+			if err := state.rename(tx); err != nil {
+				return ledgerState{}, err
+			}
+		}
+		// Decimal arithmetic saturates rather than wrapping, so a total past
+		// its range rejects the transaction instead of booking a wrong balance.
+		h := state.holdings[tx.Ticker]
+		if state.cash.Overflowed() || state.realized.Overflowed() ||
+			(h != nil && (h.shares().Overflowed() || h.cost().Overflowed() || h.localCost().Overflowed())) {
+			return ledgerState{}, outOfRange("%s on %s takes the ledger past its limit",
+				tx.Type, tx.Date.Format("2006-01-02"))
+		}
+	}
+	return state, nil
+}
+
+// open adds a lot for a buy, a short or a reinvested dividend. Reinvested
+// dividends are purchases for wash-sale purposes.
+func (state *ledgerState) open(tx Transaction) error {
+	h := state.holdings[tx.Ticker]
+	if h == nil {
+		h = &holding{ticker: tx.Ticker}
+		state.holdings[tx.Ticker] = h
+	}
+	if !h.held() {
+		h.entryDate = tx.Date
+		h.currency = tx.Currency
+		h.short = tx.Type == TxShort
+	} else if h.short != (tx.Type == TxShort) {
+		return sideMismatch(h, tx)
+	}
+	if tx.Option != nil {
+		h.option = tx.Option
+	}
+	qty := tx.Quantity
+	local := tx.tradeValue(qty)
+	h.lots = append(h.lots, Lot{ID: tx.ID, Acquired: tx.Date, Quantity: qty, CostBasis: tx.toBase(local, state.base), LocalCostBasis: local})
+	h.lastPrice = tx.Price.Float()
+	h.lastDate = tx.Date
+	h.lastRate = tx.rate().Float()
+	if tx.Type != TxShort {
+		state.washBeforeBuy(h)
+	}
+	return nil
+}
+
+// rename moves the holding of tx.Ticker to tx.NewTicker, converting shares by
+// the ratio and merging into an existing holding of the new ticker. Lots keep
+// their acquisition dates and basis.
+func (state *ledgerState) rename(tx Transaction) error {
+	h := state.holdings[tx.Ticker]
+	if !h.held() {
+		return invalidTx("rename of %s on %s without a holding", tx.Ticker, tx.Date.Format("2006-01-02"))
+	}
+	ratio := tx.shareRatio()
+	if ratio != NewDecimal(1) {
+		h.rescale(h.shares().Mul(ratio))
+	}
+	state.rescalePending(tx.Ticker, tx.NewTicker, ratio)
+	h.lastPrice /= ratio.Float()
+	delete(state.holdings, tx.Ticker)
+	h.ticker = tx.NewTicker
+
+	into := state.holdings[tx.NewTicker]
+	if !into.held() {
+		state.holdings[tx.NewTicker] = h
+		return nil
+	}
+	if into.short != h.short {
+		return sideMismatch(into, tx)
+	}
+	into.lots = append(into.lots, h.lots...)
+	into.realized = into.realized.Add(h.realized)
+	if h.entryDate.Before(into.entryDate) {
+		into.entryDate = h.entryDate
+	}
+	return nil
+}
+
+func sideMismatch(h *holding, tx Transaction) error {
+	side := Long
+	if h.short {
+		side = Short
+	}
+	return invalidTx("cannot %s %s on %s while the position is %s",
+		tx.Type, tx.Ticker, tx.Date.Format("2006-01-02"), side)
+}
+
+func (p *Portfolio) apply(state ledgerState) {
+	p.Cash = state.cash
+	p.RealizedPnL = state.realized
+	if p.Positions == nil {
+		p.Positions = make(map[string]*Position)
+	}
+
+	for ticker := range p.Positions {
+		if h := state.holdings[ticker]; !h.held() && p.IsLedgerManaged(ticker) {
+			delete(p.Positions, ticker)
+		}
+	}
+
+	for ticker, h := range state.holdings {
+		if !h.held() {
+			continue
+		}
+		pos, ok := p.Positions[ticker]
+		if !ok {
+			pos = &Position{Ticker: ticker, CurrentPrice: h.lastPrice, PeakPrice: h.lastPrice, FXRate: h.lastRate, LastUpdate: h.lastDate}
+			p.Positions[ticker] = pos
+		}
+		if h.currency != "" && h.currency != p.Base() {
+			pos.Currency = h.currency
+		}
+		if h.short {
+			pos.Side = Short
+		} else {
+			pos.Side = ""
+		}
+		if h.option != nil && pos.Option == nil {
+			c := *h.option
+			pos.Option = &c
+		}
+		pos.Shares = h.shares()
+		pos.CostBasis = h.cost()
+		pos.LocalCostBasis = h.localCost()
+		pos.EntryDate = h.entryDate
+		pos.Lots = h.lots
+		pos.RealizedPnL = h.realized
+	}
+	p.attachInstruments()
+}
@@ -0,0 +1,251 @@
+package portfolio
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+type LotMethod string
+
+const (
+	LotFIFO        LotMethod = "fifo"
+	LotLIFO        LotMethod = "lifo"
+	LotHighestCost LotMethod = "highest-cost"
+	LotSpecific    LotMethod = "specific"
+)
+
+func ParseLotMethod(s string) (LotMethod, error) {
+	m := LotMethod(strings.ToLower(strings.TrimSpace(s)))
+	switch m {
+	case LotFIFO, LotLIFO, LotHighestCost, LotSpecific:
+		return m, nil
+	case "hifo":
+		return LotHighestCost, nil
+	default:
+		return "", invalidTx("unknown lot method %q", s)
+	}
+}
+
+// Lot is an open purchase lot. The lot ID is the ID of the buy transaction that opened it.
+// CostBasis is in the portfolio base currency and LocalCostBasis in the quote currency.
+// WashSaleAdjustment holds losses disallowed by wash sales and rolled into the lot's tax basis.
+// WashReplaced counts the shares already standing in for washed losses, which
+// cannot absorb another one, and HoldingStart is set when the holding period of
+// washed shares carried over makes the lot's start earlier than Acquired.
+type Lot struct {
+	ID                 string     `json:"id"`
+	Acquired           time.Time  `json:"acquired"`
+	HoldingStart       *time.Time `json:"holding_start,omitempty"`
+	Quantity           Decimal    `json:"quantity"`
+	CostBasis          Decimal    `json:"cost_basis"`
+	LocalCostBasis     Decimal    `json:"local_cost_basis"`
+	WashSaleAdjustment Decimal    `json:"wash_sale_adjustment"`
+	WashReplaced       Decimal    `json:"wash_replaced"`
+}
+
+// holdingStart is the start of the lot's holding period.
+func holdingStart(acquired time.Time, start *time.Time) time.Time {
+	if start != nil && start.Before(acquired) {
+		return *start
+	}
+	return acquired
+}
+
+// TaxBasis is the cost basis including any wash-sale adjustment.
+func (l Lot) TaxBasis() Decimal {
+	return l.CostBasis.Add(l.WashSaleAdjustment)
+}
+
+// Term classifies the lot's holding period as of the given date.
+func (l Lot) Term(asOf time.Time) Term {
+	return holdingTerm(holdingStart(l.Acquired, l.HoldingStart), asOf)
+}
+
+func (l Lot) CostPerShare() Decimal {
+	return l.CostBasis.Div(l.Quantity)
+}
+
+// LotSelection names the lot and quantity to close when selling by specific identification.
+type LotSelection struct {
+	LotID    string  `json:"lot_id"`
+	Quantity Decimal `json:"quantity"`
+}
+
+// ClosedLot is the part of a lot consumed by a sale. Gain is the economic result;
+// TaxGain uses the wash-sale adjusted basis and adds back any disallowed loss.
+type ClosedLot struct {
+	LotID              string     `json:"lot_id"`
+	Ticker             string     `json:"ticker"`
+	Acquired           time.Time  `json:"acquired"`
+	HoldingStart       *time.Time `json:"holding_start,omitempty"`
+	Sold               time.Time  `json:"sold"`
+	Term               Term       `json:"term"`
+	Quantity           Decimal    `json:"quantity"`
+	CostBasis          Decimal    `json:"cost_basis"`
+	TaxBasis           Decimal    `json:"tax_basis"`
+	Proceeds           Decimal    `json:"proceeds"`
+	Gain               Decimal    `json:"gain"`
+	WashSale           bool       `json:"wash_sale,omitempty"`
+	WashSaleDisallowed Decimal    `json:"wash_sale_disallowed"`
+	TaxGain            Decimal    `json:"tax_gain"`
+}
+
+// Sale is the realized result of a sell or cover transaction. For covers the
+// proceeds are those of the original short sale and the cost basis is the
+// price paid to buy the shares back.
+type Sale struct {
+	TxID               string      `json:"tx_id"`
+	Ticker             string      `json:"ticker"`
+	Date               time.Time   `json:"date"`
+	Method             LotMethod   `json:"method"`
+	Quantity           Decimal     `json:"quantity"`
+	Proceeds           Decimal     `json:"proceeds"`
+	CostBasis          Decimal     `json:"cost_basis"`
+	Gain               Decimal     `json:"gain"`
+	WashSaleDisallowed Decimal     `json:"wash_sale_disallowed"`
+	Lots               []ClosedLot `json:"lots"`
+}
+
+// closeLots removes tx.Quantity shares from lots according to the sale's lot method
+// and returns the remaining open lots together with the realized sale. Amounts
+// are booked in the base currency.
+func closeLots(lots []Lot, tx Transaction, base string) ([]Lot, Sale, error) {
+	sale := Sale{TxID: tx.ID, Ticker: tx.Ticker, Date: tx.Date, Method: tx.LotMethod, Quantity: tx.Quantity}
+	if sale.Method == "" {
+		sale.Method = LotFIFO
+	}
+
+	selections, err := lotSelections(lots, tx, sale.Method)
+	if err != nil {
+		return nil, Sale{}, err
+	}
+
+	byID := make(map[string]int, len(lots))
+	for i, l := range lots {
+		byID[l.ID] = i
+	}
+
+	// Proceeds, net of fees, are booked once for the whole sale, as cash is,
+	// and split over the lots pro rata with the last lot taking the rounding
+	// remainder. For covers they are the buy-back cost including fees.
+	total := tx.toBase(tx.tradeValue(sale.Quantity), base)
+	left := total
+	open := append([]Lot(nil), lots...)
+	for n, sel := range selections {
+		i := byID[sel.LotID]
+		lot := open[i]
+		qty := sel.Quantity
+		basis := lot.CostBasis.Scale(qty, lot.Quantity).RoundTo(base)
+		localBasis := lot.LocalCostBasis.Scale(qty, lot.Quantity).RoundTo(tx.Currency)
+		adjustment := lot.WashSaleAdjustment.Scale(qty, lot.Quantity).RoundTo(base)
+		replaced := lot.WashReplaced.Scale(qty, lot.Quantity)
+		proceeds := left
+		if n < len(selections)-1 {
+			proceeds = total.Scale(qty, sale.Quantity).RoundTo(base)
+		}
+		left = left.Sub(proceeds)
+		closed := ClosedLot{
+			LotID:        lot.ID,
+			Ticker:       tx.Ticker,
+			Acquired:     lot.Acquired,
+			HoldingStart: lot.HoldingStart,
+			Sold:         tx.Date,
+			Term:         holdingTerm(holdingStart(lot.Acquired, lot.HoldingStart), tx.Date),
+			Quantity:     qty,
+			CostBasis:    basis,
+			TaxBasis:     basis.Add(adjustment),
+			Proceeds:     proceeds,
+			Gain:         proceeds.Sub(basis),
+			TaxGain:      proceeds.Sub(basis).Sub(adjustment),
+		}
+		if tx.Type == TxCover {
+			// Gains on short sales are short-term regardless of how long the
+			// short was open.
+			closed.Term = ShortTerm
+			closed.CostBasis, closed.TaxBasis, closed.Proceeds = proceeds, proceeds, basis
+			closed.Gain = basis.Sub(proceeds)
+			closed.TaxGain = closed.Gain
+		}
+		sale.Lots = append(sale.Lots, closed)
+		sale.Proceeds = sale.Proceeds.Add(closed.Proceeds)
+		sale.CostBasis = sale.CostBasis.Add(closed.CostBasis)
+
+		open[i].Quantity = open[i].Quantity.Sub(qty)
+		open[i].CostBasis = open[i].CostBasis.Sub(basis)
+		open[i].LocalCostBasis = open[i].LocalCostBasis.Sub(localBasis)
+		open[i].WashSaleAdjustment = open[i].WashSaleAdjustment.Sub(adjustment)
+		open[i].WashReplaced = open[i].WashReplaced.Sub(replaced)
+	}
+	sale.Gain = sale.Proceeds.Sub(sale.CostBasis)
+
+	remaining := open[:0]
+	for _, l := range open {
+		if l.Quantity.IsPositive() {
+			remaining = append(remaining, l)
+		}
+	}
+	return remaining, sale, nil
+}
+
+func lotSelections(lots []Lot, tx Transaction, method LotMethod) ([]LotSelection, error) {
+	if len(tx.Lots) > 0 {
+		return specificSelections(lots, tx)
+	}
+	if method == LotSpecific {
+		return nil, invalidTx("sell of %s requires lot selections under specific identification", tx.Ticker)
+	}
+
+	order := make([]int, len(lots))
+	for i := range order {
+		order[i] = i
+	}
+	switch method {
+	case LotLIFO:
+		sort.SliceStable(order, func(a, b int) bool { return lots[order[a]].Acquired.After(lots[order[b]].Acquired) })
+	case LotHighestCost:
+		sort.SliceStable(order, func(a, b int) bool { return lots[order[a]].CostPerShare().Cmp(lots[order[b]].CostPerShare()) > 0 })
+	default:
+		sort.SliceStable(order, func(a, b int) bool { return lots[order[a]].Acquired.Before(lots[order[b]].Acquired) })
+	}
+
+	var selections []LotSelection
+	left := tx.Quantity
+	for _, i := range order {
+		if !left.IsPositive() {
+			break
+		}
+		qty := MinDecimal(lots[i].Quantity, left)
+		selections = append(selections, LotSelection{LotID: lots[i].ID, Quantity: qty})
+		left = left.Sub(qty)
+	}
+	return selections, nil
+}
+
+func specificSelections(lots []Lot, tx Transaction) ([]LotSelection, error) {
+	available := make(map[string]Decimal, len(lots))
+	for _, l := range lots {
+		available[l.ID] = l.Quantity
+	}
+
+	var total Decimal
+	for _, sel := range tx.Lots {
+		qty := sel.Quantity
+		if !qty.IsPositive() {
+			return nil, invalidTx("lot %s quantity must be greater than zero", sel.LotID)
+		}
+		held, ok := available[sel.LotID]
+		if !ok {
+			return nil, invalidTx("lot %s is not an open lot of %s", sel.LotID, tx.Ticker)
+		}
+		if qty.Cmp(held) > 0 {
+			return nil, invalidTx("lot %s holds %v shares, cannot sell %v", sel.LotID, held, qty)
+		}
+		available[sel.LotID] = held.Sub(qty)
+		total = total.Add(qty)
+	}
+	if total.Cmp(tx.Quantity) != 0 {
+		return nil, invalidTx("lot selections total %v shares but sell quantity is %v", total, tx.Quantity)
+	}
+	return tx.Lots, nil
+}
@@ -0,0 +1,263 @@
+package portfolio
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ErrInvalidMargin is returned for malformed margin settings and for margin
+// operations on portfolios without a margin account.
+var ErrInvalidMargin = errors.New("invalid margin")
+
+// marginDayCount is the day-count basis of margin interest; brokers charge the
+// annual rate over a 360-day year.
+const marginDayCount = 360
+
+// marginInterestNote is the note on posted margin interest transactions.
+const marginInterestNote = "margin interest"
+
+// MarginAccount holds the terms of a margin account. Requirements are
+// percentages of market value: InitialPct is what a new position must be
+// funded with and sets buying power, MaintenancePct and ShortMaintenancePct
+// are the equity long and short positions must keep before a margin call.
+// An instrument's MaintenancePct overrides both. Interest accrues daily on the
+// debit balance at InterestRatePct a year and is posted to the ledger as a
+// margin-interest transaction at each month end.
+type MarginAccount struct {
+	InitialPct          float64   `json:"initial_pct"`
+	MaintenancePct      float64   `json:"maintenance_pct"`
+	ShortMaintenancePct float64   `json:"short_maintenance_pct"`
+	InterestRatePct     float64   `json:"interest_rate_pct"`
+	AccruedThrough      time.Time `json:"accrued_through,omitempty"`
+	AccruedInterest     Decimal   `json:"accrued_interest"`
+}
+
+// WithDefaults fills unset requirements with the Regulation T initial margin
+// and common broker maintenance levels.
+func (m MarginAccount) WithDefaults() MarginAccount {
+	if m.InitialPct == 0 {
+		m.InitialPct = 50
+	}
+	if m.MaintenancePct == 0 {
+		m.MaintenancePct = 25
+	}
+	if m.ShortMaintenancePct == 0 {
+		m.ShortMaintenancePct = 30
+	}
+	return m
+}
+
+func (m MarginAccount) Validate() error {
+	for _, pct := range []float64{m.InitialPct, m.MaintenancePct, m.ShortMaintenancePct} {
+		if pct <= 0 || pct > 100 {
+			return fmt.Errorf("%w: requirements must be above 0 and at most 100 percent", ErrInvalidMargin)
+		}
+	}
+	if m.MaintenancePct > m.InitialPct {
+		return fmt.Errorf("%w: maintenance requirement %v exceeds initial requirement %v", ErrInvalidMargin, m.MaintenancePct, m.InitialPct)
+	}
+	if m.InterestRatePct < 0 {
+		return fmt.Errorf("%w: interest rate must not be negative", ErrInvalidMargin)
+	}
+	return nil
+}
+
+// SetMargin opens or updates the margin account, keeping the interest accrued
+// so far. A nil account turns margin off; interest not yet posted is dropped.
+func (p *Portfolio) SetMargin(m *MarginAccount) (*MarginAccount, error) {
+	if m == nil {
+		p.Margin = nil
+		return nil, nil
+	}
+	settings := m.WithDefaults()
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+	if p.Margin != nil {
+		settings.AccruedThrough, settings.AccruedInterest = p.Margin.AccruedThrough, p.Margin.AccruedInterest
+	}
+	p.Margin = &settings
+	return p.Margin, nil
+}
+
+// maintenancePct is the maintenance requirement of pos: the instrument's own
+// requirement, full value for options, or the account level for its side.
+func (m MarginAccount) maintenancePct(pos *Position) float64 {
+	switch {
+	case pos.Instrument != nil && pos.Instrument.MaintenancePct > 0:
+		return pos.Instrument.MaintenancePct
+	case pos.Option != nil:
+		return 100
+	case pos.IsShort():
+		return m.ShortMaintenancePct
+	default:
+		return m.MaintenancePct
+	}
+}
+
+// MarginPosition is the requirement of one position. CallPrice is the price
+// at which the position alone would bring the account to a margin call, with
+// every other price unchanged; it is omitted when no price would.
+type MarginPosition struct {
+	Ticker         string  `json:"ticker"`
+	Short          bool    `json:"short,omitempty"`
+	MarketValue    Decimal `json:"market_value"`
+	MaintenancePct float64 `json:"maintenance_pct"`
+	Requirement    Decimal `json:"requirement"`
+	CallPrice      float64 `json:"call_price,omitempty"`
+}
+
+// MarginStatus is the state of a margin account. Loan is the debit balance,
+// the negative cash a margin account carries, and Equity the portfolio value
+// less interest accrued but not yet posted. Leverage is gross exposure over
+// equity. BuyingPower is the value of new positions the equity above the
+// initial requirement can fund. CallDistancePct is how far every price can
+// fall together before equity drops to the maintenance requirement; it is
+// 100 when no fall would trigger a call.
+type MarginStatus struct {
+	InitialPct             float64          `json:"initial_pct"`
+	InterestRatePct        float64          `json:"interest_rate_pct"`
+	Loan                   Decimal          `json:"loan"`
+	AccruedInterest        Decimal          `json:"accrued_interest"`
+	AccruedThrough         time.Time        `json:"accrued_through,omitempty"`
+	Equity                 Decimal          `json:"equity"`
+	GrossExposure          Decimal          `json:"gross_exposure"`
+	Leverage               float64          `json:"leverage"`
+	InitialRequirement     Decimal          `json:"initial_requirement"`
+	MaintenanceRequirement Decimal          `json:"maintenance_requirement"`
+	ExcessLiquidity        Decimal          `json:"excess_liquidity"`
+	BuyingPower            Decimal          `json:"buying_power"`
+	CallDistancePct        float64          `json:"call_distance_pct"`
+	MarginCall             bool             `json:"margin_call"`
+	Positions              []MarginPosition `json:"positions"`
+}
+
+// MarginStatus reports the margin account at current prices.
+func (p *Portfolio) MarginStatus() (MarginStatus, error) {
+	if p.Margin == nil {
+		return MarginStatus{}, fmt.Errorf("%w: portfolio %s has no margin account", ErrInvalidMargin, p.Name)
+	}
+	m, base := *p.Margin, p.Base()
+	s := MarginStatus{
+		InitialPct:      m.InitialPct,
+		InterestRatePct: m.InterestRatePct,
+		AccruedInterest: m.AccruedInterest.RoundTo(base),
+		AccruedThrough:  m.AccruedThrough,
+		Equity:          p.TotalValue().Sub(m.AccruedInterest.RoundTo(base)),
+		Positions:       []MarginPosition{},
+	}
+	if p.Cash.IsNegative() {
+		s.Loan = p.Cash.Neg()
+	}
+
+	var long, short Decimal
+	for _, pos := range p.Positions {
+		value := pos.MarketValue()
+		pct := m.maintenancePct(pos)
+		requirement := value.MulFloat(pct / 100).RoundTo(base)
+		s.MaintenanceRequirement = s.MaintenanceRequirement.Add(requirement)
+		s.InitialRequirement = s.InitialRequirement.Add(value.MulFloat(max(pct, m.InitialPct) / 100).RoundTo(base))
+		if pos.IsShort() {
+			short = short.Add(value)
+		} else {
+			long = long.Add(value)
+		}
+		s.Positions = append(s.Positions, MarginPosition{
+			Ticker:         pos.Ticker,
+			Short:          pos.IsShort(),
+			MarketValue:    value,
+			MaintenancePct: pct,
+			Requirement:    requirement,
+		})
+	}
+	sort.Slice(s.Positions, func(i, j int) bool { return s.Positions[i].Ticker < s.Positions[j].Ticker })
+
+	s.GrossExposure = long.Add(short)
+	s.ExcessLiquidity = s.Equity.Sub(s.MaintenanceRequirement)
+	if s.Equity.IsPositive() {
+		s.Leverage = s.GrossExposure.Float() / s.Equity.Float()
+	}
+	if free := s.Equity.Sub(s.InitialRequirement); free.IsPositive() {
+		s.BuyingPower = free.MulFloat(100 / m.InitialPct).RoundTo(base)
+	}
+
+	excess := s.ExcessLiquidity.Float()
+	if excess < 0 || !s.Equity.IsPositive() {
+		s.MarginCall = true
+		return s, nil
+	}
+	// Equity falls by the net long value and the requirement by its own
+	// size as every price falls by the same fraction.
+	s.CallDistancePct = 100
+	if exposed := long.Sub(short).Sub(s.MaintenanceRequirement).Float(); exposed > 0 {
+		s.CallDistancePct = min(excess/exposed*100, 100)
+	}
+	for i := range s.Positions {
+		mp := &s.Positions[i]
+		pos := p.Positions[mp.Ticker]
+		value, requirement := mp.MarketValue.Float(), mp.Requirement.Float()
+		if mp.Short {
+			if value > 0 {
+				mp.CallPrice = pos.CurrentPrice * (1 + excess/(value+requirement))
+			}
+		} else if fall := excess / (value - requirement); value > requirement && fall < 1 {
+			mp.CallPrice = pos.CurrentPrice * (1 - fall)
+		}
+	}
+	return s, nil
+}
+
+// MarginAccrual is the result of accruing margin interest from From to To.
+// Accrued is the interest charged over the period and Outstanding what is
+// accrued but not yet posted; Posted are the month-end interest charges
+// recorded in the ledger.
+type MarginAccrual struct {
+	From        time.Time     `json:"from"`
+	To          time.Time     `json:"to"`
+	Days        int           `json:"days"`
+	Accrued     Decimal       `json:"accrued"`
+	Outstanding Decimal       `json:"outstanding"`
+	Posted      []Transaction `json:"posted"`
+}
+
+// AccrueMarginInterest charges a day's interest on the current debit balance
+// for every day since interest was last accrued, up to now. The first run
+// only starts the accrual clock. Interest accrued in a month is posted as a
+// margin-interest transaction dated its last day once the month has ended.
+func (p *Portfolio) AccrueMarginInterest(now time.Time) (MarginAccrual, error) {
+	m := p.Margin
+	if m == nil {
+		return MarginAccrual{}, fmt.Errorf("%w: portfolio %s has no margin account", ErrInvalidMargin, p.Name)
+	}
+	today, base := dayOf(now), p.Base()
+	res := MarginAccrual{From: m.AccruedThrough, To: today, Posted: []Transaction{}}
+	if m.AccruedThrough.IsZero() {
+		m.AccruedThrough = today
+		res.From = today
+		return res, nil
+	}
+	for day := m.AccruedThrough.AddDate(0, 0, 1); !day.After(today); day = day.AddDate(0, 0, 1) {
+		if prev := day.AddDate(0, 0, -1); prev.Month() != day.Month() {
+			if charge := m.AccruedInterest.RoundTo(base); charge.IsPositive() {
+				tx, err := p.Record(Transaction{Type: TxMarginInterest, Date: prev, Amount: charge, Note: marginInterestNote})
+				if err != nil {
+					return res, err
+				}
+				res.Posted = append(res.Posted, tx)
+				m.AccruedInterest = m.AccruedInterest.Sub(charge)
+			}
+		}
+		if p.Cash.IsNegative() {
+			interest := p.Cash.Neg().MulFloat(m.InterestRatePct / 100 / marginDayCount)
+			m.AccruedInterest = m.AccruedInterest.Add(interest)
+			res.Accrued = res.Accrued.Add(interest)
+		}
+		m.AccruedThrough = day
+		res.Days++
+	}
+	res.Accrued = res.Accrued.RoundTo(base)
+	res.Outstanding = m.AccruedInterest.RoundTo(base)
+	return res, nil
+}
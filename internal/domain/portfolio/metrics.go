@@ -1,37 +1,77 @@
 package portfolio
 
-import "tracktrades/internal/util"
+import (
+	"time"
+
+	"tracktrades/internal/util"
+)
 
 type PositionDetails struct {
-	Ticker              string  `json:"ticker"`
-	Shares              float64 `json:"shares"`
-	CostBasis           float64 `json:"cost_basis"`
-	CurrentPrice        float64 `json:"current_price"`
-	CurrentValue        float64 `json:"current_value"`
-	PeakValue           float64 `json:"peak_value"`
-	UnrealizedPnL       float64 `json:"unrealized_pnl"`
-	UnrealizedPnLPct    float64 `json:"unrealized_pnl_pct"`
-	DrawdownFromPeakPct float64 `json:"drawdown_from_peak_pct"`
-	RecoveryNeededPct   float64 `json:"recovery_needed_pct"`
+	Ticker              string         `json:"ticker"`
+	Side                PositionSide   `json:"side"`
+	AssetClass          AssetClass     `json:"asset_class,omitempty"`
+	Shares              Decimal        `json:"shares"`
+	CostBasis           Decimal        `json:"cost_basis"`
+	CurrentPrice        float64        `json:"current_price"`
+	CurrentValue        Decimal        `json:"current_value"`
+	PeakValue           Decimal        `json:"peak_value"`
+	UnrealizedPnL       Decimal        `json:"unrealized_pnl"`
+	UnrealizedPnLPct    float64        `json:"unrealized_pnl_pct"`
+	RealizedPnL         Decimal        `json:"realized_pnl"`
+	DrawdownFromPeakPct float64        `json:"drawdown_from_peak_pct"`
+	RecoveryNeededPct   float64        `json:"recovery_needed_pct"`
+	WashSaleAdjustment  Decimal        `json:"wash_sale_adjustment"`
+	Currency            string         `json:"currency"`
+	FXRate              float64        `json:"fx_rate"`
+	LocalValue          Decimal        `json:"local_value"`
+	LocalCostBasis      Decimal        `json:"local_cost_basis"`
+	LocalUnrealizedPnL  Decimal        `json:"local_unrealized_pnl"`
+	FXPnL               Decimal        `json:"fx_pnl"`
+	DividendsTotal      Decimal        `json:"dividends_total"`
+	DividendsTTM        Decimal        `json:"dividends_ttm"`
+	YieldOnCostPct      float64        `json:"yield_on_cost_pct,omitempty"`
+	CurrentYieldPct     float64        `json:"current_yield_pct,omitempty"`
+	Lots                []Lot          `json:"lots,omitempty"`
+	Option              *OptionDetails `json:"option,omitempty"`
+	Note                string         `json:"note,omitempty"`
+	Tags                []string       `json:"tags,omitempty"`
+	Strategy            string         `json:"strategy,omitempty"`
 }
 
 func (p *Position) DetailedMetrics() PositionDetails {
 	curr := p.CurrentValue()
 	peak := p.PeakValue()
 
-	pnl := curr - p.CostBasis
+	pnl := curr.Sub(p.signed(p.CostBasis))
 	pnlPct := 0.0
-	if p.CostBasis > 0 {
-		pnlPct = (pnl / p.CostBasis) * 100
+	if p.CostBasis.IsPositive() {
+		pnlPct = (pnl.Float() / p.CostBasis.Float()) * 100
+	}
+
+	// Shorts measure the adverse move up from the lowest price since entry and
+	// recover when the price falls back to it.
+	drawdownPct, recoveryPct := 0.0, 0.0
+	if p.IsShort() {
+		if p.PeakPrice > 0 && p.CurrentPrice > p.PeakPrice {
+			drawdownPct = (p.CurrentPrice - p.PeakPrice) / p.PeakPrice * 100
+		}
+		recoveryPct = util.RequiredShortRecoveryPct(drawdownPct)
+	} else {
+		if peak.IsPositive() {
+			drawdownPct = (peak.Sub(curr).Float() / peak.Float()) * 100
+		}
+		recoveryPct = util.RequiredRecoveryPct(drawdownPct)
 	}
 
-	drawdownPct := 0.0
-	if peak > 0 {
-		drawdownPct = ((peak - curr) / peak) * 100
+	var washAdj Decimal
+	for _, l := range p.Lots {
+		washAdj = washAdj.Add(l.WashSaleAdjustment)
 	}
 
 	return PositionDetails{
 		Ticker:              p.Ticker,
+		Side:                p.side(),
+		AssetClass:          p.AssetClass(),
 		Shares:              p.Shares,
 		CostBasis:           p.CostBasis,
 		CurrentPrice:        p.CurrentPrice,
@@ -39,47 +79,93 @@ func (p *Position) DetailedMetrics() PositionDetails {
 		PeakValue:           peak,
 		UnrealizedPnL:       pnl,
 		UnrealizedPnLPct:    pnlPct,
+		RealizedPnL:         p.RealizedPnL,
 		DrawdownFromPeakPct: drawdownPct,
-		RecoveryNeededPct:   util.RequiredRecoveryPct(drawdownPct),
+		RecoveryNeededPct:   recoveryPct,
+		WashSaleAdjustment:  washAdj,
+		Currency:            p.QuoteCurrency(),
+		FXRate:              p.Rate(),
+		LocalValue:          p.LocalValue(),
+		LocalCostBasis:      p.LocalCost(),
+		LocalUnrealizedPnL:  p.LocalValue().Sub(p.signed(p.LocalCost())),
+		FXPnL:               p.FXPnL(),
+		Lots:                p.Lots,
+		Option:              p.optionDetails(time.Now(), p.UnderlyingPrice, 0),
+		Note:                p.Note,
+		Tags:                p.Tags,
+		Strategy:            p.Strategy,
 	}
 }
 
 type PortfolioMetrics struct {
-	TotalValue          float64 `json:"total_value"`
-	UnrealizedPnL       float64 `json:"unrealized_pnl"`
-	UnrealizedPnLPct    float64 `json:"unrealized_pnl_pct"`
-	DrawdownFromPeakPct float64 `json:"drawdown_from_peak_pct"`
-	RecoveryNeededPct   float64 `json:"recovery_needed_pct"`
+	BaseCurrency        string               `json:"base_currency"`
+	TotalValue          Decimal              `json:"total_value"`
+	UnrealizedPnL       Decimal              `json:"unrealized_pnl"`
+	UnrealizedPnLPct    float64              `json:"unrealized_pnl_pct"`
+	RealizedPnL         Decimal              `json:"realized_pnl"`
+	HighWaterMark       Decimal              `json:"high_water_mark"`
+	FXPnL               Decimal              `json:"fx_pnl"`
+	DrawdownFromPeakPct float64              `json:"drawdown_from_peak_pct"`
+	RecoveryNeededPct   float64              `json:"recovery_needed_pct"`
+	Exposure            Exposure             `json:"exposure"`
+	Currencies          []CurrencyExposure   `json:"currencies"`
+	Underlyings         []UnderlyingExposure `json:"underlyings,omitempty"`
+	Risk                RiskStats            `json:"risk"`
+	Margin              *MarginStatus        `json:"margin,omitempty"`
+	// Concentration and Warnings come from the concentration analysis;
+	// Warnings lists the limits that are exceeded.
+	Concentration ConcentrationStats     `json:"concentration"`
+	Warnings      []ConcentrationWarning `json:"warnings,omitempty"`
 }
 
 func (p *Portfolio) Metrics() PortfolioMetrics {
 	total := p.TotalValue()
 
-	cost := 0.0
+	var cost, grossCost, fxPnL Decimal
 	for _, pos := range p.Positions {
-		cost += pos.CostBasis
+		cost = cost.Add(pos.signed(pos.CostBasis))
+		grossCost = grossCost.Add(pos.CostBasis)
+		fxPnL = fxPnL.Add(pos.FXPnL())
 	}
 
-	if total > p.PeakValue {
-		p.PeakValue = total
+	peak := p.HighWaterMark()
+	if total.Cmp(peak) > 0 {
+		peak = total
 	}
 
-	pnl := total - cost
+	pnl := total.Sub(cost)
 	pnlPct := 0.0
-	if cost > 0 {
-		pnlPct = pnl / cost * 100
+	if grossCost.IsPositive() {
+		pnlPct = pnl.Float() / grossCost.Float() * 100
 	}
 
 	dd := 0.0
-	if p.PeakValue > 0 {
-		dd = ((p.PeakValue - total) / p.PeakValue) * 100
+	if peak.IsPositive() {
+		dd = (peak.Sub(total).Float() / peak.Float()) * 100
+	}
+
+	var margin *MarginStatus
+	if status, err := p.MarginStatus(); err == nil {
+		margin = &status
 	}
+	concentration := p.Concentration()
 
 	return PortfolioMetrics{
+		BaseCurrency:        p.Base(),
 		TotalValue:          total,
 		UnrealizedPnL:       pnl,
 		UnrealizedPnLPct:    pnlPct,
+		RealizedPnL:         p.RealizedPnL,
+		HighWaterMark:       peak,
+		FXPnL:               fxPnL,
 		DrawdownFromPeakPct: dd,
 		RecoveryNeededPct:   util.RequiredRecoveryPct(dd),
+		Exposure:            p.Exposure(),
+		Currencies:          p.CurrencyExposures(),
+		Underlyings:         p.UnderlyingExposures(time.Now()),
+		Risk:                p.Risk(nil).Portfolio,
+		Margin:              margin,
+		Concentration:       concentration.Stats,
+		Warnings:            concentration.Warnings,
 	}
 }
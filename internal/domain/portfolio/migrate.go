@@ -0,0 +1,64 @@
+package portfolio
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CurrentVersion is the storage format written by this version. Version 1
+// keeps quantities and booked amounts as fixed-point decimals rounded to their
+// currency; portfolios without a version were written with float amounts.
+// Version 2 quotes crypto only through the instrument registry; earlier
+// versions treated every ticker ending in USD as a crypto pair.
+const CurrentVersion = 2
+
+// Migrate upgrades a portfolio loaded from an older storage format and
+// attaches the instrument registry to the positions it describes, which is
+// not persisted on the positions themselves.
+func (p *Portfolio) Migrate() error {
+	if p.Version < 1 {
+		// Float amounts are already read to eight places; ledger-managed
+		// portfolios are replayed so cash, cost basis and realized P&L are
+		// rebooked with currency rounding, and hand-entered amounts are
+		// rounded in place.
+		base := p.Base()
+		p.Cash = p.Cash.RoundTo(base)
+		p.RealizedPnL = p.RealizedPnL.RoundTo(base)
+		for _, pos := range p.Positions {
+			pos.CostBasis = pos.CostBasis.RoundTo(base)
+			pos.LocalCostBasis = pos.LocalCostBasis.RoundTo(pos.QuoteCurrency())
+			pos.RealizedPnL = pos.RealizedPnL.RoundTo(base)
+		}
+		if err := p.Rebuild(); err != nil {
+			return fmt.Errorf("migrate portfolio %s to version %d: %w", p.Name, CurrentVersion, err)
+		}
+	}
+	if p.Version < 2 {
+		p.registerLegacyCrypto()
+	}
+	if p.Version < CurrentVersion {
+		p.Version = CurrentVersion
+	}
+	p.attachInstruments()
+	return nil
+}
+
+// registerLegacyCrypto registers the held pairs the old ticker heuristic
+// quoted as crypto, such as BTCUSD, as crypto instruments quoted in USD so
+// they keep their crypto endpoints. Tickers with a definition of their own
+// are left alone.
+func (p *Portfolio) registerLegacyCrypto() {
+	for ticker, pos := range p.Positions {
+		t := strings.ToUpper(ticker)
+		if pos.Option != nil || len(t) <= 3 || !strings.HasSuffix(t, "USD") {
+			continue
+		}
+		if _, ok := p.Instrument(t); ok {
+			continue
+		}
+		if p.Instruments == nil {
+			p.Instruments = make(map[string]Instrument)
+		}
+		p.Instruments[t] = Instrument{Ticker: t, AssetClass: AssetCrypto, Currency: "USD"}
+	}
+}
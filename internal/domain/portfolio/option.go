@@ -0,0 +1,297 @@
+package portfolio
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"tracktrades/internal/util"
+)
+
+type OptionRight string
+
+const (
+	Call OptionRight = "call"
+	Put  OptionRight = "put"
+)
+
+// DefaultContractMultiplier is the number of underlying shares per listed equity option.
+const DefaultContractMultiplier = 100
+
+// OptionContract describes a call or put. Positions holding a contract count
+// Shares in contracts and CurrentPrice per underlying share, so the value is
+// Shares * CurrentPrice * Multiplier.
+type OptionContract struct {
+	Underlying string      `json:"underlying"`
+	Strike     float64     `json:"strike"`
+	Expiry     time.Time   `json:"expiry"`
+	Right      OptionRight `json:"right"`
+	Multiplier float64     `json:"multiplier"`
+}
+
+func ParseOptionRight(s string) (OptionRight, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "call", "c":
+		return Call, nil
+	case "put", "p":
+		return Put, nil
+	default:
+		return "", invalidTx("unknown option right %q", s)
+	}
+}
+
+// Normalized upper-cases the underlying and applies the default multiplier.
+func (c OptionContract) Normalized() OptionContract {
+	c.Underlying = strings.ToUpper(strings.TrimSpace(c.Underlying))
+	if c.Multiplier == 0 {
+		c.Multiplier = DefaultContractMultiplier
+	}
+	return c
+}
+
+func (c OptionContract) Validate() error {
+	if c.Underlying == "" {
+		return invalidTx("option underlying is required")
+	}
+	if c.Strike <= 0 {
+		return invalidTx("option strike must be greater than zero")
+	}
+	if c.Expiry.IsZero() {
+		return invalidTx("option expiry is required")
+	}
+	if c.Right != Call && c.Right != Put {
+		return invalidTx("option right must be call or put")
+	}
+	if c.Multiplier <= 0 {
+		return invalidTx("option multiplier must be greater than zero")
+	}
+	return nil
+}
+
+// Symbol returns the OCC-style symbol, for example AAPL240621C00200000.
+func (c OptionContract) Symbol() string {
+	right := "C"
+	if c.Right == Put {
+		right = "P"
+	}
+	return fmt.Sprintf("%s%s%s%08d", c.Underlying, c.Expiry.Format("060102"), right, int64(math.Round(c.Strike*1000)))
+}
+
+// Intrinsic is the exercise value per underlying share at the given price.
+func (c OptionContract) Intrinsic(underlying float64) float64 {
+	if c.Right == Call {
+		return math.Max(underlying-c.Strike, 0)
+	}
+	return math.Max(c.Strike-underlying, 0)
+}
+
+// ExpiredAt reports whether the contract expired before t; it trades through its expiry day.
+func (c OptionContract) ExpiredAt(t time.Time) bool {
+	return !dayOf(t).Before(dayOf(c.Expiry).AddDate(0, 0, 1))
+}
+
+// OptionDetails adds contract terms and greeks to a position's details. Delta is
+// derived from the Black-Scholes volatility implied by the position's price and
+// is only set when the underlying price is known.
+type OptionDetails struct {
+	OptionContract
+	UnderlyingPrice float64 `json:"underlying_price,omitempty"`
+	Intrinsic       float64 `json:"intrinsic"`
+	DaysToExpiry    int     `json:"days_to_expiry"`
+	Expired         bool    `json:"expired"`
+	ImpliedVolPct   float64 `json:"implied_vol_pct,omitempty"`
+	Delta           float64 `json:"delta,omitempty"`
+	DeltaShares     float64 `json:"delta_shares,omitempty"`
+	DeltaExposure   float64 `json:"delta_exposure,omitempty"`
+}
+
+func (p *Position) optionDetails(now time.Time, underlying, riskFreePct float64) *OptionDetails {
+	if p.Option == nil {
+		return nil
+	}
+	c := *p.Option
+	d := &OptionDetails{
+		OptionContract:  c,
+		UnderlyingPrice: underlying,
+		DaysToExpiry:    int(math.Max(math.Ceil(dayOf(c.Expiry).Sub(dayOf(now)).Hours()/24), 0)),
+		Expired:         c.ExpiredAt(now),
+	}
+	if underlying <= 0 {
+		return d
+	}
+	d.Intrinsic = c.Intrinsic(underlying)
+
+	years := dayOf(c.Expiry).AddDate(0, 0, 1).Sub(now).Hours() / 24 / 365
+	if d.Expired || years <= 0 {
+		if d.Intrinsic > 0 {
+			d.Delta = 1
+		}
+	} else if vol, ok := impliedVol(c, p.CurrentPrice, underlying, years, riskFreePct/100); ok {
+		d.ImpliedVolPct = vol * 100
+		d.Delta = math.Abs(blackScholesDelta(c, underlying, years, riskFreePct/100, vol))
+	} else if d.Intrinsic > 0 {
+		d.Delta = 1
+	}
+	if c.Right == Put {
+		d.Delta = -d.Delta
+	}
+	d.DeltaShares = d.Delta * p.SignedShares().Float() * c.Multiplier
+	d.DeltaExposure = d.DeltaShares * underlying * p.Rate()
+	return d
+}
+
+// UnderlyingExposure combines stock held directly with option delta on the same underlying.
+type UnderlyingExposure struct {
+	Underlying  string  `json:"underlying"`
+	Shares      float64 `json:"shares"`
+	DeltaShares float64 `json:"delta_shares"`
+	Exposure    float64 `json:"exposure"`
+}
+
+// UnderlyingExposures lists the delta-adjusted exposure of every underlying that
+// has options held on it.
+func (p *Portfolio) UnderlyingExposures(now time.Time) []UnderlyingExposure {
+	byName := make(map[string]*UnderlyingExposure)
+	for _, pos := range p.Positions {
+		if pos.Option == nil {
+			continue
+		}
+		d := pos.optionDetails(now, p.UnderlyingPrice(pos), p.RiskFreeRatePct)
+		e := byName[d.Underlying]
+		if e == nil {
+			e = &UnderlyingExposure{Underlying: d.Underlying}
+			if stock, ok := p.Positions[d.Underlying]; ok {
+				e.Shares = stock.SignedShares().Float()
+				e.Exposure = stock.CurrentValue().Float()
+			}
+			byName[d.Underlying] = e
+		}
+		e.DeltaShares += d.DeltaShares
+		e.Exposure += d.DeltaExposure
+	}
+
+	res := make([]UnderlyingExposure, 0, len(byName))
+	for _, e := range byName {
+		res = append(res, *e)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Underlying < res[j].Underlying })
+	return res
+}
+
+// UnderlyingPrice is the price of an option's underlying: the price of a held
+// position in it, otherwise the last refreshed UnderlyingPrice.
+func (p *Portfolio) UnderlyingPrice(pos *Position) float64 {
+	if pos.Option == nil {
+		return 0
+	}
+	if stock, ok := p.Positions[pos.Option.Underlying]; ok && stock.Option == nil && stock.CurrentPrice > 0 {
+		return stock.CurrentPrice
+	}
+	return pos.UnderlyingPrice
+}
+
+// OptionExpiry reports what happened to an option position at expiry.
+type OptionExpiry struct {
+	Ticker    string  `json:"ticker"`
+	Status    string  `json:"status"`
+	Contracts float64 `json:"contracts"`
+	Intrinsic float64 `json:"intrinsic"`
+}
+
+const (
+	ExpiredWorthless = "expired-worthless"
+	SettledInCash    = "settled-in-cash"
+	// ExpiryPricePending reports an expired contract left open because the
+	// underlying price is unknown; it is settled once a price arrives.
+	ExpiryPricePending = "price-pending"
+)
+
+// ExpireOptions settles option positions that expired before now through a
+// sell, or a cover for written contracts, on the expiry day in the ledger.
+// Contracts out of the money close at zero; in-the-money contracts are
+// settled in cash at their intrinsic value at the last underlying price, so
+// the exercise or assignment is booked as its cash equivalent. Contracts whose
+// underlying price is unknown are left untouched and reported as pending, so
+// a failed quote never books them as worthless.
+func (p *Portfolio) ExpireOptions(now time.Time) ([]OptionExpiry, error) {
+	tickers := make([]string, 0, len(p.Positions))
+	for ticker, pos := range p.Positions {
+		if pos.Option != nil && pos.Option.ExpiredAt(now) && pos.Shares.IsPositive() {
+			tickers = append(tickers, ticker)
+		}
+	}
+	sort.Strings(tickers)
+
+	var res []OptionExpiry
+	for _, ticker := range tickers {
+		pos := p.Positions[ticker]
+		u := p.UnderlyingPrice(pos)
+		if u <= 0 {
+			res = append(res, OptionExpiry{Ticker: ticker, Status: ExpiryPricePending, Contracts: pos.Shares.Float()})
+			continue
+		}
+		contracts := pos.Shares
+		intrinsic := pos.Option.Intrinsic(u)
+		status := ExpiredWorthless
+		if intrinsic > 0 {
+			status = SettledInCash
+		}
+		closing := TxSell
+		if pos.IsShort() {
+			closing = TxCover
+		}
+		_, err := p.Record(Transaction{
+			Type: closing, Ticker: ticker, Date: dayOf(pos.Option.Expiry), Quantity: contracts,
+			Price: NewDecimal(intrinsic), FXRate: NewDecimal(pos.FXRate), Note: "option " + status,
+		})
+		if err != nil {
+			return res, err
+		}
+		res = append(res, OptionExpiry{Ticker: ticker, Status: status, Contracts: contracts.Float(), Intrinsic: intrinsic})
+	}
+	return res, nil
+}
+
+// impliedVol solves Black-Scholes for the volatility that reproduces price by bisection.
+func impliedVol(c OptionContract, price, underlying, years, rate float64) (float64, bool) {
+	if price <= 0 {
+		return 0, false
+	}
+	lo, hi := 1e-4, 5.0
+	if blackScholesPrice(c, underlying, years, rate, lo) > price || blackScholesPrice(c, underlying, years, rate, hi) < price {
+		return 0, false
+	}
+	for i := 0; i < 100; i++ {
+		mid := (lo + hi) / 2
+		if blackScholesPrice(c, underlying, years, rate, mid) < price {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2, true
+}
+
+func blackScholesPrice(c OptionContract, s, t, r, vol float64) float64 {
+	d1, d2 := blackScholesD(c, s, t, r, vol)
+	discounted := c.Strike * math.Exp(-r*t)
+	if c.Right == Call {
+		return s*util.NormCDF(d1) - discounted*util.NormCDF(d2)
+	}
+	return discounted*util.NormCDF(-d2) - s*util.NormCDF(-d1)
+}
+
+func blackScholesDelta(c OptionContract, s, t, r, vol float64) float64 {
+	d1, _ := blackScholesD(c, s, t, r, vol)
+	if c.Right == Call {
+		return util.NormCDF(d1)
+	}
+	return util.NormCDF(d1) - 1
+}
+
+func blackScholesD(c OptionContract, s, t, r, vol float64) (d1, d2 float64) {
+	d1 = (math.Log(s/c.Strike) + (r+vol*vol/2)*t) / (vol * math.Sqrt(t))
+	return d1, d1 - vol*math.Sqrt(t)
+}
@@ -1,16 +1,50 @@
 package portfolio
 
+import "time"
+
 type Portfolio struct {
-	Name      string               `json:"name"`
-	Cash      float64              `json:"cash"`
-	Positions map[string]*Position `json:"positions"`
-	PeakValue float64              `json:"peak_value"`
+	Name         string               `json:"name"`
+	Version      int                  `json:"version,omitempty"`
+	BaseCurrency string               `json:"base_currency,omitempty"`
+	Cash         Decimal              `json:"cash"`
+	Positions    map[string]*Position `json:"positions"`
+	PeakValue    Decimal              `json:"peak_value"`
+	RealizedPnL  Decimal              `json:"realized_pnl"`
+	LotMethod    LotMethod            `json:"lot_method,omitempty"`
+	// RiskFreeRatePct is the annual rate used by Sharpe and Sortino ratios and
+	// RiskBenchmark the ticker beta and correlation are measured against.
+	RiskFreeRatePct float64 `json:"risk_free_rate_pct,omitempty"`
+	RiskBenchmark   string  `json:"risk_benchmark,omitempty"`
+	// Benchmarks are the index tickers the portfolio is compared against.
+	Benchmarks []string `json:"benchmarks,omitempty"`
+	// Targets are the desired weights used by the rebalance planner; AllocationTags
+	// maps tickers to the tag (such as an asset class) a tag target applies to.
+	Targets        []AllocationTarget `json:"targets,omitempty"`
+	AllocationTags map[string]string  `json:"allocation_tags,omitempty"`
+	Alerts         []AlertRule        `json:"alerts,omitempty"`
+	// Watchlists are named lists of tickers followed without being held.
+	Watchlists Watchlists `json:"watchlists,omitempty"`
+	// ReinvestDividends makes imported dividends buy new lots (DRIP) instead
+	// of being credited to Cash.
+	ReinvestDividends bool `json:"reinvest_dividends,omitempty"`
+	// Margin is the margin account; without one, negative cash is not a loan.
+	Margin *MarginAccount `json:"margin,omitempty"`
+	// Scenarios are the saved stress scenarios.
+	Scenarios []Scenario `json:"scenarios,omitempty"`
+	// ConcentrationLimits are the thresholds metrics warn above; nil uses the
+	// defaults.
+	ConcentrationLimits *ConcentrationLimits `json:"concentration_limits,omitempty"`
+	// Instruments is the registry of instrument definitions keyed by ticker.
+	Instruments  map[string]Instrument `json:"instruments,omitempty"`
+	Transactions []Transaction         `json:"transactions,omitempty"`
+	History      []Snapshot            `json:"history,omitempty"`
 }
 
-func New(name string, cash float64) *Portfolio {
+func New(name string, cash Decimal) *Portfolio {
 	return &Portfolio{
 		Name:      name,
-		Cash:      cash,
+		Version:   CurrentVersion,
+		Cash:      cash.RoundTo(DefaultCurrency),
 		Positions: make(map[string]*Position),
 	}
 }
@@ -20,12 +54,13 @@ func (p *Portfolio) AddPosition(pos *Position) {
 		p.Positions = make(map[string]*Position)
 	}
 	p.Positions[pos.Ticker] = pos
+	p.attachInstruments()
 }
 
-func (p *Portfolio) TotalValue() float64 {
+func (p *Portfolio) TotalValue() Decimal {
 	v := p.Cash
 	for _, pos := range p.Positions {
-		v += pos.CurrentValue()
+		v = v.Add(pos.CurrentValue())
 	}
 	return v
 }
@@ -35,5 +70,13 @@ func (p *Portfolio) PositionDetails(ticker string) (PositionDetails, bool) {
 	if !ok {
 		return PositionDetails{}, false
 	}
-	return pos.DetailedMetrics(), true
+	d := pos.DetailedMetrics()
+	if pos.Option != nil {
+		d.Option = pos.optionDetails(time.Now(), p.UnderlyingPrice(pos), p.RiskFreeRatePct)
+	}
+	if !pos.IsShort() {
+		d.DividendsTotal, d.DividendsTTM = p.dividends(ticker, time.Now())
+		d.YieldOnCostPct, d.CurrentYieldPct = pos.yields(d.DividendsTTM.Float())
+	}
+	return d, true
 }
@@ -1,40 +1,78 @@
 package portfolio
 
-import (
-	"strings"
-	"time"
-)
+import "time"
 
 type Position struct {
 	Ticker       string    `json:"ticker"`
-	Shares       float64   `json:"shares"`
-	CostBasis    float64   `json:"cost_basis"`
+	Shares       Decimal   `json:"shares"`
+	CostBasis    Decimal   `json:"cost_basis"`
 	CurrentPrice float64   `json:"current_price"`
 	PeakPrice    float64   `json:"peak_price"`
 	EntryDate    time.Time `json:"entry_date"`
 	LastUpdate   time.Time `json:"last_update"`
+	// QuoteDate is the market date of CurrentPrice when the price provider
+	// reports one, so a Saturday refresh of a stock carries Friday's date.
+	QuoteDate   *time.Time `json:"quote_date,omitempty"`
+	RealizedPnL Decimal    `json:"realized_pnl"`
+	Lots        []Lot      `json:"lots,omitempty"`
+	// Currency is the quote currency of CurrentPrice and PeakPrice. FXRate converts
+	// it to the portfolio base currency, in which CostBasis is kept.
+	Currency       string  `json:"currency,omitempty"`
+	FXRate         float64 `json:"fx_rate,omitempty"`
+	LocalCostBasis Decimal `json:"local_cost_basis"`
+	// Option is set for option positions, which count Shares in contracts.
+	// UnderlyingPrice is the last refreshed price of the option's underlying.
+	Option          *OptionContract `json:"option,omitempty"`
+	UnderlyingPrice float64         `json:"underlying_price,omitempty"`
+	// Side marks short positions, which keep Shares positive, carry the
+	// short-sale proceeds as CostBasis and track the lowest price since entry
+	// in PeakPrice.
+	Side PositionSide `json:"side,omitempty"`
+	// Instrument is the registered definition of the ticker, attached from the
+	// portfolio's instrument registry on load and never stored with the
+	// position; price providers use it to pick endpoints and symbols.
+	Instrument *Instrument `json:"-"`
+	// Note, Tags and Strategy are the position's journal annotations.
+	Note     string   `json:"note,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Strategy string   `json:"strategy,omitempty"`
 }
 
 func (p *Position) UpdatePrice(price float64) {
 	p.CurrentPrice = price
-	if price > p.PeakPrice {
-		p.PeakPrice = price
-	}
+	p.clampPeak()
 	p.LastUpdate = time.Now()
 }
 
-func (p *Position) CurrentValue() float64 { return p.Shares * p.CurrentPrice }
-func (p *Position) PeakValue() float64    { return p.Shares * p.PeakPrice }
+// clampPeak moves PeakPrice to CurrentPrice when the current price is a new
+// high, or a new low for shorts.
+func (p *Position) clampPeak() {
+	price := p.CurrentPrice
+	if p.IsShort() {
+		if price > 0 && (p.PeakPrice <= 0 || price < p.PeakPrice) {
+			p.PeakPrice = price
+		}
+	} else if price > p.PeakPrice {
+		p.PeakPrice = price
+	}
+}
 
-func (p *Position) IsCrypto() bool {
-	t := strings.ToUpper(p.Ticker)
-	return strings.HasSuffix(t, "USD") && len(t) > 3
+// CurrentValue, PeakValue and LocalValue are negative for short positions.
+// They mark the shares at the last quote and are not rounded.
+func (p *Position) CurrentValue() Decimal {
+	return p.SignedShares().MulFloat(p.CurrentPrice * p.Multiplier() * p.Rate())
+}
+func (p *Position) PeakValue() Decimal {
+	return p.SignedShares().MulFloat(p.PeakPrice * p.Multiplier() * p.Rate())
+}
+func (p *Position) LocalValue() Decimal {
+	return p.SignedShares().MulFloat(p.CurrentPrice * p.Multiplier())
 }
 
-func (p *Position) SymbolBase() string {
-	t := strings.ToUpper(p.Ticker)
-	if p.IsCrypto() {
-		return strings.TrimSuffix(t, "USD")
+// Multiplier is the contract multiplier of an option position and 1 otherwise.
+func (p *Position) Multiplier() float64 {
+	if p.Option != nil && p.Option.Multiplier > 0 {
+		return p.Option.Multiplier
 	}
-	return t
+	return 1
 }
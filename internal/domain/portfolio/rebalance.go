@@ -0,0 +1,302 @@
+package portfolio
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ErrInvalidAllocation marks target allocations that cannot be applied.
+var ErrInvalidAllocation = errors.New("invalid allocation")
+
+// AllocationTarget is a target weight for a single ticker or for every ticker
+// carrying a tag (for example an asset class). BandPct is the tolerance in
+// percentage points either side of the target before a trade is planned.
+// A ticker target takes precedence over the target of its tag.
+type AllocationTarget struct {
+	Ticker    string  `json:"ticker,omitempty"`
+	Tag       string  `json:"tag,omitempty"`
+	WeightPct float64 `json:"weight_pct"`
+	BandPct   float64 `json:"band_pct"`
+}
+
+func (t AllocationTarget) key() string {
+	if t.Ticker != "" {
+		return t.Ticker
+	}
+	return "tag:" + t.Tag
+}
+
+// ValidateTargets normalizes targets and checks that they name exactly one
+// ticker or tag, do not repeat and sum to at most 100%. The rest is held as cash.
+func ValidateTargets(targets []AllocationTarget) ([]AllocationTarget, error) {
+	seen := make(map[string]bool, len(targets))
+	total := 0.0
+	res := make([]AllocationTarget, 0, len(targets))
+	for _, t := range targets {
+		t.Ticker = strings.ToUpper(strings.TrimSpace(t.Ticker))
+		t.Tag = strings.ToLower(strings.TrimSpace(t.Tag))
+		if (t.Ticker == "") == (t.Tag == "") {
+			return nil, fmt.Errorf("%w: a target needs either a ticker or a tag", ErrInvalidAllocation)
+		}
+		if t.WeightPct < 0 || t.BandPct < 0 {
+			return nil, fmt.Errorf("%w: weight and band of %s must not be negative", ErrInvalidAllocation, t.key())
+		}
+		if seen[t.key()] {
+			return nil, fmt.Errorf("%w: duplicate target for %s", ErrInvalidAllocation, t.key())
+		}
+		seen[t.key()] = true
+		total += t.WeightPct
+		res = append(res, t)
+	}
+	if total > 100+1e-9 {
+		return nil, fmt.Errorf("%w: target weights sum to %v%%", ErrInvalidAllocation, total)
+	}
+	return res, nil
+}
+
+// AllocationDrift compares one target (or an untargeted holding, whose target
+// is zero) with the current allocation.
+type AllocationDrift struct {
+	Ticker      string   `json:"ticker,omitempty"`
+	Tag         string   `json:"tag,omitempty"`
+	Tickers     []string `json:"tickers"`
+	TargetPct   float64  `json:"target_pct"`
+	CurrentPct  float64  `json:"current_pct"`
+	DriftPct    float64  `json:"drift_pct"`
+	BandPct     float64  `json:"band_pct"`
+	Value       Decimal  `json:"value"`
+	TargetValue Decimal  `json:"target_value"`
+	WithinBand  bool     `json:"within_band"`
+}
+
+type RebalanceTrade struct {
+	Ticker   string          `json:"ticker"`
+	Type     TransactionType `json:"type"`
+	Quantity Decimal         `json:"quantity"`
+	Price    float64         `json:"price"`
+	Amount   Decimal         `json:"amount"`
+}
+
+// RebalanceOptions controls planning. NewCash is an extra contribution to invest;
+// CashOnly forbids sells and spends only cash on underweight allocations.
+type RebalanceOptions struct {
+	NewCash  Decimal
+	CashOnly bool
+}
+
+type RebalancePlan struct {
+	TotalValue    Decimal           `json:"total_value"`
+	Cash          Decimal           `json:"cash"`
+	NewCash       Decimal           `json:"new_cash"`
+	CashOnly      bool              `json:"cash_only"`
+	TargetCashPct float64           `json:"target_cash_pct"`
+	CashPct       float64           `json:"cash_pct"`
+	CashAfter     Decimal           `json:"cash_after"`
+	Allocations   []AllocationDrift `json:"allocations"`
+	Trades        []RebalanceTrade  `json:"trades"`
+	Warnings      []string          `json:"warnings,omitempty"`
+}
+
+type rebalanceBucket struct {
+	drift   AllocationDrift
+	members []PositionDetails
+	amount  Decimal
+}
+
+// RebalancePlan compares current weights, from PositionDetails and Cash, with the
+// portfolio's targets and plans the trades that bring out-of-band allocations
+// back to target. Quantities are whole shares except for crypto.
+func (p *Portfolio) RebalancePlan(opts RebalanceOptions) RebalancePlan {
+	cash := p.Cash.Add(opts.NewCash)
+	total := p.TotalValue().Add(opts.NewCash)
+	plan := RebalancePlan{
+		TotalValue:    total,
+		Cash:          p.Cash,
+		NewCash:       opts.NewCash,
+		CashOnly:      opts.CashOnly,
+		TargetCashPct: 100,
+		Allocations:   []AllocationDrift{},
+		Trades:        []RebalanceTrade{},
+	}
+	if !total.IsPositive() {
+		plan.Warnings = append(plan.Warnings, "portfolio has no value to allocate")
+		return plan
+	}
+	plan.CashPct = cash.Float() / total.Float() * 100
+
+	for _, ticker := range p.shortTickers() {
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("short position %s is left out of rebalancing", ticker))
+	}
+	buckets := p.rebalanceBuckets(total)
+	for _, b := range buckets {
+		plan.TargetCashPct -= b.drift.TargetPct
+		if !b.drift.Value.IsPositive() && b.drift.TargetPct > 0 {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("no priced holding for %s; buy it manually", bucketName(b.drift)))
+		}
+	}
+
+	if opts.CashOnly {
+		planCashOnly(buckets, cash)
+	} else {
+		planFull(buckets, cash)
+	}
+
+	plan.CashAfter = cash
+	for _, b := range buckets {
+		plan.Allocations = append(plan.Allocations, b.drift)
+		for _, tr := range b.trades() {
+			plan.Trades = append(plan.Trades, tr)
+			if tr.Type == TxBuy {
+				plan.CashAfter = plan.CashAfter.Sub(tr.Amount)
+			} else {
+				plan.CashAfter = plan.CashAfter.Add(tr.Amount)
+			}
+		}
+	}
+	return plan
+}
+
+func (p *Portfolio) rebalanceBuckets(total Decimal) []*rebalanceBucket {
+	targets, _ := ValidateTargets(p.Targets)
+	tickerTarget := make(map[string]bool)
+	for _, t := range targets {
+		if t.Ticker != "" {
+			tickerTarget[t.Ticker] = true
+		}
+	}
+
+	tickers := p.longTickers()
+	assigned := make(map[string]bool)
+	var buckets []*rebalanceBucket
+	for _, t := range targets {
+		b := &rebalanceBucket{drift: AllocationDrift{Ticker: t.Ticker, Tag: t.Tag, TargetPct: t.WeightPct, BandPct: t.BandPct}}
+		for _, ticker := range tickers {
+			match := ticker == t.Ticker
+			if t.Tag != "" {
+				match = !tickerTarget[ticker] && p.AllocationTags[ticker] == t.Tag
+			}
+			if match {
+				b.members = append(b.members, p.Positions[ticker].DetailedMetrics())
+				assigned[ticker] = true
+			}
+		}
+		buckets = append(buckets, b)
+	}
+	for _, ticker := range tickers {
+		if !assigned[ticker] {
+			buckets = append(buckets, &rebalanceBucket{
+				drift:   AllocationDrift{Ticker: ticker},
+				members: []PositionDetails{p.Positions[ticker].DetailedMetrics()},
+			})
+		}
+	}
+
+	for _, b := range buckets {
+		b.drift.Tickers = []string{}
+		for _, m := range b.members {
+			b.drift.Tickers = append(b.drift.Tickers, m.Ticker)
+			b.drift.Value = b.drift.Value.Add(m.CurrentValue)
+		}
+		b.drift.CurrentPct = b.drift.Value.Float() / total.Float() * 100
+		b.drift.DriftPct = b.drift.CurrentPct - b.drift.TargetPct
+		b.drift.TargetValue = total.MulFloat(b.drift.TargetPct / 100)
+		b.drift.WithinBand = math.Abs(b.drift.DriftPct) <= b.drift.BandPct+1e-9
+	}
+	return buckets
+}
+
+// planFull moves every out-of-band allocation to its target, scaling buys down
+// when cash plus sale proceeds cannot fund them.
+func planFull(buckets []*rebalanceBucket, cash Decimal) {
+	funds, buys := cash, Decimal{}
+	for _, b := range buckets {
+		if b.drift.WithinBand || !b.drift.Value.IsPositive() {
+			continue
+		}
+		b.amount = b.drift.TargetValue.Sub(b.drift.Value)
+		if b.amount.IsNegative() {
+			funds = funds.Sub(b.amount)
+		} else {
+			buys = buys.Add(b.amount)
+		}
+	}
+	scaleBuys(buckets, buys, funds)
+}
+
+// planCashOnly spends cash on underweight allocations in proportion to their shortfall.
+func planCashOnly(buckets []*rebalanceBucket, cash Decimal) {
+	var buys Decimal
+	for _, b := range buckets {
+		if !b.drift.Value.IsPositive() {
+			continue
+		}
+		if shortfall := b.drift.TargetValue.Sub(b.drift.Value); shortfall.IsPositive() {
+			b.amount = shortfall
+			buys = buys.Add(shortfall)
+		}
+	}
+	scaleBuys(buckets, buys, cash)
+}
+
+func scaleBuys(buckets []*rebalanceBucket, buys, funds Decimal) {
+	if buys.Cmp(funds) <= 0 || !buys.IsPositive() {
+		return
+	}
+	if funds.IsNegative() {
+		funds = Decimal{}
+	}
+	for _, b := range buckets {
+		if b.amount.IsPositive() {
+			b.amount = b.amount.Scale(funds, buys)
+		}
+	}
+}
+
+// trades splits the bucket amount across its members in proportion to their
+// value. Members are held long positions, so a bucket without a priced member
+// plans nothing and RebalancePlan warns about it instead.
+func (b *rebalanceBucket) trades() []RebalanceTrade {
+	if b.amount.IsZero() || !b.drift.Value.IsPositive() {
+		return nil
+	}
+	var trades []RebalanceTrade
+	for _, m := range b.members {
+		if !m.Shares.IsPositive() || !m.CurrentValue.IsPositive() {
+			continue
+		}
+		// The member's part of the amount, at its value per share.
+		qty := b.amount.Abs().Scale(m.Shares, b.drift.Value)
+		if m.AssetClass != AssetCrypto {
+			qty = wholeShares(qty)
+		}
+		kind := TxBuy
+		if b.amount.IsNegative() {
+			kind = TxSell
+			qty = MinDecimal(qty, m.Shares)
+		}
+		if !qty.IsPositive() {
+			continue
+		}
+		trades = append(trades, RebalanceTrade{Ticker: m.Ticker, Type: kind, Quantity: qty, Price: m.CurrentPrice, Amount: qty.Scale(m.CurrentValue, m.Shares)})
+	}
+	return trades
+}
+
+// wholeShares rounds qty down to whole shares, keeping a quantity that falls
+// short of the next share only by the last decimal place.
+func wholeShares(qty Decimal) Decimal {
+	whole := qty.Round(0)
+	if whole.Sub(qty).Cmp(NewDecimal(1e-8)) > 0 {
+		whole = whole.Sub(NewDecimal(1))
+	}
+	return whole
+}
+
+func bucketName(d AllocationDrift) string {
+	if d.Ticker != "" {
+		return d.Ticker
+	}
+	return "tag " + d.Tag
+}
@@ -0,0 +1,135 @@
+package portfolio
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"tracktrades/internal/util"
+)
+
+// ErrInvalidRecovery is returned for projections whose target date is not in
+// the future or whose assumed return is a total loss.
+var ErrInvalidRecovery = errors.New("invalid recovery projection")
+
+const daysPerYear = 365.25
+
+// DefaultAnnualReturnPct is the return assumed by the CLI and API when none is
+// given, roughly the long-run real return of equities.
+const DefaultAnnualReturnPct = 7.0
+
+// RecoveryOptions are the assumptions of a recovery projection.
+// AnnualReturnPct is the compounded annual return prices are assumed to earn,
+// and By the target date, one year ahead when zero.
+type RecoveryOptions struct {
+	AnnualReturnPct float64   `json:"annual_return_pct"`
+	By              time.Time `json:"by"`
+}
+
+// RecoveryProjection projects how a drawdown recovers. YearsToRecover and
+// ExpectedRecovery follow the assumed return and are omitted when it never
+// recovers the loss. RequiredReturnPct is the annual price return needed to
+// recover by the target date; for shorts it is a decline and negative.
+// ProbabilityPct is the chance of recovering by the target date at the
+// assumed return and the historical volatility, and is omitted without at
+// least two daily returns in the stored history.
+type RecoveryProjection struct {
+	Ticker            string     `json:"ticker,omitempty"`
+	Short             bool       `json:"short,omitempty"`
+	DrawdownPct       float64    `json:"drawdown_pct"`
+	RecoveryNeededPct float64    `json:"recovery_needed_pct"`
+	YearsToRecover    float64    `json:"years_to_recover,omitempty"`
+	ExpectedRecovery  *time.Time `json:"expected_recovery,omitempty"`
+	RequiredReturnPct float64    `json:"required_return_pct"`
+	VolatilityPct     float64    `json:"volatility_pct"`
+	Observations      int        `json:"observations"`
+	ProbabilityPct    *float64   `json:"probability_pct,omitempty"`
+}
+
+type RecoveryReport struct {
+	AsOf            time.Time            `json:"as_of"`
+	AnnualReturnPct float64              `json:"annual_return_pct"`
+	By              time.Time            `json:"by"`
+	Portfolio       RecoveryProjection   `json:"portfolio"`
+	Positions       []RecoveryProjection `json:"positions"`
+}
+
+// RecoveryProjections projects the recovery of the portfolio from its
+// high-water mark and of each position from its peak price (the lowest price
+// for shorts). Volatility is measured on the stored daily history.
+func (p *Portfolio) RecoveryProjections(now time.Time, opts RecoveryOptions) (RecoveryReport, error) {
+	if opts.By.IsZero() {
+		opts.By = now.AddDate(1, 0, 0)
+	}
+	if !opts.By.After(now) {
+		return RecoveryReport{}, fmt.Errorf("%w: target date %s is not after %s", ErrInvalidRecovery, opts.By.Format(time.DateOnly), now.Format(time.DateOnly))
+	}
+	if opts.AnnualReturnPct <= -100 {
+		return RecoveryReport{}, fmt.Errorf("%w: assumed return must be above -100%%", ErrInvalidRecovery)
+	}
+	years := opts.By.Sub(now).Hours() / 24 / daysPerYear
+	report := RecoveryReport{AsOf: now, AnnualReturnPct: opts.AnnualReturnPct, By: opts.By, Positions: []RecoveryProjection{}}
+
+	m := p.Metrics()
+	report.Portfolio = projectRecovery(m.DrawdownFromPeakPct, false, p.DailyReturns(), opts.AnnualReturnPct, now, years)
+
+	tickers := make([]string, 0, len(p.Positions))
+	for ticker := range p.Positions {
+		tickers = append(tickers, ticker)
+	}
+	sort.Strings(tickers)
+	for _, ticker := range tickers {
+		pos := p.Positions[ticker]
+		d := pos.DetailedMetrics()
+		proj := projectRecovery(d.DrawdownFromPeakPct, pos.IsShort(), p.PositionDailyReturns(ticker), opts.AnnualReturnPct, now, years)
+		proj.Ticker = ticker
+		report.Positions = append(report.Positions, proj)
+	}
+	return report, nil
+}
+
+// projectRecovery projects a drawdown of drawdownPct. A short recovers when
+// the price falls back to its low, which is the inverse of the price gaining
+// drawdownPct, so it is projected on the inverse price, whose return is the
+// inverse of the assumed one. returns are the position's own returns, so
+// their volatility applies to either side.
+func projectRecovery(drawdownPct float64, short bool, returns []DailyReturn, annualReturnPct float64, now time.Time, years float64) RecoveryProjection {
+	stats := ComputeRisk(returns, 0, nil)
+	proj := RecoveryProjection{
+		Short:         short,
+		DrawdownPct:   drawdownPct,
+		VolatilityPct: stats.VolatilityPct,
+		Observations:  stats.Observations,
+	}
+	gainPct, returnPct := util.RequiredRecoveryPct(drawdownPct), annualReturnPct
+	proj.RecoveryNeededPct = gainPct
+	if short {
+		gainPct, returnPct = drawdownPct, inverseReturnPct(annualReturnPct)
+		proj.RecoveryNeededPct = util.RequiredShortRecoveryPct(drawdownPct)
+	}
+	if math.IsInf(gainPct, 1) {
+		return proj
+	}
+
+	if y, ok := util.RecoveryYears(gainPct, returnPct); ok {
+		proj.YearsToRecover = y
+		at := now.AddDate(0, 0, int(math.Round(y*daysPerYear)))
+		proj.ExpectedRecovery = &at
+	}
+	proj.RequiredReturnPct = util.RequiredAnnualReturnPct(gainPct, years)
+	if short {
+		proj.RequiredReturnPct = inverseReturnPct(proj.RequiredReturnPct)
+	}
+	if stats.Observations >= 2 {
+		pct := util.RecoveryProbabilityPct(gainPct, returnPct, stats.VolatilityPct, years)
+		proj.ProbabilityPct = &pct
+	}
+	return proj
+}
+
+// inverseReturnPct is the return of 1/price when the price returns pct.
+func inverseReturnPct(pct float64) float64 {
+	return (1/(1+pct/100) - 1) * 100
+}
@@ -0,0 +1,337 @@
+package portfolio
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"tracktrades/internal/util"
+)
+
+type PricePoint struct {
+	Date  time.Time `json:"date"`
+	Close float64   `json:"close"`
+}
+
+// Valuation is one point of a value series. Flow is the money moved in (positive)
+// or taken out (negative) that day; it is excluded from performance.
+type Valuation struct {
+	Date  time.Time `json:"date"`
+	Value float64   `json:"value"`
+	Flow  float64   `json:"flow"`
+}
+
+type ReturnFigures struct {
+	StartValue       float64 `json:"start_value"`
+	EndValue         float64 `json:"end_value"`
+	NetFlows         float64 `json:"net_flows"`
+	TWRPct           float64 `json:"twr_pct"`
+	AnnualizedTWRPct float64 `json:"annualized_twr_pct"`
+	MWRPct           float64 `json:"mwr_pct"`
+}
+
+type PositionReturns struct {
+	Ticker string `json:"ticker"`
+	ReturnFigures
+}
+
+type ReturnsReport struct {
+	From      time.Time         `json:"from"`
+	To        time.Time         `json:"to"`
+	Portfolio ReturnFigures     `json:"portfolio"`
+	Positions []PositionReturns `json:"positions"`
+}
+
+// LedgerWithOpeningBalances returns the ledger as the next Record would see it,
+// with hand-entered cash and positions expressed as opening entries.
+func (p *Portfolio) LedgerWithOpeningBalances() []Transaction {
+	ledger := append(p.openingEntries(time.Now()), p.Transactions...)
+	sort.SliceStable(ledger, func(i, j int) bool { return ledger[i].Date.Before(ledger[j].Date) })
+	return ledger
+}
+
+// TradedTickers lists every ticker bought, shorted or renamed into on or before to.
+func (p *Portfolio) TradedTickers(to time.Time) []string {
+	seen := make(map[string]bool)
+	var tickers []string
+	for _, tx := range p.LedgerWithOpeningBalances() {
+		ticker := tx.Ticker
+		if tx.Type == TxRename {
+			ticker = tx.NewTicker
+		} else if !tx.opens() {
+			continue
+		}
+		if !dayOf(tx.Date).After(dayOf(to)) && !seen[ticker] {
+			seen[ticker] = true
+			tickers = append(tickers, ticker)
+		}
+	}
+	sort.Strings(tickers)
+	return tickers
+}
+
+// ValueSeries values the portfolio on every day with a close in [from, to].
+// Deposits and withdrawals are the external flows.
+func (p *Portfolio) ValueSeries(closes map[string][]PricePoint, from, to time.Time) []Valuation {
+	cur := newLedgerCursor(p.LedgerWithOpeningBalances(), p.Base())
+	var series []Valuation
+	for _, d := range seriesDates(closes, from, to) {
+		var flow Decimal
+		cur.advance(d, func(tx Transaction) {
+			if tx.Type == TxDeposit || tx.Type == TxWithdrawal {
+				flow = flow.Add(tx.cashImpact(cur.base))
+			}
+		})
+		value := cur.cash.Float()
+		for ticker, shares := range cur.shares {
+			value += shares.Float() * cur.priceAsOf(ticker, closes[ticker], d) * cur.unitValue(ticker)
+		}
+		series = append(series, Valuation{Date: d, Value: value, Flow: flow.Float()})
+	}
+	if len(series) > 0 {
+		series[0].Flow = 0
+	}
+	return series
+}
+
+// PositionValueSeries values a single holding. Buys and fees charged to the
+// position are money in; sales and dividends are money out. Short positions have a negative value, so shorting
+// is money out and covering money in. A rename moves the holding's value out of
+// the old ticker and into the new one.
+func (p *Portfolio) PositionValueSeries(ticker string, closes []PricePoint, from, to time.Time) []Valuation {
+	cur := newLedgerCursor(p.LedgerWithOpeningBalances(), p.Base())
+	var series []Valuation
+	for _, d := range seriesDates(map[string][]PricePoint{ticker: closes}, from, to) {
+		flow := 0.0
+		cur.advance(d, func(tx Transaction) {
+			if tx.Type == TxRename {
+				switch ticker {
+				case tx.Ticker:
+					flow -= cur.renamed.Float() * cur.priceAsOf(ticker, closes, d) * cur.unitValue(ticker)
+				case tx.NewTicker:
+					flow += cur.renamed.Float() * tx.shareRatio().Float() * cur.priceAsOf(ticker, closes, d) * cur.unitValue(ticker)
+				}
+				return
+			}
+			if tx.Ticker != ticker {
+				return
+			}
+			switch tx.Type {
+			case TxBuy, TxSell, TxShort, TxCover, TxDividend, TxFee:
+				flow -= tx.cashImpact(cur.base).Float()
+			}
+		})
+		value := cur.shares[ticker].Float() * cur.priceAsOf(ticker, closes, d) * cur.unitValue(ticker)
+		series = append(series, Valuation{Date: d, Value: value, Flow: flow})
+	}
+	if len(series) > 0 {
+		series[0].Flow = 0
+	}
+	return series
+}
+
+// ReturnsReport computes portfolio and per-position returns between from and to.
+func (p *Portfolio) ReturnsReport(closes map[string][]PricePoint, from, to time.Time) ReturnsReport {
+	report := ReturnsReport{
+		From:      from,
+		To:        to,
+		Portfolio: Returns(p.ValueSeries(closes, from, to)),
+		Positions: []PositionReturns{},
+	}
+	for _, ticker := range p.TradedTickers(to) {
+		series := p.PositionValueSeries(ticker, closes[ticker], from, to)
+		if !seriesActive(series) {
+			continue
+		}
+		report.Positions = append(report.Positions, PositionReturns{Ticker: ticker, ReturnFigures: Returns(series)})
+	}
+	return report
+}
+
+// Returns computes the chain-linked time-weighted return and the money-weighted
+// return (XIRR) of a value series. Flows are assumed to happen at the start of the day.
+func Returns(series []Valuation) ReturnFigures {
+	if len(series) == 0 {
+		return ReturnFigures{}
+	}
+	first, last := series[0], series[len(series)-1]
+	res := ReturnFigures{StartValue: first.Value, EndValue: last.Value}
+
+	growth := 1.0
+	for i := 1; i < len(series); i++ {
+		res.NetFlows += series[i].Flow
+		base := series[i-1].Value + series[i].Flow
+		if base <= 0 {
+			continue
+		}
+		growth *= series[i].Value / base
+	}
+	res.TWRPct = (growth - 1) * 100
+
+	days := last.Date.Sub(first.Date).Hours() / 24
+	if days > 0 && growth > 0 {
+		res.AnnualizedTWRPct = (math.Pow(growth, 365/days) - 1) * 100
+	}
+
+	dates := []time.Time{first.Date}
+	amounts := []float64{-first.Value}
+	for i := 1; i < len(series); i++ {
+		amount := -series[i].Flow
+		if i == len(series)-1 {
+			amount += last.Value
+		}
+		if amount != 0 {
+			dates = append(dates, series[i].Date)
+			amounts = append(amounts, amount)
+		}
+	}
+	if irr, err := util.XIRR(dates, amounts); err == nil {
+		res.MWRPct = irr * 100
+	}
+	return res
+}
+
+func seriesActive(series []Valuation) bool {
+	for _, v := range series {
+		if v.Value != 0 || v.Flow != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func dayOf(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// seriesDates returns from, to and every day with a close in between.
+func seriesDates(closes map[string][]PricePoint, from, to time.Time) []time.Time {
+	from, to = dayOf(from), dayOf(to)
+	seen := map[time.Time]bool{from: true, to: true}
+	dates := []time.Time{from}
+	if to.After(from) {
+		dates = append(dates, to)
+	}
+	for _, points := range closes {
+		for _, pt := range points {
+			d := dayOf(pt.Date)
+			if d.Before(from) || d.After(to) || seen[d] {
+				continue
+			}
+			seen[d] = true
+			dates = append(dates, d)
+		}
+	}
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+	return dates
+}
+
+// ledgerCursor walks the ledger day by day tracking cash and share counts,
+// booked as the ledger books them.
+type ledgerCursor struct {
+	ledger    []Transaction
+	base      string
+	next      int
+	cash      Decimal
+	shares    map[string]Decimal
+	rate      map[string]float64
+	mult      map[string]float64
+	lastPrice map[string]float64
+	// renamed is the share count moved by the last rename, before conversion.
+	renamed Decimal
+}
+
+func newLedgerCursor(ledger []Transaction, base string) *ledgerCursor {
+	return &ledgerCursor{
+		ledger:    ledger,
+		base:      base,
+		shares:    make(map[string]Decimal),
+		rate:      make(map[string]float64),
+		mult:      make(map[string]float64),
+		lastPrice: make(map[string]float64),
+	}
+}
+
+// advance applies every transaction dated on or before day d, calling visit for each.
+func (c *ledgerCursor) advance(d time.Time, visit func(Transaction)) {
+	for c.next < len(c.ledger) && !dayOf(c.ledger[c.next].Date).After(d) {
+		tx := c.ledger[c.next]
+		c.next++
+		c.cash = c.cash.Add(tx.cashImpact(c.base))
+
+		switch tx.Type {
+		case TxBuy:
+			c.shares[tx.Ticker] = c.shares[tx.Ticker].Add(tx.Quantity)
+			c.rate[tx.Ticker] = tx.rate().Float()
+			c.mult[tx.Ticker] = tx.multiplier()
+			c.lastPrice[tx.Ticker] = tx.Price.Float()
+		case TxSell, TxShort:
+			c.shares[tx.Ticker] = c.shares[tx.Ticker].Sub(tx.Quantity)
+			c.rate[tx.Ticker] = tx.rate().Float()
+			c.mult[tx.Ticker] = tx.multiplier()
+			c.lastPrice[tx.Ticker] = tx.Price.Float()
+			if c.shares[tx.Ticker].IsZero() {
+				delete(c.shares, tx.Ticker)
+			}
+		case TxCover:
+			c.shares[tx.Ticker] = c.shares[tx.Ticker].Add(tx.Quantity)
+			c.rate[tx.Ticker] = tx.rate().Float()
+			c.lastPrice[tx.Ticker] = tx.Price.Float()
+			if c.shares[tx.Ticker].IsZero() {
+				delete(c.shares, tx.Ticker)
+			}
+		case TxDividend:
+			if tx.Reinvest {
+				c.shares[tx.Ticker] = c.shares[tx.Ticker].Add(tx.Quantity)
+				c.rate[tx.Ticker] = tx.rate().Float()
+				c.lastPrice[tx.Ticker] = tx.Price.Float()
+			}
+		case TxStockDividend:
+			if held := c.shares[tx.Ticker]; held.IsPositive() {
+				c.lastPrice[tx.Ticker] *= held.Float() / held.Add(tx.Quantity).Float()
+			}
+			c.shares[tx.Ticker] = c.shares[tx.Ticker].Add(tx.Quantity)
+		case TxSplit:
+			c.shares[tx.Ticker] = c.shares[tx.Ticker].Mul(tx.Ratio)
+			c.lastPrice[tx.Ticker] /= tx.Ratio.Float()
+		case TxRename:
+			ratio := tx.shareRatio()
+			c.renamed = c.shares[tx.Ticker]
+			delete(c.shares, tx.Ticker)
+			c.shares[tx.NewTicker] = c.shares[tx.NewTicker].Add(c.renamed.Mul(ratio))
+			c.rate[tx.NewTicker] = c.rate[tx.Ticker]
+			c.mult[tx.NewTicker] = c.mult[tx.Ticker]
+			if _, ok := c.lastPrice[tx.NewTicker]; !ok {
+				c.lastPrice[tx.NewTicker] = c.lastPrice[tx.Ticker] / ratio.Float()
+			}
+		}
+		visit(tx)
+	}
+}
+
+// unitValue converts a price of ticker into base currency per share or contract.
+func (c *ledgerCursor) unitValue(ticker string) float64 {
+	m := c.mult[ticker]
+	if m == 0 {
+		m = 1
+	}
+	return c.rate[ticker] * m
+}
+
+// priceAsOf returns the last close on or before d, falling back to the last traded price.
+func (c *ledgerCursor) priceAsOf(ticker string, closes []PricePoint, d time.Time) float64 {
+	if price := closeAsOf(closes, d); price > 0 {
+		return price
+	}
+	return c.lastPrice[ticker]
+}
+
+// closeAsOf returns the last close on or before d, or zero when there is none.
+func closeAsOf(closes []PricePoint, d time.Time) float64 {
+	i := sort.Search(len(closes), func(i int) bool { return dayOf(closes[i].Date).After(d) })
+	if i > 0 {
+		return closes[i-1].Close
+	}
+	return 0
+}
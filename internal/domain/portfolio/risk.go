@@ -0,0 +1,244 @@
+package portfolio
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"tracktrades/internal/util"
+)
+
+const tradingDaysPerYear = 252
+
+type DailyReturn struct {
+	Date   time.Time `json:"date"`
+	Return float64   `json:"return"`
+}
+
+type DrawdownPeriod struct {
+	DepthPct  float64    `json:"depth_pct"`
+	Peak      time.Time  `json:"peak"`
+	Trough    time.Time  `json:"trough"`
+	Recovered *time.Time `json:"recovered,omitempty"`
+}
+
+// RiskStats summarizes a daily return series. Ratios use the annual risk-free
+// rate; beta and correlation are only set when a benchmark series is given.
+type RiskStats struct {
+	Observations        int            `json:"observations"`
+	AnnualizedReturnPct float64        `json:"annualized_return_pct"`
+	VolatilityPct       float64        `json:"volatility_pct"`
+	SharpeRatio         float64        `json:"sharpe_ratio"`
+	SortinoRatio        float64        `json:"sortino_ratio"`
+	MaxDrawdown         DrawdownPeriod `json:"max_drawdown"`
+	Benchmark           string         `json:"benchmark,omitempty"`
+	Beta                float64        `json:"beta,omitempty"`
+	Correlation         float64        `json:"correlation,omitempty"`
+}
+
+type PositionRisk struct {
+	Ticker string `json:"ticker"`
+	RiskStats
+}
+
+type PortfolioRisk struct {
+	RiskFreeRatePct float64        `json:"risk_free_rate_pct"`
+	Portfolio       RiskStats      `json:"portfolio"`
+	Positions       []PositionRisk `json:"positions"`
+}
+
+// dailyHistory keeps the last stored snapshot of each day. A day whose quotes
+// did not refresh since the previous day, such as a weekend or market holiday
+// for a portfolio of stocks, is dropped so it does not add a zero return to a
+// series annualized over 252 trading days. Crypto quotes refresh every day, so
+// their weekends are kept.
+func (p *Portfolio) dailyHistory() []Snapshot {
+	var days []Snapshot
+	for _, s := range p.History {
+		if n := len(days); n > 0 && dayOf(days[n-1].Time).Equal(dayOf(s.Time)) {
+			days[n-1] = s
+			continue
+		}
+		days = append(days, s)
+	}
+	trading := days[:0]
+	for _, s := range days {
+		if n := len(trading); n > 0 && s.QuoteDate != nil && trading[n-1].QuoteDate != nil && s.QuoteDate.Equal(*trading[n-1].QuoteDate) {
+			continue
+		}
+		trading = append(trading, s)
+	}
+	return trading
+}
+
+// DailyReturns derives day-over-day returns from the stored history, removing
+// deposits and withdrawals made between snapshots.
+func (p *Portfolio) DailyReturns() []DailyReturn {
+	days := p.dailyHistory()
+	var res []DailyReturn
+	for i := 1; i < len(days); i++ {
+		var flow Decimal
+		for _, tx := range p.Transactions {
+			if (tx.Type == TxDeposit || tx.Type == TxWithdrawal) && tx.Date.After(days[i-1].Time) && !tx.Date.After(days[i].Time) {
+				flow = flow.Add(tx.cashImpact(p.Base()))
+			}
+		}
+		base := days[i-1].Value.Add(flow)
+		if !base.IsPositive() {
+			continue
+		}
+		res = append(res, DailyReturn{Date: dayOf(days[i].Time), Return: days[i].Value.Float()/base.Float() - 1})
+	}
+	return res
+}
+
+// PositionDailyReturns derives price returns for ticker from the stored snapshots.
+func (p *Portfolio) PositionDailyReturns(ticker string) []DailyReturn {
+	var points []PricePoint
+	for _, s := range p.dailyHistory() {
+		if price, ok := s.Prices[ticker]; ok && price > 0 {
+			points = append(points, PricePoint{Date: s.Time, Close: price})
+		}
+	}
+	returns := PriceReturns(points)
+	if pos, ok := p.Positions[ticker]; ok && pos.IsShort() {
+		for i := range returns {
+			returns[i].Return = -returns[i].Return
+		}
+	}
+	return returns
+}
+
+// PriceReturns converts a close series into daily returns.
+func PriceReturns(points []PricePoint) []DailyReturn {
+	var res []DailyReturn
+	for i := 1; i < len(points); i++ {
+		if points[i-1].Close <= 0 {
+			continue
+		}
+		res = append(res, DailyReturn{Date: dayOf(points[i].Date), Return: points[i].Close/points[i-1].Close - 1})
+	}
+	return res
+}
+
+// ComputeRisk annualizes a daily return series assuming 252 trading days.
+func ComputeRisk(returns []DailyReturn, riskFreePct float64, benchmark []DailyReturn) RiskStats {
+	stats := RiskStats{Observations: len(returns)}
+	if len(returns) < 2 {
+		return stats
+	}
+
+	rs := make([]float64, len(returns))
+	for i, r := range returns {
+		rs[i] = r.Return
+	}
+	rf := riskFreePct / 100
+	dailyRF := rf / tradingDaysPerYear
+	annualReturn := util.Mean(rs) * tradingDaysPerYear
+	vol := util.StdDev(rs) * math.Sqrt(tradingDaysPerYear)
+
+	stats.AnnualizedReturnPct = annualReturn * 100
+	stats.VolatilityPct = vol * 100
+	if vol > 0 {
+		stats.SharpeRatio = (annualReturn - rf) / vol
+	}
+
+	downside := 0.0
+	for _, r := range rs {
+		if d := r - dailyRF; d < 0 {
+			downside += d * d
+		}
+	}
+	if downside > 0 {
+		downsideDev := math.Sqrt(downside/float64(len(rs))) * math.Sqrt(tradingDaysPerYear)
+		stats.SortinoRatio = (annualReturn - rf) / downsideDev
+	}
+
+	stats.MaxDrawdown = maxDrawdown(returns)
+
+	if len(benchmark) > 0 {
+		xs, ys := alignReturns(returns, benchmark)
+		if len(xs) >= 2 {
+			if v := util.StdDev(ys); v > 0 {
+				stats.Beta = util.Covariance(xs, ys) / (v * v)
+			}
+			stats.Correlation = util.Correlation(xs, ys)
+		}
+	}
+	return stats
+}
+
+// maxDrawdown finds the deepest peak-to-trough fall of the compounded return index.
+func maxDrawdown(returns []DailyReturn) DrawdownPeriod {
+	var worst DrawdownPeriod
+	index, peak := 1.0, 1.0
+	peakDate := returns[0].Date.AddDate(0, 0, -1)
+	var current DrawdownPeriod
+
+	for _, r := range returns {
+		index *= 1 + r.Return
+		if index >= peak {
+			if current.DepthPct > 0 && current.Recovered == nil {
+				d := r.Date
+				current.Recovered = &d
+				if current.Peak.Equal(worst.Peak) && current.Trough.Equal(worst.Trough) {
+					worst.Recovered = &d
+				}
+			}
+			peak, peakDate = index, r.Date
+			current = DrawdownPeriod{}
+			continue
+		}
+		depth := (peak - index) / peak * 100
+		if depth > current.DepthPct {
+			current = DrawdownPeriod{DepthPct: depth, Peak: peakDate, Trough: r.Date}
+		}
+		if depth > worst.DepthPct {
+			worst = current
+		}
+	}
+	return worst
+}
+
+// alignReturns pairs the two series on their common dates.
+func alignReturns(a, b []DailyReturn) (xs, ys []float64) {
+	byDate := make(map[time.Time]float64, len(b))
+	for _, r := range b {
+		byDate[r.Date] = r.Return
+	}
+	for _, r := range a {
+		if y, ok := byDate[r.Date]; ok {
+			xs = append(xs, r.Return)
+			ys = append(ys, y)
+		}
+	}
+	return xs, ys
+}
+
+// Risk computes portfolio and per-position statistics from the stored history,
+// against the benchmark closes when provided.
+func (p *Portfolio) Risk(benchmark []PricePoint) PortfolioRisk {
+	bench := PriceReturns(benchmark)
+	res := PortfolioRisk{
+		RiskFreeRatePct: p.RiskFreeRatePct,
+		Portfolio:       ComputeRisk(p.DailyReturns(), p.RiskFreeRatePct, bench),
+		Positions:       []PositionRisk{},
+	}
+	if len(bench) > 0 {
+		res.Portfolio.Benchmark = p.RiskBenchmark
+	}
+
+	tickers := make([]string, 0, len(p.Positions))
+	for ticker := range p.Positions {
+		tickers = append(tickers, ticker)
+	}
+	sort.Strings(tickers)
+	for _, ticker := range tickers {
+		stats := ComputeRisk(p.PositionDailyReturns(ticker), p.RiskFreeRatePct, bench)
+		if len(bench) > 0 {
+			stats.Benchmark = p.RiskBenchmark
+		}
+		res.Positions = append(res.Positions, PositionRisk{Ticker: ticker, RiskStats: stats})
+	}
+	return res
+}
@@ -0,0 +1,466 @@
+package portfolio
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"tracktrades/internal/util"
+)
+
+// ErrInvalidScenario is returned for malformed shocks and scenarios and for
+// lookups of scenarios that are not saved.
+var ErrInvalidScenario = errors.New("invalid scenario")
+
+// Shock moves prices or an exchange rate by Pct percent. A price shock selects
+// positions by at most one of Ticker, Tag (an allocation tag or a journal tag
+// of the position) and AssetClass, and applies to every position when none is
+// set. A Currency shock moves that currency by Pct against all others, so a
+// stronger base currency lowers the value of foreign positions.
+type Shock struct {
+	Ticker     string     `json:"ticker,omitempty"`
+	Tag        string     `json:"tag,omitempty"`
+	AssetClass AssetClass `json:"asset_class,omitempty"`
+	Currency   string     `json:"currency,omitempty"`
+	Pct        float64    `json:"pct"`
+}
+
+// Normalized upper-cases the ticker, lower-cases the tag and maps plural asset
+// class names such as "equities" to their class.
+func (s Shock) Normalized() Shock {
+	s.Ticker = strings.ToUpper(strings.TrimSpace(s.Ticker))
+	s.Tag = strings.ToLower(strings.TrimSpace(s.Tag))
+	class := strings.ToLower(strings.TrimSpace(string(s.AssetClass)))
+	if c, ok := assetClassWords[class]; ok {
+		s.AssetClass = c
+	} else {
+		s.AssetClass = AssetClass(class)
+	}
+	if s.Currency != "" {
+		s.Currency = NormalizeCurrency(s.Currency)
+	}
+	return s
+}
+
+func (s Shock) Validate() error {
+	selectors := 0
+	for _, v := range []string{s.Ticker, s.Tag, string(s.AssetClass), s.Currency} {
+		if v != "" {
+			selectors++
+		}
+	}
+	if selectors > 1 {
+		return fmt.Errorf("%w: a shock selects by one of ticker, tag, asset class or currency", ErrInvalidScenario)
+	}
+	if s.AssetClass != "" {
+		if _, err := ParseAssetClass(string(s.AssetClass)); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidScenario, err)
+		}
+	}
+	if s.Pct < -100 {
+		return fmt.Errorf("%w: a shock cannot fall more than 100%%", ErrInvalidScenario)
+	}
+	if s.Currency != "" && s.Pct == -100 {
+		return fmt.Errorf("%w: a currency cannot fall 100%%", ErrInvalidScenario)
+	}
+	return nil
+}
+
+func (s Shock) String() string {
+	selector := "all"
+	switch {
+	case s.Ticker != "":
+		selector = "ticker:" + s.Ticker
+	case s.Tag != "":
+		selector = "tag:" + s.Tag
+	case s.AssetClass != "":
+		selector = "class:" + string(s.AssetClass)
+	case s.Currency != "":
+		selector = "fx:" + s.Currency
+	}
+	return fmt.Sprintf("%s %+g%%", selector, s.Pct)
+}
+
+// Replay is a historical window whose price moves are applied to the current
+// holdings.
+type Replay struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// Scenario is a named set of shocks, a historical replay, or both; replayed
+// moves are applied first and shocks compound on top. Expression is the
+// shocks as written, such as "tech -30%, USD +5%", and is parsed into Shocks
+// when Shocks is empty. A saved scenario keeps both, so reruns use the shocks
+// its selectors resolved to when it was saved.
+type Scenario struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description,omitempty"`
+	Expression  string  `json:"expression,omitempty"`
+	Shocks      []Shock `json:"shocks,omitempty"`
+	Replay      *Replay `json:"replay,omitempty"`
+}
+
+var assetClassWords = map[string]AssetClass{
+	"equity": AssetEquity, "equities": AssetEquity, "stock": AssetEquity, "stocks": AssetEquity,
+	"etf": AssetETF, "etfs": AssetETF,
+	"fund": AssetFund, "funds": AssetFund,
+	"bond": AssetBond, "bonds": AssetBond,
+	"crypto": AssetCrypto, "cryptos": AssetCrypto,
+}
+
+// ParseShocks reads comma-separated shocks such as
+// "tech -30%, BTC -50%, all equities -20%, USD +5%". Each is a selector and a
+// percentage. Selectors may be explicit (ticker:, tag:, class: or fx:) or
+// bare, in which case "all" is every position and otherwise an asset class
+// name, a held or registered ticker, a tag in use and a currency of the
+// portfolio are tried in that order; anything else is taken as a ticker.
+func (p *Portfolio) ParseShocks(expr string) ([]Shock, error) {
+	var shocks []Shock
+	for _, item := range strings.Split(expr, ",") {
+		fields := strings.Fields(item)
+		if len(fields) == 0 {
+			continue
+		}
+		raw := strings.TrimSuffix(fields[len(fields)-1], "%")
+		pct, err := strconv.ParseFloat(raw, 64)
+		if err != nil || len(fields) > 3 {
+			return nil, fmt.Errorf("%w: want SELECTOR PCT%%, got %q", ErrInvalidScenario, strings.TrimSpace(item))
+		}
+		words := fields[:len(fields)-1]
+		if len(words) == 2 && strings.EqualFold(words[0], "all") {
+			words = words[1:]
+		}
+		if len(words) > 1 {
+			return nil, fmt.Errorf("%w: want SELECTOR PCT%%, got %q", ErrInvalidScenario, strings.TrimSpace(item))
+		}
+		selector := ""
+		if len(words) == 1 {
+			selector = words[0]
+		}
+		shock := p.resolveShock(selector).Normalized()
+		shock.Pct = pct
+		if err := shock.Validate(); err != nil {
+			return nil, err
+		}
+		shocks = append(shocks, shock)
+	}
+	if len(shocks) == 0 {
+		return nil, fmt.Errorf("%w: no shocks in %q", ErrInvalidScenario, expr)
+	}
+	return shocks, nil
+}
+
+func (p *Portfolio) resolveShock(selector string) Shock {
+	if kind, value, ok := strings.Cut(selector, ":"); ok {
+		switch strings.ToLower(kind) {
+		case "ticker":
+			return Shock{Ticker: value}
+		case "tag":
+			return Shock{Tag: value}
+		case "class":
+			return Shock{AssetClass: AssetClass(value)}
+		case "fx", "ccy", "currency":
+			return Shock{Currency: value}
+		}
+	}
+	lower, upper := strings.ToLower(selector), strings.ToUpper(selector)
+	if selector == "" || lower == "all" {
+		return Shock{}
+	}
+	if class, ok := assetClassWords[lower]; ok {
+		return Shock{AssetClass: class}
+	}
+	if _, held := p.Positions[upper]; held {
+		return Shock{Ticker: upper}
+	}
+	if _, registered := p.Instruments[upper]; registered {
+		return Shock{Ticker: upper}
+	}
+	for ticker, pos := range p.Positions {
+		if p.AllocationTags[ticker] == lower || slices.Contains(pos.Tags, lower) {
+			return Shock{Tag: lower}
+		}
+	}
+	for _, tag := range p.AllocationTags {
+		if tag == lower {
+			return Shock{Tag: lower}
+		}
+	}
+	if upper == p.Base() {
+		return Shock{Currency: upper}
+	}
+	for _, pos := range p.Positions {
+		if pos.QuoteCurrency() == upper {
+			return Shock{Currency: upper}
+		}
+	}
+	return Shock{Ticker: upper}
+}
+
+// prepareScenario normalizes the name, parses the expression unless the
+// shocks are already given and validates.
+func (p *Portfolio) prepareScenario(sc Scenario) (Scenario, error) {
+	sc.Name = strings.ToLower(strings.TrimSpace(sc.Name))
+	sc.Expression = strings.TrimSpace(sc.Expression)
+	shocks := make([]Shock, 0, len(sc.Shocks))
+	for _, s := range sc.Shocks {
+		s = s.Normalized()
+		if err := s.Validate(); err != nil {
+			return Scenario{}, err
+		}
+		shocks = append(shocks, s)
+	}
+	if sc.Expression != "" && len(shocks) == 0 {
+		parsed, err := p.ParseShocks(sc.Expression)
+		if err != nil {
+			return Scenario{}, err
+		}
+		shocks = append(shocks, parsed...)
+	}
+	sc.Shocks = shocks
+	if sc.Replay != nil {
+		r := Replay{From: dayOf(sc.Replay.From), To: dayOf(sc.Replay.To)}
+		if r.From.IsZero() || !r.To.After(r.From) {
+			return Scenario{}, fmt.Errorf("%w: replay needs a start before its end", ErrInvalidScenario)
+		}
+		sc.Replay = &r
+	}
+	if len(sc.Shocks) == 0 && sc.Replay == nil {
+		return Scenario{}, fmt.Errorf("%w: a scenario needs shocks or a replay", ErrInvalidScenario)
+	}
+	return sc, nil
+}
+
+// SaveScenario stores sc under its name, replacing a saved scenario of the
+// same name. Expressions are parsed against the holdings at the time.
+func (p *Portfolio) SaveScenario(sc Scenario) (Scenario, error) {
+	sc, err := p.prepareScenario(sc)
+	if err != nil {
+		return Scenario{}, err
+	}
+	if sc.Name == "" {
+		return Scenario{}, fmt.Errorf("%w: name is required", ErrInvalidScenario)
+	}
+	for i := range p.Scenarios {
+		if p.Scenarios[i].Name == sc.Name {
+			p.Scenarios[i] = sc
+			return sc, nil
+		}
+	}
+	p.Scenarios = append(p.Scenarios, sc)
+	sort.Slice(p.Scenarios, func(i, j int) bool { return p.Scenarios[i].Name < p.Scenarios[j].Name })
+	return sc, nil
+}
+
+// RemoveScenario deletes the named scenario and reports whether it existed.
+func (p *Portfolio) RemoveScenario(name string) bool {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for i, sc := range p.Scenarios {
+		if sc.Name == name {
+			p.Scenarios = append(p.Scenarios[:i], p.Scenarios[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// SavedScenario returns the named scenario.
+func (p *Portfolio) SavedScenario(name string) (Scenario, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, sc := range p.Scenarios {
+		if sc.Name == name {
+			return sc, nil
+		}
+	}
+	return Scenario{}, fmt.Errorf("%w: no scenario %s", ErrInvalidScenario, name)
+}
+
+// ReplayTickers lists the tickers whose closes a replay needs: every held
+// ticker other than option contracts, and the underlyings of options.
+func (p *Portfolio) ReplayTickers() []string {
+	seen := make(map[string]bool)
+	for ticker, pos := range p.Positions {
+		if pos.Option != nil {
+			ticker = pos.Option.Underlying
+		}
+		seen[ticker] = true
+	}
+	tickers := make([]string, 0, len(seen))
+	for ticker := range seen {
+		tickers = append(tickers, ticker)
+	}
+	sort.Strings(tickers)
+	return tickers
+}
+
+// ScenarioPosition is one position under a scenario. PriceChangePct and
+// FXChangePct are the moves applied to its price and exchange rate, and PnLPct
+// is the P&L as a percentage of its current market value.
+type ScenarioPosition struct {
+	Ticker         string  `json:"ticker"`
+	PriceChangePct float64 `json:"price_change_pct"`
+	FXChangePct    float64 `json:"fx_change_pct,omitempty"`
+	Value          Decimal `json:"value"`
+	ShockedValue   Decimal `json:"shocked_value"`
+	PnL            Decimal `json:"pnl"`
+	PnLPct         float64 `json:"pnl_pct"`
+}
+
+// ScenarioResult is the portfolio after a scenario. DrawdownPct is measured
+// from the high-water mark, and RecoveryNeededPct is the gain needed to get
+// back to it. Unpriced lists the holdings a replay had no closes for; they
+// keep their price.
+type ScenarioResult struct {
+	Scenario          Scenario           `json:"scenario"`
+	TotalValue        Decimal            `json:"total_value"`
+	ShockedValue      Decimal            `json:"shocked_value"`
+	PnL               Decimal            `json:"pnl"`
+	PnLPct            float64            `json:"pnl_pct"`
+	HighWaterMark     Decimal            `json:"high_water_mark"`
+	DrawdownPct       float64            `json:"drawdown_pct"`
+	RecoveryNeededPct float64            `json:"recovery_needed_pct"`
+	Positions         []ScenarioPosition `json:"positions"`
+	Unpriced          []string           `json:"unpriced,omitempty"`
+}
+
+// RunScenario values the portfolio under sc. A replay takes each holding's
+// move from its last close on or before the start to its last close on or
+// before the end, from closes or, when closes is nil, the stored history.
+// Options move with their underlying through their delta.
+func (p *Portfolio) RunScenario(sc Scenario, closes map[string][]PricePoint) (ScenarioResult, error) {
+	sc, err := p.prepareScenario(sc)
+	if err != nil {
+		return ScenarioResult{}, err
+	}
+	res := ScenarioResult{Scenario: sc, TotalValue: p.TotalValue(), Positions: []ScenarioPosition{}}
+
+	replayed := make(map[string]float64)
+	if sc.Replay != nil {
+		if closes == nil {
+			closes = p.storedCloses()
+		}
+		for _, ticker := range p.ReplayTickers() {
+			if move, ok := replayMove(closes[ticker], sc.Replay.From, sc.Replay.To); ok {
+				replayed[ticker] = move
+			} else {
+				res.Unpriced = append(res.Unpriced, ticker)
+			}
+		}
+	}
+	// priceMove is the compounded move of a ticker that is not an option.
+	priceMove := func(ticker string, pos *Position) float64 {
+		move := 1 + replayed[ticker]
+		for _, s := range sc.Shocks {
+			if s.Currency == "" && p.shockApplies(s, ticker, pos) {
+				move *= 1 + s.Pct/100
+			}
+		}
+		return move - 1
+	}
+
+	tickers := make([]string, 0, len(p.Positions))
+	for ticker := range p.Positions {
+		tickers = append(tickers, ticker)
+	}
+	sort.Strings(tickers)
+	now := time.Now()
+	shocked := p.Cash
+	for _, ticker := range tickers {
+		pos := p.Positions[ticker]
+		price := pos.CurrentPrice
+		if pos.Option != nil {
+			underlying := pos.Option.Underlying
+			move := priceMove(underlying, p.Positions[underlying])
+			if spot := p.UnderlyingPrice(pos); spot > 0 && move != 0 {
+				delta := pos.optionDetails(now, spot, p.RiskFreeRatePct).Delta
+				price = math.Max(price+delta*spot*move, 0)
+			}
+			for _, s := range sc.Shocks {
+				if s.Ticker == ticker {
+					price *= 1 + s.Pct/100
+				}
+			}
+		} else {
+			price *= 1 + priceMove(ticker, pos)
+		}
+		fx := 1.0
+		if quote := pos.QuoteCurrency(); quote != p.Base() {
+			for _, s := range sc.Shocks {
+				switch s.Currency {
+				case quote:
+					fx *= 1 + s.Pct/100
+				case p.Base():
+					fx /= 1 + s.Pct/100
+				}
+			}
+		}
+
+		value := pos.CurrentValue()
+		after := pos.SignedShares().MulFloat(price * pos.Multiplier() * pos.Rate() * fx)
+		sp := ScenarioPosition{Ticker: ticker, FXChangePct: (fx - 1) * 100, Value: value, ShockedValue: after, PnL: after.Sub(value)}
+		if pos.CurrentPrice > 0 {
+			sp.PriceChangePct = (price/pos.CurrentPrice - 1) * 100
+		}
+		if !value.IsZero() {
+			sp.PnLPct = sp.PnL.Float() / value.Abs().Float() * 100
+		}
+		res.Positions = append(res.Positions, sp)
+		shocked = shocked.Add(after)
+	}
+
+	res.ShockedValue = shocked
+	res.PnL = shocked.Sub(res.TotalValue)
+	if res.TotalValue.IsPositive() {
+		res.PnLPct = res.PnL.Float() / res.TotalValue.Float() * 100
+	}
+	res.HighWaterMark = p.Metrics().HighWaterMark
+	if hwm := res.HighWaterMark; hwm.IsPositive() && shocked.Cmp(hwm) < 0 {
+		res.DrawdownPct = math.Min(hwm.Sub(shocked).Float()/hwm.Float()*100, 100)
+	}
+	res.RecoveryNeededPct = util.RequiredRecoveryPct(res.DrawdownPct)
+	return res, nil
+}
+
+// shockApplies reports whether a price shock selects ticker. pos is nil for
+// the unheld underlying of an option, which is classified from the registry.
+func (p *Portfolio) shockApplies(s Shock, ticker string, pos *Position) bool {
+	switch {
+	case s.Ticker != "":
+		return s.Ticker == ticker
+	case s.Tag != "":
+		return p.AllocationTags[ticker] == s.Tag || (pos != nil && slices.Contains(pos.Tags, s.Tag))
+	case s.AssetClass != "":
+		if pos != nil {
+			return pos.AssetClass() == s.AssetClass
+		}
+		return p.QuotePosition(ticker).AssetClass() == s.AssetClass
+	default:
+		return true
+	}
+}
+
+// replayMove is the price change between the last closes on or before from
+// and to.
+func replayMove(points []PricePoint, from, to time.Time) (float64, bool) {
+	var start, end float64
+	for _, pt := range points {
+		d := dayOf(pt.Date)
+		if pt.Close <= 0 || d.After(to) {
+			continue
+		}
+		if !d.After(from) {
+			start = pt.Close
+		}
+		end = pt.Close
+	}
+	if start <= 0 || end <= 0 {
+		return 0, false
+	}
+	return end/start - 1, true
+}
@@ -0,0 +1,100 @@
+package portfolio
+
+import (
+	"sort"
+	"strings"
+)
+
+type PositionSide string
+
+const (
+	Long  PositionSide = "long"
+	Short PositionSide = "short"
+)
+
+func ParsePositionSide(s string) (PositionSide, error) {
+	switch PositionSide(strings.ToLower(strings.TrimSpace(s))) {
+	case "", Long:
+		return Long, nil
+	case Short:
+		return Short, nil
+	default:
+		return "", invalidTx("unknown position side %q", s)
+	}
+}
+
+func (p *Position) IsShort() bool { return p.Side == Short }
+
+// Direction is 1 for long and -1 for short positions.
+func (p *Position) Direction() float64 {
+	if p.IsShort() {
+		return -1
+	}
+	return 1
+}
+
+func (p *Position) side() PositionSide {
+	if p.IsShort() {
+		return Short
+	}
+	return Long
+}
+
+// signed negates an amount of a short position.
+func (p *Position) signed(d Decimal) Decimal {
+	if p.IsShort() {
+		return d.Neg()
+	}
+	return d
+}
+
+// SignedShares is negative for short positions.
+func (p *Position) SignedShares() Decimal { return p.signed(p.Shares) }
+
+// MarketValue is the absolute base-currency value of the position.
+func (p *Position) MarketValue() Decimal {
+	return p.Shares.MulFloat(p.CurrentPrice * p.Multiplier() * p.Rate())
+}
+
+func (p *Portfolio) longTickers() []string  { return p.tickersBySide(false) }
+func (p *Portfolio) shortTickers() []string { return p.tickersBySide(true) }
+
+func (p *Portfolio) tickersBySide(short bool) []string {
+	var tickers []string
+	for ticker, pos := range p.Positions {
+		if pos.IsShort() == short {
+			tickers = append(tickers, ticker)
+		}
+	}
+	sort.Strings(tickers)
+	return tickers
+}
+
+// Exposure splits the market value of positions by side. Percentages are of
+// total portfolio value.
+type Exposure struct {
+	Long     Decimal `json:"long"`
+	Short    Decimal `json:"short"`
+	Gross    Decimal `json:"gross"`
+	Net      Decimal `json:"net"`
+	GrossPct float64 `json:"gross_pct"`
+	NetPct   float64 `json:"net_pct"`
+}
+
+func (p *Portfolio) Exposure() Exposure {
+	var e Exposure
+	for _, pos := range p.Positions {
+		if pos.IsShort() {
+			e.Short = e.Short.Add(pos.MarketValue())
+		} else {
+			e.Long = e.Long.Add(pos.MarketValue())
+		}
+	}
+	e.Gross = e.Long.Add(e.Short)
+	e.Net = e.Long.Sub(e.Short)
+	if total := p.TotalValue(); total.IsPositive() {
+		e.GrossPct = e.Gross.Float() / total.Float() * 100
+		e.NetPct = e.Net.Float() / total.Float() * 100
+	}
+	return e
+}
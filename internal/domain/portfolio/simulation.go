@@ -0,0 +1,390 @@
+package portfolio
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"tracktrades/internal/util"
+)
+
+// ErrInvalidSimulation is returned for out-of-range simulation options and
+// when there is too little price history to sample from.
+var ErrInvalidSimulation = errors.New("invalid simulation")
+
+type SimulationMethod string
+
+const (
+	// SimulateBootstrap draws whole historical days, so every holding moves as
+	// it did on the same day and correlations are kept as they were.
+	SimulateBootstrap SimulationMethod = "bootstrap"
+	// SimulateNormal draws daily log returns from a multivariate normal
+	// distribution with the historical means and covariances.
+	SimulateNormal SimulationMethod = "normal"
+)
+
+func ParseSimulationMethod(s string) (SimulationMethod, error) {
+	switch m := SimulationMethod(strings.ToLower(strings.TrimSpace(s))); m {
+	case SimulateBootstrap, SimulateNormal:
+		return m, nil
+	case "":
+		return SimulateBootstrap, nil
+	default:
+		return "", fmt.Errorf("%w: unknown method %q", ErrInvalidSimulation, s)
+	}
+}
+
+const (
+	maxSimulationPaths  = 10000
+	maxSimulationDays   = 5 * tradingDaysPerYear
+	minSimulationSample = 20
+	// simulationBandStep is the number of trading days between reported bands.
+	simulationBandStep = 5
+)
+
+// SimulationPercentiles are the percentiles every band reports.
+var SimulationPercentiles = []float64{5, 25, 50, 75, 95}
+
+// SimulationOptions configure a Monte Carlo run. HorizonDays counts trading
+// days (one year by default) and LookbackDays the calendar days of history
+// sampled (two years by default). A zero Seed is replaced by a random one,
+// which the result reports so the run can be repeated. DrawdownLimitPct and
+// GoalValue are optional.
+type SimulationOptions struct {
+	Method           SimulationMethod `json:"method"`
+	HorizonDays      int              `json:"horizon_days"`
+	Paths            int              `json:"paths"`
+	Seed             int64            `json:"seed"`
+	LookbackDays     int              `json:"lookback_days"`
+	DrawdownLimitPct float64          `json:"drawdown_limit_pct,omitempty"`
+	GoalValue        float64          `json:"goal_value,omitempty"`
+}
+
+func (o SimulationOptions) WithDefaults() SimulationOptions {
+	if o.Method == "" {
+		o.Method = SimulateBootstrap
+	}
+	if o.HorizonDays == 0 {
+		o.HorizonDays = tradingDaysPerYear
+	}
+	if o.Paths == 0 {
+		o.Paths = 1000
+	}
+	if o.LookbackDays == 0 {
+		o.LookbackDays = 730
+	}
+	if o.Seed == 0 {
+		o.Seed = time.Now().UnixNano()
+	}
+	return o
+}
+
+func (o SimulationOptions) Validate() error {
+	if _, err := ParseSimulationMethod(string(o.Method)); err != nil {
+		return err
+	}
+	if o.HorizonDays < 1 || o.HorizonDays > maxSimulationDays {
+		return fmt.Errorf("%w: horizon must be between 1 and %d trading days", ErrInvalidSimulation, maxSimulationDays)
+	}
+	if o.Paths < 1 || o.Paths > maxSimulationPaths {
+		return fmt.Errorf("%w: paths must be between 1 and %d", ErrInvalidSimulation, maxSimulationPaths)
+	}
+	if o.LookbackDays < 0 {
+		return fmt.Errorf("%w: lookback must not be negative", ErrInvalidSimulation)
+	}
+	if o.DrawdownLimitPct < 0 || o.DrawdownLimitPct >= 100 {
+		return fmt.Errorf("%w: drawdown limit must be between 0 and 100 percent", ErrInvalidSimulation)
+	}
+	if o.GoalValue < 0 {
+		return fmt.Errorf("%w: goal must not be negative", ErrInvalidSimulation)
+	}
+	return nil
+}
+
+// SimulationBand holds the simulated portfolio value at the percentiles of
+// SimulationResult.Percentiles, Day trading days ahead.
+type SimulationBand struct {
+	Day    int       `json:"day"`
+	Values []float64 `json:"values"`
+}
+
+// SimulationResult summarizes the simulated paths. Bands are reported every
+// five trading days and at the horizon. DrawdownBreachPct is the share of
+// paths that fall DrawdownLimitPct below their running peak, which starts at
+// the high-water mark. GoalReachedPct is the share that reach GoalValue at any
+// point and GoalAtEndPct the share that end at or above it. Positions without
+// price history are held at their current value and listed in HeldConstant.
+type SimulationResult struct {
+	Method            SimulationMethod `json:"method"`
+	Seed              int64            `json:"seed"`
+	Paths             int              `json:"paths"`
+	HorizonDays       int              `json:"horizon_days"`
+	SampleFrom        time.Time        `json:"sample_from"`
+	SampleTo          time.Time        `json:"sample_to"`
+	SampleDays        int              `json:"sample_days"`
+	Tickers           []string         `json:"tickers"`
+	HeldConstant      []string         `json:"held_constant,omitempty"`
+	StartValue        float64          `json:"start_value"`
+	HighWaterMark     float64          `json:"high_water_mark"`
+	Percentiles       []float64        `json:"percentiles"`
+	Bands             []SimulationBand `json:"bands"`
+	MeanFinal         float64          `json:"mean_final"`
+	DrawdownLimitPct  float64          `json:"drawdown_limit_pct,omitempty"`
+	DrawdownBreachPct float64          `json:"drawdown_breach_pct"`
+	GoalValue         float64          `json:"goal_value,omitempty"`
+	GoalReachedPct    float64          `json:"goal_reached_pct"`
+	GoalAtEndPct      float64          `json:"goal_at_end_pct"`
+}
+
+// Simulate projects the portfolio value over the horizon from daily closes of
+// its holdings, or from the prices in the stored history when closes is nil.
+// Only days on which every sampled holding has a close are used. Cash and
+// exchange rates stay fixed, and shorts lose as their price rises.
+func (p *Portfolio) Simulate(closes map[string][]PricePoint, opts SimulationOptions) (SimulationResult, error) {
+	opts = opts.WithDefaults()
+	if err := opts.Validate(); err != nil {
+		return SimulationResult{}, err
+	}
+	if len(p.Positions) == 0 {
+		return SimulationResult{}, fmt.Errorf("%w: portfolio %s holds no positions", ErrInvalidSimulation, p.Name)
+	}
+	if closes == nil {
+		closes = p.storedCloses()
+	}
+
+	res := SimulationResult{
+		Method:           opts.Method,
+		Seed:             opts.Seed,
+		Paths:            opts.Paths,
+		HorizonDays:      opts.HorizonDays,
+		Tickers:          []string{},
+		Percentiles:      SimulationPercentiles,
+		DrawdownLimitPct: opts.DrawdownLimitPct,
+		GoalValue:        opts.GoalValue,
+		StartValue:       p.TotalValue().Float(),
+	}
+	res.HighWaterMark = math.Max(p.HighWaterMark().Float(), res.StartValue)
+
+	tickers := make([]string, 0, len(p.Positions))
+	for ticker := range p.Positions {
+		tickers = append(tickers, ticker)
+	}
+	sort.Strings(tickers)
+	fixed := p.Cash.Float()
+	var start []float64
+	for _, ticker := range tickers {
+		value := p.Positions[ticker].CurrentValue().Float()
+		if len(closes[ticker]) < 2 {
+			res.HeldConstant = append(res.HeldConstant, ticker)
+			fixed += value
+			continue
+		}
+		res.Tickers = append(res.Tickers, ticker)
+		start = append(start, value)
+	}
+	if len(res.Tickers) == 0 {
+		return SimulationResult{}, fmt.Errorf("%w: no price history for any position", ErrInvalidSimulation)
+	}
+	dates, rows := alignedReturns(closes, res.Tickers)
+	if len(rows) < minSimulationSample {
+		return SimulationResult{}, fmt.Errorf("%w: %d days of common price history, need at least %d", ErrInvalidSimulation, len(rows), minSimulationSample)
+	}
+	res.SampleFrom, res.SampleTo, res.SampleDays = dates[0], dates[len(dates)-1], len(rows)
+
+	rng := rand.New(rand.NewSource(opts.Seed))
+	draw := bootstrapDraw(rng, rows)
+	if opts.Method == SimulateNormal {
+		draw = normalDraw(rng, rows)
+	}
+
+	var checkpoints []int
+	for day := simulationBandStep; day < opts.HorizonDays; day += simulationBandStep {
+		checkpoints = append(checkpoints, day)
+	}
+	checkpoints = append(checkpoints, opts.HorizonDays)
+	values := make([][]float64, len(checkpoints))
+	for i := range values {
+		values[i] = make([]float64, opts.Paths)
+	}
+
+	var breached, reached, atEnd int
+	var sumFinal float64
+	holdings := make([]float64, len(start))
+	returns := make([]float64, len(start))
+	for path := 0; path < opts.Paths; path++ {
+		copy(holdings, start)
+		peak, total := res.HighWaterMark, res.StartValue
+		hitLimit := opts.DrawdownLimitPct > 0 && peak > 0 && (peak-total)/peak*100 >= opts.DrawdownLimitPct
+		hitGoal := opts.GoalValue > 0 && total >= opts.GoalValue
+		next := 0
+		for day := 1; day <= opts.HorizonDays; day++ {
+			draw(returns)
+			total = fixed
+			for i := range holdings {
+				holdings[i] *= 1 + returns[i]
+				total += holdings[i]
+			}
+			if total > peak {
+				peak = total
+			} else if opts.DrawdownLimitPct > 0 && peak > 0 && (peak-total)/peak*100 >= opts.DrawdownLimitPct {
+				hitLimit = true
+			}
+			if opts.GoalValue > 0 && total >= opts.GoalValue {
+				hitGoal = true
+			}
+			if day == checkpoints[next] {
+				values[next][path] = total
+				next++
+			}
+		}
+		sumFinal += total
+		if hitLimit {
+			breached++
+		}
+		if hitGoal {
+			reached++
+			if total >= opts.GoalValue {
+				atEnd++
+			}
+		}
+	}
+
+	pct := func(n int) float64 { return float64(n) / float64(opts.Paths) * 100 }
+	res.MeanFinal = sumFinal / float64(opts.Paths)
+	if opts.DrawdownLimitPct > 0 {
+		res.DrawdownBreachPct = pct(breached)
+	}
+	if opts.GoalValue > 0 {
+		res.GoalReachedPct, res.GoalAtEndPct = pct(reached), pct(atEnd)
+	}
+	for i, day := range checkpoints {
+		sort.Float64s(values[i])
+		band := SimulationBand{Day: day, Values: make([]float64, len(SimulationPercentiles))}
+		for j, q := range SimulationPercentiles {
+			band.Values[j] = util.Percentile(values[i], q)
+		}
+		res.Bands = append(res.Bands, band)
+	}
+	return res, nil
+}
+
+// storedCloses reads a close series per ticker from the stored daily history.
+func (p *Portfolio) storedCloses() map[string][]PricePoint {
+	closes := make(map[string][]PricePoint)
+	for _, s := range p.dailyHistory() {
+		for ticker, price := range s.Prices {
+			if price > 0 {
+				closes[ticker] = append(closes[ticker], PricePoint{Date: s.Time, Close: price})
+			}
+		}
+	}
+	return closes
+}
+
+// alignedReturns returns the daily returns of tickers between consecutive
+// days on which all of them closed, one row per day in ticker order.
+func alignedReturns(closes map[string][]PricePoint, tickers []string) ([]time.Time, [][]float64) {
+	byDay := make([]map[time.Time]float64, len(tickers))
+	counts := make(map[time.Time]int)
+	for i, ticker := range tickers {
+		byDay[i] = make(map[time.Time]float64)
+		for _, pt := range closes[ticker] {
+			if d := dayOf(pt.Date); pt.Close > 0 {
+				if _, seen := byDay[i][d]; !seen {
+					counts[d]++
+				}
+				byDay[i][d] = pt.Close
+			}
+		}
+	}
+	var common []time.Time
+	for d, n := range counts {
+		if n == len(tickers) {
+			common = append(common, d)
+		}
+	}
+	sort.Slice(common, func(i, j int) bool { return common[i].Before(common[j]) })
+
+	var dates []time.Time
+	var rows [][]float64
+	for k := 1; k < len(common); k++ {
+		row := make([]float64, len(tickers))
+		for i := range tickers {
+			row[i] = byDay[i][common[k]]/byDay[i][common[k-1]] - 1
+		}
+		dates = append(dates, common[k])
+		rows = append(rows, row)
+	}
+	return dates, rows
+}
+
+func bootstrapDraw(rng *rand.Rand, rows [][]float64) func([]float64) {
+	return func(out []float64) {
+		copy(out, rows[rng.Intn(len(rows))])
+	}
+}
+
+// normalDraw samples correlated log returns through the Cholesky factor of
+// their historical covariance.
+func normalDraw(rng *rand.Rand, rows [][]float64) func([]float64) {
+	n := len(rows[0])
+	series := make([][]float64, n)
+	for i := range series {
+		series[i] = make([]float64, len(rows))
+		for k, row := range rows {
+			series[i][k] = math.Log1p(row[i])
+		}
+	}
+	mean := make([]float64, n)
+	cov := make([][]float64, n)
+	for i := range series {
+		mean[i] = util.Mean(series[i])
+		cov[i] = make([]float64, n)
+		for j := range series {
+			cov[i][j] = util.Covariance(series[i], series[j])
+		}
+	}
+	factor := cholesky(cov)
+	z := make([]float64, n)
+	return func(out []float64) {
+		for i := range z {
+			z[i] = rng.NormFloat64()
+		}
+		for i := range out {
+			x := mean[i]
+			for j := 0; j <= i; j++ {
+				x += factor[i][j] * z[j]
+			}
+			out[i] = math.Expm1(x)
+		}
+	}
+}
+
+// cholesky factors a covariance matrix into a lower triangle. Holdings that
+// move exactly with earlier ones leave a zero column instead of failing.
+func cholesky(a [][]float64) [][]float64 {
+	n := len(a)
+	l := make([][]float64, n)
+	for i := range l {
+		l[i] = make([]float64, n)
+	}
+	for i := 0; i < n; i++ {
+		for j := 0; j <= i; j++ {
+			sum := a[i][j]
+			for k := 0; k < j; k++ {
+				sum -= l[i][k] * l[j][k]
+			}
+			switch {
+			case i == j && sum > 1e-18:
+				l[i][i] = math.Sqrt(sum)
+			case i != j && l[j][j] > 0:
+				l[i][j] = sum / l[j][j]
+			}
+		}
+	}
+	return l
+}
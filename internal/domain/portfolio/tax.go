@@ -0,0 +1,124 @@
+package portfolio
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"time"
+)
+
+type Term string
+
+const (
+	ShortTerm Term = "short"
+	LongTerm  Term = "long"
+)
+
+// holdingTerm applies the US rule: a lot is long-term when sold more than one year after acquisition.
+func holdingTerm(acquired, sold time.Time) Term {
+	if sold.After(acquired.AddDate(1, 0, 0)) {
+		return LongTerm
+	}
+	return ShortTerm
+}
+
+// TaxSummary totals reportable figures: CostBasis is the wash-sale adjusted
+// basis, Adjustment the disallowed wash-sale losses and Gain the reportable gain.
+type TaxSummary struct {
+	Proceeds   Decimal `json:"proceeds"`
+	CostBasis  Decimal `json:"cost_basis"`
+	Adjustment Decimal `json:"adjustment"`
+	Gain       Decimal `json:"gain"`
+}
+
+func (s *TaxSummary) add(l ClosedLot) {
+	s.Proceeds = s.Proceeds.Add(l.Proceeds)
+	s.CostBasis = s.CostBasis.Add(l.TaxBasis)
+	s.Adjustment = s.Adjustment.Add(l.WashSaleDisallowed)
+	s.Gain = s.Gain.Add(l.TaxGain)
+}
+
+type TaxReport struct {
+	Portfolio string      `json:"portfolio"`
+	Year      int         `json:"year"`
+	ShortTerm TaxSummary  `json:"short_term"`
+	LongTerm  TaxSummary  `json:"long_term"`
+	Total     TaxSummary  `json:"total"`
+	Lots      []ClosedLot `json:"lots"`
+}
+
+// TaxReport collects every lot closed during the calendar year.
+func (p *Portfolio) TaxReport(year int) (TaxReport, error) {
+	sales, err := p.Sales("")
+	if err != nil {
+		return TaxReport{}, err
+	}
+
+	report := TaxReport{Portfolio: p.Name, Year: year, Lots: []ClosedLot{}}
+	for _, sale := range sales {
+		if sale.Date.Year() != year {
+			continue
+		}
+		for _, l := range sale.Lots {
+			report.Lots = append(report.Lots, l)
+			if l.Term == LongTerm {
+				report.LongTerm.add(l)
+			} else {
+				report.ShortTerm.add(l)
+			}
+			report.Total.add(l)
+		}
+	}
+
+	sort.SliceStable(report.Lots, func(i, j int) bool {
+		if report.Lots[i].Term != report.Lots[j].Term {
+			return report.Lots[i].Term == ShortTerm
+		}
+		return report.Lots[i].Sold.Before(report.Lots[j].Sold)
+	})
+	return report, nil
+}
+
+var form8949Header = []string{
+	"part", "description", "date_acquired", "date_sold",
+	"proceeds", "cost_basis", "adjustment_code", "adjustment_amount", "gain_or_loss",
+}
+
+// WriteForm8949CSV writes one Form 8949 row per closed lot. Part I rows hold
+// short-term lots and Part II rows long-term lots.
+func WriteForm8949CSV(w io.Writer, report TaxReport) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(form8949Header); err != nil {
+		return err
+	}
+	for _, l := range report.Lots {
+		part := "I"
+		if l.Term == LongTerm {
+			part = "II"
+		}
+		code, adjustment := "", ""
+		if l.WashSale {
+			code, adjustment = "W", formatMoney(l.WashSaleDisallowed)
+		}
+		row := []string{
+			part,
+			l.Quantity.String() + " sh " + l.Ticker,
+			l.Acquired.Format("01/02/2006"),
+			l.Sold.Format("01/02/2006"),
+			formatMoney(l.Proceeds),
+			formatMoney(l.TaxBasis),
+			code,
+			adjustment,
+			formatMoney(l.TaxGain),
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatMoney(v Decimal) string {
+	return v.StringFixed(2)
+}
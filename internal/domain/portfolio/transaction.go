@@ -0,0 +1,258 @@
+package portfolio
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrInvalidTransaction is wrapped by every validation error returned when recording a transaction.
+var ErrInvalidTransaction = errors.New("invalid transaction")
+
+type TransactionType string
+
+const (
+	TxBuy        TransactionType = "buy"
+	TxSell       TransactionType = "sell"
+	TxDividend   TransactionType = "dividend"
+	TxFee        TransactionType = "fee"
+	TxDeposit    TransactionType = "deposit"
+	TxWithdrawal TransactionType = "withdrawal"
+	TxSplit      TransactionType = "split"
+	TxShort      TransactionType = "short"
+	TxCover      TransactionType = "cover"
+	TxRename     TransactionType = "rename"
+	// TxStockDividend issues Quantity new shares without cost; the basis of the
+	// existing lots is spread over the larger share count.
+	TxStockDividend TransactionType = "stock-dividend"
+	// TxMarginInterest charges Amount of interest on a margin debit balance.
+	TxMarginInterest TransactionType = "margin-interest"
+)
+
+// Transaction is a single ledger entry. Trades (buy, sell, short, cover) use
+// Quantity and Price, cash movements (dividend, fee, deposit, withdrawal,
+// margin interest) use
+// Amount and splits use Ratio (new shares per old share). Renames move a
+// holding to NewTicker, optionally converting shares by Ratio as in a stock
+// merger. Dividends with Reinvest set buy Quantity shares at Price with the
+// Amount (DRIP); any residual stays in cash. Sells and covers
+// record the lot method in force when they were entered and may name the lots
+// to close. Price and Amount are in Currency; FXRate converts them to the
+// portfolio base currency. Option trades carry the contract, whose multiplier
+// scales Quantity * Price. Commission, ExchangeFee and RegulatoryFee are
+// charged on a trade in Currency: they add to the cost of buys and covers and
+// come off the proceeds of sells and short sales. Note, Tags and Strategy are
+// the trade's journal annotations.
+type Transaction struct {
+	ID            string          `json:"id"`
+	Type          TransactionType `json:"type"`
+	Ticker        string          `json:"ticker,omitempty"`
+	Date          time.Time       `json:"date"`
+	Quantity      Decimal         `json:"quantity"`
+	Price         Decimal         `json:"price"`
+	Commission    Decimal         `json:"commission"`
+	ExchangeFee   Decimal         `json:"exchange_fee"`
+	RegulatoryFee Decimal         `json:"regulatory_fee"`
+	Amount        Decimal         `json:"amount"`
+	Ratio         Decimal         `json:"ratio"`
+	NewTicker     string          `json:"new_ticker,omitempty"`
+	Currency      string          `json:"currency,omitempty"`
+	FXRate        Decimal         `json:"fx_rate"`
+	LotMethod     LotMethod       `json:"lot_method,omitempty"`
+	Lots          []LotSelection  `json:"lots,omitempty"`
+	Reinvest      bool            `json:"reinvest,omitempty"`
+	Note          string          `json:"note,omitempty"`
+	Tags          []string        `json:"tags,omitempty"`
+	Strategy      string          `json:"strategy,omitempty"`
+	Option        *OptionContract `json:"option,omitempty"`
+}
+
+// Notional is the local-currency value of a trade, rounded to its currency.
+func (t Transaction) Notional() Decimal {
+	return t.notionalOf(t.Quantity)
+}
+
+// Fees is the total of the trade's commission, exchange and regulatory fees,
+// each rounded to the transaction currency as booked.
+func (t Transaction) Fees() Decimal {
+	var total Decimal
+	for _, f := range []Decimal{t.Commission, t.ExchangeFee, t.RegulatoryFee} {
+		total = total.Add(f.RoundTo(t.Currency))
+	}
+	return total
+}
+
+// tradeValue is the local amount a trade of qty shares books: the notional
+// plus fees for buys and covers, less fees for sells and short sales.
+func (t Transaction) tradeValue(qty Decimal) Decimal {
+	if t.Type == TxSell || t.Type == TxShort {
+		return t.notionalOf(qty).Sub(t.Fees())
+	}
+	return t.notionalOf(qty).Add(t.Fees())
+}
+
+func (t Transaction) multiplier() float64 {
+	if t.Option != nil && t.Option.Multiplier > 0 {
+		return t.Option.Multiplier
+	}
+	return 1
+}
+
+// notionalOf is the value of qty shares at the transaction price, rounded to
+// the transaction currency.
+func (t Transaction) notionalOf(qty Decimal) Decimal {
+	return qty.Mul(t.Price).MulFloat(t.multiplier()).RoundTo(t.Currency)
+}
+
+// toBase converts a local amount at the transaction's FX rate and rounds it to
+// the base currency.
+func (t Transaction) toBase(local Decimal, base string) Decimal {
+	return local.Mul(t.rate()).RoundTo(base)
+}
+
+// cashImpact is the change in portfolio cash caused by the transaction, as
+// booked by the ledger: every amount is rounded to its currency before
+// conversion and the result to the base currency.
+func (t Transaction) cashImpact(base string) Decimal {
+	notional := t.toBase(t.Notional(), base)
+	amount := t.toBase(t.Amount.RoundTo(t.Currency), base)
+	switch t.Type {
+	case TxBuy, TxCover:
+		return t.toBase(t.tradeValue(t.Quantity), base).Neg()
+	case TxSell, TxShort:
+		return t.toBase(t.tradeValue(t.Quantity), base)
+	case TxDividend:
+		if t.Reinvest {
+			return amount.Sub(notional)
+		}
+		return amount
+	case TxDeposit:
+		return amount
+	case TxFee, TxWithdrawal, TxMarginInterest:
+		return amount.Neg()
+	default:
+		return Decimal{}
+	}
+}
+
+// IsTrade reports whether the transaction buys or sells shares.
+func (t Transaction) IsTrade() bool {
+	switch t.Type {
+	case TxBuy, TxSell, TxShort, TxCover:
+		return true
+	}
+	return false
+}
+
+// opens reports whether the transaction adds a lot; closes whether it consumes lots.
+func (t Transaction) opens() bool  { return t.Type == TxBuy || t.Type == TxShort }
+func (t Transaction) closes() bool { return t.Type == TxSell || t.Type == TxCover }
+
+func (t Transaction) rate() Decimal {
+	if !t.FXRate.IsPositive() {
+		return NewDecimal(1)
+	}
+	return t.FXRate
+}
+
+func (t Transaction) Validate() error {
+	switch t.Type {
+	case TxBuy, TxSell, TxShort, TxCover:
+		if t.Ticker == "" {
+			return invalidTx("ticker is required for %s", t.Type)
+		}
+		if !t.Quantity.IsPositive() {
+			return invalidTx("quantity must be greater than zero")
+		}
+		if t.Price.IsNegative() {
+			return invalidTx("price must not be negative")
+		}
+	case TxDividend, TxFee, TxDeposit, TxWithdrawal, TxMarginInterest:
+		if !t.Amount.IsPositive() {
+			return invalidTx("amount must be greater than zero")
+		}
+	case TxStockDividend:
+		if t.Ticker == "" {
+			return invalidTx("ticker is required for %s", t.Type)
+		}
+		if !t.Quantity.IsPositive() {
+			return invalidTx("quantity must be greater than zero")
+		}
+	case TxSplit:
+		if t.Ticker == "" {
+			return invalidTx("ticker is required for %s", t.Type)
+		}
+		if !t.Ratio.IsPositive() {
+			return invalidTx("ratio must be greater than zero")
+		}
+	case TxRename:
+		if t.Ticker == "" || t.NewTicker == "" {
+			return invalidTx("ticker and new ticker are required for %s", t.Type)
+		}
+		if t.Ticker == t.NewTicker {
+			return invalidTx("new ticker must differ from %s", t.Ticker)
+		}
+		if t.Ratio.IsNegative() {
+			return invalidTx("ratio must not be negative")
+		}
+	default:
+		return invalidTx("unknown transaction type %q", t.Type)
+	}
+	if t.FXRate.IsNegative() {
+		return invalidTx("fx rate must not be negative")
+	}
+	if t.Commission.IsNegative() || t.ExchangeFee.IsNegative() || t.RegulatoryFee.IsNegative() {
+		return invalidTx("fees must not be negative")
+	}
+	for _, d := range []Decimal{t.Quantity, t.Price, t.Amount, t.Commission, t.ExchangeFee, t.RegulatoryFee, t.Ratio, t.FXRate} {
+		if d.Overflowed() {
+			return outOfRange("%v", d)
+		}
+	}
+	if t.Fees().IsPositive() && !t.IsTrade() {
+		return invalidTx("commission and trade fees are only valid on trades; record account fees as %s", TxFee)
+	}
+	if t.Reinvest {
+		if t.Type != TxDividend {
+			return invalidTx("only dividends can be reinvested")
+		}
+		if t.Ticker == "" || !t.Price.IsPositive() {
+			return invalidTx("reinvested dividends need a ticker and a price greater than zero")
+		}
+		if t.Notional().Cmp(t.Amount.RoundTo(t.Currency)) > 0 {
+			return invalidTx("reinvested shares cost more than the dividend of %v", t.Amount)
+		}
+	}
+	if len(t.Lots) > 0 && !t.closes() {
+		return invalidTx("lot selections are only valid on sells and covers")
+	}
+	if t.Option != nil {
+		if !t.IsTrade() {
+			return invalidTx("option contracts are only valid on trades")
+		}
+		if err := t.Option.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ParseTransactionType(s string) (TransactionType, error) {
+	t := TransactionType(strings.ToLower(strings.TrimSpace(s)))
+	switch t {
+	case TxBuy, TxSell, TxDividend, TxFee, TxDeposit, TxWithdrawal, TxSplit, TxShort, TxCover, TxRename, TxStockDividend, TxMarginInterest:
+		return t, nil
+	default:
+		return "", invalidTx("unknown transaction type %q", s)
+	}
+}
+
+func invalidTx(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidTransaction, fmt.Sprintf(format, args...))
+}
+
+// outOfRange is an invalid transaction that also matches ErrOutOfRange.
+func outOfRange(format string, args ...any) error {
+	return fmt.Errorf("%w: %w: %s", ErrInvalidTransaction, ErrOutOfRange, fmt.Sprintf(format, args...))
+}
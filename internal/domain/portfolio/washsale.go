@@ -0,0 +1,115 @@
+package portfolio
+
+import "time"
+
+// washSaleWindowDays is the number of days either side of a loss sale in which
+// buying the same ticker triggers the wash-sale rule.
+const washSaleWindowDays = 30
+
+// pendingLoss is the part of a loss sale not yet matched with replacement shares.
+// A later buy inside the window can still turn it into a wash sale. loss is the
+// loss of the whole closed lot, spread over its quantity.
+type pendingLoss struct {
+	sale     int
+	lot      int
+	ticker   string
+	date     time.Time
+	loss     Decimal
+	quantity Decimal
+	shares   Decimal
+}
+
+func withinWashWindow(sale, buy time.Time) bool {
+	return !buy.Before(sale.AddDate(0, 0, -washSaleWindowDays)) && !buy.After(sale.AddDate(0, 0, washSaleWindowDays))
+}
+
+// washAfterSale matches the losing lots of the latest sale against shares bought
+// in the 30 days before it and still held, then parks any unmatched loss so a
+// buy in the following 30 days can pick it up.
+func (s *ledgerState) washAfterSale(h *holding) {
+	idx := len(s.sales) - 1
+	sale := &s.sales[idx]
+
+	for li := range sale.Lots {
+		cl := &sale.Lots[li]
+		if !cl.TaxGain.IsNegative() {
+			continue
+		}
+		loss := cl.TaxGain.Neg()
+		left := cl.Quantity
+
+		for ri := range h.lots {
+			if !left.IsPositive() {
+				break
+			}
+			replacement := &h.lots[ri]
+			if replacement.ID == cl.LotID || replacement.Acquired.After(sale.Date) || !withinWashWindow(sale.Date, replacement.Acquired) {
+				continue
+			}
+			left = left.Sub(s.disallow(sale, cl, replacement, loss, cl.Quantity, left))
+		}
+
+		if left.IsPositive() {
+			s.pending = append(s.pending, pendingLoss{
+				sale: idx, lot: li, ticker: sale.Ticker, date: sale.Date,
+				loss: loss, quantity: cl.Quantity, shares: left,
+			})
+		}
+	}
+}
+
+// washBeforeBuy treats the lot just bought as replacement shares for earlier
+// loss sales of the same ticker inside the window.
+func (s *ledgerState) washBeforeBuy(h *holding) {
+	replacement := &h.lots[len(h.lots)-1]
+
+	for pi := range s.pending {
+		pl := &s.pending[pi]
+		if !pl.shares.IsPositive() || pl.ticker != h.ticker || !withinWashWindow(pl.date, replacement.Acquired) {
+			continue
+		}
+		sale := &s.sales[pl.sale]
+		pl.shares = pl.shares.Sub(s.disallow(sale, &sale.Lots[pl.lot], replacement, pl.loss, pl.quantity, pl.shares))
+	}
+}
+
+// rescalePending converts the unmatched shares of pending losses on ticker
+// after a split, stock dividend or rename, so later buys of the new shares
+// match them share for share.
+func (s *ledgerState) rescalePending(ticker, newTicker string, ratio Decimal) {
+	for i := range s.pending {
+		pl := &s.pending[i]
+		if pl.ticker != ticker {
+			continue
+		}
+		pl.ticker = newTicker
+		pl.quantity = pl.quantity.Mul(ratio)
+		pl.shares = pl.shares.Mul(ratio)
+	}
+}
+
+// disallow moves up to shares worth of loss from the closed lot into the
+// replacement lot's basis and returns how many shares were matched. loss is
+// the lot's loss over quantity shares. The replacement lot's holding period
+// is extended by the time the washed shares were held.
+func (s *ledgerState) disallow(sale *Sale, cl *ClosedLot, replacement *Lot, loss, quantity, shares Decimal) Decimal {
+	free := replacement.Quantity.Sub(replacement.WashReplaced)
+	if !free.IsPositive() {
+		return Decimal{}
+	}
+	shares = MinDecimal(shares, free)
+	amount := loss.Scale(shares, quantity).RoundTo(s.base)
+
+	cl.WashSale = true
+	cl.WashSaleDisallowed = cl.WashSaleDisallowed.Add(amount)
+	cl.TaxGain = cl.TaxGain.Add(amount)
+	sale.WashSaleDisallowed = sale.WashSaleDisallowed.Add(amount)
+	replacement.WashSaleAdjustment = replacement.WashSaleAdjustment.Add(amount)
+	replacement.WashReplaced = replacement.WashReplaced.Add(shares)
+
+	held := cl.Sold.Sub(holdingStart(cl.Acquired, cl.HoldingStart))
+	if start := replacement.Acquired.Add(-held); start.Before(holdingStart(replacement.Acquired, replacement.HoldingStart)) {
+		replacement.HoldingStart = &start
+	}
+	return shares
+}
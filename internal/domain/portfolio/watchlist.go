@@ -0,0 +1,220 @@
+package portfolio
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrInvalidWatchlist is returned for unnamed watchlists, empty tickers and
+// lookups of lists that do not exist.
+var ErrInvalidWatchlist = errors.New("invalid watchlist")
+
+// WatchItem is a ticker followed without being held. AddedPrice is the first
+// price quoted after it was added and High52w the highest price over the
+// trailing year.
+type WatchItem struct {
+	Ticker     string    `json:"ticker"`
+	AddedAt    time.Time `json:"added_at"`
+	AddedPrice float64   `json:"added_price,omitempty"`
+	Price      float64   `json:"price,omitempty"`
+	High52w    float64   `json:"high_52w,omitempty"`
+}
+
+// ChangeSinceAddedPct is the price change since the ticker was added.
+func (w WatchItem) ChangeSinceAddedPct() float64 {
+	if w.AddedPrice <= 0 || w.Price <= 0 {
+		return 0
+	}
+	return (w.Price/w.AddedPrice - 1) * 100
+}
+
+// DrawdownFromHighPct is how far the price is below the 52-week high.
+func (w WatchItem) DrawdownFromHighPct() float64 {
+	if w.High52w <= 0 || w.Price <= 0 || w.Price >= w.High52w {
+		return 0
+	}
+	return (1 - w.Price/w.High52w) * 100
+}
+
+// RecoveryNeededPct is the gain needed to get back to the 52-week high.
+func (w WatchItem) RecoveryNeededPct() float64 {
+	if w.High52w <= 0 || w.Price <= 0 || w.Price >= w.High52w {
+		return 0
+	}
+	return (w.High52w/w.Price - 1) * 100
+}
+
+type Watchlist struct {
+	Name  string      `json:"name"`
+	Items []WatchItem `json:"items"`
+}
+
+// WatchItemView is a watch item with its derived figures, as reported.
+type WatchItemView struct {
+	WatchItem
+	ChangeSinceAddedPct float64 `json:"change_since_added_pct"`
+	DrawdownFromHighPct float64 `json:"drawdown_from_high_pct"`
+	RecoveryNeededPct   float64 `json:"recovery_needed_pct"`
+}
+
+type WatchlistView struct {
+	Name  string          `json:"name"`
+	Items []WatchItemView `json:"items"`
+}
+
+func normalizeWatchlistName(name string) string { return strings.ToLower(strings.TrimSpace(name)) }
+
+// Watchlists are a set of named lists, held by a portfolio or shared by all
+// portfolios.
+type Watchlists []Watchlist
+
+func (ws Watchlists) find(name string) *Watchlist {
+	for i := range ws {
+		if ws[i].Name == name {
+			return &ws[i]
+		}
+	}
+	return nil
+}
+
+// Watch adds ticker to the named list, creating the list if needed. Adding a
+// ticker that is already on the list returns the existing item unchanged.
+func (ws *Watchlists) Watch(list, ticker string, now time.Time) (WatchItem, error) {
+	list = normalizeWatchlistName(list)
+	ticker = strings.ToUpper(strings.TrimSpace(ticker))
+	if list == "" {
+		return WatchItem{}, fmt.Errorf("%w: list name is required", ErrInvalidWatchlist)
+	}
+	if ticker == "" {
+		return WatchItem{}, fmt.Errorf("%w: ticker is required", ErrInvalidWatchlist)
+	}
+	wl := ws.find(list)
+	if wl == nil {
+		*ws = append(*ws, Watchlist{Name: list})
+		sort.Slice(*ws, func(i, j int) bool { return (*ws)[i].Name < (*ws)[j].Name })
+		wl = ws.find(list)
+	}
+	for _, item := range wl.Items {
+		if item.Ticker == ticker {
+			return item, nil
+		}
+	}
+	item := WatchItem{Ticker: ticker, AddedAt: now}
+	wl.Items = append(wl.Items, item)
+	return item, nil
+}
+
+// Unwatch removes ticker from the named list, or the whole list when ticker
+// is empty, and reports whether anything was removed.
+func (ws *Watchlists) Unwatch(list, ticker string) bool {
+	list = normalizeWatchlistName(list)
+	ticker = strings.ToUpper(strings.TrimSpace(ticker))
+	for i, wl := range *ws {
+		if wl.Name != list {
+			continue
+		}
+		if ticker == "" {
+			*ws = append((*ws)[:i], (*ws)[i+1:]...)
+			return true
+		}
+		for j, item := range wl.Items {
+			if item.Ticker == ticker {
+				(*ws)[i].Items = append(wl.Items[:j], wl.Items[j+1:]...)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WatchedTickers lists every ticker on any watchlist once, sorted.
+func (ws Watchlists) WatchedTickers() []string {
+	seen := make(map[string]bool)
+	var res []string
+	for _, wl := range ws {
+		for _, item := range wl.Items {
+			if !seen[item.Ticker] {
+				seen[item.Ticker] = true
+				res = append(res, item.Ticker)
+			}
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// WatchQuote returns the first watched item of ticker.
+func (ws Watchlists) WatchQuote(ticker string) (WatchItem, bool) {
+	for _, wl := range ws {
+		for _, item := range wl.Items {
+			if item.Ticker == ticker {
+				return item, true
+			}
+		}
+	}
+	return WatchItem{}, false
+}
+
+// WatchQuote returns the first watched item of ticker, from the portfolio's
+// own lists and then from shared.
+func (p *Portfolio) WatchQuote(ticker string, shared ...Watchlist) (WatchItem, bool) {
+	if item, ok := p.Watchlists.WatchQuote(ticker); ok {
+		return item, true
+	}
+	return Watchlists(shared).WatchQuote(ticker)
+}
+
+// UpdateWatchQuote sets the price of every item of ticker. A positive high52w
+// replaces the stored 52-week high; the high is never below the price. The
+// first price quoted after an item is added becomes its AddedPrice.
+func (ws Watchlists) UpdateWatchQuote(ticker string, price, high52w float64) {
+	for i := range ws {
+		items := ws[i].Items
+		for j := range items {
+			item := &items[j]
+			if item.Ticker != ticker {
+				continue
+			}
+			if high52w > 0 {
+				item.High52w = high52w
+			}
+			if price > 0 {
+				item.Price = price
+				if item.AddedPrice == 0 {
+					item.AddedPrice = price
+				}
+				if price > item.High52w {
+					item.High52w = price
+				}
+			}
+		}
+	}
+}
+
+// WatchlistViews reports the named list, or every list when name is empty.
+func (ws Watchlists) WatchlistViews(name string) ([]WatchlistView, error) {
+	name = normalizeWatchlistName(name)
+	res := []WatchlistView{}
+	for _, wl := range ws {
+		if name != "" && wl.Name != name {
+			continue
+		}
+		view := WatchlistView{Name: wl.Name, Items: make([]WatchItemView, 0, len(wl.Items))}
+		for _, item := range wl.Items {
+			view.Items = append(view.Items, WatchItemView{
+				WatchItem:           item,
+				ChangeSinceAddedPct: item.ChangeSinceAddedPct(),
+				DrawdownFromHighPct: item.DrawdownFromHighPct(),
+				RecoveryNeededPct:   item.RecoveryNeededPct(),
+			})
+		}
+		res = append(res, view)
+	}
+	if name != "" && len(res) == 0 {
+		return nil, fmt.Errorf("%w: no watchlist %s", ErrInvalidWatchlist, name)
+	}
+	return res, nil
+}
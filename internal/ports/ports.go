@@ -2,19 +2,54 @@ package ports
 
 import (
 	"context"
+	"time"
 
 	"tracktrades/internal/domain/portfolio"
 )
 
 type PortfolioStore interface {
-	Create(ctx context.Context, name string, cash float64) (*portfolio.Portfolio, error)
+	Create(ctx context.Context, name string, cash portfolio.Decimal) (*portfolio.Portfolio, error)
 	List(ctx context.Context) ([]string, error)
 	Load(ctx context.Context, name string) (*portfolio.Portfolio, error)
 	Save(ctx context.Context, name string, p *portfolio.Portfolio) error
 	Remove(ctx context.Context, name string) error
+	WatchlistStore
+}
+
+// WatchlistStore keeps the watchlists shared by all portfolios in a document of
+// their own. LoadWatchlists returns fs.ErrNotExist until they are first saved.
+type WatchlistStore interface {
+	LoadWatchlists(ctx context.Context) (portfolio.Watchlists, error)
+	SaveWatchlists(ctx context.Context, lists portfolio.Watchlists) error
 }
 
 type PriceProvider interface {
 	UpdatePrice(ctx context.Context, pos *portfolio.Position) error
 	ComputeHistoricalPeak(ctx context.Context, pos *portfolio.Position) error
 }
+
+// PriceHistoryProvider returns daily closes between from and to, oldest first.
+type PriceHistoryProvider interface {
+	DailyCloses(ctx context.Context, pos *portfolio.Position, from, to time.Time) ([]portfolio.PricePoint, error)
+}
+
+// SplitProvider reports stock splits of a position's ticker on or after since.
+type SplitProvider interface {
+	Splits(ctx context.Context, pos *portfolio.Position, since time.Time) ([]portfolio.SplitEvent, error)
+}
+
+// DividendProvider reports cash dividends of a position's ticker with an ex-date on or after since.
+type DividendProvider interface {
+	Dividends(ctx context.Context, pos *portfolio.Position, since time.Time) ([]portfolio.DividendEvent, error)
+}
+
+// FXRateProvider converts between currencies. Rates are the price of one unit of from in to.
+type FXRateProvider interface {
+	Rate(ctx context.Context, from, to string) (float64, error)
+	HistoricalRate(ctx context.Context, from, to string, on time.Time) (float64, error)
+}
+
+// Notifier delivers alert events.
+type Notifier interface {
+	Notify(ctx context.Context, event portfolio.AlertEvent) error
+}
@@ -0,0 +1,163 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"tracktrades/internal/adapters/notify"
+	"tracktrades/internal/adapters/storage"
+	"tracktrades/internal/app"
+	"tracktrades/internal/domain/portfolio"
+	"tracktrades/internal/ports"
+)
+
+// scriptedPricer sets each ticker's price from a map that tests change between refreshes.
+type scriptedPricer map[string]float64
+
+func (s scriptedPricer) UpdatePrice(ctx context.Context, p *portfolio.Position) error {
+	if price, ok := s[p.Ticker]; ok {
+		p.UpdatePrice(price)
+	}
+	return nil
+}
+
+func (s scriptedPricer) ComputeHistoricalPeak(ctx context.Context, p *portfolio.Position) error {
+	return nil
+}
+
+type recordingNotifier struct {
+	events []portfolio.AlertEvent
+}
+
+func (r *recordingNotifier) Notify(ctx context.Context, e portfolio.AlertEvent) error {
+	r.events = append(r.events, e)
+	return nil
+}
+
+var (
+	_ ports.PriceProvider = scriptedPricer(nil)
+	_ ports.Notifier      = (*recordingNotifier)(nil)
+)
+
+func TestAlertsFireOnceAndClear(t *testing.T) {
+	storeInfo, err := storage.NewPortfolioStore("memory")
+	if err != nil {
+		t.Fatalf("NewPortfolioStore memory: %v", err)
+	}
+	prices := scriptedPricer{"AAPL": 100}
+	notes := &recordingNotifier{}
+	svc := app.NewPortfolioService(storeInfo.Store, prices, app.WithNotifier(notes))
+	ctx := context.Background()
+
+	if _, err := svc.CreatePortfolio(ctx, "alerts", portfolio.NewDecimal(0)); err != nil {
+		t.Fatalf("CreatePortfolio: %v", err)
+	}
+	if err := svc.AddOrUpdatePosition(ctx, "alerts", &portfolio.Position{Ticker: "AAPL", Shares: portfolio.NewDecimal(10), CostBasis: portfolio.NewDecimal(1000), CurrentPrice: 100, PeakPrice: 100}); err != nil {
+		t.Fatalf("AddOrUpdatePosition: %v", err)
+	}
+	for _, rule := range []portfolio.AlertRule{
+		{Kind: portfolio.AlertTrailingStop, Ticker: "aapl", Threshold: 10},
+		{Kind: portfolio.AlertTargetPrice, Ticker: "AAPL", Threshold: 120},
+		{Kind: portfolio.AlertPortfolioDrawdown, Threshold: 12},
+	} {
+		if _, err := svc.AddAlert(ctx, "alerts", rule); err != nil {
+			t.Fatalf("AddAlert: %v", err)
+		}
+	}
+
+	refresh := func(price float64) {
+		t.Helper()
+		prices["AAPL"] = price
+		if err := svc.UpdateAllPrices(ctx, "alerts"); err != nil {
+			t.Fatalf("UpdateAllPrices: %v", err)
+		}
+	}
+
+	refresh(100)
+	if len(notes.events) != 0 {
+		t.Fatalf("unexpected events: %#v", notes.events)
+	}
+
+	refresh(85)
+	if len(notes.events) != 2 {
+		t.Fatalf("events=%d want trailing stop and drawdown", len(notes.events))
+	}
+	for _, e := range notes.events {
+		if e.State != portfolio.AlertTriggered || e.Portfolio != "alerts" {
+			t.Fatalf("unexpected event: %#v", e)
+		}
+	}
+
+	refresh(84)
+	if len(notes.events) != 2 {
+		t.Fatalf("alert fired twice: %#v", notes.events[2:])
+	}
+
+	refresh(95)
+	if len(notes.events) != 4 || notes.events[2].State != portfolio.AlertCleared {
+		t.Fatalf("expected both alerts to clear: %#v", notes.events[2:])
+	}
+
+	rules, err := svc.ListAlerts(ctx, "alerts")
+	if err != nil {
+		t.Fatalf("ListAlerts: %v", err)
+	}
+	if len(rules) != 3 || rules[0].Triggered || rules[0].TriggeredAt == nil || !approx(rules[0].LastValue, 5) {
+		t.Fatalf("unexpected persisted state: %#v", rules[0])
+	}
+}
+
+func TestAddAlertValidatesRules(t *testing.T) {
+	storeInfo, err := storage.NewPortfolioStore("memory")
+	if err != nil {
+		t.Fatalf("NewPortfolioStore memory: %v", err)
+	}
+	svc := app.NewPortfolioService(storeInfo.Store, nopPricer{})
+	ctx := context.Background()
+	if _, err := svc.CreatePortfolio(ctx, "alerts", portfolio.NewDecimal(0)); err != nil {
+		t.Fatalf("CreatePortfolio: %v", err)
+	}
+
+	for _, rule := range []portfolio.AlertRule{
+		{Kind: portfolio.AlertStopPrice, Threshold: 90},
+		{Kind: portfolio.AlertTrailingStop, Ticker: "AAPL"},
+		{Kind: "sideways", Ticker: "AAPL", Threshold: 1},
+	} {
+		if _, err := svc.AddAlert(ctx, "alerts", rule); !errors.Is(err, portfolio.ErrInvalidAlert) {
+			t.Fatalf("AddAlert(%#v) err=%v want ErrInvalidAlert", rule, err)
+		}
+	}
+	if err := svc.RemoveAlert(ctx, "alerts", "alert-9"); !errors.Is(err, portfolio.ErrInvalidAlert) {
+		t.Fatalf("RemoveAlert err=%v", err)
+	}
+}
+
+func TestWebhookNotifierPostsEvent(t *testing.T) {
+	var got portfolio.AlertEvent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+	}))
+	defer srv.Close()
+
+	n, err := notify.New("webhook:" + srv.URL)
+	if err != nil {
+		t.Fatalf("notify.New: %v", err)
+	}
+	event := portfolio.AlertEvent{Portfolio: "alerts", State: portfolio.AlertTriggered, Message: "alert-1 triggered"}
+	if err := n.Notify(context.Background(), event); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if got.Message != event.Message || got.State != event.State {
+		t.Fatalf("unexpected payload: %#v", got)
+	}
+
+	if _, err := notify.New("pager"); err == nil {
+		t.Fatalf("expected error for unknown notifier")
+	}
+}
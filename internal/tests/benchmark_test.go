@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"tracktrades/internal/adapters/storage"
+	"tracktrades/internal/app"
+	"tracktrades/internal/domain/portfolio"
+)
+
+func TestCompareBenchmarksAlignsSeries(t *testing.T) {
+	storeInfo, err := storage.NewPortfolioStore("memory")
+	if err != nil {
+		t.Fatalf("NewPortfolioStore memory: %v", err)
+	}
+	history := staticHistory{
+		"NVDA": {
+			{Date: date("2024-01-01"), Close: 100},
+			{Date: date("2024-01-02"), Close: 110},
+			{Date: date("2024-01-03"), Close: 99},
+		},
+		"SPY": {
+			{Date: date("2023-12-29"), Close: 400},
+			{Date: date("2024-01-02"), Close: 420},
+			{Date: date("2024-01-03"), Close: 399},
+		},
+	}
+	svc := app.NewPortfolioService(storeInfo.Store, nopPricer{}, app.WithPriceHistory(history))
+	ctx := context.Background()
+
+	if _, err := svc.CreatePortfolio(ctx, "bench", portfolio.NewDecimal(0)); err != nil {
+		t.Fatalf("CreatePortfolio: %v", err)
+	}
+	for _, tx := range []portfolio.Transaction{
+		{Type: portfolio.TxDeposit, Date: date("2024-01-01"), Amount: portfolio.NewDecimal(1000)},
+		{Type: portfolio.TxBuy, Ticker: "NVDA", Date: date("2024-01-01"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(100)},
+	} {
+		if _, err := svc.RecordTransaction(ctx, "bench", tx); err != nil {
+			t.Fatalf("RecordTransaction: %v", err)
+		}
+	}
+
+	if _, err := svc.CompareBenchmarks(ctx, "bench", nil, date("2024-01-01"), date("2024-01-03")); err == nil {
+		t.Fatalf("expected error without benchmarks")
+	}
+	if err := svc.SetBenchmarks(ctx, "bench", []string{" spy", "SPY", ""}); err != nil {
+		t.Fatalf("SetBenchmarks: %v", err)
+	}
+
+	report, err := svc.CompareBenchmarks(ctx, "bench", nil, date("2024-01-01"), date("2024-01-03"))
+	if err != nil {
+		t.Fatalf("CompareBenchmarks: %v", err)
+	}
+	if len(report.Benchmarks) != 1 {
+		t.Fatalf("Benchmarks=%d want 1", len(report.Benchmarks))
+	}
+	cmp := report.Benchmarks[0]
+	if cmp.Ticker != "SPY" || len(cmp.Series) != 3 {
+		t.Fatalf("unexpected comparison: %#v", cmp)
+	}
+	if !approx(cmp.Series[2].Portfolio, 99) || !approx(cmp.Series[2].Benchmark, 99.75) {
+		t.Fatalf("unexpected last point: %#v", cmp.Series[2])
+	}
+	if !approx(cmp.RelativeReturnPct, -0.75) {
+		t.Fatalf("RelativeReturnPct=%v want -0.75", cmp.RelativeReturnPct)
+	}
+	if !approx(cmp.Beta, 2) || cmp.TrackingErrorPct <= 0 {
+		t.Fatalf("Beta=%v TrackingErrorPct=%v", cmp.Beta, cmp.TrackingErrorPct)
+	}
+}
@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+
+	"tracktrades/internal/domain/portfolio"
+)
+
+func TestConcentrationStatsAndLimits(t *testing.T) {
+	p := portfolio.New("concentration", portfolio.NewDecimal(0))
+	p.AddPosition(&portfolio.Position{Ticker: "AAA", Shares: portfolio.NewDecimal(10), CostBasis: portfolio.NewDecimal(1000), CurrentPrice: 100})
+	p.AddPosition(&portfolio.Position{Ticker: "BBB", Shares: portfolio.NewDecimal(10), CostBasis: portfolio.NewDecimal(500), CurrentPrice: 50})
+	p.AddPosition(&portfolio.Position{Ticker: "CCC", Side: portfolio.Short, Shares: portfolio.NewDecimal(10), CostBasis: portfolio.NewDecimal(500), CurrentPrice: 50})
+
+	// Shorts count by their size, so the weights are 50/25/25 of gross exposure.
+	report := p.Concentration()
+	stats := report.Stats
+	if stats.LargestTicker != "AAA" || !approx(stats.LargestWeightPct, 50) || !approx(stats.Top5WeightPct, 100) {
+		t.Fatalf("stats=%#v", stats)
+	}
+	if !approx(stats.HHI, 0.375) || !approx(stats.EffectiveBets, 1/0.375) {
+		t.Fatalf("hhi=%v bets=%v", stats.HHI, stats.EffectiveBets)
+	}
+	kinds := func(ws []portfolio.ConcentrationWarning) []string {
+		var res []string
+		for _, w := range ws {
+			res = append(res, w.Kind)
+		}
+		return res
+	}
+	if got := kinds(report.Warnings); !reflect.DeepEqual(got, []string{"position-weight", "position-weight", "position-weight", "hhi"}) {
+		t.Fatalf("warnings=%v", got)
+	}
+
+	limits, err := p.SetConcentrationLimits(portfolio.ConcentrationLimits{MaxPositionPct: 30, MaxHHI: 0.5, MinEffectiveBets: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limits.MaxTop5Pct != 60 || limits.CorrelationThreshold != 0.8 {
+		t.Fatalf("limits=%#v", limits)
+	}
+	m := p.Metrics()
+	if got := kinds(m.Warnings); !reflect.DeepEqual(got, []string{"position-weight", "effective-bets"}) || m.Warnings[0].Tickers[0] != "AAA" {
+		t.Fatalf("metrics warnings=%#v", m.Warnings)
+	}
+	if !approx(m.Concentration.LargestWeightPct, 50) {
+		t.Fatalf("metrics concentration=%#v", m.Concentration)
+	}
+
+	if _, err := p.SetConcentrationLimits(portfolio.ConcentrationLimits{MaxHHI: 2}); !errors.Is(err, portfolio.ErrInvalidConcentration) {
+		t.Fatalf("err=%v want ErrInvalidConcentration", err)
+	}
+}
+
+func TestCorrelationMatrixClustersCorrelatedPositions(t *testing.T) {
+	p := portfolio.New("correlation", portfolio.NewDecimal(0))
+	for _, ticker := range []string{"AAA", "BBB", "CCC", "DDD", "EEE"} {
+		pos := &portfolio.Position{Ticker: ticker, Shares: portfolio.NewDecimal(10), CostBasis: portfolio.NewDecimal(1000), CurrentPrice: 100}
+		if ticker == "DDD" {
+			pos.Side = portfolio.Short
+		}
+		p.AddPosition(pos)
+	}
+	// AAA and BBB move together, DDD is short the same series, CCC moves on
+	// its own and EEE has only a few days of history.
+	wavy := wavySeries(30)
+	for i := range wavy {
+		prices := map[string]float64{"AAA": wavy[i], "BBB": 2 * wavy[i], "CCC": 100 + 5*math.Cos(3*float64(i)) + float64(i%4), "DDD": wavy[i]}
+		if i >= 25 {
+			prices["EEE"] = 100 + float64(i)
+		}
+		p.History = append(p.History, portfolio.Snapshot{Time: date("2024-01-01").AddDate(0, 0, i), Prices: prices})
+	}
+
+	corr := p.Concentration().Correlation
+	if !reflect.DeepEqual(corr.Tickers, []string{"AAA", "BBB", "CCC", "DDD", "EEE"}) {
+		t.Fatalf("tickers=%v", corr.Tickers)
+	}
+	if c := corr.Matrix[0][1]; c == nil || !approx(*c, 1) || corr.Matrix[1][0] != c {
+		t.Fatalf("AAA/BBB=%v", c)
+	}
+	// A short of the same series offsets the long rather than adding to it.
+	if c := corr.Matrix[0][3]; c == nil || !approx(*c, -1) {
+		t.Fatalf("AAA/DDD=%v", c)
+	}
+	if c := corr.Matrix[2][0]; c == nil || math.Abs(*c) >= 0.8 {
+		t.Fatalf("CCC/AAA=%v", c)
+	}
+	if corr.Matrix[0][4] != nil || corr.Matrix[4][4] == nil || *corr.Matrix[4][4] != 1 {
+		t.Fatalf("EEE row=%v", corr.Matrix[4])
+	}
+	if len(corr.Clusters) != 1 || !reflect.DeepEqual(corr.Clusters[0].Tickers, []string{"AAA", "BBB"}) || !approx(corr.Clusters[0].MinCorrelation, 1) {
+		t.Fatalf("clusters=%#v", corr.Clusters)
+	}
+
+	// AAA and BBB are 40% together, at the cluster limit; lowering it warns.
+	// Five equal positions have an HHI of 0.2, above the default limit.
+	if _, err := p.SetConcentrationLimits(portfolio.ConcentrationLimits{MaxHHI: 0.25, MaxClusterPct: 35}); err != nil {
+		t.Fatal(err)
+	}
+	warnings := p.Metrics().Warnings
+	if len(warnings) != 1 || warnings[0].Kind != "correlated-cluster" || !approx(warnings[0].Value, 40) {
+		t.Fatalf("warnings=%#v", warnings)
+	}
+}
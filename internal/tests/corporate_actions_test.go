@@ -0,0 +1,172 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"tracktrades/internal/adapters/storage"
+	"tracktrades/internal/app"
+	"tracktrades/internal/domain/portfolio"
+)
+
+type fixedSplits []portfolio.SplitEvent
+
+func (f fixedSplits) Splits(ctx context.Context, pos *portfolio.Position, since time.Time) ([]portfolio.SplitEvent, error) {
+	var res []portfolio.SplitEvent
+	for _, ev := range f {
+		if ev.Ticker == pos.Ticker && !ev.Date.Before(since) {
+			res = append(res, ev)
+		}
+	}
+	return res, nil
+}
+
+func TestSplitAfterRefreshKeepsDrawdownSane(t *testing.T) {
+	p := portfolio.New("splits", portfolio.NewDecimal(0))
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxDeposit, Date: date("2024-01-02"), Amount: portfolio.NewDecimal(20000)},
+		{Type: portfolio.TxBuy, Ticker: "NVDA", Date: date("2024-01-02"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(1000)},
+	})
+	p.RecordSnapshot(date("2024-03-01"), true)
+	if _, err := p.AddAlert(portfolio.AlertRule{Kind: portfolio.AlertStopPrice, Ticker: "NVDA", Threshold: 800}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The post-split quote arrives before the split is recorded.
+	p.Positions["NVDA"].UpdatePrice(105)
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxSplit, Ticker: "NVDA", Date: date("2024-06-10"), Ratio: portfolio.NewDecimal(10)},
+	})
+
+	pos := p.Positions["NVDA"]
+	if !approx(pos.Shares.Float(), 100) || !approx(pos.CurrentPrice, 105) || !approx(pos.PeakPrice, 105) {
+		t.Fatalf("Shares=%v CurrentPrice=%v PeakPrice=%v", pos.Shares, pos.CurrentPrice, pos.PeakPrice)
+	}
+	if d := pos.DetailedMetrics(); d.DrawdownFromPeakPct != 0 || !approx(d.UnrealizedPnL.Float(), 500) {
+		t.Fatalf("Drawdown=%v PnL=%v", d.DrawdownFromPeakPct, d.UnrealizedPnL)
+	}
+	if lot := pos.Lots[0]; !approx(lot.Quantity.Float(), 100) || !approx(lot.CostPerShare().Float(), 100) {
+		t.Fatalf("unexpected lot after split: %#v", lot)
+	}
+	if got := p.History[0].Prices["NVDA"]; !approx(got, 100) {
+		t.Fatalf("snapshot price=%v want 100", got)
+	}
+	if got := p.Alerts[0].Threshold; !approx(got, 80) {
+		t.Fatalf("stop threshold=%v want 80", got)
+	}
+}
+
+func TestReverseSplitRescalesStalePrice(t *testing.T) {
+	ratio, err := portfolio.ParseSplitRatio("1:10")
+	if err != nil || ratio != portfolio.NewDecimal(0.1) {
+		t.Fatalf("ratio=%v err=%v", ratio, err)
+	}
+	if r, _ := portfolio.ParseSplitRatio("3-for-2"); r != portfolio.NewDecimal(1.5) {
+		t.Fatalf("3-for-2 parsed as %v", r)
+	}
+
+	p := portfolio.New("splits", portfolio.NewDecimal(0))
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxDeposit, Date: date("2024-01-02"), Amount: portfolio.NewDecimal(1000)},
+		{Type: portfolio.TxBuy, Ticker: "SIRI", Date: date("2024-01-02"), Quantity: portfolio.NewDecimal(200), Price: portfolio.NewDecimal(5)},
+		{Type: portfolio.TxSplit, Ticker: "SIRI", Date: date("2024-09-10"), Ratio: ratio},
+	})
+	pos := p.Positions["SIRI"]
+	if !approx(pos.Shares.Float(), 20) || !approx(pos.CurrentPrice, 50) || !approx(pos.PeakPrice, 50) || !approx(pos.CostBasis.Float(), 1000) {
+		t.Fatalf("unexpected position after reverse split: %#v", pos)
+	}
+}
+
+func TestRenameMovesHoldingAndReferences(t *testing.T) {
+	p := portfolio.New("renames", portfolio.NewDecimal(0))
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxDeposit, Date: date("2022-01-03"), Amount: portfolio.NewDecimal(5000)},
+		{Type: portfolio.TxBuy, Ticker: "FB", Date: date("2022-01-03"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(330)},
+	})
+	p.Positions["FB"].UpdatePrice(200)
+	p.Targets = []portfolio.AllocationTarget{{Ticker: "FB", WeightPct: 50}}
+	if _, err := p.AddAlert(portfolio.AlertRule{Kind: portfolio.AlertTrailingStop, Ticker: "FB", Threshold: 20}); err != nil {
+		t.Fatal(err)
+	}
+
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxRename, Ticker: "FB", NewTicker: "META", Date: date("2022-06-09")},
+	})
+	if _, ok := p.Positions["FB"]; ok {
+		t.Fatalf("FB position should be gone: %#v", p.Positions)
+	}
+	pos := p.Positions["META"]
+	if pos == nil || pos.Shares != portfolio.NewDecimal(10) || !approx(pos.CostBasis.Float(), 3300) || !approx(pos.CurrentPrice, 200) || !approx(pos.PeakPrice, 330) {
+		t.Fatalf("unexpected META position: %#v", pos)
+	}
+	if !pos.EntryDate.Equal(date("2022-01-03")) || pos.Lots[0].Acquired != date("2022-01-03") {
+		t.Fatalf("rename must keep the acquisition date: %#v", pos)
+	}
+	if p.Targets[0].Ticker != "META" || p.Alerts[0].Ticker != "META" {
+		t.Fatalf("targets=%v alerts=%v", p.Targets, p.Alerts)
+	}
+
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxSell, Ticker: "META", Date: date("2023-02-01"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(180)},
+	})
+	sales, _ := p.Sales("META")
+	if len(sales) != 1 || sales[0].Lots[0].Term != portfolio.LongTerm || !approx(sales[0].Gain.Float(), -1500) {
+		t.Fatalf("unexpected sale after rename: %#v", sales)
+	}
+	if len(p.Positions) != 0 || !approx(p.Cash.Float(), 3500) {
+		t.Fatalf("positions=%v cash=%v", p.Positions, p.Cash)
+	}
+}
+
+func TestMergerConvertsIntoExistingHolding(t *testing.T) {
+	p := portfolio.New("mergers", portfolio.NewDecimal(0))
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxDeposit, Date: date("2024-01-02"), Amount: portfolio.NewDecimal(10000)},
+		{Type: portfolio.TxBuy, Ticker: "ATVI", Date: date("2024-01-02"), Quantity: portfolio.NewDecimal(20), Price: portfolio.NewDecimal(90)},
+		{Type: portfolio.TxBuy, Ticker: "MSFT", Date: date("2024-01-02"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(380)},
+		{Type: portfolio.TxRename, Ticker: "ATVI", NewTicker: "MSFT", Date: date("2024-02-01"), Ratio: portfolio.NewDecimal(0.25)},
+	})
+	pos := p.Positions["MSFT"]
+	if pos == nil || !approx(pos.Shares.Float(), 15) || !approx(pos.CostBasis.Float(), 5600) || len(pos.Lots) != 2 || !approx(pos.CurrentPrice, 380) {
+		t.Fatalf("unexpected merged position: %#v", pos)
+	}
+	if _, ok := p.Positions["ATVI"]; ok {
+		t.Fatalf("ATVI should have been merged away")
+	}
+}
+
+func TestRecomputePeaksRecordsDetectedSplits(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryPortfolioStore()
+	splits := fixedSplits{
+		{Ticker: "NVDA", Date: date("2023-01-10"), Ratio: portfolio.NewDecimal(2)},
+		{Ticker: "NVDA", Date: date("2024-06-10"), Ratio: portfolio.NewDecimal(10)},
+	}
+	svc := app.NewPortfolioService(store, nopPricer{}, app.WithSplitDetection(splits))
+	if _, err := svc.CreatePortfolio(ctx, "p", portfolio.NewDecimal(0)); err != nil {
+		t.Fatal(err)
+	}
+	for _, tx := range []portfolio.Transaction{
+		{Type: portfolio.TxDeposit, Date: date("2024-01-02"), Amount: portfolio.NewDecimal(10000)},
+		{Type: portfolio.TxBuy, Ticker: "NVDA", Date: date("2024-01-02"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(500)},
+	} {
+		if _, err := svc.RecordTransaction(ctx, "p", tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := svc.RecomputeHistoricalPeaks(ctx, "p"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	actions, err := svc.ListCorporateActions(ctx, "p")
+	if err != nil || len(actions) != 1 || actions[0].Ratio != portfolio.NewDecimal(10) || !actions[0].Date.Equal(date("2024-06-10")) {
+		t.Fatalf("actions=%#v err=%v", actions, err)
+	}
+	pos, ok, err := svc.GetPosition(ctx, "p", "NVDA")
+	if err != nil || !ok || !approx(pos.Shares.Float(), 100) {
+		t.Fatalf("pos=%#v ok=%v err=%v", pos, ok, err)
+	}
+}
@@ -0,0 +1,118 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"tracktrades/internal/adapters/storage"
+	"tracktrades/internal/app"
+	"tracktrades/internal/domain/portfolio"
+	"tracktrades/internal/ports"
+)
+
+type fixedFX struct {
+	historical float64
+	current    float64
+}
+
+func (f *fixedFX) Rate(ctx context.Context, from, to string) (float64, error) {
+	if from == to {
+		return 1, nil
+	}
+	return f.current, nil
+}
+
+func (f *fixedFX) HistoricalRate(ctx context.Context, from, to string, on time.Time) (float64, error) {
+	if from == to {
+		return 1, nil
+	}
+	return f.historical, nil
+}
+
+var _ ports.FXRateProvider = (*fixedFX)(nil)
+
+func TestForeignPositionReportsBaseValueAndFXPnL(t *testing.T) {
+	storeInfo, err := storage.NewPortfolioStore("memory")
+	if err != nil {
+		t.Fatalf("NewPortfolioStore memory: %v", err)
+	}
+	fx := &fixedFX{historical: 1.10, current: 1.20}
+	svc := app.NewPortfolioService(storeInfo.Store, nopPricer{}, app.WithFXRates(fx))
+	ctx := context.Background()
+
+	if _, err := svc.CreatePortfolio(ctx, "fx", portfolio.NewDecimal(2000)); err != nil {
+		t.Fatalf("CreatePortfolio: %v", err)
+	}
+	tx := portfolio.Transaction{Type: portfolio.TxBuy, Ticker: "SAP", Currency: "EUR", Date: date("2024-01-02"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(100)}
+	recorded, err := svc.RecordTransaction(ctx, "fx", tx)
+	if err != nil {
+		t.Fatalf("RecordTransaction: %v", err)
+	}
+	if recorded.FXRate != portfolio.NewDecimal(1.10) {
+		t.Fatalf("FXRate=%v want historical rate 1.10", recorded.FXRate)
+	}
+	if err := svc.UpdateAllPrices(ctx, "fx"); err != nil {
+		t.Fatalf("UpdateAllPrices: %v", err)
+	}
+
+	d, ok, err := svc.GetPosition(ctx, "fx", "SAP")
+	if err != nil || !ok {
+		t.Fatalf("GetPosition: %v ok=%v", err, ok)
+	}
+	if d.Currency != "EUR" || !approx(d.LocalValue.Float(), 1000) || !approx(d.CurrentValue.Float(), 1200) {
+		t.Fatalf("unexpected values: %#v", d)
+	}
+	if !approx(d.CostBasis.Float(), 1100) || !approx(d.LocalUnrealizedPnL.Float(), 0) || !approx(d.FXPnL.Float(), 100) {
+		t.Fatalf("unexpected P&L split: cost=%v local=%v fx=%v", d.CostBasis, d.LocalUnrealizedPnL, d.FXPnL)
+	}
+
+	m, err := svc.GetMetrics(ctx, "fx")
+	if err != nil {
+		t.Fatalf("GetMetrics: %v", err)
+	}
+	if m.BaseCurrency != "USD" || !approx(m.TotalValue.Float(), 900+1200) || !approx(m.FXPnL.Float(), 100) {
+		t.Fatalf("unexpected metrics: %#v", m)
+	}
+	if len(m.Currencies) != 2 || m.Currencies[0].Currency != "EUR" || !approx(m.Currencies[0].LocalValue.Float(), 1000) {
+		t.Fatalf("unexpected currency exposures: %#v", m.Currencies)
+	}
+}
+
+func TestForeignTradeRequiresRateWithoutProvider(t *testing.T) {
+	p := portfolio.New("fx", portfolio.NewDecimal(1000))
+	_, err := p.Record(portfolio.Transaction{Type: portfolio.TxBuy, Ticker: "SHEL", Currency: "GBP", Quantity: portfolio.NewDecimal(1), Price: portfolio.NewDecimal(25)})
+	if !errors.Is(err, portfolio.ErrInvalidTransaction) {
+		t.Fatalf("expected missing fx rate error, got %v", err)
+	}
+}
+
+func TestTradeAfterPositionWithoutCostBasis(t *testing.T) {
+	store := storage.NewFilePortfolioStore(t.TempDir())
+	svc := app.NewPortfolioService(store, nopPricer{})
+	ctx := context.Background()
+
+	if _, err := svc.CreatePortfolio(ctx, "gift", portfolio.NewDecimal(1000)); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.AddOrUpdatePosition(ctx, "gift", &portfolio.Position{Ticker: "MSFT", Shares: portfolio.NewDecimal(1)}); err != nil {
+		t.Fatal(err)
+	}
+	tx := portfolio.Transaction{Type: portfolio.TxBuy, Ticker: "AAPL", Date: date("2024-01-02"), Quantity: portfolio.NewDecimal(2), Price: portfolio.NewDecimal(100)}
+	if _, err := svc.RecordTransaction(ctx, "gift", tx); err != nil {
+		t.Fatalf("RecordTransaction: %v", err)
+	}
+
+	p, err := store.Load(ctx, "gift")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pos := p.Positions["MSFT"]
+	if pos == nil || pos.Shares != portfolio.NewDecimal(1) || !pos.CostBasis.IsZero() || pos.Rate() != 1 {
+		t.Fatalf("MSFT=%#v", pos)
+	}
+	if !approx(p.Cash.Float(), 800) {
+		t.Fatalf("Cash=%v want 800", p.Cash)
+	}
+}
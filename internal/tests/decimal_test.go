@@ -0,0 +1,241 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tracktrades/internal/adapters/storage"
+	"tracktrades/internal/app"
+	"tracktrades/internal/domain/portfolio"
+)
+
+func TestDecimalArithmeticIsExact(t *testing.T) {
+	var sum portfolio.Decimal
+	for i := 0; i < 1000; i++ {
+		sum = sum.Add(portfolio.NewDecimal(0.1))
+	}
+	if sum != portfolio.NewDecimal(100) {
+		t.Fatalf("sum=%v want 100", sum)
+	}
+
+	d, err := portfolio.ParseDecimal("1234.5600000000002")
+	if err != nil || d.String() != "1234.56" {
+		t.Fatalf("d=%v err=%v", d, err)
+	}
+	if got := portfolio.NewDecimal(2.345).Round(2); got.String() != "2.35" {
+		t.Fatalf("Round=%v want 2.35", got)
+	}
+	if got := portfolio.NewDecimal(-2.345).RoundTo("USD"); got.String() != "-2.35" {
+		t.Fatalf("RoundTo=%v want -2.35", got)
+	}
+	if got := portfolio.NewDecimal(1234.5).RoundTo("jpy"); got.StringFixed(2) != "1235.00" {
+		t.Fatalf("JPY=%v want 1235", got)
+	}
+	if got := portfolio.NewDecimal(100).Scale(portfolio.NewDecimal(1), portfolio.NewDecimal(3)); got.String() != "33.33333333" {
+		t.Fatalf("Scale=%v", got)
+	}
+}
+
+func TestDecimalSaturatesOnOverflow(t *testing.T) {
+	big, err := portfolio.ParseDecimal("1e30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum := big.Add(big); !sum.Overflowed() || !sum.IsPositive() {
+		t.Fatalf("sum=%v should saturate high", sum)
+	}
+	if diff := big.Neg().Sub(big); !diff.Overflowed() || !diff.IsNegative() {
+		t.Fatalf("diff=%v should saturate low", diff)
+	}
+	if back := big.Add(big).Sub(big); !back.Overflowed() {
+		t.Fatalf("back=%v should stay saturated", back)
+	}
+	if sum := big.Add(big.Neg()); sum.Overflowed() || !sum.IsZero() {
+		t.Fatalf("sum=%v want 0", sum)
+	}
+	if prod := big.Mul(portfolio.NewDecimal(-2)); !prod.Overflowed() || !prod.IsNegative() {
+		t.Fatalf("prod=%v should saturate low", prod)
+	}
+	if !portfolio.NewDecimal(1e31).Overflowed() {
+		t.Fatal("out-of-range float should saturate")
+	}
+	if _, err := portfolio.ParseDecimal("1e31"); !errors.Is(err, portfolio.ErrOutOfRange) {
+		t.Fatalf("err=%v want ErrOutOfRange", err)
+	}
+}
+
+func TestDecimalHoldsLargeWonAndYenAmounts(t *testing.T) {
+	// Amounts past the 92 billion an int64 of 1e-8 units would hold.
+	cash, err := portfolio.ParseDecimal("150000000000.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cash.Add(cash).String(); got != "300000000001" {
+		t.Fatalf("sum=%v", got)
+	}
+	if got := cash.Neg().Add(portfolio.NewDecimal(0.25)).String(); got != "-150000000000.25" {
+		t.Fatalf("diff=%v", got)
+	}
+	if got := cash.Mul(portfolio.NewDecimal(3)).Div(portfolio.NewDecimal(2)).StringFixed(2); got != "225000000000.75" {
+		t.Fatalf("scaled=%v", got)
+	}
+	if got := cash.Neg().RoundTo("KRW").String(); got != "-150000000001" {
+		t.Fatalf("rounded=%v", got)
+	}
+	if cash.Cmp(cash.Neg()) <= 0 || !approx(cash.Float(), 150000000000.5) || !approx(cash.Neg().Float(), -150000000000.5) {
+		t.Fatalf("cmp or float of %v", cash)
+	}
+
+	p := portfolio.New("won", portfolio.NewDecimal(0))
+	p.BaseCurrency = "KRW"
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxDeposit, Date: date("2024-01-02"), Amount: portfolio.NewDecimal(120e9)},
+		{Type: portfolio.TxDeposit, Date: date("2024-01-03"), Amount: portfolio.NewDecimal(80e9)},
+		{Type: portfolio.TxBuy, Ticker: "005930", Date: date("2024-01-04"), Quantity: portfolio.NewDecimal(1e6), Price: portfolio.NewDecimal(75000)},
+	})
+	if p.Cash != portfolio.NewDecimal(200e9-75e9) {
+		t.Fatalf("Cash=%v", p.Cash)
+	}
+	data, err := json.Marshal(p.Cash)
+	if err != nil || string(data) != "125000000000" {
+		t.Fatalf("json=%s err=%v", data, err)
+	}
+}
+
+func TestLedgerRejectsOutOfRangeAmounts(t *testing.T) {
+	huge, err := portfolio.ParseDecimal("1e30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := portfolio.New("huge", portfolio.NewDecimal(0))
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxDeposit, Date: date("2024-01-02"), Amount: huge},
+	})
+	for _, tx := range []portfolio.Transaction{
+		{Type: portfolio.TxDeposit, Date: date("2024-01-03"), Amount: huge},
+		{Type: portfolio.TxDeposit, Date: date("2024-01-03"), Amount: portfolio.NewDecimal(1e40)},
+		{Type: portfolio.TxBuy, Ticker: "AAPL", Date: date("2024-01-03"), Quantity: portfolio.NewDecimal(1e15), Price: portfolio.NewDecimal(1e16)},
+	} {
+		_, err := p.Record(tx)
+		if !errors.Is(err, portfolio.ErrInvalidTransaction) || !errors.Is(err, portfolio.ErrOutOfRange) {
+			t.Fatalf("Record(%s) err=%v, want ErrInvalidTransaction and ErrOutOfRange", tx.Type, err)
+		}
+	}
+	if p.Cash != huge || len(p.Transactions) != 1 {
+		t.Fatalf("Cash=%v transactions=%d", p.Cash, len(p.Transactions))
+	}
+}
+
+func TestServiceRejectsOutOfRangeHandEnteredAmounts(t *testing.T) {
+	ctx := context.Background()
+	svc := app.NewPortfolioService(storage.NewMemoryPortfolioStore(), nopPricer{})
+	if _, err := svc.CreatePortfolio(ctx, "p", portfolio.NewDecimal(1e40)); !errors.Is(err, portfolio.ErrOutOfRange) {
+		t.Fatalf("CreatePortfolio err=%v want ErrOutOfRange", err)
+	}
+	if _, err := svc.CreatePortfolio(ctx, "p", portfolio.NewDecimal(0)); err != nil {
+		t.Fatal(err)
+	}
+	pos := &portfolio.Position{Ticker: "X", Shares: portfolio.NewDecimal(1), CostBasis: portfolio.NewDecimal(-1e40)}
+	if err := svc.AddOrUpdatePosition(ctx, "p", pos); !errors.Is(err, portfolio.ErrOutOfRange) {
+		t.Fatalf("AddOrUpdatePosition err=%v want ErrOutOfRange", err)
+	}
+	if list, err := svc.ListPositions(ctx, "p"); err != nil || len(list) != 0 {
+		t.Fatalf("positions=%v err=%v", list, err)
+	}
+}
+
+func TestDecimalJSONIsLossless(t *testing.T) {
+	pos := portfolio.Position{Ticker: "X", Shares: portfolio.NewDecimal(0.1).Add(portfolio.NewDecimal(0.2)), CostBasis: portfolio.NewDecimal(1234567.89)}
+	data, err := json.Marshal(pos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back portfolio.Position
+	if err := json.Unmarshal(data, &back); err != nil || back.Shares.String() != "0.3" || back.CostBasis != pos.CostBasis {
+		t.Fatalf("round trip %s -> %#v err=%v", data, back, err)
+	}
+
+	var p portfolio.Portfolio
+	if err := json.Unmarshal([]byte(`{"name":"p","cash":"99.99","realized_pnl":-0.30000000000000004}`), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Cash.String() != "99.99" || p.RealizedPnL.String() != "-0.3" {
+		t.Fatalf("Cash=%v RealizedPnL=%v", p.Cash, p.RealizedPnL)
+	}
+}
+
+func TestLedgerBooksCashWithoutDrift(t *testing.T) {
+	p := portfolio.New("cents", portfolio.NewDecimal(0))
+	var txs []portfolio.Transaction
+	for i := 0; i < 100; i++ {
+		txs = append(txs,
+			portfolio.Transaction{Type: portfolio.TxDeposit, Date: date("2024-01-02"), Amount: portfolio.NewDecimal(0.1)},
+			portfolio.Transaction{Type: portfolio.TxFee, Date: date("2024-01-02"), Amount: portfolio.NewDecimal(0.07)},
+		)
+	}
+	recordAll(t, p, txs)
+	if p.Cash != portfolio.NewDecimal(3) {
+		t.Fatalf("Cash=%v want 3", p.Cash)
+	}
+}
+
+func TestLedgerRoundsToCurrencyMinorUnit(t *testing.T) {
+	p := portfolio.New("yen", portfolio.NewDecimal(0))
+	p.BaseCurrency = "JPY"
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxDeposit, Date: date("2024-01-02"), Amount: portfolio.NewDecimal(100000)},
+		{Type: portfolio.TxBuy, Ticker: "7203", Date: date("2024-01-02"), Quantity: portfolio.NewDecimal(3), Price: portfolio.NewDecimal(2500.4)},
+		{Type: portfolio.TxBuy, Ticker: "AAPL", Date: date("2024-01-03"), Quantity: portfolio.NewDecimal(1), Price: portfolio.NewDecimal(190.555), Currency: "USD", FXRate: portfolio.NewDecimal(151.237)},
+	})
+
+	// 7501.2 yen is booked as 7501; the USD trade is rounded to the cent and
+	// then to the yen.
+	if got := p.Positions["7203"].CostBasis; got != portfolio.NewDecimal(7501) {
+		t.Fatalf("7203 cost=%v want 7501", got)
+	}
+	aapl := p.Positions["AAPL"]
+	if aapl.LocalCostBasis != portfolio.NewDecimal(190.56) || aapl.CostBasis != portfolio.NewDecimal(28820) {
+		t.Fatalf("AAPL local=%v cost=%v", aapl.LocalCostBasis, aapl.CostBasis)
+	}
+	if p.Cash != portfolio.NewDecimal(100000-7501-28820) {
+		t.Fatalf("Cash=%v", p.Cash)
+	}
+}
+
+func TestLoadMigratesFloatPortfolio(t *testing.T) {
+	dir := t.TempDir()
+	legacy := `{
+  "name": "legacy",
+  "cash": 900.0000010000001,
+  "positions": {
+    "ABC": {"ticker": "ABC", "shares": 3, "cost_basis": 99.99999899999999, "current_price": 34, "peak_price": 34}
+  },
+  "realized_pnl": 0,
+  "transactions": [
+    {"id": "tx-1", "type": "deposit", "date": "2024-01-02T00:00:00Z", "amount": 1000, "currency": "USD", "fx_rate": 1},
+    {"id": "tx-2", "type": "buy", "ticker": "ABC", "date": "2024-01-02T00:00:00Z", "quantity": 3, "price": 33.333333, "currency": "USD", "fx_rate": 1}
+  ]
+}`
+	if err := os.WriteFile(filepath.Join(dir, "legacy.json"), []byte(legacy), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	store := storage.NewFilePortfolioStore(dir)
+	p, err := store.Load(context.Background(), "legacy")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if p.Version != portfolio.CurrentVersion {
+		t.Fatalf("Version=%d want %d", p.Version, portfolio.CurrentVersion)
+	}
+	if p.Cash != portfolio.NewDecimal(900) || p.Positions["ABC"].CostBasis != portfolio.NewDecimal(100) {
+		t.Fatalf("Cash=%v cost=%v", p.Cash, p.Positions["ABC"].CostBasis)
+	}
+	if p.Positions["ABC"].CurrentPrice != 34 {
+		t.Fatalf("migration must keep quotes: %#v", p.Positions["ABC"])
+	}
+}
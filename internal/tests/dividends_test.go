@@ -0,0 +1,198 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"tracktrades/internal/adapters/storage"
+	"tracktrades/internal/app"
+	"tracktrades/internal/domain/portfolio"
+)
+
+type fixedDividends []portfolio.DividendEvent
+
+func (f fixedDividends) Dividends(ctx context.Context, pos *portfolio.Position, since time.Time) ([]portfolio.DividendEvent, error) {
+	var res []portfolio.DividendEvent
+	for _, ev := range f {
+		if ev.Ticker == pos.Ticker && !ev.ExDate.Before(since) {
+			res = append(res, ev)
+		}
+	}
+	return res, nil
+}
+
+func TestCashDividendCreditsCash(t *testing.T) {
+	p := portfolio.New("income", portfolio.NewDecimal(0))
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxDeposit, Date: date("2024-01-02"), Amount: portfolio.NewDecimal(1000)},
+		{Type: portfolio.TxBuy, Ticker: "KO", Date: date("2024-01-02"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(60)},
+		{Type: portfolio.TxDividend, Ticker: "KO", Date: date("2024-03-15"), Amount: portfolio.NewDecimal(4.85)},
+	})
+	pos := p.Positions["KO"]
+	if !approx(p.Cash.Float(), 404.85) || pos.Shares != portfolio.NewDecimal(10) || len(pos.Lots) != 1 {
+		t.Fatalf("Cash=%v position=%#v", p.Cash, pos)
+	}
+}
+
+func TestReinvestedDividendOpensLot(t *testing.T) {
+	p := portfolio.New("income", portfolio.NewDecimal(0))
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxDeposit, Date: date("2024-01-02"), Amount: portfolio.NewDecimal(1000)},
+		{Type: portfolio.TxBuy, Ticker: "KO", Date: date("2024-01-02"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(60)},
+		{Type: portfolio.TxDividend, Ticker: "KO", Date: date("2024-03-15"), Amount: portfolio.NewDecimal(5), Price: portfolio.NewDecimal(62.5), Reinvest: true},
+	})
+	pos := p.Positions["KO"]
+	if !approx(p.Cash.Float(), 400) || !approx(pos.Shares.Float(), 10.08) || !approx(pos.CostBasis.Float(), 605) || len(pos.Lots) != 2 {
+		t.Fatalf("Cash=%v position=%#v", p.Cash, pos)
+	}
+	if lot := pos.Lots[1]; !lot.Acquired.Equal(date("2024-03-15")) || !approx(lot.Quantity.Float(), 0.08) {
+		t.Fatalf("unexpected reinvested lot: %#v", lot)
+	}
+
+	// Buying fewer shares than the dividend pays for leaves the rest in cash.
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxDividend, Ticker: "KO", Date: date("2024-06-14"), Amount: portfolio.NewDecimal(5), Price: portfolio.NewDecimal(60), Quantity: portfolio.NewDecimal(0.05), Reinvest: true},
+	})
+	if !approx(p.Cash.Float(), 402) || !approx(p.Positions["KO"].Shares.Float(), 10.13) {
+		t.Fatalf("Cash=%v Shares=%v", p.Cash, p.Positions["KO"].Shares)
+	}
+}
+
+func TestStockDividendRescalesLotsAndPrice(t *testing.T) {
+	p := portfolio.New("income", portfolio.NewDecimal(0))
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxDeposit, Date: date("2024-01-02"), Amount: portfolio.NewDecimal(1000)},
+		{Type: portfolio.TxBuy, Ticker: "ABC", Date: date("2024-01-02"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(50)},
+		{Type: portfolio.TxStockDividend, Ticker: "ABC", Date: date("2024-05-01"), Quantity: portfolio.NewDecimal(2)},
+	})
+	pos := p.Positions["ABC"]
+	if !approx(pos.Shares.Float(), 12) || !approx(pos.CostBasis.Float(), 500) || !approx(pos.CurrentPrice, 50/1.2) || !approx(p.Cash.Float(), 500) {
+		t.Fatalf("Cash=%v position=%#v", p.Cash, pos)
+	}
+	if lot := pos.Lots[0]; !approx(lot.Quantity.Float(), 12) || !lot.Acquired.Equal(date("2024-01-02")) {
+		t.Fatalf("unexpected lot: %#v", lot)
+	}
+}
+
+func TestPositionDetailsDividendYields(t *testing.T) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	p := portfolio.New("income", portfolio.NewDecimal(0))
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxDeposit, Date: today.AddDate(-2, 0, 0), Amount: portfolio.NewDecimal(2000)},
+		{Type: portfolio.TxBuy, Ticker: "KO", Date: today.AddDate(-2, 0, 0), Quantity: portfolio.NewDecimal(20), Price: portfolio.NewDecimal(50)},
+		{Type: portfolio.TxDividend, Ticker: "KO", Date: today.AddDate(0, -14, 0), Amount: portfolio.NewDecimal(30)},
+		{Type: portfolio.TxDividend, Ticker: "KO", Date: today.AddDate(0, -6, 0), Amount: portfolio.NewDecimal(20)},
+		{Type: portfolio.TxDividend, Ticker: "KO", Date: today.AddDate(0, -1, 0), Amount: portfolio.NewDecimal(20)},
+	})
+	p.Positions["KO"].UpdatePrice(80)
+
+	d, ok := p.PositionDetails("KO")
+	if !ok {
+		t.Fatal("KO not found")
+	}
+	if d.DividendsTotal != portfolio.NewDecimal(70) || d.DividendsTTM != portfolio.NewDecimal(40) {
+		t.Fatalf("Total=%v TTM=%v", d.DividendsTotal, d.DividendsTTM)
+	}
+	if !approx(d.YieldOnCostPct, 4) || !approx(d.CurrentYieldPct, 2.5) {
+		t.Fatalf("YieldOnCost=%v CurrentYield=%v", d.YieldOnCostPct, d.CurrentYieldPct)
+	}
+}
+
+func TestIncomeSummaryByTickerAndMonth(t *testing.T) {
+	p := portfolio.New("income", portfolio.NewDecimal(0))
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxDeposit, Date: date("2023-01-02"), Amount: portfolio.NewDecimal(5000)},
+		{Type: portfolio.TxBuy, Ticker: "KO", Date: date("2023-01-02"), Quantity: portfolio.NewDecimal(20), Price: portfolio.NewDecimal(50)},
+		{Type: portfolio.TxBuy, Ticker: "PEP", Date: date("2023-01-02"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(100)},
+		{Type: portfolio.TxDividend, Ticker: "KO", Date: date("2023-12-15"), Amount: portfolio.NewDecimal(9)},
+		{Type: portfolio.TxDividend, Ticker: "KO", Date: date("2024-03-15"), Amount: portfolio.NewDecimal(10)},
+		{Type: portfolio.TxDividend, Ticker: "PEP", Date: date("2024-03-29"), Amount: portfolio.NewDecimal(12)},
+		{Type: portfolio.TxDividend, Ticker: "KO", Date: date("2024-06-14"), Amount: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(50), Reinvest: true},
+	})
+
+	s := p.IncomeSummary(date("2024-01-01"), date("2024-12-31"))
+	if !approx(s.Total, 32) || !approx(s.Reinvested, 10) || !approx(s.TTM, 32) {
+		t.Fatalf("Total=%v Reinvested=%v TTM=%v", s.Total, s.Reinvested, s.TTM)
+	}
+	if len(s.ByMonth) != 2 || s.ByMonth[0].Month != "2024-03" || !approx(s.ByMonth[0].Amount, 22) || !approx(s.ByMonth[1].Amount, 10) {
+		t.Fatalf("ByMonth=%#v", s.ByMonth)
+	}
+	if len(s.ByTicker) != 2 || s.ByTicker[0].Ticker != "KO" || !approx(s.ByTicker[0].Total, 20) || !approx(s.ByTicker[0].YieldOnCostPct, 20.0/1010*100) {
+		t.Fatalf("ByTicker=%#v", s.ByTicker)
+	}
+	if !approx(s.YieldOnCostPct, 32.0/2010*100) {
+		t.Fatalf("YieldOnCost=%v", s.YieldOnCostPct)
+	}
+}
+
+func TestDividendTransactionsFromEvents(t *testing.T) {
+	p := portfolio.New("income", portfolio.NewDecimal(0))
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxDeposit, Date: date("2024-01-02"), Amount: portfolio.NewDecimal(5000)},
+		{Type: portfolio.TxBuy, Ticker: "KO", Date: date("2024-01-02"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(60)},
+		{Type: portfolio.TxBuy, Ticker: "KO", Date: date("2024-03-14"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(60)},
+		{Type: portfolio.TxShort, Ticker: "T", Date: date("2024-01-02"), Quantity: portfolio.NewDecimal(100), Price: portfolio.NewDecimal(17)},
+		{Type: portfolio.TxDividend, Ticker: "KO", Date: date("2024-06-14"), Amount: portfolio.NewDecimal(9.70)},
+	})
+
+	txs := p.DividendTransactions([]portfolio.DividendEvent{
+		{Ticker: "KO", ExDate: date("2024-06-14"), PerShare: 0.485, Price: 62},
+		{Ticker: "KO", ExDate: date("2024-03-14"), PerShare: 0.485, Price: 60},
+		{Ticker: "T", ExDate: date("2024-04-09"), PerShare: 0.2775},
+	}, true)
+	if len(txs) != 2 {
+		t.Fatalf("txs=%#v", txs)
+	}
+	// Shares bought on the ex-date do not receive the dividend.
+	if tx := txs[0]; tx.Type != portfolio.TxDividend || tx.Amount != portfolio.NewDecimal(4.85) || !tx.Reinvest || tx.Price != portfolio.NewDecimal(60) {
+		t.Fatalf("unexpected KO dividend: %#v", tx)
+	}
+	if tx := txs[1]; tx.Type != portfolio.TxFee || tx.Ticker != "T" || tx.Amount != portfolio.NewDecimal(27.75) {
+		t.Fatalf("unexpected short dividend: %#v", tx)
+	}
+}
+
+func TestImportDividendsReinvestsEachEvent(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryPortfolioStore()
+	events := fixedDividends{
+		{Ticker: "KO", ExDate: date("2023-12-01"), PerShare: 0.46, Price: 58},
+		{Ticker: "KO", ExDate: date("2024-03-14"), PerShare: 0.5, Price: 50},
+		{Ticker: "KO", ExDate: date("2024-06-14"), PerShare: 0.5, Price: 50},
+	}
+	svc := app.NewPortfolioService(store, nopPricer{}, app.WithDividendImport(events))
+	if _, err := svc.CreatePortfolio(ctx, "p", portfolio.NewDecimal(0)); err != nil {
+		t.Fatal(err)
+	}
+	for _, tx := range []portfolio.Transaction{
+		{Type: portfolio.TxDeposit, Date: date("2024-01-02"), Amount: portfolio.NewDecimal(1000)},
+		{Type: portfolio.TxBuy, Ticker: "KO", Date: date("2024-01-02"), Quantity: portfolio.NewDecimal(100), Price: portfolio.NewDecimal(5)},
+	} {
+		if _, err := svc.RecordTransaction(ctx, "p", tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := svc.SetDividendReinvestment(ctx, "p", true); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		recorded, err := svc.ImportDividends(ctx, "p", time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := 2 - 2*i; len(recorded) != want {
+			t.Fatalf("run %d recorded %d dividends, want %d: %#v", i, len(recorded), want, recorded)
+		}
+	}
+	// The second dividend is also paid on the shares the first one bought.
+	pos, ok, err := svc.GetPosition(ctx, "p", "KO")
+	if err != nil || !ok || !approx(pos.Shares.Float(), 102.01) {
+		t.Fatalf("pos=%#v ok=%v err=%v", pos, ok, err)
+	}
+	income, err := svc.GetIncome(ctx, "p", date("2024-01-01"), date("2024-12-31"))
+	if err != nil || !approx(income.Total, 100.5) || !approx(income.Reinvested, 100.5) {
+		t.Fatalf("income=%#v err=%v", income, err)
+	}
+}
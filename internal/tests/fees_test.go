@@ -0,0 +1,126 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+
+	"tracktrades/internal/domain/portfolio"
+)
+
+func feePortfolio(t *testing.T) *portfolio.Portfolio {
+	t.Helper()
+	p := portfolio.New("fees", portfolio.NewDecimal(0))
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxDeposit, Date: date("2024-01-02"), Amount: portfolio.NewDecimal(10000)},
+		{Type: portfolio.TxBuy, Ticker: "AAA", Date: date("2024-01-02"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(100), Commission: portfolio.NewDecimal(5), ExchangeFee: portfolio.NewDecimal(0.3)},
+		{Type: portfolio.TxSell, Ticker: "AAA", Date: date("2024-03-01"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(120), Commission: portfolio.NewDecimal(5), RegulatoryFee: portfolio.NewDecimal(0.25)},
+		{Type: portfolio.TxShort, Ticker: "BBB", Date: date("2024-03-04"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(50), Commission: portfolio.NewDecimal(1)},
+		{Type: portfolio.TxCover, Ticker: "BBB", Date: date("2024-04-01"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(40), Commission: portfolio.NewDecimal(1)},
+		{Type: portfolio.TxFee, Date: date("2024-04-30"), Amount: portfolio.NewDecimal(25), Note: "platform fee"},
+		{Type: portfolio.TxFee, Ticker: "AAA", Date: date("2024-05-02"), Amount: portfolio.NewDecimal(2), Note: "ADR custody fee"},
+	})
+	return p
+}
+
+func TestTradeFeesFoldIntoBasisAndProceeds(t *testing.T) {
+	p := portfolio.New("fees", portfolio.NewDecimal(0))
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxDeposit, Date: date("2024-01-02"), Amount: portfolio.NewDecimal(10000)},
+		{Type: portfolio.TxBuy, Ticker: "AAA", Date: date("2024-01-02"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(100), Commission: portfolio.NewDecimal(5), ExchangeFee: portfolio.NewDecimal(0.3)},
+	})
+	if got := p.Positions["AAA"].CostBasis; got != portfolio.NewDecimal(1005.3) {
+		t.Fatalf("cost=%v want 1005.3", got)
+	}
+	if p.Cash != portfolio.NewDecimal(8994.7) {
+		t.Fatalf("Cash=%v want 8994.7", p.Cash)
+	}
+
+	p = feePortfolio(t)
+	sales, err := p.Sales("")
+	if err != nil || len(sales) != 2 {
+		t.Fatalf("sales=%#v err=%v", sales, err)
+	}
+	// Sell proceeds are net of fees; a cover's buy-back cost includes them and
+	// the short's proceeds are net of the fee paid to open it.
+	if sales[0].Proceeds != portfolio.NewDecimal(1194.75) || sales[0].Gain != portfolio.NewDecimal(189.45) {
+		t.Fatalf("sell=%#v", sales[0])
+	}
+	if sales[1].Proceeds != portfolio.NewDecimal(499) || sales[1].CostBasis != portfolio.NewDecimal(401) || sales[1].Gain != portfolio.NewDecimal(98) {
+		t.Fatalf("cover=%#v", sales[1])
+	}
+	if p.Cash != portfolio.NewDecimal(10000+189.45+98-27) {
+		t.Fatalf("Cash=%v", p.Cash)
+	}
+
+	for _, tx := range []portfolio.Transaction{
+		{Type: portfolio.TxDeposit, Date: date("2024-06-03"), Amount: portfolio.NewDecimal(100), Commission: portfolio.NewDecimal(1)},
+		{Type: portfolio.TxBuy, Ticker: "AAA", Date: date("2024-06-03"), Quantity: portfolio.NewDecimal(1), Price: portfolio.NewDecimal(100), RegulatoryFee: portfolio.NewDecimal(-1)},
+	} {
+		if _, err := p.Record(tx); !errors.Is(err, portfolio.ErrInvalidTransaction) {
+			t.Fatalf("%s: err=%v want ErrInvalidTransaction", tx.Type, err)
+		}
+	}
+}
+
+func TestForeignTradeFeesConvertToBase(t *testing.T) {
+	p := portfolio.New("fx-fees", portfolio.NewDecimal(0))
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxDeposit, Date: date("2024-01-02"), Amount: portfolio.NewDecimal(5000)},
+		{Type: portfolio.TxBuy, Ticker: "SAP", Date: date("2024-01-02"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(180), Commission: portfolio.NewDecimal(4), Currency: "EUR", FXRate: portfolio.NewDecimal(1.1)},
+	})
+	pos := p.Positions["SAP"]
+	if pos.LocalCostBasis != portfolio.NewDecimal(1804) || pos.CostBasis != portfolio.NewDecimal(1984.4) {
+		t.Fatalf("local=%v cost=%v", pos.LocalCostBasis, pos.CostBasis)
+	}
+	report := p.FeeReport(date("2024-01-01"), date("2024-12-31"))
+	if report.Commission != portfolio.NewDecimal(4.4) || report.TradedNotional != portfolio.NewDecimal(1980) {
+		t.Fatalf("report=%#v", report)
+	}
+}
+
+func TestFeeReportByPositionAndPeriod(t *testing.T) {
+	p := feePortfolio(t)
+
+	report := p.FeeReport(date("2024-01-01"), date("2024-12-31"))
+	if report.Commission != portfolio.NewDecimal(12) || report.Exchange != portfolio.NewDecimal(0.3) ||
+		report.Regulatory != portfolio.NewDecimal(0.25) || report.Account != portfolio.NewDecimal(27) ||
+		report.Total != portfolio.NewDecimal(39.55) {
+		t.Fatalf("report=%#v", report.FeeBreakdown)
+	}
+	if report.Trades != 4 || report.TradedNotional != portfolio.NewDecimal(3100) || !approx(report.PctOfTraded, 12.55/3100*100) {
+		t.Fatalf("trades=%d notional=%v pct=%v", report.Trades, report.TradedNotional, report.PctOfTraded)
+	}
+	// Without stored history the drag is measured against the current value.
+	if !approx(report.AverageValue, p.TotalValue().Float()) || !approx(report.DragPct, 39.55/p.TotalValue().Float()*100) {
+		t.Fatalf("average=%v drag=%v", report.AverageValue, report.DragPct)
+	}
+
+	if len(report.Positions) != 2 {
+		t.Fatalf("positions=%#v", report.Positions)
+	}
+	aaa, bbb := report.Positions[0], report.Positions[1]
+	if aaa.Ticker != "AAA" || aaa.Total != portfolio.NewDecimal(12.55) || aaa.Account != portfolio.NewDecimal(2) ||
+		aaa.Trades != 2 || !approx(aaa.PctOfTraded, 10.55/2200*100) {
+		t.Fatalf("AAA=%#v", aaa)
+	}
+	if bbb.Ticker != "BBB" || bbb.Total != portfolio.NewDecimal(2) || bbb.TradedNotional != portfolio.NewDecimal(900) {
+		t.Fatalf("BBB=%#v", bbb)
+	}
+
+	spring := p.FeeReport(date("2024-03-02"), date("2024-04-30"))
+	if spring.Trades != 2 || spring.Total != portfolio.NewDecimal(27) || len(spring.Positions) != 1 {
+		t.Fatalf("spring=%#v", spring)
+	}
+}
+
+func TestShortDividendIsNotAFee(t *testing.T) {
+	p := portfolio.New("short-div", portfolio.NewDecimal(0))
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxDeposit, Date: date("2024-01-02"), Amount: portfolio.NewDecimal(1000)},
+		{Type: portfolio.TxShort, Ticker: "XYZ", Date: date("2024-01-02"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(20)},
+	})
+	recordAll(t, p, p.DividendTransactions([]portfolio.DividendEvent{{Ticker: "XYZ", ExDate: date("2024-02-01"), PerShare: 0.5}}, false))
+	if report := p.FeeReport(date("2024-01-01"), date("2024-12-31")); !report.Total.IsZero() {
+		t.Fatalf("report=%#v", report)
+	}
+}
@@ -0,0 +1,82 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"tracktrades/internal/adapters/storage"
+	"tracktrades/internal/app"
+	"tracktrades/internal/domain/portfolio"
+)
+
+func TestSnapshotsMergeWithinDayAndKeepHigh(t *testing.T) {
+	p := portfolio.New("hist", portfolio.NewDecimal(0))
+	pos := &portfolio.Position{Ticker: "AAPL", Shares: portfolio.NewDecimal(10), CurrentPrice: 100}
+	p.AddPosition(pos)
+
+	day := date("2024-05-01")
+	p.RecordSnapshot(day.Add(10*time.Hour), false)
+	pos.CurrentPrice = 120
+	p.RecordSnapshot(day.Add(12*time.Hour), false)
+	pos.CurrentPrice = 90
+	p.RecordSnapshot(day.Add(16*time.Hour), true)
+	pos.CurrentPrice = 95
+	p.RecordSnapshot(day.Add(24*time.Hour+10*time.Hour), false)
+
+	if len(p.History) != 2 {
+		t.Fatalf("History=%d want 2", len(p.History))
+	}
+	if p.History[0].Value != portfolio.NewDecimal(900) || p.History[0].High != portfolio.NewDecimal(1200) || !p.History[0].Close {
+		t.Fatalf("unexpected close snapshot: %#v", p.History[0])
+	}
+	if p.HighWaterMark() != portfolio.NewDecimal(1200) {
+		t.Fatalf("HighWaterMark=%v want 1200", p.HighWaterMark())
+	}
+
+	curve := p.EquityCurve(day.AddDate(0, 0, 1), day.AddDate(0, 0, 2))
+	if len(curve.Points) != 1 || curve.Points[0].HighWaterMark != 1200 {
+		t.Fatalf("unexpected curve: %#v", curve)
+	}
+	if dd := curve.Points[0].DrawdownFromPeakPct; dd < 20.8 || dd > 20.9 {
+		t.Fatalf("DrawdownFromPeakPct=%v want ~20.83", dd)
+	}
+}
+
+func TestPriceRefreshPersistsHighWaterMark(t *testing.T) {
+	storeInfo, err := storage.NewPortfolioStore("memory")
+	if err != nil {
+		t.Fatalf("NewPortfolioStore memory: %v", err)
+	}
+	svc := app.NewPortfolioService(storeInfo.Store, bumpPricer{})
+	ctx := context.Background()
+
+	if _, err := svc.CreatePortfolio(ctx, "hist", portfolio.NewDecimal(0)); err != nil {
+		t.Fatalf("CreatePortfolio: %v", err)
+	}
+	if err := svc.AddOrUpdatePosition(ctx, "hist", &portfolio.Position{Ticker: "AAPL", Shares: portfolio.NewDecimal(1), CurrentPrice: 100}); err != nil {
+		t.Fatalf("AddOrUpdatePosition: %v", err)
+	}
+	if err := svc.UpdateAllPrices(ctx, "hist"); err != nil {
+		t.Fatalf("UpdateAllPrices: %v", err)
+	}
+	if err := svc.RecordDailyClose(ctx, "hist"); err != nil {
+		t.Fatalf("RecordDailyClose: %v", err)
+	}
+
+	curve, err := svc.GetHistory(ctx, "hist", time.Now().AddDate(0, 0, -1), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	if len(curve.Points) != 1 || curve.HighWaterMark != 102 {
+		t.Fatalf("unexpected curve: %#v", curve)
+	}
+
+	m, err := svc.GetMetrics(ctx, "hist")
+	if err != nil {
+		t.Fatalf("GetMetrics: %v", err)
+	}
+	if m.HighWaterMark != portfolio.NewDecimal(102) {
+		t.Fatalf("HighWaterMark=%v want 102", m.HighWaterMark)
+	}
+}
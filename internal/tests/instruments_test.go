@@ -0,0 +1,166 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tracktrades/internal/adapters/storage"
+	"tracktrades/internal/app"
+	"tracktrades/internal/domain/portfolio"
+)
+
+func TestSetInstrumentAttachesToPosition(t *testing.T) {
+	p := portfolio.New("instruments", portfolio.NewDecimal(0))
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxDeposit, Date: date("2024-01-02"), Amount: portfolio.NewDecimal(10000)},
+		{Type: portfolio.TxBuy, Ticker: "AMDUSD", Date: date("2024-01-02"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(150)},
+	})
+	if pos := p.Positions["AMDUSD"]; pos.IsCrypto() || pos.Instrument != nil {
+		t.Fatalf("unregistered ticker must not be crypto: %#v", pos)
+	}
+
+	inst, err := p.SetInstrument(portfolio.Instrument{Ticker: "ethbtc", AssetClass: portfolio.AssetCrypto, Currency: "btc"})
+	if err != nil || inst.Ticker != "ETHBTC" || inst.Currency != "BTC" {
+		t.Fatalf("inst=%#v err=%v", inst, err)
+	}
+	// New trades in a registered ticker default to its quote currency, and
+	// the definition survives the ledger replay.
+	tx, err := p.Record(portfolio.Transaction{Type: portfolio.TxBuy, Ticker: "ETHBTC", Date: date("2024-01-03"), Quantity: portfolio.NewDecimal(2), Price: portfolio.NewDecimal(0.05), FXRate: portfolio.NewDecimal(45000)})
+	if err != nil || tx.Currency != "BTC" {
+		t.Fatalf("tx=%#v err=%v", tx, err)
+	}
+	pos := p.Positions["ETHBTC"]
+	if !pos.IsCrypto() || pos.QuoteCurrency() != "BTC" {
+		t.Fatalf("unexpected ETHBTC position: %#v", pos)
+	}
+	if d, _ := p.PositionDetails("ETHBTC"); d.AssetClass != portfolio.AssetCrypto {
+		t.Fatalf("AssetClass=%v", d.AssetClass)
+	}
+
+	if !p.RemoveInstrument("ETHBTC") || p.Positions["ETHBTC"].IsCrypto() {
+		t.Fatalf("instrument should be detached: %#v", p.Positions["ETHBTC"])
+	}
+	if _, err := p.SetInstrument(portfolio.Instrument{Ticker: "X", AssetClass: "warrant"}); !errors.Is(err, portfolio.ErrInvalidInstrument) {
+		t.Fatalf("err=%v want ErrInvalidInstrument", err)
+	}
+}
+
+func TestRebalanceUsesRegisteredAssetClass(t *testing.T) {
+	p := portfolio.New("instruments", portfolio.NewDecimal(1000))
+	p.AddPosition(&portfolio.Position{Ticker: "BTCUSD", Shares: portfolio.NewDecimal(0.1), CostBasis: portfolio.NewDecimal(4000), CurrentPrice: 40000})
+	p.AddPosition(&portfolio.Position{Ticker: "VTI", Shares: portfolio.NewDecimal(10), CostBasis: portfolio.NewDecimal(2000), CurrentPrice: 200})
+	p.Targets = []portfolio.AllocationTarget{{Ticker: "BTCUSD", WeightPct: 50}, {Ticker: "VTI", WeightPct: 50}}
+
+	trades := tradesByTicker(p.RebalancePlan(portfolio.RebalanceOptions{}))
+	if tr := trades["BTCUSD"]; !tr.Quantity.IsZero() {
+		t.Fatalf("unregistered BTCUSD should trade whole shares: %#v", tr)
+	}
+	if tr := trades["VTI"]; tr.Type != portfolio.TxBuy || tr.Quantity != portfolio.NewDecimal(7) {
+		t.Fatalf("unexpected VTI trade: %#v", tr)
+	}
+
+	if _, err := p.SetInstrument(portfolio.Instrument{Ticker: "BTCUSD", AssetClass: portfolio.AssetCrypto}); err != nil {
+		t.Fatal(err)
+	}
+	trades = tradesByTicker(p.RebalancePlan(portfolio.RebalanceOptions{}))
+	if tr := trades["BTCUSD"]; tr.Type != portfolio.TxSell || !approx(tr.Quantity.Float(), 0.0125) {
+		t.Fatalf("unexpected BTCUSD trade: %#v", tr)
+	}
+}
+
+func TestInstrumentRegistryPersists(t *testing.T) {
+	ctx := context.Background()
+	svc := app.NewPortfolioService(storage.NewMemoryPortfolioStore(), nopPricer{})
+	if _, err := svc.CreatePortfolio(ctx, "p", portfolio.NewDecimal(0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.AddOrUpdatePosition(ctx, "p", &portfolio.Position{Ticker: "VOD", Shares: portfolio.NewDecimal(100), CostBasis: portfolio.NewDecimal(90), CurrentPrice: 0.7}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.SetInstrument(ctx, "p", portfolio.Instrument{
+		Ticker: "VOD", Exchange: "lse", Currency: "GBP", Symbols: map[string]string{"AlphaVantage": "VOD.LON"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := svc.ListInstruments(ctx, "p")
+	if err != nil || len(list) != 1 || list[0].AssetClass != portfolio.AssetEquity || list[0].Exchange != "LSE" || list[0].Symbol("alphavantage") != "VOD.LON" {
+		t.Fatalf("list=%#v err=%v", list, err)
+	}
+	pos, ok, err := svc.GetPosition(ctx, "p", "VOD")
+	if err != nil || !ok || pos.AssetClass != portfolio.AssetEquity {
+		t.Fatalf("pos=%#v ok=%v err=%v", pos, ok, err)
+	}
+
+	if err := svc.RemoveInstrument(ctx, "p", "VOD"); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.RemoveInstrument(ctx, "p", "VOD"); !errors.Is(err, portfolio.ErrInvalidInstrument) {
+		t.Fatalf("err=%v want ErrInvalidInstrument", err)
+	}
+}
+
+func TestLoadRegistersLegacyCryptoPairs(t *testing.T) {
+	dir := t.TempDir()
+	legacy := `{
+  "name": "legacy",
+  "version": 1,
+  "cash": 100,
+  "positions": {
+    "BTCUSD": {"ticker": "BTCUSD", "shares": 0.5, "cost_basis": 20000, "current_price": 40000},
+    "ETHUSD": {"ticker": "ETHUSD", "shares": 2, "cost_basis": 4000, "current_price": 2000},
+    "MSFT": {"ticker": "MSFT", "shares": 1, "cost_basis": 300, "current_price": 300}
+  },
+  "instruments": {"ETHUSD": {"ticker": "ETHUSD", "asset_class": "equity"}}
+}`
+	if err := os.WriteFile(filepath.Join(dir, "legacy.json"), []byte(legacy), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	store := storage.NewFilePortfolioStore(dir)
+	ctx := context.Background()
+	p, err := store.Load(ctx, "legacy")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if p.Version != portfolio.CurrentVersion {
+		t.Fatalf("Version=%d want %d", p.Version, portfolio.CurrentVersion)
+	}
+	if inst, ok := p.Instrument("BTCUSD"); !ok || inst.AssetClass != portfolio.AssetCrypto || inst.Currency != "USD" {
+		t.Fatalf("BTCUSD instrument=%#v ok=%v", inst, ok)
+	}
+	if !p.Positions["BTCUSD"].IsCrypto() {
+		t.Fatal("legacy BTCUSD position should keep quoting as crypto")
+	}
+	if p.Positions["ETHUSD"].IsCrypto() || p.Positions["MSFT"].IsCrypto() {
+		t.Fatal("an existing definition and non-USD tickers must be left alone")
+	}
+	if _, ok := p.Instrument("MSFT"); ok {
+		t.Fatal("MSFT should not be registered")
+	}
+
+	// The registry alone is stored; positions get their definition on load.
+	if err := store.Save(ctx, "legacy", p); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "legacy.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw struct {
+		Positions map[string]map[string]json.RawMessage `json:"positions"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := raw.Positions["BTCUSD"]["instrument"]; ok {
+		t.Fatalf("instrument persisted on the position: %s", raw.Positions["BTCUSD"]["instrument"])
+	}
+	again, err := store.Load(ctx, "legacy")
+	if err != nil || !again.Positions["BTCUSD"].IsCrypto() {
+		t.Fatalf("reload err=%v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"tracktrades/internal/adapters/storage"
+	"tracktrades/internal/app"
+	"tracktrades/internal/domain/portfolio"
+)
+
+func journalPortfolio(t *testing.T) *portfolio.Portfolio {
+	t.Helper()
+	p := portfolio.New("journal", portfolio.NewDecimal(0))
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxDeposit, Date: date("2024-01-02"), Amount: portfolio.NewDecimal(5000)},
+		{Type: portfolio.TxBuy, Ticker: "AAA", Date: date("2024-01-02"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(100), Tags: []string{" Swing "}, Strategy: "Breakout"},
+		{Type: portfolio.TxSell, Ticker: "AAA", Date: date("2024-02-01"), Quantity: portfolio.NewDecimal(5), Price: portfolio.NewDecimal(120), Note: "took half off"},
+		{Type: portfolio.TxBuy, Ticker: "BBB", Date: date("2024-01-05"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(50), Tags: []string{"swing", "earnings-play"}},
+		{Type: portfolio.TxSell, Ticker: "BBB", Date: date("2024-02-05"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(40)},
+		{Type: portfolio.TxBuy, Ticker: "CCC", Date: date("2024-03-01"), Quantity: portfolio.NewDecimal(4), Price: portfolio.NewDecimal(25)},
+	})
+	p.Positions["AAA"].UpdatePrice(110)
+	p.Positions["CCC"].UpdatePrice(30)
+	if _, err := p.AnnotatePosition("CCC", portfolio.JournalNote{Note: "earnings next week", Tags: []string{"earnings-play"}}); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestJournalFiltersByTagAndStrategy(t *testing.T) {
+	p := journalPortfolio(t)
+
+	entries := p.Journal(portfolio.JournalFilter{Tag: "SWING"})
+	if len(entries) != 2 || entries[0].Ticker != "AAA" || entries[1].Ticker != "BBB" || entries[0].Tags[0] != "swing" {
+		t.Fatalf("swing entries=%#v", entries)
+	}
+	entries = p.Journal(portfolio.JournalFilter{Tag: "earnings-play"})
+	if len(entries) != 2 || entries[1].Kind != portfolio.JournalPosition || entries[1].Note != "earnings next week" {
+		t.Fatalf("earnings entries=%#v", entries)
+	}
+	if entries := p.Journal(portfolio.JournalFilter{Strategy: "breakout"}); len(entries) != 1 || entries[0].Type != portfolio.TxBuy {
+		t.Fatalf("breakout entries=%#v", entries)
+	}
+	// Untagged trades with a note are still journal entries.
+	if entries := p.Journal(portfolio.JournalFilter{Ticker: "AAA"}); len(entries) != 2 || entries[1].Note != "took half off" {
+		t.Fatalf("AAA entries=%#v", entries)
+	}
+
+	if _, err := p.AnnotateTransaction("tx-99", portfolio.JournalNote{Note: "x"}); !errors.Is(err, portfolio.ErrInvalidJournal) {
+		t.Fatalf("err=%v want ErrInvalidJournal", err)
+	}
+}
+
+func TestJournalBreakdownByTagAndStrategy(t *testing.T) {
+	p := journalPortfolio(t)
+
+	byTag, err := p.JournalBreakdown(portfolio.GroupByTag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byTag.Groups) != 2 {
+		t.Fatalf("groups=%#v", byTag.Groups)
+	}
+	earnings, swing := byTag.Groups[0], byTag.Groups[1]
+	// AAA won 100 and BBB lost 100; five AAA shares are still open at +10.
+	if swing.Name != "swing" || swing.Trades != 2 || swing.Wins != 1 || swing.Losses != 1 || !approx(swing.WinRatePct, 50) ||
+		!swing.RealizedPnL.IsZero() || swing.UnrealizedPnL != portfolio.NewDecimal(50) || swing.OpenPositions != 1 {
+		t.Fatalf("swing=%#v", swing)
+	}
+	if earnings.Name != "earnings-play" || earnings.Trades != 1 || earnings.Losses != 1 || earnings.WinRatePct != 0 ||
+		earnings.RealizedPnL != portfolio.NewDecimal(-100) || earnings.UnrealizedPnL != portfolio.NewDecimal(20) || earnings.OpenPositions != 1 {
+		t.Fatalf("earnings=%#v", earnings)
+	}
+
+	byStrategy, err := p.JournalBreakdown(portfolio.GroupByStrategy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byStrategy.Groups) != 1 || byStrategy.Groups[0].Name != "breakout" || byStrategy.Groups[0].Wins != 1 ||
+		byStrategy.Groups[0].RealizedPnL != portfolio.NewDecimal(100) {
+		t.Fatalf("strategies=%#v", byStrategy.Groups)
+	}
+}
+
+func TestJournalPersistsAcrossStores(t *testing.T) {
+	dir := t.TempDir()
+	for _, spec := range []string{
+		"memory",
+		"file:" + filepath.Join(dir, "file"),
+		"gzip:" + filepath.Join(dir, "gzip"),
+		"sqlite:" + filepath.Join(dir, "journal.db"),
+	} {
+		storeInfo, err := storage.NewPortfolioStore(spec)
+		if err != nil {
+			t.Fatalf("NewPortfolioStore %s: %v", spec, err)
+		}
+		svc := app.NewPortfolioService(storeInfo.Store, nopPricer{})
+		ctx := context.Background()
+		if _, err := svc.CreatePortfolio(ctx, "book", portfolio.NewDecimal(1000)); err != nil {
+			t.Fatalf("%s CreatePortfolio: %v", spec, err)
+		}
+		tx, err := svc.RecordTransaction(ctx, "book", portfolio.Transaction{Type: portfolio.TxBuy, Ticker: "AAPL", Date: date("2024-01-02"), Quantity: portfolio.NewDecimal(2), Price: portfolio.NewDecimal(150)})
+		if err != nil {
+			t.Fatalf("%s RecordTransaction: %v", spec, err)
+		}
+		if _, err := svc.AnnotateTransaction(ctx, "book", tx.ID, portfolio.JournalNote{Tags: []string{"swing"}, Strategy: "pullback"}); err != nil {
+			t.Fatalf("%s AnnotateTransaction: %v", spec, err)
+		}
+		if _, err := svc.AnnotatePosition(ctx, "book", "AAPL", portfolio.JournalNote{Note: "core holding", Tags: []string{"core"}}); err != nil {
+			t.Fatalf("%s AnnotatePosition: %v", spec, err)
+		}
+
+		entries, err := svc.GetJournal(ctx, "book", portfolio.JournalFilter{})
+		if err != nil || len(entries) != 2 || entries[1].Strategy != "pullback" {
+			t.Fatalf("%s entries=%#v err=%v", spec, entries, err)
+		}
+		detail, ok, err := svc.GetPosition(ctx, "book", "AAPL")
+		if err != nil || !ok || detail.Note != "core holding" || len(detail.Tags) != 1 || detail.Tags[0] != "core" {
+			t.Fatalf("%s detail=%#v ok=%v err=%v", spec, detail, ok, err)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tracktrades/internal/adapters/storage"
+	"tracktrades/internal/app"
+	"tracktrades/internal/domain/portfolio"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func TestLedgerReplayDerivesPositionsAndCash(t *testing.T) {
+	p := portfolio.New("ledger", portfolio.NewDecimal(0))
+
+	txs := []portfolio.Transaction{
+		{Type: portfolio.TxDeposit, Date: date("2024-01-01"), Amount: portfolio.NewDecimal(10000)},
+		{Type: portfolio.TxBuy, Ticker: "NVDA", Date: date("2024-01-02"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(100)},
+		{Type: portfolio.TxBuy, Ticker: "NVDA", Date: date("2024-02-01"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(200)},
+		{Type: portfolio.TxSell, Ticker: "NVDA", Date: date("2024-03-01"), Quantity: portfolio.NewDecimal(5), Price: portfolio.NewDecimal(250)},
+		{Type: portfolio.TxDividend, Ticker: "NVDA", Date: date("2024-03-15"), Amount: portfolio.NewDecimal(20)},
+		{Type: portfolio.TxFee, Date: date("2024-03-31"), Amount: portfolio.NewDecimal(5)},
+		{Type: portfolio.TxSplit, Ticker: "NVDA", Date: date("2024-06-10"), Ratio: portfolio.NewDecimal(10)},
+		{Type: portfolio.TxWithdrawal, Date: date("2024-07-01"), Amount: portfolio.NewDecimal(1000)},
+	}
+	for _, tx := range txs {
+		if _, err := p.Record(tx); err != nil {
+			t.Fatalf("Record %s: %v", tx.Type, err)
+		}
+	}
+
+	wantCash := 10000.0 - 1000 - 2000 + 1250 + 20 - 5 - 1000
+	if !approx(p.Cash.Float(), wantCash) {
+		t.Fatalf("Cash=%v want %v", p.Cash, wantCash)
+	}
+
+	pos, ok := p.Positions["NVDA"]
+	if !ok {
+		t.Fatalf("NVDA position not derived")
+	}
+	if !approx(pos.Shares.Float(), 150) {
+		t.Fatalf("Shares=%v want 150", pos.Shares)
+	}
+	if !approx(pos.CostBasis.Float(), 2500) {
+		t.Fatalf("CostBasis=%v want 2500", pos.CostBasis)
+	}
+	if !pos.EntryDate.Equal(date("2024-01-02")) {
+		t.Fatalf("EntryDate=%v want 2024-01-02", pos.EntryDate)
+	}
+	if len(p.Transactions) != len(txs) {
+		t.Fatalf("Transactions=%d want %d", len(p.Transactions), len(txs))
+	}
+}
+
+func TestLedgerRejectsOversell(t *testing.T) {
+	p := portfolio.New("ledger", portfolio.NewDecimal(1000))
+	if _, err := p.Record(portfolio.Transaction{Type: portfolio.TxBuy, Ticker: "AAPL", Date: date("2024-01-02"), Quantity: portfolio.NewDecimal(1), Price: portfolio.NewDecimal(100)}); err != nil {
+		t.Fatalf("Record buy: %v", err)
+	}
+
+	before := len(p.Transactions)
+	_, err := p.Record(portfolio.Transaction{Type: portfolio.TxSell, Ticker: "AAPL", Date: date("2024-01-03"), Quantity: portfolio.NewDecimal(2), Price: portfolio.NewDecimal(100)})
+	if !errors.Is(err, portfolio.ErrInvalidTransaction) {
+		t.Fatalf("expected invalid transaction error, got %v", err)
+	}
+	if len(p.Transactions) != before {
+		t.Fatalf("rejected transaction must not be stored")
+	}
+}
+
+func TestLedgerSeedsOpeningBalances(t *testing.T) {
+	p := portfolio.New("legacy", portfolio.NewDecimal(500))
+	p.AddPosition(&portfolio.Position{Ticker: "MSFT", Shares: portfolio.NewDecimal(2), CostBasis: portfolio.NewDecimal(400), CurrentPrice: 250, EntryDate: date("2023-05-01")})
+
+	if _, err := p.Record(portfolio.Transaction{Type: portfolio.TxSell, Ticker: "MSFT", Date: date("2024-01-02"), Quantity: portfolio.NewDecimal(1), Price: portfolio.NewDecimal(300)}); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+
+	if !approx(p.Cash.Float(), 800) {
+		t.Fatalf("Cash=%v want 800", p.Cash)
+	}
+	pos := p.Positions["MSFT"]
+	if pos == nil || !approx(pos.Shares.Float(), 1) || !approx(pos.CostBasis.Float(), 200) {
+		t.Fatalf("unexpected position after replay: %#v", pos)
+	}
+	if pos.CurrentPrice != 250 {
+		t.Fatalf("market data should survive replay, CurrentPrice=%v", pos.CurrentPrice)
+	}
+}
+
+func TestServiceLedgerPersistsAcrossStores(t *testing.T) {
+	dir := t.TempDir()
+	specs := []string{
+		"memory",
+		"file:" + filepath.Join(dir, "file"),
+		"gzip:" + filepath.Join(dir, "gzip"),
+		"sqlite:" + filepath.Join(dir, "ledger.db"),
+	}
+
+	for _, spec := range specs {
+		storeInfo, err := storage.NewPortfolioStore(spec)
+		if err != nil {
+			t.Fatalf("NewPortfolioStore %s: %v", spec, err)
+		}
+		svc := app.NewPortfolioService(storeInfo.Store, nopPricer{})
+		ctx := context.Background()
+
+		if _, err := svc.CreatePortfolio(ctx, "book", portfolio.NewDecimal(1000)); err != nil {
+			t.Fatalf("%s CreatePortfolio: %v", spec, err)
+		}
+		if _, err := svc.RecordTransaction(ctx, "book", portfolio.Transaction{Type: portfolio.TxBuy, Ticker: "AAPL", Date: date("2024-01-02"), Quantity: portfolio.NewDecimal(4), Price: portfolio.NewDecimal(150)}); err != nil {
+			t.Fatalf("%s RecordTransaction: %v", spec, err)
+		}
+
+		txs, err := svc.ListTransactions(ctx, "book", "AAPL")
+		if err != nil {
+			t.Fatalf("%s ListTransactions: %v", spec, err)
+		}
+		if len(txs) != 1 || txs[0].Quantity != portfolio.NewDecimal(4) {
+			t.Fatalf("%s unexpected transactions: %#v", spec, txs)
+		}
+
+		detail, ok, err := svc.GetPosition(ctx, "book", "AAPL")
+		if err != nil || !ok {
+			t.Fatalf("%s GetPosition: %v ok=%v", spec, err, ok)
+		}
+		if detail.Shares != portfolio.NewDecimal(4) || detail.CostBasis != portfolio.NewDecimal(600) {
+			t.Fatalf("%s unexpected position: %#v", spec, detail)
+		}
+
+		err = svc.AddOrUpdatePosition(ctx, "book", &portfolio.Position{Ticker: "AAPL", Shares: portfolio.NewDecimal(1)})
+		if err == nil {
+			t.Fatalf("%s expected ledger-managed position to reject direct updates", spec)
+		}
+	}
+}
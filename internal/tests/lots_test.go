@@ -0,0 +1,126 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+
+	"tracktrades/internal/domain/portfolio"
+)
+
+func lotPortfolio(t *testing.T, method portfolio.LotMethod) *portfolio.Portfolio {
+	t.Helper()
+
+	p := portfolio.New("lots", portfolio.NewDecimal(10000))
+	p.LotMethod = method
+	buys := []portfolio.Transaction{
+		{Type: portfolio.TxBuy, Ticker: "AAPL", Date: date("2024-01-02"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(100)},
+		{Type: portfolio.TxBuy, Ticker: "AAPL", Date: date("2024-02-01"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(150)},
+		{Type: portfolio.TxBuy, Ticker: "AAPL", Date: date("2024-03-01"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(120)},
+	}
+	for _, tx := range buys {
+		if _, err := p.Record(tx); err != nil {
+			t.Fatalf("Record buy: %v", err)
+		}
+	}
+	return p
+}
+
+func TestLotMatchingMethods(t *testing.T) {
+	tests := []struct {
+		method   portfolio.LotMethod
+		wantGain float64
+	}{
+		{portfolio.LotFIFO, 15*130 - (10*100 + 5*150)},
+		{portfolio.LotLIFO, 15*130 - (10*120 + 5*150)},
+		{portfolio.LotHighestCost, 15*130 - (10*150 + 5*120)},
+	}
+
+	for _, tt := range tests {
+		p := lotPortfolio(t, tt.method)
+		sell := portfolio.Transaction{Type: portfolio.TxSell, Ticker: "AAPL", Date: date("2024-04-01"), Quantity: portfolio.NewDecimal(15), Price: portfolio.NewDecimal(130)}
+		if _, err := p.Record(sell); err != nil {
+			t.Fatalf("%s Record sell: %v", tt.method, err)
+		}
+
+		if !approx(p.RealizedPnL.Float(), tt.wantGain) {
+			t.Errorf("%s RealizedPnL=%v want %v", tt.method, p.RealizedPnL, tt.wantGain)
+		}
+		pos := p.Positions["AAPL"]
+		if !approx(pos.Shares.Float(), 15) || len(pos.Lots) != 2 {
+			t.Errorf("%s unexpected remaining position: shares=%v lots=%d", tt.method, pos.Shares, len(pos.Lots))
+		}
+		if m := p.Metrics(); !approx(m.RealizedPnL.Float(), tt.wantGain) {
+			t.Errorf("%s Metrics().RealizedPnL=%v want %v", tt.method, m.RealizedPnL, tt.wantGain)
+		}
+	}
+}
+
+func TestSpecificLotIdentification(t *testing.T) {
+	p := lotPortfolio(t, portfolio.LotSpecific)
+	lotID := p.Positions["AAPL"].Lots[2].ID
+
+	_, err := p.Record(portfolio.Transaction{Type: portfolio.TxSell, Ticker: "AAPL", Date: date("2024-04-01"), Quantity: portfolio.NewDecimal(5), Price: portfolio.NewDecimal(130)})
+	if !errors.Is(err, portfolio.ErrInvalidTransaction) {
+		t.Fatalf("expected lot selection to be required, got %v", err)
+	}
+
+	sell := portfolio.Transaction{
+		Type: portfolio.TxSell, Ticker: "AAPL", Date: date("2024-04-01"), Quantity: portfolio.NewDecimal(5), Price: portfolio.NewDecimal(130),
+		Lots: []portfolio.LotSelection{{LotID: lotID, Quantity: portfolio.NewDecimal(5)}},
+	}
+	if _, err := p.Record(sell); err != nil {
+		t.Fatalf("Record sell: %v", err)
+	}
+
+	sales, err := p.Sales("AAPL")
+	if err != nil {
+		t.Fatalf("Sales: %v", err)
+	}
+	if len(sales) != 1 || len(sales[0].Lots) != 1 || sales[0].Lots[0].LotID != lotID {
+		t.Fatalf("unexpected sales: %#v", sales)
+	}
+	if !approx(sales[0].Gain.Float(), 50) {
+		t.Fatalf("Gain=%v want 50", sales[0].Gain)
+	}
+}
+
+func TestFullSellClosesPositionAndKeepsRealized(t *testing.T) {
+	p := lotPortfolio(t, portfolio.LotFIFO)
+	if _, err := p.Record(portfolio.Transaction{Type: portfolio.TxSell, Ticker: "AAPL", Date: date("2024-04-01"), Quantity: portfolio.NewDecimal(30), Price: portfolio.NewDecimal(140)}); err != nil {
+		t.Fatalf("Record sell: %v", err)
+	}
+	if _, ok := p.Positions["AAPL"]; ok {
+		t.Fatalf("fully sold position should be removed")
+	}
+	if !approx(p.RealizedPnL.Float(), 30*140-(1000+1500+1200)) {
+		t.Fatalf("RealizedPnL=%v", p.RealizedPnL)
+	}
+}
+
+func TestLotSelectionsKeepFullPrecision(t *testing.T) {
+	qty, err := portfolio.ParseDecimal("9876543210.12345678")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part, err := portfolio.ParseDecimal("876543210.87654321")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := portfolio.New("precision", portfolio.NewDecimal(5000000))
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxBuy, Ticker: "PENNY", Date: date("2024-01-02"), Quantity: qty, Price: portfolio.NewDecimal(0.0001)},
+		{Type: portfolio.TxBuy, Ticker: "PENNY", Date: date("2024-01-03"), Quantity: qty, Price: portfolio.NewDecimal(0.0002)},
+	})
+	sell, err := p.Record(portfolio.Transaction{Type: portfolio.TxSell, Ticker: "PENNY", Date: date("2024-02-01"), Quantity: qty.Add(part), Price: portfolio.NewDecimal(0.0003)})
+	if err != nil {
+		t.Fatalf("Record sell: %v", err)
+	}
+	sale, err := p.Sales("PENNY")
+	if err != nil || len(sale) != 1 || len(sale[0].Lots) != 2 || sale[0].Lots[0].Quantity != qty || sale[0].Lots[1].Quantity != part {
+		t.Fatalf("sale of %v=%#v", sell.Quantity, sale)
+	}
+	lots := p.Positions["PENNY"].Lots
+	if len(lots) != 1 || lots[0].Quantity != qty.Sub(part) {
+		t.Fatalf("open lots=%#v want %v left", lots, qty.Sub(part))
+	}
+}
@@ -0,0 +1,140 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"tracktrades/internal/adapters/storage"
+	"tracktrades/internal/app"
+	"tracktrades/internal/domain/portfolio"
+)
+
+func TestMarginStatusLeverageAndCallDistance(t *testing.T) {
+	p := portfolio.New("margin", portfolio.NewDecimal(0))
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxDeposit, Date: date("2024-01-02"), Amount: portfolio.NewDecimal(10000)},
+		{Type: portfolio.TxBuy, Ticker: "AAA", Date: date("2024-01-02"), Quantity: portfolio.NewDecimal(150), Price: portfolio.NewDecimal(100)},
+		{Type: portfolio.TxShort, Ticker: "CCC", Date: date("2024-01-02"), Quantity: portfolio.NewDecimal(20), Price: portfolio.NewDecimal(50)},
+	})
+	if _, err := p.MarginStatus(); !errors.Is(err, portfolio.ErrInvalidMargin) {
+		t.Fatalf("err=%v want ErrInvalidMargin", err)
+	}
+	if p.Metrics().Margin != nil {
+		t.Fatal("cash account reports margin")
+	}
+	if _, err := p.SetMargin(&portfolio.MarginAccount{MaintenancePct: 60}); !errors.Is(err, portfolio.ErrInvalidMargin) {
+		t.Fatalf("err=%v want ErrInvalidMargin", err)
+	}
+	if _, err := p.SetMargin(&portfolio.MarginAccount{InterestRatePct: 8}); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := p.MarginStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Equity is 10,000 against 16,000 of gross exposure; maintenance is 25% of
+	// the long and 30% of the short, initial 50% of both.
+	if s.Loan != portfolio.NewDecimal(4000) || s.Equity != portfolio.NewDecimal(10000) || !approx(s.Leverage, 1.6) ||
+		s.MaintenanceRequirement != portfolio.NewDecimal(4050) || s.InitialRequirement != portfolio.NewDecimal(8000) ||
+		s.ExcessLiquidity != portfolio.NewDecimal(5950) || s.BuyingPower != portfolio.NewDecimal(4000) || s.MarginCall {
+		t.Fatalf("status=%#v", s)
+	}
+	if !approx(s.CallDistancePct, 5950.0/9950*100) {
+		t.Fatalf("call distance=%v", s.CallDistancePct)
+	}
+	aaa, ccc := s.Positions[0], s.Positions[1]
+	if aaa.Requirement != portfolio.NewDecimal(3750) || !approx(aaa.CallPrice, 100*(1-5950.0/11250)) {
+		t.Fatalf("AAA=%#v", aaa)
+	}
+	if !ccc.Short || ccc.MaintenancePct != 30 || !approx(ccc.CallPrice, 50*(1+5950.0/1300)) {
+		t.Fatalf("CCC=%#v", ccc)
+	}
+	if m := p.Metrics().Margin; m == nil || m.Leverage != s.Leverage {
+		t.Fatalf("metrics margin=%#v", m)
+	}
+
+	// An instrument requirement overrides the account's.
+	if _, err := p.SetInstrument(portfolio.Instrument{Ticker: "AAA", MaintenancePct: 40}); err != nil {
+		t.Fatal(err)
+	}
+	p.Positions["AAA"].UpdatePrice(40)
+	s, _ = p.MarginStatus()
+	if s.Positions[0].Requirement != portfolio.NewDecimal(2400) || !s.MarginCall || s.CallDistancePct != 0 {
+		t.Fatalf("status=%#v", s)
+	}
+}
+
+func TestMarginInterestAccruesDailyAndPostsMonthly(t *testing.T) {
+	p := portfolio.New("margin", portfolio.NewDecimal(0))
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxDeposit, Date: date("2024-01-02"), Amount: portfolio.NewDecimal(1000)},
+		{Type: portfolio.TxBuy, Ticker: "AAA", Date: date("2024-01-02"), Quantity: portfolio.NewDecimal(20), Price: portfolio.NewDecimal(100)},
+	})
+	if _, err := p.AccrueMarginInterest(date("2024-01-25")); !errors.Is(err, portfolio.ErrInvalidMargin) {
+		t.Fatalf("err=%v want ErrInvalidMargin", err)
+	}
+	if _, err := p.SetMargin(&portfolio.MarginAccount{InterestRatePct: 7.2}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first run starts the clock; 7.2% on 1,000 is 0.20 a day.
+	if res, err := p.AccrueMarginInterest(date("2024-01-25")); err != nil || res.Days != 0 {
+		t.Fatalf("res=%#v err=%v", res, err)
+	}
+	res, err := p.AccrueMarginInterest(date("2024-01-31"))
+	if err != nil || res.Days != 6 || res.Accrued != portfolio.NewDecimal(1.2) || len(res.Posted) != 0 {
+		t.Fatalf("res=%#v err=%v", res, err)
+	}
+
+	// January's interest is posted at month end and compounds into the loan.
+	res, err = p.AccrueMarginInterest(date("2024-02-02"))
+	if err != nil || res.Days != 2 || len(res.Posted) != 1 || res.Outstanding != portfolio.NewDecimal(0.4) {
+		t.Fatalf("res=%#v err=%v", res, err)
+	}
+	posted := res.Posted[0]
+	if posted.Type != portfolio.TxMarginInterest || posted.Amount != portfolio.NewDecimal(1.2) || !posted.Date.Equal(date("2024-01-31")) {
+		t.Fatalf("posted=%#v", posted)
+	}
+	if p.Cash != portfolio.NewDecimal(-1001.2) {
+		t.Fatalf("Cash=%v", p.Cash)
+	}
+	s, _ := p.MarginStatus()
+	if s.AccruedInterest != portfolio.NewDecimal(0.4) || s.Equity != p.TotalValue().Sub(portfolio.NewDecimal(0.4)) {
+		t.Fatalf("status=%#v", s)
+	}
+	if report := p.FeeReport(date("2024-01-01"), date("2024-12-31")); !report.Total.IsZero() {
+		t.Fatalf("margin interest reported as a fee: %#v", report.FeeBreakdown)
+	}
+}
+
+func TestMarginSettingsPersistWithAccrual(t *testing.T) {
+	svc := app.NewPortfolioService(storage.NewMemoryPortfolioStore(), nopPricer{})
+	ctx := context.Background()
+	if _, err := svc.CreatePortfolio(ctx, "swing", portfolio.NewDecimal(0)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.RecordTransaction(ctx, "swing", portfolio.Transaction{Type: portfolio.TxBuy, Ticker: "AAA", Date: date("2024-01-02"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(100)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.GetMargin(ctx, "swing"); !errors.Is(err, portfolio.ErrInvalidMargin) {
+		t.Fatalf("err=%v want ErrInvalidMargin", err)
+	}
+	if _, err := svc.SetMargin(ctx, "swing", &portfolio.MarginAccount{InitialPct: 60, InterestRatePct: 3.6}); err != nil {
+		t.Fatal(err)
+	}
+	for _, day := range []string{"2024-03-01", "2024-03-11"} {
+		if _, err := svc.AccrueMarginInterest(ctx, "swing", date(day)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Changing the terms keeps the interest accrued so far.
+	if _, err := svc.SetMargin(ctx, "swing", &portfolio.MarginAccount{InterestRatePct: 5}); err != nil {
+		t.Fatal(err)
+	}
+	s, err := svc.GetMargin(ctx, "swing")
+	if err != nil || s.AccruedInterest != portfolio.NewDecimal(1) || s.InitialPct != 50 || s.InterestRatePct != 5 {
+		t.Fatalf("status=%#v err=%v", s, err)
+	}
+}
@@ -9,20 +9,20 @@ import (
 func TestPositionMetrics(t *testing.T) {
 	p := &portfolio.Position{
 		Ticker:       "TEST",
-		Shares:       10,
-		CostBasis:    1000,
+		Shares:       portfolio.NewDecimal(10),
+		CostBasis:    portfolio.NewDecimal(1000),
 		CurrentPrice: 80,
 		PeakPrice:    120,
 	}
 	d := p.DetailedMetrics()
 
-	if d.CurrentValue != 800 {
+	if d.CurrentValue != portfolio.NewDecimal(800) {
 		t.Fatalf("CurrentValue = %v, want 800", d.CurrentValue)
 	}
-	if d.PeakValue != 1200 {
+	if d.PeakValue != portfolio.NewDecimal(1200) {
 		t.Fatalf("PeakValue = %v, want 1200", d.PeakValue)
 	}
-	if d.UnrealizedPnL != -200 {
+	if d.UnrealizedPnL != portfolio.NewDecimal(-200) {
 		t.Fatalf("PnL = %v, want -200", d.UnrealizedPnL)
 	}
 	if d.DrawdownFromPeakPct <= 30 || d.DrawdownFromPeakPct >= 40 {
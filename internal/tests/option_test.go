@@ -0,0 +1,161 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"tracktrades/internal/domain/portfolio"
+)
+
+func callContract(expiry time.Time) *portfolio.OptionContract {
+	return &portfolio.OptionContract{Underlying: "aapl", Strike: 200, Expiry: expiry, Right: portfolio.Call}
+}
+
+func TestOptionTradesUseContractMultiplier(t *testing.T) {
+	p := portfolio.New("opts", portfolio.NewDecimal(0))
+	expiry := date("2024-06-21")
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxDeposit, Date: date("2024-05-01"), Amount: portfolio.NewDecimal(2000)},
+		{Type: portfolio.TxBuy, Date: date("2024-05-01"), Quantity: portfolio.NewDecimal(2), Price: portfolio.NewDecimal(5), Option: callContract(expiry)},
+	})
+
+	symbol := "AAPL240621C00200000"
+	pos, ok := p.Positions[symbol]
+	if !ok {
+		t.Fatalf("option position %s missing: %#v", symbol, p.Positions)
+	}
+	if pos.Option == nil || pos.Option.Multiplier != 100 || !approx(pos.CurrentValue().Float(), 1000) || !approx(pos.CostBasis.Float(), 1000) {
+		t.Fatalf("unexpected option position: %#v", pos)
+	}
+	if !approx(p.Cash.Float(), 1000) {
+		t.Fatalf("Cash=%v want 1000", p.Cash)
+	}
+
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxSell, Ticker: symbol, Date: date("2024-05-10"), Quantity: portfolio.NewDecimal(1), Price: portfolio.NewDecimal(7)},
+	})
+	if !approx(p.RealizedPnL.Float(), 200) || !approx(p.Cash.Float(), 1700) {
+		t.Fatalf("RealizedPnL=%v Cash=%v want 200 and 1700", p.RealizedPnL, p.Cash)
+	}
+}
+
+func TestOptionDeltaExposure(t *testing.T) {
+	p := portfolio.New("opts", portfolio.NewDecimal(0))
+	expiry := time.Now().AddDate(0, 2, 0)
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxDeposit, Date: date("2024-05-01"), Amount: portfolio.NewDecimal(50000)},
+		{Type: portfolio.TxBuy, Ticker: "AAPL", Date: date("2024-05-01"), Quantity: portfolio.NewDecimal(100), Price: portfolio.NewDecimal(210)},
+		{Type: portfolio.TxBuy, Date: date("2024-05-01"), Quantity: portfolio.NewDecimal(1), Price: portfolio.NewDecimal(15), Option: callContract(expiry)},
+	})
+
+	symbol := callContract(expiry).Normalized().Symbol()
+	d, ok := p.PositionDetails(symbol)
+	if !ok || d.Option == nil {
+		t.Fatalf("missing option details for %s", symbol)
+	}
+	if d.Option.UnderlyingPrice != 210 || d.Option.Intrinsic != 10 || d.Option.ImpliedVolPct <= 0 {
+		t.Fatalf("unexpected option details: %#v", d.Option)
+	}
+	if d.Option.Delta <= 0.5 || d.Option.Delta >= 1 || !approx(d.Option.DeltaShares, d.Option.Delta*100) {
+		t.Fatalf("Delta=%v DeltaShares=%v", d.Option.Delta, d.Option.DeltaShares)
+	}
+
+	m := p.Metrics()
+	if len(m.Underlyings) != 1 || m.Underlyings[0].Shares != 100 || !approx(m.Underlyings[0].DeltaShares, d.Option.DeltaShares) {
+		t.Fatalf("unexpected underlyings: %#v", m.Underlyings)
+	}
+}
+
+func TestExpireOptions(t *testing.T) {
+	p := portfolio.New("opts", portfolio.NewDecimal(0))
+	expiry := date("2024-06-21")
+	put := &portfolio.OptionContract{Underlying: "AAPL", Strike: 200, Expiry: expiry, Right: portfolio.Put}
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxDeposit, Date: date("2024-05-01"), Amount: portfolio.NewDecimal(2000)},
+		{Type: portfolio.TxBuy, Date: date("2024-05-01"), Quantity: portfolio.NewDecimal(1), Price: portfolio.NewDecimal(4), Option: callContract(expiry)},
+		{Type: portfolio.TxBuy, Date: date("2024-05-01"), Quantity: portfolio.NewDecimal(1), Price: portfolio.NewDecimal(3), Option: put},
+	})
+	for _, pos := range p.Positions {
+		pos.UnderlyingPrice = 190
+	}
+
+	if res, err := p.ExpireOptions(date("2024-06-21").Add(20 * time.Hour)); err != nil || len(res) != 0 {
+		t.Fatalf("options expired early: %#v %v", res, err)
+	}
+
+	res, err := p.ExpireOptions(date("2024-06-22"))
+	if err != nil {
+		t.Fatalf("ExpireOptions: %v", err)
+	}
+	if len(res) != 2 || res[0].Status != portfolio.ExpiredWorthless || res[1].Status != portfolio.SettledInCash || !approx(res[1].Intrinsic, 10) {
+		t.Fatalf("unexpected expiries: %#v", res)
+	}
+	if len(p.Positions) != 0 {
+		t.Fatalf("expired contracts should be closed: %#v", p.Positions)
+	}
+	// The call loses its 400 premium; the put pays 10 x 100 in cash for 300.
+	if p.RealizedPnL != portfolio.NewDecimal(-400+700) || p.Cash != portfolio.NewDecimal(2000-700+1000) {
+		t.Fatalf("RealizedPnL=%v Cash=%v", p.RealizedPnL, p.Cash)
+	}
+	last := p.Transactions[len(p.Transactions)-1]
+	if last.Type != portfolio.TxSell || last.Price != portfolio.NewDecimal(10) || !last.Date.Equal(expiry) {
+		t.Fatalf("settlement=%#v", last)
+	}
+
+	if res, err := p.ExpireOptions(date("2024-06-24")); err != nil || len(res) != 0 {
+		t.Fatalf("settled contracts expired again: %#v %v", res, err)
+	}
+}
+
+func TestExpireWrittenOptionInTheMoneySettlesInCash(t *testing.T) {
+	p := portfolio.New("opts", portfolio.NewDecimal(0))
+	expiry := date("2024-06-21")
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxDeposit, Date: date("2024-05-01"), Amount: portfolio.NewDecimal(2000)},
+		{Type: portfolio.TxShort, Date: date("2024-05-01"), Quantity: portfolio.NewDecimal(2), Price: portfolio.NewDecimal(4), Option: callContract(expiry)},
+	})
+	ticker := "AAPL240621C00200000"
+	p.Positions[ticker].UnderlyingPrice = 203
+
+	res, err := p.ExpireOptions(date("2024-06-22"))
+	if err != nil || len(res) != 1 || res[0].Status != portfolio.SettledInCash {
+		t.Fatalf("res=%#v err=%v", res, err)
+	}
+	if _, ok := p.Positions[ticker]; ok {
+		t.Fatal("assigned call should be closed")
+	}
+	// Written for 800, assigned at 3 x 2 x 100.
+	if p.RealizedPnL != portfolio.NewDecimal(200) || p.Cash != portfolio.NewDecimal(2000+800-600) {
+		t.Fatalf("RealizedPnL=%v Cash=%v", p.RealizedPnL, p.Cash)
+	}
+	if last := p.Transactions[len(p.Transactions)-1]; last.Type != portfolio.TxCover {
+		t.Fatalf("settlement=%#v", last)
+	}
+}
+
+func TestExpireOptionsWithoutUnderlyingPriceWaits(t *testing.T) {
+	p := portfolio.New("opts", portfolio.NewDecimal(0))
+	expiry := date("2024-06-21")
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxDeposit, Date: date("2024-05-01"), Amount: portfolio.NewDecimal(2000)},
+		{Type: portfolio.TxBuy, Date: date("2024-05-01"), Quantity: portfolio.NewDecimal(1), Price: portfolio.NewDecimal(4), Option: callContract(expiry)},
+	})
+	ticker := "AAPL240621C00200000"
+
+	res, err := p.ExpireOptions(date("2024-06-22"))
+	if err != nil {
+		t.Fatalf("ExpireOptions: %v", err)
+	}
+	if len(res) != 1 || res[0].Status != portfolio.ExpiryPricePending || len(p.Transactions) != 2 {
+		t.Fatalf("unexpected expiries: %#v", res)
+	}
+	if pos := p.Positions[ticker]; pos == nil {
+		t.Fatal("contract should stay open")
+	}
+
+	p.Positions[ticker].UnderlyingPrice = 210
+	res, _ = p.ExpireOptions(date("2024-06-23"))
+	if len(res) != 1 || res[0].Status != portfolio.SettledInCash || !approx(res[0].Intrinsic, 10) {
+		t.Fatalf("unexpected expiries once priced: %#v", res)
+	}
+}
@@ -0,0 +1,152 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"tracktrades/internal/adapters/storage"
+	"tracktrades/internal/app"
+	"tracktrades/internal/domain/portfolio"
+)
+
+func rebalanceService(t *testing.T) *app.PortfolioService {
+	t.Helper()
+	storeInfo, err := storage.NewPortfolioStore("memory")
+	if err != nil {
+		t.Fatalf("NewPortfolioStore memory: %v", err)
+	}
+	svc := app.NewPortfolioService(storeInfo.Store, nopPricer{})
+	ctx := context.Background()
+
+	if _, err := svc.CreatePortfolio(ctx, "reb", portfolio.NewDecimal(1000)); err != nil {
+		t.Fatalf("CreatePortfolio: %v", err)
+	}
+	for _, pos := range []*portfolio.Position{
+		{Ticker: "AAPL", Shares: portfolio.NewDecimal(10), CostBasis: portfolio.NewDecimal(1000), CurrentPrice: 100},
+		{Ticker: "MSFT", Shares: portfolio.NewDecimal(20), CostBasis: portfolio.NewDecimal(2000), CurrentPrice: 100},
+		{Ticker: "BND", Shares: portfolio.NewDecimal(10), CostBasis: portfolio.NewDecimal(1000), CurrentPrice: 100},
+	} {
+		if err := svc.AddOrUpdatePosition(ctx, "reb", pos); err != nil {
+			t.Fatalf("AddOrUpdatePosition: %v", err)
+		}
+	}
+	for _, target := range []portfolio.AllocationTarget{
+		{Ticker: "aapl", WeightPct: 40, BandPct: 5},
+		{Ticker: "MSFT", WeightPct: 20, BandPct: 5},
+		{Tag: "Bond", WeightPct: 30, BandPct: 2},
+	} {
+		if err := svc.SetTarget(ctx, "reb", target); err != nil {
+			t.Fatalf("SetTarget: %v", err)
+		}
+	}
+	if err := svc.TagTicker(ctx, "reb", "bnd", "bond"); err != nil {
+		t.Fatalf("TagTicker: %v", err)
+	}
+	return svc
+}
+
+func tradesByTicker(plan portfolio.RebalancePlan) map[string]portfolio.RebalanceTrade {
+	res := make(map[string]portfolio.RebalanceTrade)
+	for _, tr := range plan.Trades {
+		res[tr.Ticker] = tr
+	}
+	return res
+}
+
+func TestRebalancePlanHitsTargets(t *testing.T) {
+	svc := rebalanceService(t)
+
+	plan, err := svc.GetRebalancePlan(context.Background(), "reb", portfolio.RebalanceOptions{})
+	if err != nil {
+		t.Fatalf("GetRebalancePlan: %v", err)
+	}
+	if !approx(plan.TargetCashPct, 10) || !approx(plan.CashPct, 20) {
+		t.Fatalf("unexpected cash weights: %#v", plan)
+	}
+
+	trades := tradesByTicker(plan)
+	if tr := trades["AAPL"]; tr.Type != portfolio.TxBuy || tr.Quantity != portfolio.NewDecimal(10) {
+		t.Fatalf("unexpected AAPL trade: %#v", tr)
+	}
+	if tr := trades["MSFT"]; tr.Type != portfolio.TxSell || tr.Quantity != portfolio.NewDecimal(10) {
+		t.Fatalf("unexpected MSFT trade: %#v", tr)
+	}
+	if tr := trades["BND"]; tr.Type != portfolio.TxBuy || tr.Quantity != portfolio.NewDecimal(5) {
+		t.Fatalf("unexpected BND trade: %#v", tr)
+	}
+	if !approx(plan.CashAfter.Float(), 500) {
+		t.Fatalf("CashAfter=%v want 500", plan.CashAfter)
+	}
+}
+
+func TestRebalanceRespectsBands(t *testing.T) {
+	svc := rebalanceService(t)
+	ctx := context.Background()
+	if err := svc.SetTarget(ctx, "reb", portfolio.AllocationTarget{Ticker: "MSFT", WeightPct: 30, BandPct: 12}); err != nil {
+		t.Fatalf("SetTarget: %v", err)
+	}
+
+	plan, err := svc.GetRebalancePlan(ctx, "reb", portfolio.RebalanceOptions{})
+	if err != nil {
+		t.Fatalf("GetRebalancePlan: %v", err)
+	}
+	if _, ok := tradesByTicker(plan)["MSFT"]; ok {
+		t.Fatalf("MSFT within band should not trade: %#v", plan.Trades)
+	}
+}
+
+func TestRebalanceCashOnlyNeverSells(t *testing.T) {
+	svc := rebalanceService(t)
+
+	plan, err := svc.GetRebalancePlan(context.Background(), "reb", portfolio.RebalanceOptions{CashOnly: true, NewCash: portfolio.NewDecimal(500)})
+	if err != nil {
+		t.Fatalf("GetRebalancePlan: %v", err)
+	}
+	spent := 0.0
+	for _, tr := range plan.Trades {
+		if tr.Type != portfolio.TxBuy {
+			t.Fatalf("cash-only plan sells: %#v", tr)
+		}
+		spent += tr.Amount.Float()
+	}
+	if spent <= 0 || spent > 1500 {
+		t.Fatalf("spent %v of 1500 available", spent)
+	}
+	if plan.CashAfter.IsNegative() {
+		t.Fatalf("CashAfter=%v", plan.CashAfter)
+	}
+}
+
+func TestSetTargetRejectsOverAllocation(t *testing.T) {
+	svc := rebalanceService(t)
+
+	err := svc.SetTarget(context.Background(), "reb", portfolio.AllocationTarget{Ticker: "TSLA", WeightPct: 20})
+	if !errors.Is(err, portfolio.ErrInvalidAllocation) {
+		t.Fatalf("expected ErrInvalidAllocation, got %v", err)
+	}
+}
+
+func TestRebalanceUnpricedTargetsWarnWithoutTakingCash(t *testing.T) {
+	p := portfolio.New("reb", portfolio.NewDecimal(100))
+	p.AddPosition(&portfolio.Position{Ticker: "AAPL", Shares: portfolio.NewDecimal(10), CostBasis: portfolio.NewDecimal(1000), CurrentPrice: 100})
+	p.AddPosition(&portfolio.Position{Ticker: "MSFT", Shares: portfolio.NewDecimal(9), CostBasis: portfolio.NewDecimal(900), CurrentPrice: 100})
+	p.AddPosition(&portfolio.Position{Ticker: "AMD", Shares: portfolio.NewDecimal(5), CostBasis: portfolio.NewDecimal(500)})
+	p.Targets = []portfolio.AllocationTarget{
+		{Ticker: "AAPL", WeightPct: 55},
+		{Ticker: "MSFT", WeightPct: 35, BandPct: 15},
+		{Ticker: "NVDA", WeightPct: 5},
+		{Ticker: "AMD", WeightPct: 5},
+	}
+
+	// NVDA is not held and AMD has no price, so both get a warning and leave
+	// the cash to AAPL.
+	plan := p.RebalancePlan(portfolio.RebalanceOptions{})
+	trades := tradesByTicker(plan)
+	if _, ok := trades["NVDA"]; ok || len(plan.Warnings) != 2 {
+		t.Fatalf("trades=%#v warnings=%v", plan.Trades, plan.Warnings)
+	}
+	if aapl := trades["AAPL"]; aapl.Type != portfolio.TxBuy || aapl.Quantity != portfolio.NewDecimal(1) {
+		t.Fatalf("AAPL trade=%#v", aapl)
+	}
+}
@@ -1,8 +1,12 @@
 package tests
 
 import (
+	"errors"
+	"math"
 	"testing"
+	"time"
 
+	"tracktrades/internal/domain/portfolio"
 	"tracktrades/internal/util"
 )
 
@@ -33,3 +37,74 @@ func TestRequiredRecoveryPct(t *testing.T) {
 		}
 	}
 }
+
+func TestRecoveryYearsAndRequiredReturn(t *testing.T) {
+	if y, ok := util.RecoveryYears(25, 10); !ok || !approx(y, math.Log(1.25)/math.Log(1.1)) {
+		t.Fatalf("years=%v ok=%v", y, ok)
+	}
+	if _, ok := util.RecoveryYears(25, 0); ok {
+		t.Fatal("a flat return recovers")
+	}
+	if r := util.RequiredAnnualReturnPct(25, 2); !approx(r, (math.Sqrt(1.25)-1)*100) {
+		t.Fatalf("required=%v", r)
+	}
+
+	// Without drift, the chance of touching the barrier is twice the chance of
+	// ending above it (the reflection principle).
+	want := math.Erfc(math.Log(1.25)/0.2/math.Sqrt2) * 100
+	if p := util.RecoveryProbabilityPct(25, 0, 20, 1); !approx(p, want) {
+		t.Fatalf("probability=%v want %v", p, want)
+	}
+	if p := util.RecoveryProbabilityPct(25, 30, 0, 1); p != 100 {
+		t.Fatalf("deterministic probability=%v", p)
+	}
+	short, long := util.RecoveryProbabilityPct(25, 5, 20, 1), util.RecoveryProbabilityPct(25, 5, 20, 5)
+	if !(short > 0 && short < long && long < 100) {
+		t.Fatalf("probabilities 1y=%v 5y=%v", short, long)
+	}
+}
+
+func TestRecoveryProjectionsForPositionsAndPortfolio(t *testing.T) {
+	p := portfolio.New("recovery", portfolio.NewDecimal(1000))
+	p.AddPosition(&portfolio.Position{Ticker: "AAA", Shares: portfolio.NewDecimal(10), CostBasis: portfolio.NewDecimal(1000), CurrentPrice: 100, PeakPrice: 125})
+	p.AddPosition(&portfolio.Position{Ticker: "BBB", Side: portfolio.Short, Shares: portfolio.NewDecimal(10), CostBasis: portfolio.NewDecimal(600), CurrentPrice: 55, PeakPrice: 50})
+	for i, price := range []float64{120, 125, 118, 110, 104, 100} {
+		day, value := date("2024-06-03").AddDate(0, 0, i), 1000+10*price-550
+		p.History = append(p.History, portfolio.Snapshot{Time: day, Value: portfolio.NewDecimal(value), High: portfolio.NewDecimal(value), Close: true, Prices: map[string]float64{"AAA": price}})
+	}
+	now := date("2024-06-10")
+	by := date("2026-06-10")
+	years := by.Sub(now).Hours() / 24 / 365.25
+
+	report, err := p.RecoveryProjections(now, portfolio.RecoveryOptions{AnnualReturnPct: 7, By: by})
+	if err != nil {
+		t.Fatal(err)
+	}
+	aaa, bbb := report.Positions[0], report.Positions[1]
+	if !approx(aaa.DrawdownPct, 20) || !approx(aaa.RecoveryNeededPct, 25) || !approx(aaa.YearsToRecover, math.Log(1.25)/math.Log(1.07)) {
+		t.Fatalf("AAA=%#v", aaa)
+	}
+	if !approx(math.Pow(1+aaa.RequiredReturnPct/100, years), 1.25) {
+		t.Fatalf("AAA required=%v", aaa.RequiredReturnPct)
+	}
+	if aaa.Observations != 5 || aaa.VolatilityPct <= 0 || aaa.ProbabilityPct == nil || *aaa.ProbabilityPct <= 0 || *aaa.ProbabilityPct >= 100 {
+		t.Fatalf("AAA=%#v", aaa)
+	}
+	// The short needs the price to fall back to 50, which a rising market
+	// never does; it has no history for a probability.
+	if !bbb.Short || bbb.ExpectedRecovery != nil || bbb.ProbabilityPct != nil || !approx(math.Pow(1+bbb.RequiredReturnPct/100, years), 50.0/55) {
+		t.Fatalf("BBB=%#v", bbb)
+	}
+	if report.Portfolio.Observations != 5 || !approx(report.Portfolio.DrawdownPct, 250.0/1700*100) || report.Portfolio.ProbabilityPct == nil {
+		t.Fatalf("portfolio=%#v", report.Portfolio)
+	}
+
+	report, _ = p.RecoveryProjections(now, portfolio.RecoveryOptions{AnnualReturnPct: -10})
+	if bbb := report.Positions[1]; !approx(bbb.YearsToRecover, math.Log(50.0/55)/math.Log(0.9)) || !report.By.Equal(now.AddDate(1, 0, 0)) {
+		t.Fatalf("BBB=%#v by=%v", bbb, report.By)
+	}
+
+	if _, err := p.RecoveryProjections(now, portfolio.RecoveryOptions{By: now.Add(-time.Hour)}); !errors.Is(err, portfolio.ErrInvalidRecovery) {
+		t.Fatalf("err=%v want ErrInvalidRecovery", err)
+	}
+}
@@ -0,0 +1,106 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"tracktrades/internal/adapters/storage"
+	"tracktrades/internal/app"
+	"tracktrades/internal/domain/portfolio"
+	"tracktrades/internal/ports"
+	"tracktrades/internal/util"
+)
+
+type staticHistory map[string][]portfolio.PricePoint
+
+func (h staticHistory) DailyCloses(ctx context.Context, pos *portfolio.Position, from, to time.Time) ([]portfolio.PricePoint, error) {
+	var res []portfolio.PricePoint
+	for _, pt := range h[pos.Ticker] {
+		if !pt.Date.Before(from) && !pt.Date.After(to) {
+			res = append(res, pt)
+		}
+	}
+	return res, nil
+}
+
+var _ ports.PriceHistoryProvider = staticHistory(nil)
+
+func TestReturnsSeparateFlowsFromPerformance(t *testing.T) {
+	storeInfo, err := storage.NewPortfolioStore("memory")
+	if err != nil {
+		t.Fatalf("NewPortfolioStore memory: %v", err)
+	}
+	history := staticHistory{"NVDA": {
+		{Date: date("2024-01-01"), Close: 100},
+		{Date: date("2024-01-02"), Close: 110},
+		{Date: date("2024-01-03"), Close: 121},
+	}}
+	svc := app.NewPortfolioService(storeInfo.Store, nopPricer{}, app.WithPriceHistory(history))
+	ctx := context.Background()
+
+	if _, err := svc.CreatePortfolio(ctx, "ret", portfolio.NewDecimal(0)); err != nil {
+		t.Fatalf("CreatePortfolio: %v", err)
+	}
+	for _, tx := range []portfolio.Transaction{
+		{Type: portfolio.TxDeposit, Date: date("2024-01-01"), Amount: portfolio.NewDecimal(1000)},
+		{Type: portfolio.TxBuy, Ticker: "NVDA", Date: date("2024-01-01"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(100)},
+		{Type: portfolio.TxDeposit, Date: date("2024-01-02"), Amount: portfolio.NewDecimal(1000)},
+	} {
+		if _, err := svc.RecordTransaction(ctx, "ret", tx); err != nil {
+			t.Fatalf("RecordTransaction: %v", err)
+		}
+	}
+
+	report, err := svc.GetReturns(ctx, "ret", date("2024-01-01"), date("2024-01-03"))
+	if err != nil {
+		t.Fatalf("GetReturns: %v", err)
+	}
+
+	wantTWR := (2100.0/2000*2210/2100 - 1) * 100
+	if !approx(report.Portfolio.TWRPct, wantTWR) {
+		t.Fatalf("TWR=%v want %v", report.Portfolio.TWRPct, wantTWR)
+	}
+	if !approx(report.Portfolio.NetFlows, 1000) || !approx(report.Portfolio.EndValue, 2210) {
+		t.Fatalf("unexpected figures: %#v", report.Portfolio)
+	}
+	if report.Portfolio.MWRPct <= 0 {
+		t.Fatalf("MWR=%v want positive", report.Portfolio.MWRPct)
+	}
+
+	if len(report.Positions) != 1 || !approx(report.Positions[0].TWRPct, 21) {
+		t.Fatalf("unexpected position returns: %#v", report.Positions)
+	}
+}
+
+func TestReturnsRequireHistoryProvider(t *testing.T) {
+	storeInfo, err := storage.NewPortfolioStore("memory")
+	if err != nil {
+		t.Fatalf("NewPortfolioStore memory: %v", err)
+	}
+	svc := app.NewPortfolioService(storeInfo.Store, nopPricer{})
+	ctx := context.Background()
+	if _, err := svc.CreatePortfolio(ctx, "ret", portfolio.NewDecimal(100)); err != nil {
+		t.Fatalf("CreatePortfolio: %v", err)
+	}
+	if _, err := svc.RecordTransaction(ctx, "ret", portfolio.Transaction{Type: portfolio.TxBuy, Ticker: "AAPL", Date: date("2024-01-01"), Quantity: portfolio.NewDecimal(1), Price: portfolio.NewDecimal(50)}); err != nil {
+		t.Fatalf("RecordTransaction: %v", err)
+	}
+	if _, err := svc.GetReturns(ctx, "ret", date("2024-01-01"), date("2024-02-01")); err == nil {
+		t.Fatalf("expected an error without a price history provider")
+	}
+}
+
+func TestXIRR(t *testing.T) {
+	dates := []time.Time{date("2023-01-01"), date("2024-01-01")}
+	irr, err := util.XIRR(dates, []float64{-1000, 1100})
+	if err != nil {
+		t.Fatalf("XIRR: %v", err)
+	}
+	if irr < 0.0995 || irr > 0.1005 {
+		t.Fatalf("XIRR=%v want ~0.10", irr)
+	}
+	if _, err := util.XIRR(dates, []float64{100, 100}); err == nil {
+		t.Fatalf("expected an error when flows never change sign")
+	}
+}
@@ -0,0 +1,160 @@
+package tests
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"tracktrades/internal/adapters/storage"
+	"tracktrades/internal/app"
+	"tracktrades/internal/domain/portfolio"
+)
+
+func riskPortfolio(values []float64) *portfolio.Portfolio {
+	p := portfolio.New("risk", portfolio.NewDecimal(0))
+	start := date("2024-03-01")
+	for i, v := range values {
+		p.History = append(p.History, portfolio.Snapshot{
+			Time:   start.AddDate(0, 0, i),
+			Value:  portfolio.NewDecimal(v),
+			High:   portfolio.NewDecimal(v),
+			Close:  true,
+			Prices: map[string]float64{"AAPL": v / 10},
+		})
+	}
+	p.Positions["AAPL"] = &portfolio.Position{Ticker: "AAPL", Shares: portfolio.NewDecimal(10), CurrentPrice: values[len(values)-1] / 10}
+	return p
+}
+
+func TestRiskMaxDrawdownWithDates(t *testing.T) {
+	p := riskPortfolio([]float64{100, 110, 99, 104.5, 121})
+	risk := p.Risk(nil)
+
+	dd := risk.Portfolio.MaxDrawdown
+	if !approx(dd.DepthPct, 10) {
+		t.Fatalf("DepthPct=%v want 10", dd.DepthPct)
+	}
+	if !dd.Peak.Equal(date("2024-03-02")) || !dd.Trough.Equal(date("2024-03-03")) {
+		t.Fatalf("unexpected drawdown dates: %#v", dd)
+	}
+	if dd.Recovered == nil || !dd.Recovered.Equal(date("2024-03-05")) {
+		t.Fatalf("Recovered=%v want 2024-03-05", dd.Recovered)
+	}
+	if risk.Portfolio.Observations != 4 || risk.Portfolio.VolatilityPct <= 0 {
+		t.Fatalf("unexpected stats: %#v", risk.Portfolio)
+	}
+	if len(risk.Positions) != 1 || !approx(risk.Positions[0].VolatilityPct, risk.Portfolio.VolatilityPct) {
+		t.Fatalf("unexpected position risk: %#v", risk.Positions)
+	}
+	if m := p.Metrics(); !approx(m.Risk.MaxDrawdown.DepthPct, 10) {
+		t.Fatalf("metrics risk section missing: %#v", m.Risk)
+	}
+}
+
+func TestRiskRatiosUseRiskFreeRate(t *testing.T) {
+	p := riskPortfolio([]float64{100, 101, 100.5, 102, 101.5, 103})
+	base := p.Risk(nil).Portfolio
+
+	p.RiskFreeRatePct = 5
+	withRF := p.Risk(nil).Portfolio
+	if !(withRF.SharpeRatio < base.SharpeRatio) || !(withRF.SortinoRatio < base.SortinoRatio) {
+		t.Fatalf("risk-free rate should lower ratios: base=%#v rf=%#v", base, withRF)
+	}
+	want := (base.AnnualizedReturnPct - 5) / base.VolatilityPct
+	if math.Abs(withRF.SharpeRatio-want) > 1e-9 {
+		t.Fatalf("SharpeRatio=%v want %v", withRF.SharpeRatio, want)
+	}
+}
+
+func TestDailyReturnsRemoveDeposits(t *testing.T) {
+	p := riskPortfolio([]float64{100, 200})
+	p.Transactions = []portfolio.Transaction{{ID: "tx-1", Type: portfolio.TxDeposit, Date: date("2024-03-02"), Amount: portfolio.NewDecimal(100)}}
+
+	returns := p.DailyReturns()
+	if len(returns) != 1 || !approx(returns[0].Return, 0) {
+		t.Fatalf("unexpected returns: %#v", returns)
+	}
+}
+
+func TestRiskBetaAgainstBenchmark(t *testing.T) {
+	storeInfo, err := storage.NewPortfolioStore("memory")
+	if err != nil {
+		t.Fatalf("NewPortfolioStore memory: %v", err)
+	}
+	values := []float64{100, 110, 99, 104.5, 121}
+	closes := []portfolio.PricePoint{{Date: date("2024-03-01"), Close: 400}}
+	for i := 1; i < len(values); i++ {
+		r := values[i]/values[i-1] - 1
+		closes = append(closes, portfolio.PricePoint{Date: date("2024-03-01").AddDate(0, 0, i), Close: closes[i-1].Close * (1 + r/2)})
+	}
+	svc := app.NewPortfolioService(storeInfo.Store, nopPricer{}, app.WithPriceHistory(staticHistory{"SPY": closes}))
+	ctx := context.Background()
+
+	if err := storeInfo.Store.Save(ctx, "risk", riskPortfolio(values)); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if err := svc.SetRiskSettings(ctx, "risk", 4, "spy"); err != nil {
+		t.Fatalf("SetRiskSettings: %v", err)
+	}
+
+	risk, err := svc.GetRisk(ctx, "risk")
+	if err != nil {
+		t.Fatalf("GetRisk: %v", err)
+	}
+	if risk.RiskFreeRatePct != 4 || risk.Portfolio.Benchmark != "SPY" {
+		t.Fatalf("unexpected settings: %#v", risk)
+	}
+	if !approx(risk.Portfolio.Beta, 2) || !approx(risk.Portfolio.Correlation, 1) {
+		t.Fatalf("Beta=%v Correlation=%v want 2 and 1", risk.Portfolio.Beta, risk.Portfolio.Correlation)
+	}
+
+	m, err := svc.GetMetrics(ctx, "risk")
+	if err != nil {
+		t.Fatalf("GetMetrics: %v", err)
+	}
+	if !approx(m.Risk.Beta, 2) {
+		t.Fatalf("metrics Beta=%v want 2", m.Risk.Beta)
+	}
+
+	// Without benchmark closes metrics still reports the other risk figures.
+	offline := app.NewPortfolioService(storeInfo.Store, nopPricer{}, app.WithPriceHistory(staticHistory{}))
+	m, err = offline.GetMetrics(ctx, "risk")
+	if err != nil || m.Risk.Beta != 0 || m.Risk.Observations != 4 {
+		t.Fatalf("offline metrics risk=%#v err=%v", m.Risk, err)
+	}
+}
+
+func TestDailyReturnsSkipDaysWithoutFreshQuotes(t *testing.T) {
+	p := portfolio.New("calendar", portfolio.NewDecimal(0))
+	snap := func(day, quoted string, price float64) {
+		q := date(quoted)
+		p.History = append(p.History, portfolio.Snapshot{Time: date(day), Value: portfolio.NewDecimal(10 * price), Close: true, Prices: map[string]float64{"AAPL": price}, QuoteDate: &q})
+	}
+	// Friday, a weekend and a Monday holiday still quoting Friday, then a flat
+	// Tuesday and a Wednesday.
+	snap("2024-05-24", "2024-05-24", 100)
+	snap("2024-05-25", "2024-05-24", 100)
+	snap("2024-05-26", "2024-05-24", 100)
+	snap("2024-05-27", "2024-05-24", 100)
+	snap("2024-05-28", "2024-05-28", 100)
+	snap("2024-05-29", "2024-05-29", 110)
+
+	returns := p.DailyReturns()
+	if len(returns) != 2 || !returns[0].Date.Equal(date("2024-05-28")) || returns[0].Return != 0 || !approx(returns[1].Return, 0.1) {
+		t.Fatalf("returns=%#v", returns)
+	}
+	p.Positions["AAPL"] = &portfolio.Position{Ticker: "AAPL", Shares: portfolio.NewDecimal(10), CurrentPrice: 110}
+	if got := p.PositionDailyReturns("AAPL"); len(got) != 2 || !approx(got[1].Return, 0.1) {
+		t.Fatalf("position returns=%#v", got)
+	}
+
+	// Crypto quotes refresh over the weekend, so those days count.
+	c := portfolio.New("crypto", portfolio.NewDecimal(0))
+	for i, price := range []float64{100, 105, 110} {
+		q := date("2024-05-24").AddDate(0, 0, i)
+		c.History = append(c.History, portfolio.Snapshot{Time: q, Value: portfolio.NewDecimal(price), Close: true, Prices: map[string]float64{"BTCUSD": price}, QuoteDate: &q})
+	}
+	if got := c.DailyReturns(); len(got) != 2 || !got[1].Date.Equal(date("2024-05-26")) {
+		t.Fatalf("crypto returns=%#v", got)
+	}
+}
@@ -0,0 +1,160 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"tracktrades/internal/adapters/storage"
+	"tracktrades/internal/app"
+	"tracktrades/internal/domain/portfolio"
+)
+
+func scenarioPortfolio() *portfolio.Portfolio {
+	p := portfolio.New("stress", portfolio.NewDecimal(1000))
+	p.AddPosition(&portfolio.Position{Ticker: "AAPL", Shares: portfolio.NewDecimal(10), CostBasis: portfolio.NewDecimal(1000), CurrentPrice: 100})
+	p.AddPosition(&portfolio.Position{Ticker: "BTC", Shares: portfolio.NewDecimal(0.1), CostBasis: portfolio.NewDecimal(5000), CurrentPrice: 50000})
+	p.AddPosition(&portfolio.Position{Ticker: "SAP", Shares: portfolio.NewDecimal(10), CostBasis: portfolio.NewDecimal(1100), CurrentPrice: 100, Currency: "EUR", FXRate: 1.1})
+	p.AllocationTags = map[string]string{"AAPL": "tech"}
+	p.PeakValue = portfolio.NewDecimal(9000)
+	return p
+}
+
+func TestScenarioShocksTagsTickersAndCurrencies(t *testing.T) {
+	p := scenarioPortfolio()
+	shocks, err := p.ParseShocks("tech -30%, BTC -50%, all equities -20%, USD +5%")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []portfolio.Shock{
+		{Tag: "tech", Pct: -30},
+		{Ticker: "BTC", Pct: -50},
+		{AssetClass: portfolio.AssetEquity, Pct: -20},
+		{Currency: "USD", Pct: 5},
+	}
+	for i := range want {
+		if shocks[i] != want[i] {
+			t.Fatalf("shock %d = %#v want %#v", i, shocks[i], want[i])
+		}
+	}
+
+	res, err := p.RunScenario(portfolio.Scenario{Expression: "tech -30%, BTC -50%, USD +5%"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A stronger dollar lowers the euro position in a dollar portfolio; dollar
+	// positions keep their rate.
+	sap := 1100 / 1.05
+	shocked := 1000 + 700 + 2500 + sap
+	if !approx(res.TotalValue.Float(), 8100) || !approx(res.ShockedValue.Float(), shocked) || !approx(res.PnL.Float(), shocked-8100) {
+		t.Fatalf("result=%#v", res)
+	}
+	aapl, btc, sapPos := res.Positions[0], res.Positions[1], res.Positions[2]
+	if aapl.Ticker != "AAPL" || !approx(aapl.PriceChangePct, -30) || aapl.FXChangePct != 0 || !approx(aapl.PnL.Float(), -300) {
+		t.Fatalf("AAPL=%#v", aapl)
+	}
+	if !approx(btc.PnLPct, -50) || !approx(sapPos.FXChangePct, (1/1.05-1)*100) || sapPos.PriceChangePct != 0 {
+		t.Fatalf("BTC=%#v SAP=%#v", btc, sapPos)
+	}
+	if !approx(res.HighWaterMark.Float(), 9000) || !approx(res.DrawdownPct, (9000-shocked)/9000*100) || !approx(res.RecoveryNeededPct, (9000/shocked-1)*100) {
+		t.Fatalf("drawdown=%v recovery=%v", res.DrawdownPct, res.RecoveryNeededPct)
+	}
+
+	for _, expr := range []string{"", "tech", "tech -30% extra words", "AAPL -120%", "class:gold -10%"} {
+		if _, err := p.ParseShocks(expr); !errors.Is(err, portfolio.ErrInvalidScenario) {
+			t.Errorf("%q: err=%v want ErrInvalidScenario", expr, err)
+		}
+	}
+}
+
+func TestScenarioReplaysHistoryThroughOptions(t *testing.T) {
+	p := portfolio.New("replay", portfolio.NewDecimal(1000))
+	p.AddPosition(&portfolio.Position{Ticker: "AAA", Shares: portfolio.NewDecimal(10), CostBasis: portfolio.NewDecimal(1000), CurrentPrice: 100})
+	p.AddPosition(&portfolio.Position{Ticker: "BBB", Shares: portfolio.NewDecimal(5), CostBasis: portfolio.NewDecimal(500), CurrentPrice: 100})
+	p.AddPosition(&portfolio.Position{Ticker: "OPT", Shares: portfolio.NewDecimal(1), CurrentPrice: 5, UnderlyingPrice: 100, Option: &portfolio.OptionContract{Underlying: "AAA", Strike: 100, Expiry: date("2030-01-18"), Right: portfolio.Call, Multiplier: 100}})
+	if got := p.ReplayTickers(); len(got) != 2 || got[0] != "AAA" || got[1] != "BBB" {
+		t.Fatalf("replay tickers=%v", got)
+	}
+	closes := map[string][]portfolio.PricePoint{"AAA": {
+		{Date: date("2021-12-31"), Close: 80},
+		{Date: date("2022-01-03"), Close: 100},
+		{Date: date("2022-06-30"), Close: 80},
+		{Date: date("2022-07-01"), Close: 60},
+	}}
+	sc := portfolio.Scenario{Expression: "equities -10%", Replay: &portfolio.Replay{From: date("2022-01-03"), To: date("2022-06-30")}}
+	res, err := p.RunScenario(sc, closes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aaa, bbb, opt := res.Positions[0], res.Positions[1], res.Positions[2]
+	// The replayed fall of 20% compounds with the 10% shock.
+	if !approx(aaa.PriceChangePct, -28) || !approx(bbb.PriceChangePct, -10) {
+		t.Fatalf("AAA=%#v BBB=%#v", aaa, bbb)
+	}
+	if len(res.Unpriced) != 1 || res.Unpriced[0] != "BBB" {
+		t.Fatalf("unpriced=%v", res.Unpriced)
+	}
+	if opt.PnL.Float() >= 0 || opt.ShockedValue.IsNegative() || opt.PriceChangePct < -100 {
+		t.Fatalf("OPT=%#v", opt)
+	}
+
+	sc.Replay = &portfolio.Replay{From: date("2022-06-30"), To: date("2022-01-03")}
+	if _, err := p.RunScenario(sc, closes); !errors.Is(err, portfolio.ErrInvalidScenario) {
+		t.Fatalf("err=%v want ErrInvalidScenario", err)
+	}
+}
+
+func TestScenariosAreSavedAndRerun(t *testing.T) {
+	svc := app.NewPortfolioService(storage.NewMemoryPortfolioStore(), nopPricer{})
+	ctx := context.Background()
+	if _, err := svc.CreatePortfolio(ctx, "main", portfolio.NewDecimal(1000)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.RecordTransaction(ctx, "main", portfolio.Transaction{Type: portfolio.TxBuy, Ticker: "AAPL", Date: date("2024-01-02"), Quantity: portfolio.NewDecimal(5), Price: portfolio.NewDecimal(100)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.SaveScenario(ctx, "main", portfolio.Scenario{Expression: "all -20%"}); !errors.Is(err, portfolio.ErrInvalidScenario) {
+		t.Fatalf("err=%v want ErrInvalidScenario for a nameless scenario", err)
+	}
+	sc, err := svc.SaveScenario(ctx, "main", portfolio.Scenario{Name: "Crash", Description: "broad sell-off", Expression: "all -20%"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.Name != "crash" || len(sc.Shocks) != 1 || sc.Shocks[0].Pct != -20 {
+		t.Fatalf("saved=%#v", sc)
+	}
+	if _, err := svc.SaveScenario(ctx, "main", portfolio.Scenario{Name: "crash", Expression: "all -40%"}); err != nil {
+		t.Fatal(err)
+	}
+	list, _ := svc.ListScenarios(ctx, "main")
+	if len(list) != 1 || list[0].Shocks[0].Pct != -40 {
+		t.Fatalf("scenarios=%#v", list)
+	}
+
+	res, err := svc.RunSavedScenario(ctx, "main", "CRASH")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Scenario.Name != "crash" || len(res.Scenario.Shocks) != 1 || !approx(res.ShockedValue.Float(), 500+300) {
+		t.Fatalf("result=%#v", res)
+	}
+	// A rerun applies each saved shock once.
+	if _, err := svc.SaveScenario(ctx, "main", portfolio.Scenario{Name: "apple", Expression: "AAPL -50%"}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		res, err = svc.RunSavedScenario(ctx, "main", "apple")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Scenario.Shocks) != 1 || !approx(res.Positions[0].PriceChangePct, -50) || !approx(res.ShockedValue.Float(), 750) {
+			t.Fatalf("run %d result=%#v", i, res)
+		}
+	}
+	if err := svc.RemoveScenario(ctx, "main", "crash"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.RunSavedScenario(ctx, "main", "crash"); !errors.Is(err, portfolio.ErrInvalidScenario) {
+		t.Fatalf("err=%v want ErrInvalidScenario", err)
+	}
+}
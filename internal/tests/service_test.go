@@ -41,14 +41,14 @@ func TestServiceAddAndPersistPosition(t *testing.T) {
 	svc := app.NewPortfolioService(storeInfo.Store, nopPricer{})
 
 	ctx := context.Background()
-	if _, err := svc.CreatePortfolio(ctx, "Test", 500); err != nil {
+	if _, err := svc.CreatePortfolio(ctx, "Test", portfolio.NewDecimal(500)); err != nil {
 		t.Fatalf("CreatePortfolio: %v", err)
 	}
 
 	pos := &portfolio.Position{
 		Ticker:       "NVDA",
-		Shares:       2,
-		CostBasis:    200,
+		Shares:       portfolio.NewDecimal(2),
+		CostBasis:    portfolio.NewDecimal(200),
 		CurrentPrice: 110,
 	}
 	pos.UpdatePrice(pos.CurrentPrice)
@@ -63,7 +63,7 @@ func TestServiceAddAndPersistPosition(t *testing.T) {
 	}
 
 	wantTotal := 500.0 + (2 * 110)
-	if metrics.TotalValue != wantTotal {
+	if metrics.TotalValue != portfolio.NewDecimal(wantTotal) {
 		t.Fatalf("TotalValue=%v want %v", metrics.TotalValue, wantTotal)
 	}
 
@@ -74,7 +74,7 @@ func TestServiceAddAndPersistPosition(t *testing.T) {
 	if !ok {
 		t.Fatalf("position NVDA not found")
 	}
-	if detail.Ticker != "NVDA" || detail.Shares != 2 {
+	if detail.Ticker != "NVDA" || detail.Shares != portfolio.NewDecimal(2) {
 		t.Fatalf("unexpected detail: %#v", detail)
 	}
 }
@@ -88,10 +88,10 @@ func TestServiceUpdatesPricesAndPeaks(t *testing.T) {
 	svc := app.NewPortfolioService(storeInfo.Store, bumpPricer{})
 
 	ctx := context.Background()
-	if _, err := svc.CreatePortfolio(ctx, "Test", 0); err != nil {
+	if _, err := svc.CreatePortfolio(ctx, "Test", portfolio.NewDecimal(0)); err != nil {
 		t.Fatalf("CreatePortfolio: %v", err)
 	}
-	pos := &portfolio.Position{Ticker: "AAPL", Shares: 1, CostBasis: 100, CurrentPrice: 100}
+	pos := &portfolio.Position{Ticker: "AAPL", Shares: portfolio.NewDecimal(1), CostBasis: portfolio.NewDecimal(100), CurrentPrice: 100}
 	pos.UpdatePrice(pos.CurrentPrice)
 	if err := svc.AddOrUpdatePosition(ctx, "Test", pos); err != nil {
 		t.Fatalf("AddOrUpdatePosition: %v", err)
@@ -121,7 +121,7 @@ func TestServiceUpdatesPricesAndPeaks(t *testing.T) {
 	if err != nil || !ok {
 		t.Fatalf("GetPosition after recompute: %v ok=%v", err, ok)
 	}
-	if detail.PeakValue < detail.CurrentValue {
+	if detail.PeakValue.Cmp(detail.CurrentValue) < 0 {
 		t.Fatalf("PeakValue should be at least current value: peak=%v current=%v", detail.PeakValue, detail.CurrentValue)
 	}
 }
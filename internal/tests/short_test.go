@@ -0,0 +1,123 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+
+	"tracktrades/internal/domain/portfolio"
+)
+
+func TestShortSaleLedgerAndCover(t *testing.T) {
+	p := portfolio.New("shorts", portfolio.NewDecimal(0))
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxDeposit, Date: date("2024-01-02"), Amount: portfolio.NewDecimal(10000)},
+		{Type: portfolio.TxShort, Ticker: "TSLA", Date: date("2024-01-03"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(200)},
+	})
+
+	pos := p.Positions["TSLA"]
+	if pos == nil || !pos.IsShort() || pos.Shares != portfolio.NewDecimal(10) || !approx(pos.CostBasis.Float(), 2000) {
+		t.Fatalf("unexpected short position: %#v", pos)
+	}
+	if !approx(p.Cash.Float(), 12000) || !approx(pos.CurrentValue().Float(), -2000) || !approx(p.TotalValue().Float(), 10000) {
+		t.Fatalf("Cash=%v Value=%v Total=%v", p.Cash, pos.CurrentValue(), p.TotalValue())
+	}
+
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxCover, Ticker: "TSLA", Date: date("2024-02-01"), Quantity: portfolio.NewDecimal(4), Price: portfolio.NewDecimal(150)},
+	})
+	if !approx(p.RealizedPnL.Float(), 200) || !approx(p.Cash.Float(), 11400) || !approx(p.Positions["TSLA"].Shares.Float(), 6) {
+		t.Fatalf("RealizedPnL=%v Cash=%v Shares=%v", p.RealizedPnL, p.Cash, p.Positions["TSLA"].Shares)
+	}
+
+	sales, err := p.Sales("TSLA")
+	if err != nil || len(sales) != 1 {
+		t.Fatalf("sales=%v err=%v", sales, err)
+	}
+	if s := sales[0]; !approx(s.Proceeds.Float(), 800) || !approx(s.CostBasis.Float(), 600) || !approx(s.Gain.Float(), 200) || s.Lots[0].Term != portfolio.ShortTerm {
+		t.Fatalf("unexpected cover sale: %#v", s)
+	}
+
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxCover, Ticker: "TSLA", Date: date("2024-03-01"), Quantity: portfolio.NewDecimal(6), Price: portfolio.NewDecimal(250)},
+	})
+	if _, ok := p.Positions["TSLA"]; ok || !approx(p.RealizedPnL.Float(), -100) || !approx(p.Cash.Float(), 9900) {
+		t.Fatalf("RealizedPnL=%v Cash=%v positions=%v", p.RealizedPnL, p.Cash, p.Positions)
+	}
+}
+
+func TestShortRejectsMixedSides(t *testing.T) {
+	p := portfolio.New("shorts", portfolio.NewDecimal(0))
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxDeposit, Date: date("2024-01-02"), Amount: portfolio.NewDecimal(10000)},
+		{Type: portfolio.TxShort, Ticker: "TSLA", Date: date("2024-01-03"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(200)},
+		{Type: portfolio.TxBuy, Ticker: "AAPL", Date: date("2024-01-03"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(100)},
+	})
+
+	bad := []portfolio.Transaction{
+		{Type: portfolio.TxBuy, Ticker: "TSLA", Date: date("2024-01-04"), Quantity: portfolio.NewDecimal(1), Price: portfolio.NewDecimal(200)},
+		{Type: portfolio.TxSell, Ticker: "TSLA", Date: date("2024-01-04"), Quantity: portfolio.NewDecimal(1), Price: portfolio.NewDecimal(200)},
+		{Type: portfolio.TxShort, Ticker: "AAPL", Date: date("2024-01-04"), Quantity: portfolio.NewDecimal(1), Price: portfolio.NewDecimal(100)},
+		{Type: portfolio.TxCover, Ticker: "TSLA", Date: date("2024-01-04"), Quantity: portfolio.NewDecimal(11), Price: portfolio.NewDecimal(200)},
+	}
+	for _, tx := range bad {
+		if _, err := p.Record(tx); !errors.Is(err, portfolio.ErrInvalidTransaction) {
+			t.Fatalf("%s %s: err=%v want ErrInvalidTransaction", tx.Type, tx.Ticker, err)
+		}
+	}
+}
+
+func TestShortMetricsUseTrough(t *testing.T) {
+	pos := &portfolio.Position{Ticker: "TSLA", Side: portfolio.Short, Shares: portfolio.NewDecimal(10), CostBasis: portfolio.NewDecimal(2000), CurrentPrice: 200, PeakPrice: 200}
+	pos.UpdatePrice(160)
+	pos.UpdatePrice(180)
+	if pos.PeakPrice != 160 {
+		t.Fatalf("PeakPrice=%v want trough 160", pos.PeakPrice)
+	}
+
+	d := pos.DetailedMetrics()
+	if d.Side != portfolio.Short || !approx(d.CurrentValue.Float(), -1800) || !approx(d.UnrealizedPnL.Float(), 200) || !approx(d.UnrealizedPnLPct, 10) {
+		t.Fatalf("unexpected short details: %#v", d)
+	}
+	// 180 is 12.5% above the 160 trough; the price must fall 11.11% to get back.
+	if !approx(d.DrawdownFromPeakPct, 12.5) || !approx(d.RecoveryNeededPct, 12.5/112.5*100) {
+		t.Fatalf("Drawdown=%v Recovery=%v", d.DrawdownFromPeakPct, d.RecoveryNeededPct)
+	}
+}
+
+func TestGrossAndNetExposure(t *testing.T) {
+	p := portfolio.New("shorts", portfolio.NewDecimal(0))
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxDeposit, Date: date("2024-01-02"), Amount: portfolio.NewDecimal(10000)},
+		{Type: portfolio.TxBuy, Ticker: "AAPL", Date: date("2024-01-03"), Quantity: portfolio.NewDecimal(60), Price: portfolio.NewDecimal(100)},
+		{Type: portfolio.TxShort, Ticker: "TSLA", Date: date("2024-01-03"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(200)},
+	})
+
+	m := p.Metrics()
+	e := m.Exposure
+	if !approx(e.Long.Float(), 6000) || !approx(e.Short.Float(), 2000) || !approx(e.Gross.Float(), 8000) || !approx(e.Net.Float(), 4000) {
+		t.Fatalf("unexpected exposure: %#v", e)
+	}
+	if !approx(m.TotalValue.Float(), 10000) || !approx(e.GrossPct, 80) || !approx(e.NetPct, 40) {
+		t.Fatalf("TotalValue=%v exposure=%#v", m.TotalValue, e)
+	}
+}
+
+func TestShortStopAlertFiresOnRise(t *testing.T) {
+	p := portfolio.New("shorts", portfolio.NewDecimal(0))
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxDeposit, Date: date("2024-01-02"), Amount: portfolio.NewDecimal(10000)},
+		{Type: portfolio.TxShort, Ticker: "TSLA", Date: date("2024-01-03"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(200)},
+	})
+	if _, err := p.AddAlert(portfolio.AlertRule{Kind: portfolio.AlertStopPrice, Ticker: "TSLA", Threshold: 220}); err != nil {
+		t.Fatal(err)
+	}
+
+	p.Positions["TSLA"].UpdatePrice(190)
+	if events := p.EvaluateAlerts(date("2024-01-04")); len(events) != 0 {
+		t.Fatalf("unexpected events: %#v", events)
+	}
+	p.Positions["TSLA"].UpdatePrice(225)
+	if events := p.EvaluateAlerts(date("2024-01-05")); len(events) != 1 || events[0].State != portfolio.AlertTriggered {
+		t.Fatalf("expected stop to trigger: %#v", events)
+	}
+}
@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+
+	"tracktrades/internal/domain/portfolio"
+)
+
+// closeSeries dates closes on consecutive days from 2024-01-01.
+func closeSeries(closes ...float64) []portfolio.PricePoint {
+	points := make([]portfolio.PricePoint, len(closes))
+	for i, c := range closes {
+		points[i] = portfolio.PricePoint{Date: date("2024-01-01").AddDate(0, 0, i), Close: c}
+	}
+	return points
+}
+
+// wavySeries is a deterministic close series with ups and downs.
+func wavySeries(n int) []float64 {
+	closes := make([]float64, n)
+	for i := range closes {
+		closes[i] = 100 * (1 + 0.002*float64(i) + 0.05*math.Sin(float64(i)))
+	}
+	return closes
+}
+
+func simulationPortfolio() *portfolio.Portfolio {
+	p := portfolio.New("sim", portfolio.NewDecimal(1000))
+	p.AddPosition(&portfolio.Position{Ticker: "AAA", Shares: portfolio.NewDecimal(10), CostBasis: portfolio.NewDecimal(1000), CurrentPrice: 100, PeakPrice: 100})
+	p.AddPosition(&portfolio.Position{Ticker: "BBB", Shares: portfolio.NewDecimal(10), Side: portfolio.Short, CostBasis: portfolio.NewDecimal(1000), CurrentPrice: 100, PeakPrice: 100})
+	return p
+}
+
+func TestSimulationIsReproducibleBySeed(t *testing.T) {
+	p := simulationPortfolio()
+	delete(p.Positions, "BBB")
+	closes := map[string][]portfolio.PricePoint{"AAA": closeSeries(wavySeries(60)...)}
+	opts := portfolio.SimulationOptions{HorizonDays: 21, Paths: 200, Seed: 42, DrawdownLimitPct: 5, GoalValue: 2100}
+
+	first, err := p.Simulate(closes, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := p.Simulate(closes, opts)
+	if !reflect.DeepEqual(first, again) {
+		t.Fatal("same seed gave different results")
+	}
+	opts.Seed = 7
+	other, _ := p.Simulate(closes, opts)
+	if reflect.DeepEqual(first.Bands, other.Bands) {
+		t.Fatal("different seeds gave the same bands")
+	}
+
+	if first.Seed != 42 || first.SampleDays != 59 || len(first.Bands) != 5 || first.Bands[4].Day != 21 {
+		t.Fatalf("result=%#v", first)
+	}
+	final := first.Bands[4].Values
+	if !(final[0] < final[2] && final[2] < final[4]) {
+		t.Fatalf("final percentiles=%v", final)
+	}
+	if first.DrawdownBreachPct <= 0 || first.DrawdownBreachPct >= 100 || first.GoalAtEndPct > first.GoalReachedPct {
+		t.Fatalf("breach=%v goal=%v/%v", first.DrawdownBreachPct, first.GoalReachedPct, first.GoalAtEndPct)
+	}
+}
+
+func TestSimulationPreservesCorrelation(t *testing.T) {
+	// A long and a short of two tickers that always move together cancel out
+	// on every path, which only holds when their returns are drawn jointly.
+	p := simulationPortfolio()
+	series := closeSeries(wavySeries(40)...)
+	closes := map[string][]portfolio.PricePoint{"AAA": series, "BBB": series}
+	for _, method := range []portfolio.SimulationMethod{portfolio.SimulateBootstrap, portfolio.SimulateNormal} {
+		res, err := p.Simulate(closes, portfolio.SimulationOptions{Method: method, HorizonDays: 10, Paths: 50, Seed: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, band := range res.Bands {
+			for _, v := range band.Values {
+				if math.Abs(v-1000) > 1e-6 {
+					t.Fatalf("%s band=%#v", method, band)
+				}
+			}
+		}
+	}
+}
+
+func TestSimulationSamplesStoredHistory(t *testing.T) {
+	p := simulationPortfolio()
+	delete(p.Positions, "BBB")
+	p.AddPosition(&portfolio.Position{Ticker: "OPT", Shares: portfolio.NewDecimal(1), CurrentPrice: 2, Option: &portfolio.OptionContract{Underlying: "AAA", Strike: 110, Expiry: date("2030-01-18"), Right: portfolio.Call, Multiplier: 100}})
+	// Every stored day gains 1%, so every path compounds the same way.
+	for i := 0; i < 25; i++ {
+		p.History = append(p.History, portfolio.Snapshot{Time: date("2024-01-01").AddDate(0, 0, i), Prices: map[string]float64{"AAA": 100 * math.Pow(1.01, float64(i))}})
+	}
+	res, err := p.Simulate(nil, portfolio.SimulationOptions{HorizonDays: 3, Paths: 10, Seed: 3, GoalValue: 2030, DrawdownLimitPct: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := 1000 + 200 + 1000*math.Pow(1.01, 3)
+	if len(res.HeldConstant) != 1 || res.HeldConstant[0] != "OPT" || !approx(res.Bands[0].Values[0], want) || !approx(res.MeanFinal, want) {
+		t.Fatalf("result=%#v", res)
+	}
+	if res.GoalReachedPct != 100 || res.GoalAtEndPct != 100 || res.DrawdownBreachPct != 0 {
+		t.Fatalf("goal=%v/%v breach=%v", res.GoalReachedPct, res.GoalAtEndPct, res.DrawdownBreachPct)
+	}
+
+	p.History = p.History[:10]
+	if _, err := p.Simulate(nil, portfolio.SimulationOptions{Seed: 3}); !errors.Is(err, portfolio.ErrInvalidSimulation) {
+		t.Fatalf("err=%v want ErrInvalidSimulation", err)
+	}
+	if _, err := p.Simulate(nil, portfolio.SimulationOptions{Paths: 1000000}); !errors.Is(err, portfolio.ErrInvalidSimulation) {
+		t.Fatalf("err=%v want ErrInvalidSimulation", err)
+	}
+}
@@ -2,8 +2,11 @@ package tests
 
 import (
 	"context"
+	"errors"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 
 	"tracktrades/internal/adapters/storage"
@@ -18,7 +21,7 @@ func TestMemoryRepositoryIsIsolated(t *testing.T) {
 
 	store := storeInfo.Store
 	ctx := context.Background()
-	if _, err := store.Create(ctx, "SessionOne", 500); err != nil {
+	if _, err := store.Create(ctx, "SessionOne", portfolio.NewDecimal(500)); err != nil {
 		t.Fatalf("Create: %v", err)
 	}
 
@@ -26,17 +29,17 @@ func TestMemoryRepositoryIsIsolated(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Load: %v", err)
 	}
-	if loaded.Name != "SessionOne" || loaded.Cash != 500 {
+	if loaded.Name != "SessionOne" || loaded.Cash != portfolio.NewDecimal(500) {
 		t.Fatalf("unexpected portfolio: %#v", loaded)
 	}
 
 	// Mutating the loaded portfolio should not affect persisted state until Save is called.
-	loaded.Cash = 0
+	loaded.Cash = portfolio.NewDecimal(0)
 	again, err := store.Load(ctx, "SessionOne")
 	if err != nil {
 		t.Fatalf("Load after mutation: %v", err)
 	}
-	if again.Cash != 500 {
+	if again.Cash != portfolio.NewDecimal(500) {
 		t.Fatalf("expected persisted cash to remain 500, got %v", again.Cash)
 	}
 }
@@ -52,7 +55,7 @@ func TestFileRepositorySpecCreatesFile(t *testing.T) {
 	store := storeInfo.Store
 	ctx := context.Background()
 
-	if _, err := store.Create(ctx, "persisted", 0); err != nil {
+	if _, err := store.Create(ctx, "persisted", portfolio.NewDecimal(0)); err != nil {
 		t.Fatalf("Create: %v", err)
 	}
 
@@ -61,7 +64,7 @@ func TestFileRepositorySpecCreatesFile(t *testing.T) {
 		t.Fatalf("Load: %v", err)
 	}
 
-	p.Positions["TEST"] = &portfolio.Position{Ticker: "TEST", Shares: 1, CurrentPrice: 10}
+	p.Positions["TEST"] = &portfolio.Position{Ticker: "TEST", Shares: portfolio.NewDecimal(1), CurrentPrice: 10}
 
 	if err := store.Save(ctx, "persisted", p); err != nil {
 		t.Fatalf("Save: %v", err)
@@ -96,7 +99,7 @@ func TestGzipRepositorySpecCreatesFile(t *testing.T) {
 	store := storeInfo.Store
 	ctx := context.Background()
 
-	if _, err := store.Create(ctx, "compressed", 50); err != nil {
+	if _, err := store.Create(ctx, "compressed", portfolio.NewDecimal(50)); err != nil {
 		t.Fatalf("Create: %v", err)
 	}
 
@@ -104,7 +107,7 @@ func TestGzipRepositorySpecCreatesFile(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Load: %v", err)
 	}
-	if loaded.Cash != 50 {
+	if loaded.Cash != portfolio.NewDecimal(50) {
 		t.Fatalf("Cash=%v want 50", loaded.Cash)
 	}
 
@@ -131,20 +134,20 @@ func TestSQLiteRepositoryPersistsData(t *testing.T) {
 	store := storeInfo.Store
 	ctx := context.Background()
 
-	if _, err := store.Create(ctx, "db", 10); err != nil {
+	if _, err := store.Create(ctx, "db", portfolio.NewDecimal(10)); err != nil {
 		t.Fatalf("Create: %v", err)
 	}
 
-	portfolio, err := store.Load(ctx, "db")
+	p, err := store.Load(ctx, "db")
 	if err != nil {
 		t.Fatalf("Load: %v", err)
 	}
-	if portfolio.Cash != 10 {
-		t.Fatalf("Cash=%v want 10", portfolio.Cash)
+	if p.Cash != portfolio.NewDecimal(10) {
+		t.Fatalf("Cash=%v want 10", p.Cash)
 	}
 
-	portfolio.Cash = 15
-	if err := store.Save(ctx, "db", portfolio); err != nil {
+	p.Cash = portfolio.NewDecimal(15)
+	if err := store.Save(ctx, "db", p); err != nil {
 		t.Fatalf("Save: %v", err)
 	}
 
@@ -152,11 +155,48 @@ func TestSQLiteRepositoryPersistsData(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Load after save: %v", err)
 	}
-	if again.Cash != 15 {
+	if again.Cash != portfolio.NewDecimal(15) {
 		t.Fatalf("Cash after save=%v want 15", again.Cash)
 	}
 }
 
+func TestRepositoriesKeepGlobalWatchlistsApart(t *testing.T) {
+	dir := t.TempDir()
+	for _, spec := range []string{"memory", "file:" + filepath.Join(dir, "json"), "gzip:" + filepath.Join(dir, "gz"), "sqlite:" + filepath.Join(dir, "watch.db")} {
+		storeInfo, err := storage.NewPortfolioStore(spec)
+		if err != nil {
+			t.Fatalf("NewPortfolioStore %s: %v", spec, err)
+		}
+		store := storeInfo.Store
+		ctx := context.Background()
+
+		if _, err := store.LoadWatchlists(ctx); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("%s: err=%v want fs.ErrNotExist before the first save", spec, err)
+		}
+		lists := portfolio.Watchlists{{Name: "semis", Items: []portfolio.WatchItem{{Ticker: "NVDA", Price: 100}}}}
+		if err := store.SaveWatchlists(ctx, lists); err != nil {
+			t.Fatalf("%s: SaveWatchlists: %v", spec, err)
+		}
+		if _, err := store.Create(ctx, "main", portfolio.NewDecimal(0)); err != nil {
+			t.Fatalf("%s: Create: %v", spec, err)
+		}
+
+		loaded, err := store.LoadWatchlists(ctx)
+		if err != nil || !reflect.DeepEqual(loaded, lists) {
+			t.Fatalf("%s: lists=%#v err=%v", spec, loaded, err)
+		}
+		if names, err := store.List(ctx); err != nil || len(names) != 1 || names[0] != "main" {
+			t.Fatalf("%s: List=%v err=%v", spec, names, err)
+		}
+		if err := store.SaveWatchlists(ctx, nil); err != nil {
+			t.Fatalf("%s: SaveWatchlists: %v", spec, err)
+		}
+		if loaded, err := store.LoadWatchlists(ctx); err != nil || len(loaded) != 0 {
+			t.Fatalf("%s: emptied lists=%#v err=%v", spec, loaded, err)
+		}
+	}
+}
+
 func TestUnsupportedRepositorySpec(t *testing.T) {
 	if _, err := storage.NewPortfolioStore("db:postgres"); err == nil {
 		t.Fatalf("expected error for unsupported backend")
@@ -0,0 +1,61 @@
+package tests
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"tracktrades/internal/domain/portfolio"
+)
+
+func TestTaxReportClassifiesHoldingPeriod(t *testing.T) {
+	p := portfolio.New("tax", portfolio.NewDecimal(10000))
+	txs := []portfolio.Transaction{
+		{Type: portfolio.TxBuy, Ticker: "MSFT", Date: date("2022-06-01"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(100)},
+		{Type: portfolio.TxBuy, Ticker: "MSFT", Date: date("2023-09-01"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(200)},
+		{Type: portfolio.TxSell, Ticker: "MSFT", Date: date("2023-06-02"), Quantity: portfolio.NewDecimal(2), Price: portfolio.NewDecimal(90)},
+		{Type: portfolio.TxSell, Ticker: "MSFT", Date: date("2024-03-01"), Quantity: portfolio.NewDecimal(15), Price: portfolio.NewDecimal(250)},
+	}
+	for _, tx := range txs {
+		if _, err := p.Record(tx); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+
+	report, err := p.TaxReport(2024)
+	if err != nil {
+		t.Fatalf("TaxReport: %v", err)
+	}
+	if len(report.Lots) != 2 {
+		t.Fatalf("Lots=%d want 2", len(report.Lots))
+	}
+	if !approx(report.LongTerm.Gain.Float(), 8*250-800) {
+		t.Fatalf("LongTerm.Gain=%v want %v", report.LongTerm.Gain, 8*250-800)
+	}
+	if !approx(report.ShortTerm.Gain.Float(), 7*250-1400) {
+		t.Fatalf("ShortTerm.Gain=%v want %v", report.ShortTerm.Gain, 7*250-1400)
+	}
+
+	prior, err := p.TaxReport(2023)
+	if err != nil {
+		t.Fatalf("TaxReport 2023: %v", err)
+	}
+	if len(prior.Lots) != 1 || prior.Lots[0].Term != portfolio.LongTerm || !approx(prior.Total.Gain.Float(), -20) {
+		t.Fatalf("unexpected 2023 report: %#v", prior)
+	}
+
+	var buf bytes.Buffer
+	if err := portfolio.WriteForm8949CSV(&buf, report); err != nil {
+		t.Fatalf("WriteForm8949CSV: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("csv lines=%d want 3: %q", len(lines), buf.String())
+	}
+	if !strings.HasPrefix(lines[1], "I,7 sh MSFT,09/01/2023,03/01/2024") {
+		t.Fatalf("unexpected short-term row %q", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], "II,8 sh MSFT,06/01/2022,03/01/2024") {
+		t.Fatalf("unexpected long-term row %q", lines[2])
+	}
+}
@@ -0,0 +1,178 @@
+package tests
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"tracktrades/internal/domain/portfolio"
+)
+
+func recordAll(t *testing.T, p *portfolio.Portfolio, txs []portfolio.Transaction) {
+	t.Helper()
+	for _, tx := range txs {
+		if _, err := p.Record(tx); err != nil {
+			t.Fatalf("Record %s %s: %v", tx.Type, tx.Date.Format("2006-01-02"), err)
+		}
+	}
+}
+
+func TestWashSaleRebuyAfterLoss(t *testing.T) {
+	p := portfolio.New("wash", portfolio.NewDecimal(10000))
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxBuy, Ticker: "TSLA", Date: date("2024-01-02"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(200)},
+		{Type: portfolio.TxSell, Ticker: "TSLA", Date: date("2024-02-01"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(150)},
+		{Type: portfolio.TxBuy, Ticker: "TSLA", Date: date("2024-02-20"), Quantity: portfolio.NewDecimal(6), Price: portfolio.NewDecimal(160)},
+	})
+
+	sales, err := p.Sales("TSLA")
+	if err != nil {
+		t.Fatalf("Sales: %v", err)
+	}
+	cl := sales[0].Lots[0]
+	if !cl.WashSale || !approx(cl.WashSaleDisallowed.Float(), 300) {
+		t.Fatalf("expected 300 of the 500 loss disallowed, got %#v", cl)
+	}
+	if !approx(cl.TaxGain.Float(), -200) || !approx(cl.Gain.Float(), -500) {
+		t.Fatalf("TaxGain=%v Gain=%v want -200 and -500", cl.TaxGain, cl.Gain)
+	}
+
+	d, ok := p.PositionDetails("TSLA")
+	if !ok {
+		t.Fatalf("TSLA not found")
+	}
+	if !approx(d.WashSaleAdjustment.Float(), 300) || !approx(d.Lots[0].TaxBasis().Float(), 960+300) {
+		t.Fatalf("replacement lot should carry the disallowed loss: %#v", d.Lots)
+	}
+	if !approx(d.CostBasis.Float(), 960) {
+		t.Fatalf("economic cost basis should be unchanged, got %v", d.CostBasis)
+	}
+}
+
+func TestWashSaleBuyBeforeLossAndTaxReport(t *testing.T) {
+	p := portfolio.New("wash", portfolio.NewDecimal(10000))
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxBuy, Ticker: "AMD", Date: date("2024-01-02"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(100)},
+		{Type: portfolio.TxBuy, Ticker: "AMD", Date: date("2024-03-01"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(80)},
+		{Type: portfolio.TxSell, Ticker: "AMD", Date: date("2024-03-15"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(70)},
+		{Type: portfolio.TxSell, Ticker: "AMD", Date: date("2024-06-03"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(90)},
+	})
+
+	report, err := p.TaxReport(2024)
+	if err != nil {
+		t.Fatalf("TaxReport: %v", err)
+	}
+	if !approx(report.ShortTerm.Adjustment.Float(), 300) {
+		t.Fatalf("Adjustment=%v want 300", report.ShortTerm.Adjustment)
+	}
+	// -300 loss is deferred, then the replacement lot sells for 900 against 800+300 adjusted basis.
+	if !approx(report.ShortTerm.Gain.Float(), 0+(900-1100)) {
+		t.Fatalf("Gain=%v want -200", report.ShortTerm.Gain)
+	}
+	if !approx(p.RealizedPnL.Float(), -300+100) {
+		t.Fatalf("economic RealizedPnL=%v want -200", p.RealizedPnL)
+	}
+
+	var buf bytes.Buffer
+	if err := portfolio.WriteForm8949CSV(&buf, report); err != nil {
+		t.Fatalf("WriteForm8949CSV: %v", err)
+	}
+	if !strings.Contains(buf.String(), ",W,300.00,0.00") {
+		t.Fatalf("expected wash-sale adjustment row, got %q", buf.String())
+	}
+}
+
+func TestNoWashSaleOutsideWindow(t *testing.T) {
+	p := portfolio.New("wash", portfolio.NewDecimal(10000))
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxBuy, Ticker: "INTC", Date: date("2024-01-02"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(50)},
+		{Type: portfolio.TxSell, Ticker: "INTC", Date: date("2024-02-01"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(40)},
+		{Type: portfolio.TxBuy, Ticker: "INTC", Date: date("2024-03-05"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(41)},
+	})
+
+	sales, err := p.Sales("INTC")
+	if err != nil {
+		t.Fatalf("Sales: %v", err)
+	}
+	if sales[0].Lots[0].WashSale {
+		t.Fatalf("buy 33 days later must not trigger a wash sale")
+	}
+}
+
+func TestWashSaleReplacementCapacityFollowsSalesAndSplits(t *testing.T) {
+	p := portfolio.New("wash", portfolio.NewDecimal(10000))
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxBuy, Ticker: "XYZ", Date: date("2024-01-02"), Quantity: portfolio.NewDecimal(4), Price: portfolio.NewDecimal(100)},
+		{Type: portfolio.TxSell, Ticker: "XYZ", Date: date("2024-02-01"), Quantity: portfolio.NewDecimal(4), Price: portfolio.NewDecimal(80)},
+		// Four of these ten shares replace the washed ones.
+		{Type: portfolio.TxBuy, Ticker: "XYZ", Date: date("2024-02-05"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(90)},
+		{Type: portfolio.TxBuy, Ticker: "XYZ", Date: date("2024-02-06"), Quantity: portfolio.NewDecimal(5), Price: portfolio.NewDecimal(90)},
+		// Selling half the replacement lot takes half its replaced shares.
+		{Type: portfolio.TxSell, Ticker: "XYZ", Date: date("2024-02-07"), Quantity: portfolio.NewDecimal(5), Price: portfolio.NewDecimal(100)},
+		{Type: portfolio.TxSell, Ticker: "XYZ", Date: date("2024-02-08"), Quantity: portfolio.NewDecimal(5), Price: portfolio.NewDecimal(70), LotMethod: portfolio.LotLIFO},
+	})
+	sales, err := p.Sales("XYZ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cl := sales[2].Lots[0]; !cl.WashSale || !approx(cl.WashSaleDisallowed.Float(), 60) {
+		t.Fatalf("three free replacement shares should take 60 of the 100 loss: %#v", cl)
+	}
+	d, _ := p.PositionDetails("XYZ")
+	if len(d.Lots) != 1 || !approx(d.Lots[0].WashReplaced.Float(), 5) || !approx(d.Lots[0].WashSaleAdjustment.Float(), 40+60) {
+		t.Fatalf("lots=%#v", d.Lots)
+	}
+
+	// After a split every replacement share is still used up.
+	p = portfolio.New("wash", portfolio.NewDecimal(10000))
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxBuy, Ticker: "XYZ", Date: date("2024-01-02"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(100)},
+		{Type: portfolio.TxSell, Ticker: "XYZ", Date: date("2024-02-01"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(80)},
+		{Type: portfolio.TxBuy, Ticker: "XYZ", Date: date("2024-02-05"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(85)},
+		{Type: portfolio.TxSplit, Ticker: "XYZ", Date: date("2024-02-06"), Ratio: portfolio.NewDecimal(2)},
+		{Type: portfolio.TxBuy, Ticker: "XYZ", Date: date("2024-02-07"), Quantity: portfolio.NewDecimal(5), Price: portfolio.NewDecimal(40)},
+		{Type: portfolio.TxSell, Ticker: "XYZ", Date: date("2024-02-08"), Quantity: portfolio.NewDecimal(5), Price: portfolio.NewDecimal(30), LotMethod: portfolio.LotLIFO},
+	})
+	sales, _ = p.Sales("XYZ")
+	if cl := sales[1].Lots[0]; cl.WashSale || !approx(cl.TaxGain.Float(), -50) {
+		t.Fatalf("split replacement shares should have no room left: %#v", cl)
+	}
+}
+
+func TestWashSalePendingLossSplitsAndHoldingPeriodCarries(t *testing.T) {
+	p := portfolio.New("wash", portfolio.NewDecimal(10000))
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxBuy, Ticker: "XYZ", Date: date("2023-11-01"), Quantity: portfolio.NewDecimal(20), Price: portfolio.NewDecimal(100)},
+		{Type: portfolio.TxSell, Ticker: "XYZ", Date: date("2024-02-01"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(80)},
+		{Type: portfolio.TxSplit, Ticker: "XYZ", Date: date("2024-02-05"), Ratio: portfolio.NewDecimal(2)},
+		// Twenty post-split shares replace the ten sold before the split.
+		{Type: portfolio.TxBuy, Ticker: "XYZ", Date: date("2024-02-10"), Quantity: portfolio.NewDecimal(20), Price: portfolio.NewDecimal(40)},
+	})
+	sales, err := p.Sales("XYZ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cl := sales[0].Lots[0]; !approx(cl.WashSaleDisallowed.Float(), 200) {
+		t.Fatalf("the whole loss should be disallowed: %#v", cl)
+	}
+
+	// The washed shares were held 333 days, so the replacement bought in
+	// December is long-term by late January.
+	p = portfolio.New("wash", portfolio.NewDecimal(10000))
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxBuy, Ticker: "XYZ", Date: date("2023-01-02"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(100)},
+		{Type: portfolio.TxSell, Ticker: "XYZ", Date: date("2023-12-01"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(80)},
+		{Type: portfolio.TxBuy, Ticker: "XYZ", Date: date("2023-12-10"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(85)},
+	})
+	d, _ := p.PositionDetails("XYZ")
+	if start := d.Lots[0].HoldingStart; start == nil || !start.Equal(date("2023-01-11")) || d.Lots[0].Term(date("2024-01-20")) != portfolio.LongTerm {
+		t.Fatalf("lot=%#v", d.Lots[0])
+	}
+	recordAll(t, p, []portfolio.Transaction{
+		{Type: portfolio.TxSell, Ticker: "XYZ", Date: date("2024-01-20"), Quantity: portfolio.NewDecimal(10), Price: portfolio.NewDecimal(90)},
+	})
+	sales, _ = p.Sales("XYZ")
+	if cl := sales[1].Lots[0]; cl.Term != portfolio.LongTerm || !cl.Acquired.Equal(date("2023-12-10")) {
+		t.Fatalf("closed=%#v", cl)
+	}
+}
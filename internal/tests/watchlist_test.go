@@ -0,0 +1,200 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"tracktrades/internal/adapters/storage"
+	"tracktrades/internal/app"
+	"tracktrades/internal/domain/portfolio"
+)
+
+// highPricer quotes prices like scriptedPricer and reports a fixed high as
+// the historical peak.
+type highPricer struct {
+	scriptedPricer
+	highs map[string]float64
+}
+
+func (h highPricer) ComputeHistoricalPeak(ctx context.Context, p *portfolio.Position) error {
+	if high, ok := h.highs[p.Ticker]; ok {
+		p.PeakPrice = high
+	}
+	return nil
+}
+
+func TestWatchlistTracksChangeAndHigh(t *testing.T) {
+	p := portfolio.New("watch", portfolio.NewDecimal(0))
+	now := date("2024-03-01")
+	if _, err := p.Watchlists.Watch("Tech", "nvda", now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Watchlists.Watch("tech", "amd", now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Watchlists.Watch("", "AMD", now); !errors.Is(err, portfolio.ErrInvalidWatchlist) {
+		t.Fatalf("err=%v want ErrInvalidWatchlist", err)
+	}
+
+	p.Watchlists.UpdateWatchQuote("NVDA", 100, 125)
+	p.Watchlists.UpdateWatchQuote("NVDA", 110, 0)
+	// A new high raises the stored one.
+	p.Watchlists.UpdateWatchQuote("AMD", 150, 140)
+
+	views, err := p.Watchlists.WatchlistViews("TECH")
+	if err != nil || len(views) != 1 || len(views[0].Items) != 2 {
+		t.Fatalf("views=%#v err=%v", views, err)
+	}
+	nvda, amd := views[0].Items[0], views[0].Items[1]
+	if nvda.Ticker != "NVDA" || nvda.AddedPrice != 100 || !approx(nvda.ChangeSinceAddedPct, 10) ||
+		!approx(nvda.DrawdownFromHighPct, 12) || !approx(nvda.RecoveryNeededPct, 125.0/110*100-100) {
+		t.Fatalf("nvda=%#v", nvda)
+	}
+	if amd.High52w != 150 || amd.DrawdownFromHighPct != 0 {
+		t.Fatalf("amd=%#v", amd)
+	}
+
+	if !p.Watchlists.Unwatch("tech", "NVDA") || p.Watchlists.Unwatch("tech", "NVDA") || len(p.Watchlists.WatchedTickers()) != 1 {
+		t.Fatalf("watched=%v", p.Watchlists.WatchedTickers())
+	}
+	if !p.Watchlists.Unwatch("tech", "") || len(p.Watchlists) != 0 {
+		t.Fatalf("watchlists=%#v", p.Watchlists)
+	}
+	if _, err := p.Watchlists.WatchlistViews("tech"); !errors.Is(err, portfolio.ErrInvalidWatchlist) {
+		t.Fatalf("err=%v want ErrInvalidWatchlist", err)
+	}
+}
+
+func TestAlertsEvaluateWatchedTickers(t *testing.T) {
+	p := portfolio.New("watch", portfolio.NewDecimal(0))
+	if _, err := p.Watchlists.Watch("ideas", "TSLA", date("2024-03-01")); err != nil {
+		t.Fatal(err)
+	}
+	p.Watchlists.UpdateWatchQuote("TSLA", 180, 200)
+	stop, _ := p.AddAlert(portfolio.AlertRule{Kind: portfolio.AlertStopPrice, Ticker: "TSLA", Threshold: 170})
+	trail, _ := p.AddAlert(portfolio.AlertRule{Kind: portfolio.AlertTrailingStop, Ticker: "TSLA", Threshold: 15})
+	shared, _ := p.AddAlert(portfolio.AlertRule{Kind: portfolio.AlertTargetPrice, Ticker: "MSFT", Threshold: 400})
+
+	if events := p.EvaluateAlerts(time.Now()); len(events) != 0 {
+		t.Fatalf("unexpected events %#v", events)
+	}
+
+	// A stop-price rule fires at or below its threshold, as for a long
+	// position; the trailing stop measures from the 52-week high.
+	p.Watchlists.UpdateWatchQuote("TSLA", 165, 0)
+	global := []portfolio.Watchlist{{Name: "megacaps", Items: []portfolio.WatchItem{{Ticker: "MSFT", Price: 410, High52w: 420}}}}
+	events := p.EvaluateAlerts(time.Now(), global...)
+	if len(events) != 3 {
+		t.Fatalf("events=%#v", events)
+	}
+	fired := map[string]float64{}
+	for _, e := range events {
+		fired[e.Rule.ID] = e.Value
+	}
+	if fired[stop.ID] != 165 || !approx(fired[trail.ID], 17.5) || fired[shared.ID] != 410 {
+		t.Fatalf("fired=%v", fired)
+	}
+}
+
+func TestGlobalWatchlistRefreshedWithPortfolio(t *testing.T) {
+	prices := scriptedPricer{"NVDA": 100}
+	notes := &recordingNotifier{}
+	svc := app.NewPortfolioService(storage.NewMemoryPortfolioStore(), highPricer{prices, map[string]float64{"NVDA": 120}}, app.WithNotifier(notes))
+	ctx := context.Background()
+	if _, err := svc.CreatePortfolio(ctx, "main", portfolio.NewDecimal(1000)); err != nil {
+		t.Fatal(err)
+	}
+
+	item, err := svc.Watch(ctx, app.GlobalWatchlists, "semis", "nvda")
+	if err != nil || item.AddedPrice != 100 || item.High52w != 120 {
+		t.Fatalf("item=%#v err=%v", item, err)
+	}
+	if _, err := svc.AddAlert(ctx, "main", portfolio.AlertRule{Kind: portfolio.AlertTargetPrice, Ticker: "NVDA", Threshold: 115}); err != nil {
+		t.Fatal(err)
+	}
+
+	prices["NVDA"] = 130
+	if err := svc.UpdateAllPrices(ctx, "main"); err != nil {
+		t.Fatal(err)
+	}
+	lists, err := svc.GetWatchlists(ctx, app.GlobalWatchlists, "")
+	if err != nil || len(lists) != 1 {
+		t.Fatalf("lists=%#v err=%v", lists, err)
+	}
+	got := lists[0].Items[0]
+	if got.Price != 130 || got.High52w != 130 || !approx(got.ChangeSinceAddedPct, 30) {
+		t.Fatalf("item=%#v", got)
+	}
+	if len(notes.events) != 1 || notes.events[0].State != portfolio.AlertTriggered || notes.events[0].Value != 130 {
+		t.Fatalf("events=%#v", notes.events)
+	}
+
+	if err := svc.Unwatch(ctx, app.GlobalWatchlists, "semis", "AMD"); !errors.Is(err, portfolio.ErrInvalidWatchlist) {
+		t.Fatalf("err=%v want ErrInvalidWatchlist", err)
+	}
+}
+
+// cryptoPricer quotes only positions registered as crypto instruments.
+type cryptoPricer struct{ scriptedPricer }
+
+func (c cryptoPricer) UpdatePrice(ctx context.Context, p *portfolio.Position) error {
+	if !p.IsCrypto() {
+		return errors.New("not a crypto instrument")
+	}
+	return c.scriptedPricer.UpdatePrice(ctx, p)
+}
+
+func TestGlobalWatchlistsQuoteRegisteredInstruments(t *testing.T) {
+	prices := scriptedPricer{"BTCUSD": 60000}
+	svc := app.NewPortfolioService(storage.NewMemoryPortfolioStore(), cryptoPricer{prices})
+	ctx := context.Background()
+	if _, err := svc.CreatePortfolio(ctx, "main", portfolio.NewDecimal(1000)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.SetInstrument(ctx, "main", portfolio.Instrument{Ticker: "BTCUSD", AssetClass: portfolio.AssetCrypto}); err != nil {
+		t.Fatal(err)
+	}
+
+	item, err := svc.Watch(ctx, app.GlobalWatchlists, "coins", "btcusd")
+	if err != nil || item.AddedPrice != 60000 {
+		t.Fatalf("item=%#v err=%v", item, err)
+	}
+	prices["BTCUSD"] = 66000
+	if err := svc.UpdateAllPrices(ctx, "main"); err != nil {
+		t.Fatal(err)
+	}
+	lists, err := svc.GetWatchlists(ctx, app.GlobalWatchlists, "coins")
+	if err != nil || len(lists) != 1 || lists[0].Items[0].Price != 66000 {
+		t.Fatalf("lists=%#v err=%v", lists, err)
+	}
+}
+
+func TestGlobalWatchlistsAreNotAPortfolio(t *testing.T) {
+	store := storage.NewMemoryPortfolioStore()
+	ctx := context.Background()
+	svc := app.NewPortfolioService(store, scriptedPricer{"AMD": 150})
+	if _, err := svc.CreatePortfolio(ctx, "main", portfolio.NewDecimal(1000)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Watch(ctx, app.GlobalWatchlists, "semis", "amd"); err != nil {
+		t.Fatal(err)
+	}
+	lists, err := store.LoadWatchlists(ctx)
+	if err != nil || len(lists) != 1 || len(lists[0].Items) != 1 || lists[0].Items[0].AddedPrice != 150 {
+		t.Fatalf("lists=%#v err=%v", lists, err)
+	}
+	names, err := svc.ListPortfolios(ctx)
+	if err != nil || len(names) != 1 || names[0] != "main" {
+		t.Fatalf("names=%v err=%v", names, err)
+	}
+
+	// Portfolio operations never reach the global lists.
+	if _, err := svc.GetMetrics(ctx, app.GlobalWatchlists); err == nil {
+		t.Fatal("metrics of the global watchlists should fail")
+	}
+	if err := svc.UpdateAllPrices(ctx, app.GlobalWatchlists); err == nil {
+		t.Fatal("refreshing the global watchlists as a portfolio should fail")
+	}
+}
@@ -11,3 +11,65 @@ func RequiredRecoveryPct(lossPct float64) float64 {
 	}
 	return (lossPct / (100 - lossPct)) * 100
 }
+
+// RequiredShortRecoveryPct is the price decline a short position needs to get
+// back to its best price after the price rose adversePct above it.
+func RequiredShortRecoveryPct(adversePct float64) float64 {
+	if adversePct <= 0 {
+		return 0
+	}
+	return adversePct / (100 + adversePct) * 100
+}
+
+// RecoveryYears is how long a gain of recoveryPct takes when compounding at
+// annualReturnPct a year. ok is false when the return never gets there.
+func RecoveryYears(recoveryPct, annualReturnPct float64) (years float64, ok bool) {
+	if recoveryPct <= 0 {
+		return 0, true
+	}
+	if annualReturnPct <= 0 || math.IsInf(recoveryPct, 1) {
+		return 0, false
+	}
+	return math.Log1p(recoveryPct/100) / math.Log1p(annualReturnPct/100), true
+}
+
+// RequiredAnnualReturnPct is the compounded annual return that gains
+// recoveryPct in the given number of years.
+func RequiredAnnualReturnPct(recoveryPct, years float64) float64 {
+	if recoveryPct <= 0 {
+		return 0
+	}
+	if years <= 0 || math.IsInf(recoveryPct, 1) {
+		return math.Inf(1)
+	}
+	return math.Expm1(math.Log1p(recoveryPct/100)/years) * 100
+}
+
+// RecoveryProbabilityPct is the chance that a gain of recoveryPct is reached
+// at any time within the given years by a price whose logarithm moves as a
+// Brownian motion: its median path compounds at annualReturnPct and its
+// annualized volatility is volatilityPct.
+func RecoveryProbabilityPct(recoveryPct, annualReturnPct, volatilityPct, years float64) float64 {
+	if recoveryPct <= 0 {
+		return 100
+	}
+	if years <= 0 || annualReturnPct <= -100 || math.IsInf(recoveryPct, 1) {
+		return 0
+	}
+	barrier := math.Log1p(recoveryPct / 100)
+	drift := math.Log1p(annualReturnPct / 100)
+	sigma := volatilityPct / 100
+	if sigma <= 0 {
+		if drift*years >= barrier {
+			return 100
+		}
+		return 0
+	}
+	spread := sigma * math.Sqrt(years)
+	p := NormCDF((drift*years - barrier) / spread)
+	// The reflected term can overflow on its own; combine it in log space.
+	if tail := NormCDF((-barrier - drift*years) / spread); tail > 0 {
+		p += math.Exp(2*drift*barrier/(sigma*sigma) + math.Log(tail))
+	}
+	return math.Min(math.Max(p, 0), 1) * 100
+}
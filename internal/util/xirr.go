@@ -0,0 +1,79 @@
+package util
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// XIRR returns the annualized internal rate of return, as a fraction, of cash
+// flows made on irregular dates. Negative amounts are money paid in.
+func XIRR(dates []time.Time, amounts []float64) (float64, error) {
+	if len(dates) != len(amounts) || len(dates) < 2 {
+		return 0, errors.New("xirr needs at least two dated cash flows")
+	}
+
+	hasNeg, hasPos := false, false
+	for _, a := range amounts {
+		hasNeg = hasNeg || a < 0
+		hasPos = hasPos || a > 0
+	}
+	if !hasNeg || !hasPos {
+		return 0, errors.New("xirr needs both inflows and outflows")
+	}
+
+	years := make([]float64, len(dates))
+	for i, d := range dates {
+		years[i] = d.Sub(dates[0]).Hours() / 24 / 365
+	}
+	npv := func(rate float64) float64 {
+		total := 0.0
+		for i, a := range amounts {
+			total += a / math.Pow(1+rate, years[i])
+		}
+		return total
+	}
+
+	rate := 0.1
+	for i := 0; i < 50; i++ {
+		f := npv(rate)
+		if math.Abs(f) < 1e-9 {
+			return rate, nil
+		}
+		df := 0.0
+		for j, a := range amounts {
+			df -= years[j] * a / math.Pow(1+rate, years[j]+1)
+		}
+		if df == 0 {
+			break
+		}
+		next := rate - f/df
+		if next <= -1 || math.IsNaN(next) || math.IsInf(next, 0) {
+			break
+		}
+		if math.Abs(next-rate) < 1e-12 {
+			return next, nil
+		}
+		rate = next
+	}
+
+	// Newton failed to converge; fall back to bisection on a wide bracket.
+	lo, hi := -0.9999, 100.0
+	flo, fhi := npv(lo), npv(hi)
+	if flo*fhi > 0 {
+		return 0, errors.New("xirr did not converge")
+	}
+	for i := 0; i < 200; i++ {
+		mid := (lo + hi) / 2
+		fm := npv(mid)
+		if math.Abs(fm) < 1e-9 {
+			return mid, nil
+		}
+		if flo*fm < 0 {
+			hi = mid
+		} else {
+			lo, flo = mid, fm
+		}
+	}
+	return (lo + hi) / 2, nil
+}